@@ -93,19 +93,8 @@ func marshalLifecycleToXML(rules []*s3.LifecycleRule) ([]byte, error) {
 	for _, r := range rules {
 		ruleStart := xml.StartElement{Name: xml.Name{Local: "Rule"}}
 		enc.EncodeToken(ruleStart)
-		// Add this in the loop over each rule
 		if r.Filter != nil {
-			enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Filter"}})
-
-			// Prefix
-			if r.Filter.Prefix != nil {
-				enc.EncodeElement(*r.Filter.Prefix, xml.StartElement{Name: xml.Name{Local: "Prefix"}})
-			} else {
-				// Always emit empty <Prefix> if nil
-				enc.EncodeElement("", xml.StartElement{Name: xml.Name{Local: "Prefix"}})
-			}
-
-			enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "Filter"}})
+			encodeLifecycleFilter(enc, r.Filter)
 		}
 
 		if r.ID != nil {
@@ -115,8 +104,40 @@ func marshalLifecycleToXML(rules []*s3.LifecycleRule) ([]byte, error) {
 			enc.EncodeElement(*r.Status, xml.StartElement{Name: xml.Name{Local: "Status"}})
 		}
 
-		if r.Expiration != nil && r.Expiration.Days != nil {
-			enc.EncodeElement(*r.Expiration.Days, xml.StartElement{Name: xml.Name{Local: "Expiration"}})
+		if e := r.Expiration; e != nil {
+			enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Expiration"}})
+			if e.Days != nil {
+				enc.EncodeElement(*e.Days, xml.StartElement{Name: xml.Name{Local: "Days"}})
+			}
+			if e.Date != nil {
+				enc.EncodeElement(e.Date.UTC().Format(time.RFC3339), xml.StartElement{Name: xml.Name{Local: "Date"}})
+			}
+			if e.ExpiredObjectDeleteMarker != nil {
+				enc.EncodeElement(*e.ExpiredObjectDeleteMarker, xml.StartElement{Name: xml.Name{Local: "ExpiredObjectDeleteMarker"}})
+			}
+			enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "Expiration"}})
+		}
+
+		if e := r.NoncurrentVersionExpiration; e != nil {
+			enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "NoncurrentVersionExpiration"}})
+			if e.NoncurrentDays != nil {
+				enc.EncodeElement(*e.NoncurrentDays, xml.StartElement{Name: xml.Name{Local: "NoncurrentDays"}})
+			}
+			if e.NewerNoncurrentVersions != nil {
+				enc.EncodeElement(*e.NewerNoncurrentVersions, xml.StartElement{Name: xml.Name{Local: "NewerNoncurrentVersions"}})
+			}
+			enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "NoncurrentVersionExpiration"}})
+		}
+
+		for _, t := range r.NoncurrentVersionTransitions {
+			enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "NoncurrentVersionTransition"}})
+			if t.NoncurrentDays != nil {
+				enc.EncodeElement(*t.NoncurrentDays, xml.StartElement{Name: xml.Name{Local: "NoncurrentDays"}})
+			}
+			if t.StorageClass != nil {
+				enc.EncodeElement(*t.StorageClass, xml.StartElement{Name: xml.Name{Local: "StorageClass"}})
+			}
+			enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "NoncurrentVersionTransition"}})
 		}
 
 		for _, t := range r.Transitions {
@@ -147,6 +168,46 @@ func marshalLifecycleToXML(rules []*s3.LifecycleRule) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// encodeLifecycleFilter writes a rule's Filter: a prefix, a single tag, a
+// size bound, or an And of several of them.
+func encodeLifecycleFilter(enc *xml.Encoder, f *s3.LifecycleRuleFilter) {
+	enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Filter"}})
+	switch {
+	case f.And != nil:
+		enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "And"}})
+		if f.And.Prefix != nil {
+			enc.EncodeElement(*f.And.Prefix, xml.StartElement{Name: xml.Name{Local: "Prefix"}})
+		}
+		for _, tag := range f.And.Tags {
+			encodeLifecycleTag(enc, tag)
+		}
+		if f.And.ObjectSizeGreaterThan != nil {
+			enc.EncodeElement(*f.And.ObjectSizeGreaterThan, xml.StartElement{Name: xml.Name{Local: "ObjectSizeGreaterThan"}})
+		}
+		if f.And.ObjectSizeLessThan != nil {
+			enc.EncodeElement(*f.And.ObjectSizeLessThan, xml.StartElement{Name: xml.Name{Local: "ObjectSizeLessThan"}})
+		}
+		enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "And"}})
+	case f.Tag != nil:
+		encodeLifecycleTag(enc, f.Tag)
+	case f.ObjectSizeGreaterThan != nil:
+		enc.EncodeElement(*f.ObjectSizeGreaterThan, xml.StartElement{Name: xml.Name{Local: "ObjectSizeGreaterThan"}})
+	case f.ObjectSizeLessThan != nil:
+		enc.EncodeElement(*f.ObjectSizeLessThan, xml.StartElement{Name: xml.Name{Local: "ObjectSizeLessThan"}})
+	default:
+		// Always emit <Prefix>, empty if nil
+		enc.EncodeElement(aws.StringValue(f.Prefix), xml.StartElement{Name: xml.Name{Local: "Prefix"}})
+	}
+	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "Filter"}})
+}
+
+func encodeLifecycleTag(enc *xml.Encoder, tag *s3.Tag) {
+	enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "Tag"}})
+	enc.EncodeElement(aws.StringValue(tag.Key), xml.StartElement{Name: xml.Name{Local: "Key"}})
+	enc.EncodeElement(aws.StringValue(tag.Value), xml.StartElement{Name: xml.Name{Local: "Value"}})
+	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "Tag"}})
+}
+
 func (s3c *S3ClientSession) PutLifecycleRules(rules []*s3.LifecycleRule) error {
 	return s3c.PutLifecycleRulesCustomHeaders(rules, map[string]string{})
 }
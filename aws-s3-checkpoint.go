@@ -0,0 +1,234 @@
+package alfredo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// MigrationCheckpoint records how far a MigrationLoop run has progressed so a
+// restarted process can resume listing from the last fully processed page
+// instead of re-listing and re-HEADing the whole source bucket.
+//
+// Pages are committed strictly in listing order: the continuation token only
+// advances once every object of a page (and of every page before it) has
+// produced a result, so objects still in flight are never skipped on resume.
+type MigrationCheckpoint struct {
+	SourceBucket      string            `json:"sourceBucket"`
+	TargetBucket      string            `json:"targetBucket"`
+	ContinuationToken *string           `json:"continuationToken,omitempty"`
+	PagesCompleted    int64             `json:"pagesCompleted"`
+	TotalObjects      int64             `json:"totalObjects"`
+	MigratedObjects   int64             `json:"migratedObjects"`
+	SkippedObjects    int64             `json:"skippedObjects"`
+	TotalBytes        int64             `json:"totalBytes"`
+	CompletedBytes    int64             `json:"completedBytes"`
+	FilteredObjects   int64             `json:"filteredObjects"`
+	FilteredBytes     int64             `json:"filteredBytes"`
+	FailedKeys        map[string]string `json:"failedKeys"`
+	Complete          bool              `json:"complete"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
+
+	path    string
+	pending []*checkpointPage
+	mu      sync.Mutex
+}
+
+// checkpointPage tallies the results of one listed page until all of its
+// objects have finished.
+type checkpointPage struct {
+	nextToken      *string
+	last           bool
+	remaining      int64
+	objects        int64
+	migrated       int64
+	skipped        int64
+	bytes          int64
+	completedBytes int64
+	filtered       int64
+	filteredBytes  int64
+	failed         map[string]string
+}
+
+func NewMigrationCheckpoint(path string) *MigrationCheckpoint {
+	return &MigrationCheckpoint{
+		path:       path,
+		FailedKeys: make(map[string]string),
+	}
+}
+
+// LoadMigrationCheckpoint reads the checkpoint stored at path; a missing file
+// yields an empty checkpoint so the same call serves both a first run and a
+// restart.
+func LoadMigrationCheckpoint(path string) (*MigrationCheckpoint, error) {
+	cp := NewMigrationCheckpoint(path)
+	if !FileExistsEasy(path) {
+		return cp, nil
+	}
+	if err := ReadStructFromJSONFile(path, cp); err != nil {
+		return nil, fmt.Errorf("failed to read migration checkpoint %s: %v", path, err)
+	}
+	if cp.FailedKeys == nil {
+		cp.FailedKeys = make(map[string]string)
+	}
+	return cp, nil
+}
+
+func (cp *MigrationCheckpoint) GetPath() string {
+	return cp.path
+}
+
+func (cp *MigrationCheckpoint) IsComplete() bool {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.Complete
+}
+
+// Save writes the checkpoint to a temporary file and renames it into place so
+// a crash mid-write never leaves a truncated checkpoint behind.
+func (cp *MigrationCheckpoint) Save() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.save()
+}
+
+func (cp *MigrationCheckpoint) save() error {
+	if len(cp.path) == 0 {
+		return errors.New("migration checkpoint has no path")
+	}
+	cp.UpdatedAt = time.Now()
+	tmp := cp.path + ".tmp"
+	if err := WriteStructToJSONFile(tmp, cp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
+
+// checkBuckets refuses to resume a checkpoint that was written for a different
+// source/target pair, and claims an empty checkpoint for this pair.
+func (cp *MigrationCheckpoint) checkBuckets(source, target string) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if len(cp.SourceBucket) == 0 && len(cp.TargetBucket) == 0 {
+		cp.SourceBucket = source
+		cp.TargetBucket = target
+		return nil
+	}
+	if cp.SourceBucket != source || cp.TargetBucket != target {
+		return fmt.Errorf("migration checkpoint %s is for s3://%s => s3://%s, not s3://%s => s3://%s",
+			cp.path, cp.SourceBucket, cp.TargetBucket, source, target)
+	}
+	return nil
+}
+
+// seed restores the counters and failed keys of a resumed run into progress.
+func (cp *MigrationCheckpoint) seed(progress *ProgressTracker) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	progress.Lock()
+	defer progress.Unlock()
+	progress.TotalObjects = cp.TotalObjects
+	progress.MigratedObjects = cp.MigratedObjects
+	progress.SkippedObjects = cp.SkippedObjects
+	progress.TotalBytes = cp.TotalBytes
+	progress.CompletedBytes = cp.CompletedBytes
+	progress.FilteredObjects = cp.FilteredObjects
+	progress.FilteredBytes = cp.FilteredBytes
+	if progress.FailedObjects == nil {
+		progress.FailedObjects = make(map[string]error)
+	}
+	for key, msg := range cp.FailedKeys {
+		progress.FailedObjects[key] = errors.New(msg)
+	}
+}
+
+// beginPage registers a freshly listed page holding count objects; nextToken
+// is where listing continues once the page is done (nil on the last page).
+func (cp *MigrationCheckpoint) beginPage(nextToken *string, last bool, count int) *checkpointPage {
+	if cp == nil {
+		return nil
+	}
+	page := &checkpointPage{
+		nextToken: nextToken,
+		last:      last,
+		remaining: int64(count),
+		failed:    make(map[string]string),
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.pending = append(cp.pending, page)
+	cp.commit()
+	return page
+}
+
+// record accounts for the result of one object of page and commits every
+// leading page that has now finished.
+func (cp *MigrationCheckpoint) record(page *checkpointPage, result CopyResult) {
+	if cp == nil || page == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	page.objects++
+	page.bytes += result.BytesCopied
+	switch {
+	case result.Success && result.WasSkipped:
+		page.skipped++
+		page.completedBytes += result.BytesCopied
+	case result.Success:
+		page.migrated++
+		page.completedBytes += result.BytesCopied
+	case result.Error != nil:
+		page.failed[result.SourceKey] = result.Error.Error()
+	default:
+		page.failed[result.SourceKey] = "unknown error"
+	}
+	page.remaining--
+	cp.commit()
+}
+
+// recordFiltered accounts for an object of page excluded by the filter.
+func (cp *MigrationCheckpoint) recordFiltered(page *checkpointPage, size int64) {
+	if cp == nil || page == nil {
+		return
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	page.filtered++
+	page.filteredBytes += size
+	page.remaining--
+	cp.commit()
+}
+
+// commit folds finished pages into the checkpoint in listing order and
+// persists it; the caller holds cp.mu.
+func (cp *MigrationCheckpoint) commit() {
+	committed := false
+	for len(cp.pending) > 0 && cp.pending[0].remaining <= 0 {
+		page := cp.pending[0]
+		cp.pending = cp.pending[1:]
+		cp.TotalObjects += page.objects
+		cp.MigratedObjects += page.migrated
+		cp.SkippedObjects += page.skipped
+		cp.TotalBytes += page.bytes
+		cp.CompletedBytes += page.completedBytes
+		cp.FilteredObjects += page.filtered
+		cp.FilteredBytes += page.filteredBytes
+		for key, msg := range page.failed {
+			cp.FailedKeys[key] = msg
+		}
+		cp.ContinuationToken = page.nextToken
+		cp.Complete = page.last
+		cp.PagesCompleted++
+		committed = true
+	}
+	if !committed || len(cp.path) == 0 {
+		return
+	}
+	if err := cp.save(); err != nil {
+		log.Printf("WARNING: failed to save migration checkpoint %s: %v", cp.path, err)
+	}
+}
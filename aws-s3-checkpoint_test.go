@@ -0,0 +1,131 @@
+package alfredo
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMigrationCheckpointCommitsInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cp := NewMigrationCheckpoint(path)
+
+	page1 := cp.beginPage(aws.String("t1"), false, 2)
+	page2 := cp.beginPage(aws.String("t2"), false, 1)
+
+	// a later page finishing first must not move the token past page1
+	cp.record(page2, CopyResult{SourceKey: "c", Success: true, BytesCopied: 5})
+	assert.Nil(t, cp.ContinuationToken)
+	assert.False(t, FileExistsEasy(path))
+
+	cp.record(page1, CopyResult{SourceKey: "a", Success: true, BytesCopied: 10})
+	cp.record(page1, CopyResult{SourceKey: "b", Error: errors.New("AccessDenied"), BytesCopied: 20})
+
+	assert.Equal(t, "t2", aws.StringValue(cp.ContinuationToken))
+	assert.Equal(t, int64(2), cp.PagesCompleted)
+	assert.Equal(t, int64(3), cp.TotalObjects)
+	assert.Equal(t, int64(2), cp.MigratedObjects)
+	assert.Equal(t, int64(35), cp.TotalBytes)
+	assert.Equal(t, int64(15), cp.CompletedBytes)
+	assert.Equal(t, map[string]string{"b": "AccessDenied"}, cp.FailedKeys)
+
+	loaded, err := LoadMigrationCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "t2", aws.StringValue(loaded.ContinuationToken))
+	assert.Equal(t, int64(3), loaded.TotalObjects)
+	assert.Equal(t, cp.FailedKeys, loaded.FailedKeys)
+	assert.False(t, loaded.Complete)
+	assert.False(t, FileExistsEasy(path+".tmp"))
+}
+
+func TestMigrationCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cp := NewMigrationCheckpoint(path)
+	cp.SourceBucket = "source-bucket"
+	cp.TargetBucket = "target-bucket"
+	cp.ContinuationToken = aws.String("t7")
+	cp.PagesCompleted = 7
+	cp.TotalObjects = 7000
+	cp.MigratedObjects = 6999
+	cp.FailedKeys["broken"] = "NoSuchKey"
+	assert.NoError(t, cp.Save())
+
+	loaded, err := LoadMigrationCheckpoint(path)
+	assert.NoError(t, err)
+
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	srcS3c := &S3ClientSession{Bucket: "source-bucket"}
+	tgtS3c := &S3ClientSession{Bucket: "target-bucket"}
+	progress := &ProgressTracker{}
+	NewMigrationManager(srcS3c, tgtS3c, progress, logger, logger, 100).WithCheckpoint(loaded)
+
+	assert.Equal(t, "t7", aws.StringValue(srcS3c.ContinuationToken))
+	assert.Equal(t, int64(7000), progress.TotalObjects)
+	assert.Equal(t, int64(6999), progress.MigratedObjects)
+	assert.EqualError(t, progress.FailedObjects["broken"], "NoSuchKey")
+
+	// a checkpoint for another bucket pair is refused
+	other := NewMigrationManager(&S3ClientSession{Bucket: "elsewhere"}, &S3ClientSession{Bucket: "target-bucket"},
+		&ProgressTracker{}, logger, logger, 100).WithCheckpoint(loaded)
+	var wg sync.WaitGroup
+	results := make(chan CopyResult, 1)
+	assert.Error(t, other.MigrationLoop(&wg, &results))
+}
+
+func TestMigrationLoopSavesCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+
+	mockSourceS3 := new(MockS3Client)
+	mockSourceS3.On("ListObjectsV2WithContext", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		ContinuationToken:     aws.String("t1"),
+		NextContinuationToken: aws.String("t2"),
+		IsTruncated:           aws.Bool(true),
+	}, nil).Once()
+	mockSourceS3.On("ListObjectsV2WithContext", mock.Anything, mock.Anything).Return(&s3.ListObjectsV2Output{
+		ContinuationToken: aws.String("t2"),
+		IsTruncated:       aws.Bool(false),
+	}, nil).Once()
+
+	cp := NewMigrationCheckpoint(path)
+	cp.ContinuationToken = aws.String("t1")
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket"}
+	tgtS3c := &S3ClientSession{Bucket: "target-bucket"}
+	mgr := NewMigrationManager(srcS3c, tgtS3c, &ProgressTracker{}, logger, logger, 100).WithCheckpoint(cp)
+
+	var wg sync.WaitGroup
+	results := make(chan CopyResult, 1)
+	assert.NoError(t, mgr.MigrationLoop(&wg, &results))
+	assert.False(t, mgr.IsDone())
+
+	loaded, err := LoadMigrationCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "t2", aws.StringValue(loaded.ContinuationToken))
+	assert.Equal(t, "source-bucket", loaded.SourceBucket)
+	assert.Equal(t, "target-bucket", loaded.TargetBucket)
+
+	assert.NoError(t, mgr.MigrationLoop(&wg, &results))
+	assert.True(t, mgr.IsDone())
+	wg.Wait()
+
+	loaded, err = LoadMigrationCheckpoint(path)
+	assert.NoError(t, err)
+	assert.True(t, loaded.Complete)
+	assert.Nil(t, loaded.ContinuationToken)
+	assert.Equal(t, int64(2), loaded.PagesCompleted)
+
+	// a finished checkpoint makes a restarted loop a no-op instead of re-listing
+	restarted := NewMigrationManager(&S3ClientSession{Client: new(MockS3Client), Bucket: "source-bucket"}, &S3ClientSession{Bucket: "target-bucket"},
+		&ProgressTracker{}, logger, logger, 100).WithCheckpoint(loaded)
+	assert.NoError(t, restarted.MigrationLoop(&wg, &results))
+	assert.True(t, restarted.IsDone())
+	mockSourceS3.AssertExpectations(t)
+}
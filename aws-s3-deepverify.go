@@ -0,0 +1,236 @@
+package alfredo
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// DeepVerifyMode selects how verification compares the content of objects
+// whose sizes already match.
+type DeepVerifyMode string
+
+const (
+	DeepVerifyNone DeepVerifyMode = ""
+	// DeepVerifyETag reads only the source and recomputes the ETag the target
+	// should have, as a plain or multipart MD5 depending on how the target was
+	// written. Only when the ETags still differ are both objects read and
+	// their SHA-256 compared, since the ETag of an object encrypted with
+	// SSE-KMS or SSE-C is not an MD5 of its content.
+	DeepVerifyETag DeepVerifyMode = "etag"
+	// DeepVerifySHA256 reads both objects and compares their SHA-256.
+	DeepVerifySHA256 DeepVerifyMode = "sha256"
+)
+
+// etagParts returns the part count of a multipart ETag, or 0 for the plain
+// MD5 of a single-part upload.
+func etagParts(etag string) int64 {
+	i := strings.LastIndex(etag, "-")
+	if i < 0 {
+		return 0
+	}
+	parts, err := strconv.ParseInt(strings.Trim(etag[i+1:], `"`), 10, 64)
+	if err != nil || parts < 1 {
+		return 0
+	}
+	return parts
+}
+
+// partsFor is the number of parts an object of size bytes is cut into.
+func partsFor(size, partSize int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + partSize - 1) / partSize
+}
+
+// multipartPartSizes lists the part sizes that could have produced a
+// multipart upload of size bytes in parts parts: hint first, then the layout
+// the migration uses, then common client defaults.
+func multipartPartSizes(size, parts, hint int64) []int64 {
+	const mib = 1024 * 1024
+	migration := ((size+parts-1)/parts + mib - 1) / mib * mib
+	var sizes []int64
+	for _, partSize := range []int64{hint, migration, CalculatePartSize(size), defaultPartSizeMin, 8 * mib, 16 * mib, 64 * mib} {
+		if partSize <= 0 || partsFor(size, partSize) != parts {
+			continue
+		}
+		duplicate := false
+		for _, s := range sizes {
+			duplicate = duplicate || s == partSize
+		}
+		if !duplicate {
+			sizes = append(sizes, partSize)
+		}
+	}
+	return sizes
+}
+
+// etagWriter computes an S3 ETag over what is written to it: a plain MD5 when
+// partSize is 0, otherwise the MD5 of the concatenated part MD5s followed by
+// the part count.
+type etagWriter struct {
+	partSize int64
+	inPart   int64
+	part     hash.Hash
+	digests  []byte
+	parts    int64
+}
+
+func newETagWriter(partSize int64) *etagWriter {
+	return &etagWriter{partSize: partSize, part: md5.New()}
+}
+
+func (w *etagWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if w.partSize > 0 && int64(len(chunk)) > w.partSize-w.inPart {
+			chunk = p[:w.partSize-w.inPart]
+		}
+		w.part.Write(chunk)
+		w.inPart += int64(len(chunk))
+		p = p[len(chunk):]
+		if w.partSize > 0 && w.inPart == w.partSize {
+			w.endPart()
+		}
+	}
+	return n, nil
+}
+
+func (w *etagWriter) endPart() {
+	w.digests = w.part.Sum(w.digests)
+	w.parts++
+	w.part.Reset()
+	w.inPart = 0
+}
+
+func (w *etagWriter) ETag() string {
+	if w.partSize == 0 {
+		return hex.EncodeToString(w.part.Sum(nil))
+	}
+	if w.inPart > 0 || w.parts == 0 {
+		w.endPart()
+	}
+	sum := md5.Sum(w.digests)
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:]), w.parts)
+}
+
+// MultipartETag computes the ETag S3 gives the content of r when it is
+// uploaded in parts of partSize bytes; a partSize of 0 gives the ETag of a
+// single-part upload.
+func MultipartETag(r io.Reader, partSize int64) (string, error) {
+	w := newETagWriter(partSize)
+	if _, err := io.Copy(w, r); err != nil {
+		return "", err
+	}
+	return w.ETag(), nil
+}
+
+// inSample reports whether key falls within the given percentage of keys.
+// The choice depends only on the key, so repeated runs check the same objects.
+func inSample(key string, percent float64) bool {
+	if percent <= 0 || percent >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return float64(h.Sum32()%10000) < percent*100
+}
+
+// readObject streams the object at key into w.
+func (s3c *S3ClientSession) readObject(key string, w io.Writer) error {
+	output, err := s3c.Client.GetObject(s3c.encryptGet(&s3.GetObjectInput{Bucket: aws.String(s3c.Bucket), Key: aws.String(key)}))
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+	_, err = io.Copy(w, output.Body)
+	return err
+}
+
+func (s3c *S3ClientSession) objectSHA256(key string) (string, error) {
+	h := sha256.New()
+	if err := s3c.readObject(key, h); err != nil {
+		return "", fmt.Errorf("failed to read s3://%s/%s: %v", s3c.Bucket, key, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contentMismatch compares the content of a source object and its target copy
+// of the same size. It returns the checksums that differ, or empty strings
+// when the content matches. Differing ETags are confirmed with SHA-256, as
+// the ETags of objects encrypted with SSE-KMS or SSE-C are not MD5s of the
+// content.
+func contentMismatch(srcs3c, tgts3c *S3ClientSession, src, dst *s3.Object, opts VerifyOptions) (srcSum, tgtSum string, err error) {
+	srcKey, tgtKey := aws.StringValue(src.Key), aws.StringValue(dst.Key)
+	if opts.DeepVerify == DeepVerifyETag {
+		srcETag, tgtETag := strings.Trim(aws.StringValue(src.ETag), `"`), strings.Trim(aws.StringValue(dst.ETag), `"`)
+		srcParts, tgtParts := etagParts(srcETag), etagParts(tgtETag)
+		switch {
+		case len(srcETag) == 0 || len(tgtETag) == 0:
+			// nothing to recompute; fall through to SHA-256
+		case srcETag == tgtETag:
+			return "", "", nil
+		case srcParts == 0 && tgtParts == 0:
+			// nothing to recompute either
+		case tgtParts == 0:
+			etags, err := sourceETags(srcs3c, srcKey, []int64{0})
+			if err != nil || etags[0] == tgtETag {
+				return "", "", err
+			}
+		default:
+			partSizes := multipartPartSizes(aws.Int64Value(src.Size), tgtParts, opts.PartSize)
+			if len(partSizes) == 0 {
+				break
+			}
+			etags, err := sourceETags(srcs3c, srcKey, partSizes)
+			if err != nil {
+				return "", "", err
+			}
+			for _, etag := range etags {
+				if etag == tgtETag {
+					return "", "", nil
+				}
+			}
+		}
+		VerbosePrintf("ETags of %s do not match; comparing SHA-256", tgtKey)
+	}
+
+	srcSum, err = srcs3c.objectSHA256(srcKey)
+	if err != nil {
+		return "", "", err
+	}
+	tgtSum, err = tgts3c.objectSHA256(tgtKey)
+	if err != nil || srcSum == tgtSum {
+		return "", "", err
+	}
+	return srcSum, tgtSum, nil
+}
+
+// sourceETag reads the object once and returns its ETag for each part size.
+func sourceETags(s3c *S3ClientSession, key string, partSizes []int64) ([]string, error) {
+	writers := make([]io.Writer, len(partSizes))
+	etagWriters := make([]*etagWriter, len(partSizes))
+	for i, partSize := range partSizes {
+		etagWriters[i] = newETagWriter(partSize)
+		writers[i] = etagWriters[i]
+	}
+	if err := s3c.readObject(key, io.MultiWriter(writers...)); err != nil {
+		return nil, fmt.Errorf("failed to read s3://%s/%s: %v", s3c.Bucket, key, err)
+	}
+	etags := make([]string, len(partSizes))
+	for i, w := range etagWriters {
+		etags[i] = w.ETag()
+	}
+	return etags, nil
+}
@@ -0,0 +1,145 @@
+package alfredo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockS3Client) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	// a function gives every call a fresh body
+	if fn, ok := args.Get(0).(func(*s3.GetObjectInput) *s3.GetObjectOutput); ok {
+		return fn(input), args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
+}
+
+func TestMultipartETag(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	p1, p2, p3 := md5.Sum(data[:100]), md5.Sum(data[100:200]), md5.Sum(data[200:])
+	want := md5.Sum(append(append(p1[:], p2[:]...), p3[:]...))
+
+	etag, err := MultipartETag(bytes.NewReader(data), 100)
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(want[:])+"-3", etag)
+
+	etag, err = MultipartETag(bytes.NewReader(data), 0)
+	assert.NoError(t, err)
+	whole := md5.Sum(data)
+	assert.Equal(t, hex.EncodeToString(whole[:]), etag)
+
+	assert.Equal(t, int64(3), etagParts(`"`+etag+`-3"`))
+	assert.Equal(t, int64(0), etagParts(etag))
+}
+
+func TestMultipartPartSizes(t *testing.T) {
+	const mib = 1024 * 1024
+	sizes := multipartPartSizes(20*mib, 3, 0)
+	assert.Equal(t, []int64{7 * mib, 8 * mib}, sizes)
+	assert.Equal(t, int64(9*mib), multipartPartSizes(20*mib, 3, 9*mib)[0])
+	assert.Empty(t, multipartPartSizes(20*mib, 50, 0))
+}
+
+func TestInSample(t *testing.T) {
+	n := 0
+	for i := 0; i < 10000; i++ {
+		if inSample(fmt.Sprintf("dir/object-%d", i), 10) {
+			n++
+		}
+	}
+	assert.InDelta(t, 1000, n, 150)
+	assert.True(t, inSample("any", 0))
+	assert.Equal(t, inSample("dir/object-1", 50), inSample("dir/object-1", 50))
+}
+
+func TestVerificationFlagsContentMismatch(t *testing.T) {
+	const mib = 1024 * 1024
+	good := bytes.Repeat([]byte("a"), 6*mib)
+	bad := append(bytes.Repeat([]byte("a"), 6*mib-1), 'b')
+	goodMD5 := md5.Sum(good)
+	copyETag, _ := MultipartETag(bytes.NewReader(good), 5*mib)
+
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	size := int64(len(good))
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("good"), Size: &size, ETag: aws.String(`"` + hex.EncodeToString(goodMD5[:]) + `"`)},
+		{Key: str("torn"), Size: &size, ETag: aws.String(`"` + hex.EncodeToString(goodMD5[:]) + `"`)},
+	}}, nil)
+	// both copies were written in 5 MiB parts; the torn one has a corrupt last byte
+	tornETag, _ := MultipartETag(bytes.NewReader(bad), 5*mib)
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("good"), Size: &size, ETag: aws.String(`"` + copyETag + `"`)},
+		{Key: str("torn"), Size: &size, ETag: aws.String(`"` + tornETag + `"`)},
+	}}, nil)
+	mockSourceS3.On("GetObject", mock.Anything).Return(func(*s3.GetObjectInput) *s3.GetObjectOutput {
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(good))}
+	}, nil)
+	mockTargetS3.On("GetObject", mock.MatchedBy(func(in *s3.GetObjectInput) bool { return *in.Key == "torn" })).Return(func(*s3.GetObjectInput) *s3.GetObjectOutput {
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(bad))}
+	}, nil)
+	mockTargetS3.On("GetObject", mock.Anything).Return(func(*s3.GetObjectInput) *s3.GetObjectOutput {
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(good))}
+	}, nil)
+
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+
+	for _, mode := range []DeepVerifyMode{DeepVerifyETag, DeepVerifySHA256} {
+		var buf bytes.Buffer
+		assert.NoError(t, RunVerificationWithOptions(srcS3c, tgtS3c, VerifyOptions{DeepVerify: mode}, &buf))
+		var d Diff
+		dec := json.NewDecoder(&buf)
+		assert.NoError(t, dec.Decode(&d), mode)
+		assert.Equal(t, ContentMismatch, d.Type)
+		assert.Equal(t, "torn", d.Key)
+		assert.NotEqual(t, d.SourceSum, d.TargetSum)
+		assert.False(t, dec.More(), mode)
+	}
+	// the etag pass only reads the torn target, to confirm the mismatch
+	mockTargetS3.AssertNumberOfCalls(t, "GetObject", 3)
+
+	// a tiny sample leaves the torn object out
+	var buf bytes.Buffer
+	assert.NoError(t, RunVerificationWithOptions(srcS3c, tgtS3c, VerifyOptions{DeepVerify: DeepVerifyETag, SamplePercent: 0.01}, &buf))
+	assert.Empty(t, buf.String())
+}
+
+func TestETagMismatchConfirmedBySHA256(t *testing.T) {
+	data := []byte("same content, encrypted differently")
+	size := int64(len(data))
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	// single-part ETags of SSE-KMS objects are not MD5s, so they differ
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("k"), Size: &size, ETag: aws.String(`"11111111111111111111111111111111"`)},
+	}}, nil)
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("k"), Size: &size, ETag: aws.String(`"22222222222222222222222222222222"`)},
+	}}, nil)
+	for _, m := range []*MockS3Client{mockSourceS3, mockTargetS3} {
+		m.On("GetObject", mock.Anything).Return(func(*s3.GetObjectInput) *s3.GetObjectOutput {
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}
+		}, nil)
+	}
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+
+	var buf bytes.Buffer
+	assert.NoError(t, RunVerificationWithOptions(srcS3c, tgtS3c, VerifyOptions{DeepVerify: DeepVerifyETag}, &buf))
+	assert.Empty(t, buf.String())
+	mockTargetS3.AssertNumberOfCalls(t, "GetObject", 1)
+}
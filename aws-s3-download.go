@@ -0,0 +1,272 @@
+package alfredo
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// SyncOptions control S3SyncBucketToDirectory and
+// S3SyncDirectoryToBucketWithOptions.
+type SyncOptions struct {
+	Prefix string // only sync keys under Prefix, stored relative to it
+	Delete bool   // remove what the other side no longer has
+	DryRun bool   // only print what would be transferred or deleted
+	// Checksum compares content with the object's ETag instead of trusting
+	// size and modification time
+	Checksum bool
+}
+
+// fileETags returns the ETag the file at path would get for each part size,
+// reading it once (see MultipartETag).
+func fileETags(path string, partSizes []int64) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	writers := make([]io.Writer, len(partSizes))
+	etagWriters := make([]*etagWriter, len(partSizes))
+	for i, partSize := range partSizes {
+		etagWriters[i] = newETagWriter(partSize)
+		writers[i] = etagWriters[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, err
+	}
+	etags := make([]string, len(partSizes))
+	for i, w := range etagWriters {
+		etags[i] = w.ETag()
+	}
+	return etags, nil
+}
+
+// fileMatchesETag reports whether the content of the file at path has the
+// given ETag, trying the part sizes that could have produced a multipart one.
+func fileMatchesETag(path string, size int64, etag string) (bool, error) {
+	etag = strings.Trim(etag, `"`)
+	partSizes := []int64{0}
+	if parts := etagParts(etag); parts > 0 {
+		partSizes = multipartPartSizes(size, parts, 0)
+		if len(partSizes) == 0 {
+			return false, nil
+		}
+	}
+	etags, err := fileETags(path, partSizes)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range etags {
+		if e == etag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// localPathForKey maps a key to a path under dirPath, refusing keys that would
+// escape it.
+func localPathForKey(dirPath, rel string) (string, error) {
+	path := filepath.Join(dirPath, filepath.FromSlash(rel))
+	if path != filepath.Clean(dirPath) && !strings.HasPrefix(path, filepath.Clean(dirPath)+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %q is outside of %s", rel, dirPath)
+	}
+	return path, nil
+}
+
+// localCopyCurrent reports whether the file at path already holds obj: same
+// size and either the same modification time or, with checksum, the same
+// ETag.
+func localCopyCurrent(path string, obj *s3.Object, checksum bool) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || info.Size() != aws.Int64Value(obj.Size) {
+		return false, nil
+	}
+	if checksum {
+		return fileMatchesETag(path, info.Size(), aws.StringValue(obj.ETag))
+	}
+	return info.ModTime().Truncate(time.Second).Equal(aws.TimeValue(obj.LastModified).Truncate(time.Second)), nil
+}
+
+// downloadToFile downloads key into path through a temporary file in the same
+// directory, so path only ever holds a complete object. The file's
+// modification time is set to lastModified for later syncs.
+func (s3c *S3ClientSession) downloadToFile(downloader *s3manager.Downloader, key, path string, lastModified time.Time) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // a no-op after the rename
+
+	var n int64
+	err = s3c.retry(func() error {
+		if err := tmp.Truncate(0); err != nil {
+			return err
+		}
+		var err error
+		n, err = downloader.DownloadWithContext(s3c.ctx, tmp, s3c.encryptGet(&s3.GetObjectInput{
+			Bucket: aws.String(s3c.Bucket),
+			Key:    aws.String(key),
+		}))
+		return err
+	})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !lastModified.IsZero() {
+		if err := os.Chtimes(tmpName, lastModified, lastModified); err != nil {
+			return 0, err
+		}
+	}
+	return n, os.Rename(tmpName, path)
+}
+
+// S3SyncBucketToDirectory downloads the objects under opts.Prefix into
+// dirPath, up to GetConcurrency() at a time. Files that already match their
+// object are skipped, and with opts.Delete, files that have no object are
+// removed. Failed downloads are recorded in progress.FailedObjects and do not
+// stop the others.
+func (s3c S3ClientSession) S3SyncBucketToDirectory(dirPath string, opts SyncOptions, progress *ProgressTracker) error {
+	if err := s3c.EstablishSession(); err != nil {
+		return fmt.Errorf("error establishing session for bucket %s: %v", s3c.Bucket, err)
+	}
+	if s3c.ctx == nil {
+		s3c.ctx = aws.BackgroundContext()
+	}
+	if progress.FailedObjects == nil {
+		progress.FailedObjects = make(map[string]error)
+	}
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dirPath, err)
+	}
+	downloader := s3manager.NewDownloaderWithClient(s3c.Client)
+
+	type download struct {
+		obj  *s3.Object
+		path string
+	}
+	downloads := make(chan download)
+	var failed int64
+	var wg sync.WaitGroup
+	for i := 0; i < s3c.GetConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range downloads {
+				key := aws.StringValue(d.obj.Key)
+				current, err := localCopyCurrent(d.path, d.obj, opts.Checksum)
+				if err == nil && current {
+					VerbosePrintf("Skipping s3://%s/%s, %s is up to date", s3c.Bucket, key, d.path)
+					atomic.AddInt64(&progress.SkippedObjects, 1)
+					atomic.AddInt64(&progress.CompletedBytes, aws.Int64Value(d.obj.Size))
+					continue
+				}
+				if err == nil && opts.DryRun {
+					fmt.Printf("(dry run) download s3://%s/%s -> %s\n", s3c.Bucket, key, d.path)
+					continue
+				}
+				if err == nil {
+					var n int64
+					n, err = s3c.downloadToFile(downloader, key, d.path, aws.TimeValue(d.obj.LastModified))
+					atomic.AddInt64(&progress.CompletedBytes, n)
+				}
+				if err != nil {
+					log.Printf("Failed to download s3://%s/%s to %s: %v", s3c.Bucket, key, d.path, err)
+					progress.Lock()
+					progress.FailedObjects[key] = err
+					progress.Unlock()
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				if s3c.logging {
+					log.Printf("Downloaded s3://%s/%s to %s", s3c.Bucket, key, d.path)
+				}
+				atomic.AddInt64(&progress.MigratedObjects, 1)
+			}
+		}()
+	}
+
+	listed := make(map[string]bool)
+	it := NewS3Iter(&s3c, &s3.ListObjectsV2Input{Bucket: aws.String(s3c.Bucket), Prefix: aws.String(opts.Prefix)})
+	var listErr error
+	for {
+		obj, err := it.Next()
+		if err != nil {
+			listErr = fmt.Errorf("failed to list bucket %s: %v", s3c.Bucket, err)
+			break
+		}
+		if obj == nil {
+			break
+		}
+		rel := strings.TrimPrefix(aws.StringValue(obj.Key), opts.Prefix)
+		if len(rel) == 0 || strings.HasSuffix(rel, "/") {
+			continue // folder placeholder
+		}
+		path, err := localPathForKey(dirPath, rel)
+		if err != nil {
+			log.Printf("WARNING: skipping s3://%s/%s: %v", s3c.Bucket, aws.StringValue(obj.Key), err)
+			continue
+		}
+		listed[path] = true
+		atomic.AddInt64(&progress.TotalObjects, 1)
+		atomic.AddInt64(&progress.TotalBytes, aws.Int64Value(obj.Size))
+		downloads <- download{obj: obj, path: path}
+	}
+	close(downloads)
+	wg.Wait()
+	if listErr != nil {
+		// without a full listing nothing can safely be deleted
+		return listErr
+	}
+
+	if opts.Delete {
+		err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() && !listed[path] {
+				if opts.DryRun {
+					fmt.Printf("(dry run) delete %s\n", path)
+					return nil
+				}
+				log.Printf("Deleting %s, not in s3://%s/%s", path, s3c.Bucket, opts.Prefix)
+				return os.Remove(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete stale files in %s: %v", dirPath, err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d objects failed to download. Check FailedObjects map for details", failed)
+	}
+	if s3c.logging {
+		log.Printf("Sync of s3://%s/%s to %s has concluded", s3c.Bucket, opts.Prefix, dirPath)
+	}
+	return nil
+}
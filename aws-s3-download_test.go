@@ -0,0 +1,96 @@
+package alfredo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// fakeObjects serves GetObject requests for the keys in contents.
+func fakeObjects(contents map[string]string) func(*s3.GetObjectInput) *s3.GetObjectOutput {
+	return func(in *s3.GetObjectInput) *s3.GetObjectOutput {
+		body := contents[*in.Key]
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body)), ContentLength: aws.Int64(int64(len(body)))}
+	}
+}
+
+func TestS3SyncBucketToDirectory(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	contents := map[string]string{"data/a.txt": "alpha", "data/dir/b.txt": "bravo"}
+	mockS3 := new(MockS3Client)
+	mockS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("data/a.txt"), Size: int64p(5), LastModified: aws.Time(t0), ETag: aws.String(`"` + MD5SumString("alpha") + `"`)},
+		&s3.Object{Key: str("data/dir/"), Size: int64p(0), LastModified: aws.Time(t0)},
+		&s3.Object{Key: str("data/dir/b.txt"), Size: int64p(5), LastModified: aws.Time(t0), ETag: aws.String(`"` + MD5SumString("bravo") + `"`)},
+		&s3.Object{Key: str("data/../../evil"), Size: int64p(1), LastModified: aws.Time(t0)},
+	), nil)
+	mockS3.On("GetObjectWithContext", mock.Anything, mock.Anything).Return(fakeObjects(contents), nil)
+	s3c := S3ClientSession{Client: mockS3, Bucket: "bucket", established: true}
+	dir := t.TempDir()
+	opts := SyncOptions{Prefix: "data/"}
+
+	progress := &ProgressTracker{}
+	assert.NoError(t, s3c.S3SyncBucketToDirectory(dir, opts, progress))
+	assert.Equal(t, int64(2), progress.MigratedObjects)
+	assert.Equal(t, int64(10), progress.CompletedBytes)
+	b, _ := os.ReadFile(filepath.Join(dir, "dir", "b.txt"))
+	assert.Equal(t, "bravo", string(b))
+	info, err := os.Stat(filepath.Join(dir, "a.txt"))
+	if assert.NoError(t, err) {
+		assert.True(t, info.ModTime().Equal(t0))
+	}
+	mockS3.AssertNumberOfCalls(t, "GetObjectWithContext", 2)
+
+	// unchanged files are skipped
+	progress = &ProgressTracker{}
+	assert.NoError(t, s3c.S3SyncBucketToDirectory(dir, opts, progress))
+	assert.Equal(t, int64(2), progress.SkippedObjects)
+	mockS3.AssertNumberOfCalls(t, "GetObjectWithContext", 2)
+
+	// same size and time but different content is only caught by checksum
+	path := filepath.Join(dir, "a.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("ALPHA"), 0644))
+	assert.NoError(t, os.Chtimes(path, t0, t0))
+	assert.NoError(t, s3c.S3SyncBucketToDirectory(dir, opts, &ProgressTracker{}))
+	mockS3.AssertNumberOfCalls(t, "GetObjectWithContext", 2)
+	opts.Checksum = true
+	assert.NoError(t, s3c.S3SyncBucketToDirectory(dir, opts, &ProgressTracker{}))
+	mockS3.AssertNumberOfCalls(t, "GetObjectWithContext", 3)
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, "alpha", string(b))
+
+	// files without an object are only removed on request
+	stale := filepath.Join(dir, "dir", "stale.txt")
+	assert.NoError(t, os.WriteFile(stale, []byte("x"), 0644))
+	assert.NoError(t, s3c.S3SyncBucketToDirectory(dir, opts, &ProgressTracker{}))
+	assert.FileExists(t, stale)
+	opts.Delete = true
+	assert.NoError(t, s3c.S3SyncBucketToDirectory(dir, opts, &ProgressTracker{}))
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, path)
+}
+
+func TestS3SyncBucketToDirectoryFailure(t *testing.T) {
+	mockS3 := new(MockS3Client)
+	mockS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("gone"), Size: int64p(3), LastModified: aws.Time(time.Now())},
+	), nil)
+	mockS3.On("GetObjectWithContext", mock.Anything, mock.Anything).Return(nil, awserr.NewRequestFailure(awserr.New("NoSuchKey", "", nil), 404, "req"))
+	s3c := S3ClientSession{Client: mockS3, Bucket: "bucket", established: true}
+	dir := t.TempDir()
+
+	progress := &ProgressTracker{}
+	assert.Error(t, s3c.S3SyncBucketToDirectory(dir, SyncOptions{}, progress))
+	assert.Contains(t, progress.FailedObjects, "gone")
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries, "no partial or temporary file is left behind")
+}
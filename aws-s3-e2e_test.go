@@ -0,0 +1,118 @@
+package alfredo
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSession returns a session for bucket on srv, creating the bucket.
+func fakeSession(t *testing.T, srv *s3fake.Server, bucket string) *S3ClientSession {
+	var s3c S3ClientSession
+	s3c.WithEndpoint(srv.URL).WithRegion("us-east-1").WithBucket(bucket).
+		WithCredentials(S3credStruct{AccessKey: "key", SecretKey: "secret"})
+	assert.NoError(t, s3c.EstablishSession())
+	_, err := s3c.Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	assert.NoError(t, err)
+	return &s3c
+}
+
+// migrateAll runs the migration loop from src to tgt until the listing is
+// exhausted, expecting every object to succeed.
+func migrateAll(t *testing.T, src, tgt *S3ClientSession, objects int) *ProgressTracker {
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	progress := &ProgressTracker{}
+	mgr := NewMigrationManager(src, tgt, progress, logger, logger, 2)
+	var wg sync.WaitGroup
+	results := make(chan CopyResult, objects)
+	for {
+		assert.NoError(t, mgr.MigrationLoop(&wg, &results))
+		if mgr.IsDone() {
+			break
+		}
+	}
+	wg.Wait()
+	close(results)
+	for result := range results {
+		assert.NoError(t, result.Error, result.SourceKey)
+	}
+	return progress
+}
+
+func TestMigrationAndVerificationEndToEnd(t *testing.T) {
+	srcSrv, tgtSrv := s3fake.New(), s3fake.New()
+	defer srcSrv.Close()
+	defer tgtSrv.Close()
+	// small pages so that the migration and the verification paginate
+	srcSrv.MaxKeys, tgtSrv.MaxKeys = 2, 2
+	src, tgt := fakeSession(t, srcSrv, "source"), fakeSession(t, tgtSrv, "target")
+
+	contents := map[string][]byte{
+		"a.txt":      []byte("alpha"),
+		"docs/b.txt": []byte("bravo"),
+		"docs/c.txt": []byte("charlie"),
+		"logs/d.log": []byte("delta"),
+		"big.bin":    bytes.Repeat([]byte("0123456789abcdef"), int(defaultPartSizeMin+1024)/16),
+	}
+	for key, data := range contents {
+		_, err := src.Client.PutObject(&s3.PutObjectInput{Bucket: aws.String("source"), Key: aws.String(key), Body: bytes.NewReader(data)})
+		assert.NoError(t, err)
+	}
+
+	progress := migrateAll(t, src, tgt, len(contents))
+	assert.Equal(t, int64(len(contents)), progress.MigratedObjects)
+	for key, data := range contents {
+		got, ok := tgtSrv.Object("target", key)
+		assert.True(t, ok, key)
+		assert.True(t, bytes.Equal(data, got), key)
+	}
+
+	opts := VerifyOptions{DeepVerify: DeepVerifyETag}
+	report, err := RunVerificationWithReport(src, tgt, opts, nil)
+	assert.NoError(t, err)
+	assert.True(t, report.Clean(), report.String())
+
+	// tamper with the target and verify again
+	_, err = tgt.Client.PutObject(&s3.PutObjectInput{Bucket: aws.String("target"), Key: aws.String("docs/b.txt"), Body: strings.NewReader("BRAVO")})
+	assert.NoError(t, err)
+	_, err = tgt.Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("target"), Key: aws.String("logs/d.log")})
+	assert.NoError(t, err)
+	report, err = RunVerificationWithReport(src, tgt, opts, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), report.Counts[ContentMismatch])
+	assert.Equal(t, int64(1), report.Counts[Missing])
+	assert.Equal(t, VerifyExitDifferences, VerificationExitCode(report, err))
+}
+
+func TestServerSideMigrationEndToEnd(t *testing.T) {
+	srv := s3fake.New()
+	defer srv.Close()
+	src, tgt := fakeSession(t, srv, "source"), fakeSession(t, srv, "target")
+	assert.True(t, SameEndpoint(src, tgt))
+
+	contents := map[string][]byte{
+		"small": []byte("small object"),
+		"large": bytes.Repeat([]byte("x"), int(defaultPartSizeMin)*2+1),
+	}
+	for key, data := range contents {
+		_, err := src.Client.PutObject(&s3.PutObjectInput{Bucket: aws.String("source"), Key: aws.String(key), Body: bytes.NewReader(data)})
+		assert.NoError(t, err)
+	}
+	progress := migrateAll(t, src, tgt, len(contents))
+	assert.Equal(t, int64(len(contents)), progress.MigratedObjects)
+	for key, data := range contents {
+		got, _ := srv.Object("target", key)
+		assert.True(t, bytes.Equal(data, got), key)
+	}
+	report, err := RunVerificationWithReport(src, tgt, VerifyOptions{DeepVerify: DeepVerifySHA256}, nil)
+	assert.NoError(t, err)
+	assert.True(t, report.Clean(), report.String())
+}
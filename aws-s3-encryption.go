@@ -0,0 +1,125 @@
+package alfredo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const sseCustomerAlgorithm = "AES256"
+
+// S3Encryption is how a session encrypts the objects it writes and, for
+// SSE-C, the key it needs to read them. Sessions are independent, so a
+// migration can read with the source's key and write with the target's.
+type S3Encryption struct {
+	// ServerSideEncryption is s3.ServerSideEncryptionAes256 (SSE-S3) or
+	// s3.ServerSideEncryptionAwsKms (SSE-KMS); empty leaves it to the bucket
+	ServerSideEncryption string `json:"sse,omitempty"`
+	// KMSKeyId selects the SSE-KMS key instead of the account's default
+	KMSKeyId string `json:"kmsKeyId,omitempty"`
+	// CustomerKey is a 256-bit SSE-C key. It is never serialized.
+	CustomerKey []byte `json:"-"`
+}
+
+// Validate checks that the settings can be sent together.
+func (e *S3Encryption) Validate() error {
+	switch e.ServerSideEncryption {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		return fmt.Errorf("unsupported server-side encryption: %s", e.ServerSideEncryption)
+	}
+	if len(e.KMSKeyId) > 0 && e.ServerSideEncryption != s3.ServerSideEncryptionAwsKms {
+		return errors.New("a KMS key id needs server-side encryption aws:kms")
+	}
+	if len(e.CustomerKey) > 0 {
+		if len(e.CustomerKey) != 32 {
+			return fmt.Errorf("an SSE-C key must be 32 bytes, not %d", len(e.CustomerKey))
+		}
+		if len(e.ServerSideEncryption) > 0 {
+			return errors.New("an SSE-C key cannot be combined with SSE-S3 or SSE-KMS")
+		}
+	}
+	return nil
+}
+
+// WithEncryption sets how the session's objects are encrypted; it is checked
+// by EstablishSession. SSE-C keys are only sent over HTTPS.
+func (s3c *S3ClientSession) WithEncryption(e S3Encryption) *S3ClientSession {
+	s3c.Encryption = &e
+	return s3c
+}
+
+// sse returns the SSE-S3 or SSE-KMS settings to write with, or nils.
+func (s3c *S3ClientSession) sse() (*string, *string) {
+	if s3c.Encryption == nil || len(s3c.Encryption.ServerSideEncryption) == 0 {
+		return nil, nil
+	}
+	var keyID *string
+	if len(s3c.Encryption.KMSKeyId) > 0 {
+		keyID = aws.String(s3c.Encryption.KMSKeyId)
+	}
+	return aws.String(s3c.Encryption.ServerSideEncryption), keyID
+}
+
+// customerKey returns the SSE-C algorithm and key, or nils. The SDK encodes
+// the key and adds its MD5.
+func (s3c *S3ClientSession) customerKey() (*string, *string) {
+	if s3c.Encryption == nil || len(s3c.Encryption.CustomerKey) == 0 {
+		return nil, nil
+	}
+	return aws.String(sseCustomerAlgorithm), aws.String(string(s3c.Encryption.CustomerKey))
+}
+
+// The helpers below add the session's encryption to a request and return it,
+// so they can wrap the input where it is built.
+
+func (s3c *S3ClientSession) encryptPut(in *s3.PutObjectInput) *s3.PutObjectInput {
+	in.ServerSideEncryption, in.SSEKMSKeyId = s3c.sse()
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	return in
+}
+
+func (s3c *S3ClientSession) encryptUpload(in *s3manager.UploadInput) *s3manager.UploadInput {
+	in.ServerSideEncryption, in.SSEKMSKeyId = s3c.sse()
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	return in
+}
+
+func (s3c *S3ClientSession) encryptCreateMPU(in *s3.CreateMultipartUploadInput) *s3.CreateMultipartUploadInput {
+	in.ServerSideEncryption, in.SSEKMSKeyId = s3c.sse()
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	return in
+}
+
+func (s3c *S3ClientSession) encryptUploadPart(in *s3.UploadPartInput) *s3.UploadPartInput {
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	return in
+}
+
+func (s3c *S3ClientSession) encryptHead(in *s3.HeadObjectInput) *s3.HeadObjectInput {
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	return in
+}
+
+func (s3c *S3ClientSession) encryptGet(in *s3.GetObjectInput) *s3.GetObjectInput {
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	return in
+}
+
+// encryptCopy encrypts a server-side copy into s3c, reading the source with
+// source's SSE-C key.
+func (s3c *S3ClientSession) encryptCopy(in *s3.CopyObjectInput, source *S3ClientSession) *s3.CopyObjectInput {
+	in.ServerSideEncryption, in.SSEKMSKeyId = s3c.sse()
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey = source.customerKey()
+	return in
+}
+
+func (s3c *S3ClientSession) encryptUploadPartCopy(in *s3.UploadPartCopyInput, source *S3ClientSession) *s3.UploadPartCopyInput {
+	in.SSECustomerAlgorithm, in.SSECustomerKey = s3c.customerKey()
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey = source.customerKey()
+	return in
+}
@@ -0,0 +1,126 @@
+package alfredo
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	sourceCustomerKey = bytes.Repeat([]byte("s"), 32)
+	targetCustomerKey = bytes.Repeat([]byte("t"), 32)
+)
+
+func TestS3EncryptionValidate(t *testing.T) {
+	for _, e := range []S3Encryption{
+		{},
+		{ServerSideEncryption: s3.ServerSideEncryptionAes256},
+		{ServerSideEncryption: s3.ServerSideEncryptionAwsKms, KMSKeyId: "alias/key"},
+		{CustomerKey: sourceCustomerKey},
+	} {
+		assert.NoError(t, e.Validate(), e.ServerSideEncryption)
+	}
+	for _, e := range []S3Encryption{
+		{ServerSideEncryption: "rot13"},
+		{ServerSideEncryption: s3.ServerSideEncryptionAes256, KMSKeyId: "alias/key"},
+		{CustomerKey: []byte("short")},
+		{ServerSideEncryption: s3.ServerSideEncryptionAes256, CustomerKey: sourceCustomerKey},
+	} {
+		assert.Error(t, e.Validate())
+	}
+	var s3c S3ClientSession
+	s3c.WithEndpoint("https://localhost").WithRegion("us-east-1").
+		WithCredentials(S3credStruct{AccessKey: "key", SecretKey: "secret"}).
+		WithEncryption(S3Encryption{CustomerKey: []byte("short")})
+	assert.ErrorContains(t, s3c.EstablishSession(), "invalid encryption settings")
+}
+
+func TestServerSideEncryptionUpload(t *testing.T) {
+	srv := s3fake.New()
+	defer srv.Close()
+	s3c := fakeSession(t, srv, "bucket")
+	s3c.WithEncryption(S3Encryption{ServerSideEncryption: s3.ServerSideEncryptionAwsKms, KMSKeyId: "alias/key"})
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644))
+	_, err := s3c.S3SyncDirectoryToBucketWithOptions(dir, SyncOptions{}, &ProgressTracker{})
+	assert.NoError(t, err)
+	head, err := s3c.Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a.txt")})
+	if assert.NoError(t, err) {
+		assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(head.ServerSideEncryption))
+		assert.Equal(t, "alias/key", aws.StringValue(head.SSEKMSKeyId))
+	}
+}
+
+// putCustomerEncrypted stores data at key, encrypted with the session's key.
+func putCustomerEncrypted(t *testing.T, s3c *S3ClientSession, key string, data []byte) {
+	_, err := s3c.Client.PutObject(s3c.encryptPut(&s3.PutObjectInput{Bucket: aws.String(s3c.Bucket), Key: aws.String(key), Body: bytes.NewReader(data)}))
+	assert.NoError(t, err, key)
+}
+
+// assertCustomerEncrypted checks that key can only be read with s3c's key.
+func assertCustomerEncrypted(t *testing.T, s3c *S3ClientSession, key string) {
+	_, err := s3c.Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(s3c.Bucket), Key: aws.String(key)})
+	assert.Error(t, err, key)
+	s3c.ObjectKey = key
+	exists, err := s3c.HeadObject()
+	assert.NoError(t, err, key)
+	assert.True(t, exists, key)
+}
+
+func TestCustomerKeyMigrationReencrypts(t *testing.T) {
+	srcSrv, tgtSrv := s3fake.NewTLS(), s3fake.NewTLS()
+	defer srcSrv.Close()
+	defer tgtSrv.Close()
+	src, tgt := fakeSession(t, srcSrv, "source"), fakeSession(t, tgtSrv, "target")
+	src.WithEncryption(S3Encryption{CustomerKey: sourceCustomerKey})
+	tgt.WithEncryption(S3Encryption{CustomerKey: targetCustomerKey})
+
+	contents := map[string][]byte{
+		"small": []byte("small object"),
+		"large": bytes.Repeat([]byte("x"), int(defaultPartSizeMin)+1024),
+	}
+	for key, data := range contents {
+		putCustomerEncrypted(t, src, key, data)
+	}
+	progress := migrateAll(t, src, tgt, len(contents))
+	assert.Equal(t, int64(len(contents)), progress.MigratedObjects)
+	for key, data := range contents {
+		got, _ := tgtSrv.Object("target", key)
+		assert.True(t, bytes.Equal(data, got), key)
+		assertCustomerEncrypted(t, tgt, key)
+	}
+
+	report, err := RunVerificationWithReport(src, tgt, VerifyOptions{DeepVerify: DeepVerifySHA256}, nil)
+	assert.NoError(t, err)
+	assert.True(t, report.Clean(), report.String())
+}
+
+func TestCustomerKeyServerSideCopy(t *testing.T) {
+	srv := s3fake.NewTLS()
+	defer srv.Close()
+	src, tgt := fakeSession(t, srv, "source"), fakeSession(t, srv, "target")
+	src.WithEncryption(S3Encryption{CustomerKey: sourceCustomerKey})
+	tgt.WithEncryption(S3Encryption{CustomerKey: targetCustomerKey})
+
+	contents := map[string][]byte{
+		"small": []byte("small object"),
+		"large": bytes.Repeat([]byte("y"), int(defaultPartSizeMin)*2+1),
+	}
+	for key, data := range contents {
+		putCustomerEncrypted(t, src, key, data)
+	}
+	progress := migrateAll(t, src, tgt, len(contents))
+	assert.Equal(t, int64(len(contents)), progress.MigratedObjects)
+	for key, data := range contents {
+		got, _ := srv.Object("target", key)
+		assert.True(t, bytes.Equal(data, got), key)
+		assertCustomerEncrypted(t, tgt, key)
+	}
+}
@@ -0,0 +1,165 @@
+package alfredo
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectFilter selects the slice of a bucket to migrate or verify. Every set
+// criterion must hold for an object to be included; an empty filter includes
+// everything.
+//
+// Globs follow path.Match; a pattern without a '/' is matched against the
+// last path element of the key (so "*.tmp" matches "logs/a.tmp"), otherwise
+// against the whole key.
+type ObjectFilter struct {
+	IncludePrefixes []string  `json:"includePrefixes,omitempty"`
+	ExcludePrefixes []string  `json:"excludePrefixes,omitempty"`
+	IncludeGlobs    []string  `json:"includeGlobs,omitempty"`
+	ExcludeGlobs    []string  `json:"excludeGlobs,omitempty"`
+	MinSize         int64     `json:"minSize,omitempty"`
+	MaxSize         int64     `json:"maxSize,omitempty"` // 0 means no upper bound
+	ModifiedAfter   time.Time `json:"modifiedAfter,omitempty"`
+	ModifiedBefore  time.Time `json:"modifiedBefore,omitempty"`
+	StorageClasses  []string  `json:"storageClasses,omitempty"`
+}
+
+// Validate reports malformed glob patterns up front rather than on the first
+// key they are matched against.
+func (f *ObjectFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.IncludeGlobs...), f.ExcludeGlobs...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %v", pattern, err)
+		}
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("minimum size %d exceeds maximum size %d", f.MinSize, f.MaxSize)
+	}
+	return nil
+}
+
+// NeedsObjectDetails is true when the filter looks at the modification time or
+// storage class, which a plain key list does not carry.
+func (f *ObjectFilter) NeedsObjectDetails() bool {
+	return f != nil && (!f.ModifiedAfter.IsZero() || !f.ModifiedBefore.IsZero() || len(f.StorageClasses) > 0)
+}
+
+// MatchKey applies the prefix and glob criteria only.
+func (f *ObjectFilter) MatchKey(key string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.IncludePrefixes) > 0 && !hasAnyPrefix(key, f.IncludePrefixes) {
+		return false
+	}
+	if hasAnyPrefix(key, f.ExcludePrefixes) {
+		return false
+	}
+	if len(f.IncludeGlobs) > 0 && !matchAnyGlob(key, f.IncludeGlobs) {
+		return false
+	}
+	return !matchAnyGlob(key, f.ExcludeGlobs)
+}
+
+// MatchKeyAndSize applies the prefix, glob and size criteria.
+func (f *ObjectFilter) MatchKeyAndSize(key string, size int64) bool {
+	if f == nil {
+		return true
+	}
+	if size < f.MinSize || (f.MaxSize > 0 && size > f.MaxSize) {
+		return false
+	}
+	return f.MatchKey(key)
+}
+
+// Match applies every criterion; an empty storageClass is treated as STANDARD,
+// which is what S3 omits from listings.
+func (f *ObjectFilter) Match(key string, size int64, lastModified time.Time, storageClass string) bool {
+	if f == nil {
+		return true
+	}
+	if !f.MatchKeyAndSize(key, size) {
+		return false
+	}
+	if !f.ModifiedAfter.IsZero() && !lastModified.After(f.ModifiedAfter) {
+		return false
+	}
+	if !f.ModifiedBefore.IsZero() && !lastModified.Before(f.ModifiedBefore) {
+		return false
+	}
+	if len(f.StorageClasses) > 0 {
+		if len(storageClass) == 0 {
+			storageClass = "STANDARD"
+		}
+		found := false
+		for _, sc := range f.StorageClasses {
+			if strings.EqualFold(sc, storageClass) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyGlob(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		subject := key
+		if !strings.Contains(pattern, "/") {
+			subject = path.Base(key)
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// WithFilter restricts MigrationLoop, MigrationBatch and MigrateAllVersions to
+// the objects selected by filter.
+func (mgr *MigrationMgrStruct) WithFilter(filter *ObjectFilter) *MigrationMgrStruct {
+	mgr.Filter = filter
+	return mgr
+}
+
+func (mgr *MigrationMgrStruct) countFiltered(size int64) {
+	atomic.AddInt64(&mgr.Progress.FilteredObjects, 1)
+	atomic.AddInt64(&mgr.Progress.FilteredBytes, size)
+}
+
+// matchesFilterDetails HEADs the source object for the modification time and
+// storage class criteria, which a batch key list does not carry.
+func (mgr *MigrationMgrStruct) matchesFilterDetails(size int64) (bool, error) {
+	var head *s3.HeadObjectOutput
+	err := mgr.retry(func() error {
+		var err error
+		mgr.sourceRequest()
+		head, err = mgr.SourceS3.Client.HeadObjectWithContext(mgr.SourceS3.ctx, mgr.SourceS3.encryptHead(&s3.HeadObjectInput{
+			Bucket: aws.String(mgr.SourceS3.Bucket),
+			Key:    aws.String(mgr.SourceS3.ObjectKey),
+		}))
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return mgr.Filter.Match(mgr.SourceS3.ObjectKey, size, aws.TimeValue(head.LastModified), aws.StringValue(head.StorageClass)), nil
+}
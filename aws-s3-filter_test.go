@@ -0,0 +1,105 @@
+package alfredo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestObjectFilterMatch(t *testing.T) {
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := &ObjectFilter{
+		IncludePrefixes: []string{"logs/2024/"},
+		ExcludeGlobs:    []string{"*.tmp"},
+		MaxSize:         100,
+		ModifiedAfter:   cutoff,
+		StorageClasses:  []string{"STANDARD"},
+	}
+	assert.NoError(t, f.Validate())
+	assert.True(t, f.NeedsObjectDetails())
+
+	after := cutoff.Add(time.Hour)
+	assert.True(t, f.Match("logs/2024/a.log", 10, after, ""))
+	assert.True(t, f.Match("logs/2024/a.log", 10, after, "standard"))
+	assert.False(t, f.Match("logs/2023/a.log", 10, after, ""))
+	assert.False(t, f.Match("logs/2024/deep/a.tmp", 10, after, ""))
+	assert.False(t, f.Match("logs/2024/a.log", 101, after, ""))
+	assert.False(t, f.Match("logs/2024/a.log", 10, cutoff, ""))
+	assert.False(t, f.Match("logs/2024/a.log", 10, after, "GLACIER"))
+
+	// a glob with a '/' is matched against the whole key
+	g := &ObjectFilter{IncludeGlobs: []string{"logs/*/a.log"}}
+	assert.True(t, g.MatchKey("logs/2024/a.log"))
+	assert.False(t, g.MatchKey("logs/2024/x/a.log"))
+	assert.False(t, g.NeedsObjectDetails())
+
+	var none *ObjectFilter
+	assert.True(t, none.Match("anything", 1, time.Time{}, "GLACIER"))
+
+	assert.Error(t, (&ObjectFilter{ExcludeGlobs: []string{"[bad"}}).Validate())
+	assert.Error(t, (&ObjectFilter{MinSize: 10, MaxSize: 5}).Validate())
+}
+
+func TestMigrationBatchCountsFiltered(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	progress := &ProgressTracker{}
+	mgr := NewMigrationManager(&S3ClientSession{Bucket: "source-bucket"}, &S3ClientSession{Bucket: "target-bucket"},
+		progress, logger, logger, 100).WithFilter(&ObjectFilter{ExcludePrefixes: []string{"tmp/"}, MinSize: 10})
+
+	var wg sync.WaitGroup
+	results := make(chan CopyResult, 10)
+	assert.NoError(t, mgr.MigrationBatch([]string{"tmp/a|50", "small|5"}, &wg, &results))
+	assert.Equal(t, int64(2), progress.FilteredObjects)
+	assert.Equal(t, int64(55), progress.FilteredBytes)
+	assert.Equal(t, int64(0), progress.TotalObjects)
+	assert.Empty(t, results)
+}
+
+func TestVerificationHonoursFilter(t *testing.T) {
+	old := aws.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	recent := aws.Time(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("a.tmp"), Size: int64p(1), LastModified: recent},
+		{Key: str("b"), Size: int64p(2), LastModified: old},
+		{Key: str("c"), Size: int64p(3), LastModified: recent},
+		{Key: str("d"), Size: int64p(4), LastModified: recent},
+	}}, nil)
+	// target copies carry the migration time, so only the source is aged
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("b"), Size: int64p(2), LastModified: recent},
+		{Key: str("c"), Size: int64p(3), LastModified: recent},
+		{Key: str("x.tmp"), Size: int64p(9), LastModified: recent},
+		{Key: str("y"), Size: int64p(9), LastModified: recent},
+	}}, nil)
+
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+	filter := &ObjectFilter{ExcludeGlobs: []string{"*.tmp"}, ModifiedAfter: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	var buf bytes.Buffer
+	assert.NoError(t, RunVerificationWithOptions(srcS3c, tgtS3c, VerifyOptions{Filter: filter}, &buf))
+
+	var diffs []Diff
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var d Diff
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &d))
+		diffs = append(diffs, d)
+	}
+	assert.Equal(t, []Diff{
+		{Type: Missing, Key: "d", SourceSize: 4},
+		{Type: Extra, Key: "y", TargetSize: 9},
+	}, diffs)
+}
@@ -0,0 +1,350 @@
+package alfredo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	CopyMethodRegular = "regular"
+	CopyMethodMPU     = "mpu"
+	CopyMethodSkipped = "skipped"
+)
+
+// JournalRecord is one line of a result journal: the outcome of migrating a
+// single object.
+type JournalRecord struct {
+	Time         time.Time `json:"time"`
+	SourceBucket string    `json:"source_bucket"`
+	TargetBucket string    `json:"target_bucket"`
+	SourceKey    string    `json:"source_key"`
+	TargetKey    string    `json:"target_key"`
+	Bytes        int64     `json:"bytes"`
+	DurationMs   int64     `json:"duration_ms"`
+	Method       string    `json:"method,omitempty"`
+	SourceETag   string    `json:"source_etag,omitempty"`
+	TargetETag   string    `json:"target_etag,omitempty"`
+	Success      bool      `json:"success"`
+	ErrorCode    string    `json:"error_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+var journalCSVHeader = []string{"time", "source_bucket", "target_bucket", "source_key", "target_key", "bytes",
+	"duration_ms", "method", "source_etag", "target_etag", "success", "error_code", "error"}
+
+func (r JournalRecord) csvRow() []string {
+	return []string{r.Time.Format(time.RFC3339Nano), r.SourceBucket, r.TargetBucket, r.SourceKey, r.TargetKey,
+		strconv.FormatInt(r.Bytes, 10), strconv.FormatInt(r.DurationMs, 10), r.Method, r.SourceETag, r.TargetETag,
+		strconv.FormatBool(r.Success), r.ErrorCode, r.Error}
+}
+
+func journalRecordFromCSV(header []string, row []string) (JournalRecord, error) {
+	var r JournalRecord
+	field := make(map[string]string, len(header))
+	for i, name := range header {
+		if i < len(row) {
+			field[name] = row[i]
+		}
+	}
+	var err error
+	if len(field["time"]) > 0 {
+		if r.Time, err = time.Parse(time.RFC3339Nano, field["time"]); err != nil {
+			return r, err
+		}
+	}
+	r.SourceBucket = field["source_bucket"]
+	r.TargetBucket = field["target_bucket"]
+	r.SourceKey = field["source_key"]
+	r.TargetKey = field["target_key"]
+	if r.Bytes, err = strconv.ParseInt(field["bytes"], 10, 64); err != nil {
+		return r, err
+	}
+	r.DurationMs, _ = strconv.ParseInt(field["duration_ms"], 10, 64)
+	r.Method = field["method"]
+	r.SourceETag = field["source_etag"]
+	r.TargetETag = field["target_etag"]
+	r.Success = field["success"] == "true"
+	r.ErrorCode = field["error_code"]
+	r.Error = field["error"]
+	return r, nil
+}
+
+// errorCodePattern finds the first S3 error code in an error message that was
+// wrapped with %v, e.g. "failed to put object: SlowDown: Please reduce ...".
+var errorCodePattern = regexp.MustCompile(`\b([A-Z][A-Za-z0-9]+): `)
+
+// ErrorCode is the S3 error code behind err, or "" if there is none.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	if m := errorCodePattern.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// ResultJournal appends one record per migrated object to a file, as JSON
+// lines or, when the path ends in ".csv", as CSV with a header row. It is
+// safe for concurrent use, and a nil journal discards records.
+type ResultJournal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	csv  *csv.Writer
+}
+
+// NewResultJournal opens path for appending, so a journal can span several
+// runs; LoadFailedResults keeps only the latest record per key.
+func NewResultJournal(path string) (*ResultJournal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result journal %s: %v", path, err)
+	}
+	j := &ResultJournal{path: path, file: f}
+	if isCSVJournal(path) {
+		j.csv = csv.NewWriter(f)
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to stat result journal %s: %v", path, err)
+		}
+		if info.Size() == 0 {
+			j.csv.Write(journalCSVHeader)
+			j.csv.Flush()
+		}
+	}
+	return j, nil
+}
+
+func isCSVJournal(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".csv")
+}
+
+func (j *ResultJournal) GetPath() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
+
+func (j *ResultJournal) Write(record JournalRecord) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.csv != nil {
+		j.csv.Write(record.csvRow())
+		j.csv.Flush()
+		return j.csv.Error()
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(b, '\n'))
+	return err
+}
+
+func (j *ResultJournal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// ReadResultJournal reads every record of a JSONL or CSV journal in order.
+func ReadResultJournal(path string) ([]JournalRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result journal %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var records []JournalRecord
+	if isCSVJournal(path) {
+		reader := csv.NewReader(f)
+		header, err := reader.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read result journal %s: %v", path, err)
+		}
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read result journal %s: %v", path, err)
+			}
+			record, err := journalRecordFromCSV(header, row)
+			if err != nil {
+				return nil, fmt.Errorf("malformed record in result journal %s: %v", path, err)
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("malformed record in result journal %s: %v", path, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read result journal %s: %v", path, err)
+	}
+	return records, nil
+}
+
+// LoadFailedResults returns the keys whose latest record in the journal is a
+// failure, in the order they first appear.
+func LoadFailedResults(path string) ([]JournalRecord, error) {
+	records, err := ReadResultJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]JournalRecord)
+	var order []string
+	for _, r := range records {
+		id := r.SourceBucket + "/" + r.SourceKey
+		if _, seen := latest[id]; !seen {
+			order = append(order, id)
+		}
+		latest[id] = r
+	}
+	var failed []JournalRecord
+	for _, id := range order {
+		if !latest[id].Success {
+			failed = append(failed, latest[id])
+		}
+	}
+	return failed, nil
+}
+
+// WithJournal has the migration append a JournalRecord for every object.
+func (mgr *MigrationMgrStruct) WithJournal(j *ResultJournal) *MigrationMgrStruct {
+	mgr.Journal = j
+	return mgr
+}
+
+// copyResult describes the outcome of the MigrateObject call that just ran on mgr.
+func (mgr *MigrationMgrStruct) copyResult(err error, duration time.Duration, size int64) CopyResult {
+	result := CopyResult{
+		SourceKey:   mgr.SourceS3.ObjectKey,
+		TargetKey:   mgr.TargetS3.ObjectKey,
+		Bucket:      mgr.SourceS3.Bucket,
+		Success:     err == nil,
+		Error:       err,
+		Duration:    duration,
+		BytesCopied: size,
+		WasSkipped:  mgr.TargetS3.WasSkipped,
+		Method:      mgr.copyMethod,
+		TargetETag:  mgr.targetETag,
+	}
+	if mgr.SourceHead != nil {
+		result.SourceETag = aws.StringValue(mgr.SourceHead.ETag)
+	}
+	return result
+}
+
+func (mgr *MigrationMgrStruct) journalResult(result CopyResult) {
+	if mgr.Journal == nil {
+		return
+	}
+	record := JournalRecord{
+		Time:         time.Now().UTC(),
+		SourceBucket: mgr.SourceS3.Bucket,
+		TargetBucket: mgr.TargetS3.Bucket,
+		SourceKey:    result.SourceKey,
+		TargetKey:    result.TargetKey,
+		Bytes:        result.BytesCopied,
+		DurationMs:   result.Duration.Milliseconds(),
+		Method:       result.Method,
+		SourceETag:   result.SourceETag,
+		TargetETag:   result.TargetETag,
+		Success:      result.Success,
+	}
+	if result.Error != nil {
+		record.ErrorCode = ErrorCode(result.Error)
+		record.Error = result.Error.Error()
+	}
+	if err := mgr.Journal.Write(record); err != nil {
+		log.Printf("WARNING: failed to write result journal %s: %v", mgr.Journal.GetPath(), err)
+	}
+}
+
+// RetryFailed re-migrates the objects whose latest record in the journal at
+// journalPath is a failure. Records for other source buckets are ignored. If
+// mgr has a journal of its own (it may be the same file) the new outcomes are
+// appended to it.
+func (mgr *MigrationMgrStruct) RetryFailed(journalPath string) error {
+	failed, err := LoadFailedResults(journalPath)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, r := range failed {
+		if len(r.SourceBucket) > 0 && r.SourceBucket != mgr.SourceS3.Bucket {
+			continue
+		}
+		keys = append(keys, fmt.Sprintf("%s|%d", r.SourceKey, r.Bytes))
+	}
+	if len(keys) == 0 {
+		log.Printf("No failed objects of bucket %s in result journal %s\n", mgr.SourceS3.Bucket, journalPath)
+		return nil
+	}
+	log.Printf("Retrying %d failed objects from result journal %s\n", len(keys), journalPath)
+
+	var wg sync.WaitGroup
+	resultsChan := make(chan CopyResult, len(keys))
+	if err := mgr.MigrationBatch(keys, &wg, &resultsChan); err != nil {
+		return err
+	}
+	wg.Wait()
+	close(resultsChan)
+
+	failures := 0
+	for result := range resultsChan {
+		if !result.Success {
+			failures++
+			mgr.Progress.mu.Lock()
+			mgr.Progress.FailedObjects[result.SourceKey] = result.Error
+			mgr.Progress.mu.Unlock()
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d objects failed again. Check FailedObjects map for details", failures, len(keys))
+	}
+	return nil
+}
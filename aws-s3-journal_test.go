@@ -0,0 +1,107 @@
+package alfredo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCode(t *testing.T) {
+	assert.Equal(t, "", ErrorCode(nil))
+	assert.Equal(t, "NoSuchKey", ErrorCode(awserr.New("NoSuchKey", "gone", nil)))
+	wrapped := fmt.Errorf("failed to put object: %v", awserr.New("SlowDown", "Please reduce your request rate.", nil))
+	assert.Equal(t, "SlowDown", ErrorCode(wrapped))
+	assert.Equal(t, "", ErrorCode(errors.New("skip size exceeded")))
+}
+
+func TestResultJournalRoundTrip(t *testing.T) {
+	for _, name := range []string{"journal.jsonl", "journal.csv"} {
+		path := filepath.Join(t.TempDir(), name)
+		j, err := NewResultJournal(path)
+		assert.NoError(t, err)
+		assert.NoError(t, j.Write(JournalRecord{SourceBucket: "src", SourceKey: "a", Bytes: 1, Success: true, Method: CopyMethodRegular}))
+		assert.NoError(t, j.Write(JournalRecord{SourceBucket: "src", SourceKey: "b", Bytes: 2, ErrorCode: "SlowDown", Error: "SlowDown: x, \"quoted\""}))
+		assert.NoError(t, j.Write(JournalRecord{SourceBucket: "src", SourceKey: "c|d", Bytes: 3, ErrorCode: "InternalError"}))
+		assert.NoError(t, j.Close())
+
+		// a second run appends; c now succeeds
+		j, err = NewResultJournal(path)
+		assert.NoError(t, err)
+		assert.NoError(t, j.Write(JournalRecord{SourceBucket: "src", SourceKey: "c|d", Bytes: 3, Success: true, Method: CopyMethodMPU}))
+		assert.NoError(t, j.Close())
+
+		records, err := ReadResultJournal(path)
+		assert.NoError(t, err, name)
+		assert.Len(t, records, 4, name)
+
+		failed, err := LoadFailedResults(path)
+		assert.NoError(t, err)
+		if assert.Len(t, failed, 1, name) {
+			assert.Equal(t, "b", failed[0].SourceKey)
+			assert.Equal(t, int64(2), failed[0].Bytes)
+			assert.Equal(t, "SlowDown", failed[0].ErrorCode)
+			assert.Equal(t, "SlowDown: x, \"quoted\"", failed[0].Error)
+		}
+	}
+
+	var none *ResultJournal
+	assert.NoError(t, none.Write(JournalRecord{}))
+}
+
+func TestMigrationJournalsResults(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	j, err := NewResultJournal(path)
+	assert.NoError(t, err)
+	mgr := NewMigrationManager(&S3ClientSession{Bucket: "source-bucket"}, &S3ClientSession{Bucket: "target-bucket"},
+		&ProgressTracker{}, logger, logger, 100).WithJournal(j)
+
+	mgr.SourceS3.ObjectKey = "k"
+	mgr.TargetS3.ObjectKey = "k2"
+	mgr.SourceHead = &s3.HeadObjectOutput{ETag: aws.String(`"src"`)}
+	mgr.copyMethod = CopyMethodRegular
+	mgr.targetETag = `"tgt"`
+	mgr.journalResult(mgr.copyResult(nil, 1500*time.Millisecond, 42))
+	mgr.copyMethod = CopyMethodMPU
+	mgr.journalResult(mgr.copyResult(fmt.Errorf("failed to complete: %v", awserr.New("InternalError", "oops", nil)), time.Second, 42))
+	assert.NoError(t, j.Close())
+
+	records, err := ReadResultJournal(path)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		r := records[0]
+		assert.Equal(t, "source-bucket", r.SourceBucket)
+		assert.Equal(t, "target-bucket", r.TargetBucket)
+		assert.Equal(t, "k2", r.TargetKey)
+		assert.Equal(t, int64(1500), r.DurationMs)
+		assert.Equal(t, `"src"`, r.SourceETag)
+		assert.Equal(t, `"tgt"`, r.TargetETag)
+		assert.True(t, r.Success)
+		assert.Equal(t, CopyMethodMPU, records[1].Method)
+		assert.Equal(t, "InternalError", records[1].ErrorCode)
+	}
+
+	// retrying hands the failed keys (with their sizes) to MigrationBatch;
+	// filtering them all out keeps the test off the network
+	progress := &ProgressTracker{}
+	retryMgr := NewMigrationManager(&S3ClientSession{Bucket: "source-bucket"}, &S3ClientSession{Bucket: "target-bucket"},
+		progress, logger, logger, 100).WithFilter(&ObjectFilter{ExcludePrefixes: []string{"k"}})
+	assert.NoError(t, retryMgr.RetryFailed(path))
+	assert.Equal(t, int64(1), progress.FilteredObjects)
+	assert.Equal(t, int64(42), progress.FilteredBytes)
+}
+
+func TestParseKeyListAllowsPipeInKey(t *testing.T) {
+	name, size := ParseKeyList("a|b|12")
+	assert.Equal(t, "a|b", name)
+	assert.Equal(t, int64(12), size)
+}
@@ -0,0 +1,114 @@
+package alfredo
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeyMapper rewrites a source object key into the key it is stored under on
+// the target.
+type KeyMapper interface {
+	MapKey(key string) string
+}
+
+// ReversibleKeyMapper can also map a target key back to its source key; ok is
+// false for target keys the mapper could not have produced. Verification uses
+// it to report and filter target-only objects by their source key.
+type ReversibleKeyMapper interface {
+	KeyMapper
+	UnmapKey(key string) (string, bool)
+}
+
+// orderedKeyMapper is implemented by mappers that keep lexicographic key order,
+// which lets verification stream both listings instead of sorting the source.
+type orderedKeyMapper interface {
+	PreservesOrder() bool
+}
+
+// prefixedKeyMapper is implemented by mappers whose output always starts with
+// a fixed prefix, which narrows the target listing during verification.
+type prefixedKeyMapper interface {
+	TargetPrefix() string
+}
+
+// PrefixMapper strips Strip from keys that start with it, then prepends Add.
+type PrefixMapper struct {
+	Strip string `json:"strip,omitempty"`
+	Add   string `json:"add,omitempty"`
+}
+
+func NewPrefixMapper(strip, add string) *PrefixMapper {
+	return &PrefixMapper{Strip: strip, Add: add}
+}
+
+func (m *PrefixMapper) MapKey(key string) string {
+	return m.Add + strings.TrimPrefix(key, m.Strip)
+}
+
+func (m *PrefixMapper) UnmapKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, m.Add) {
+		return "", false
+	}
+	return m.Strip + strings.TrimPrefix(key, m.Add), true
+}
+
+// PreservesOrder holds only without Strip: stripping reorders keys that had
+// the prefix against those that did not.
+func (m *PrefixMapper) PreservesOrder() bool {
+	return len(m.Strip) == 0
+}
+
+func (m *PrefixMapper) TargetPrefix() string {
+	return m.Add
+}
+
+// RegexMapper rewrites keys matching Pattern with Replacement (regexp
+// ReplaceAllString syntax, e.g. "$1"); keys that do not match are unchanged.
+type RegexMapper struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func NewRegexMapper(pattern, replacement string) (*RegexMapper, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key rewrite pattern %q: %v", pattern, err)
+	}
+	return &RegexMapper{Pattern: re, Replacement: replacement}, nil
+}
+
+func (m *RegexMapper) MapKey(key string) string {
+	return m.Pattern.ReplaceAllString(key, m.Replacement)
+}
+
+// WithKeyMapper sets how source keys are rewritten on the target; it takes
+// precedence over UseSourceAsPrefixOnTarget.
+func (mgr *MigrationMgrStruct) WithKeyMapper(mapper KeyMapper) *MigrationMgrStruct {
+	mgr.KeyMapper = mapper
+	return mgr
+}
+
+func (mgr *MigrationMgrStruct) keyMapper() KeyMapper {
+	return resolveKeyMapper(mgr.KeyMapper, mgr.UseSourceAsPrefixOnTarget, mgr.SourceS3.Bucket)
+}
+
+// targetKey is the key the source object key is migrated to.
+func (mgr *MigrationMgrStruct) targetKey(key string) string {
+	if m := mgr.keyMapper(); m != nil {
+		return m.MapKey(key)
+	}
+	return key
+}
+
+// resolveKeyMapper expresses the legacy UseSourceAsPrefixOnTarget switch as a
+// PrefixMapper so there is a single mapping path.
+func resolveKeyMapper(mapper KeyMapper, useSourceAsPrefix bool, sourceBucket string) KeyMapper {
+	if mapper != nil {
+		return mapper
+	}
+	if useSourceAsPrefix {
+		return NewPrefixMapper("", sourceBucket+"/")
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package alfredo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPrefixMapper(t *testing.T) {
+	m := NewPrefixMapper("old/", "new/")
+	assert.Equal(t, "new/a/b", m.MapKey("old/a/b"))
+	assert.Equal(t, "new/other", m.MapKey("other"))
+	k, ok := m.UnmapKey("new/a/b")
+	assert.True(t, ok)
+	assert.Equal(t, "old/a/b", k)
+	_, ok = m.UnmapKey("unrelated/a")
+	assert.False(t, ok)
+	assert.False(t, m.PreservesOrder())
+	assert.True(t, NewPrefixMapper("", "x/").PreservesOrder())
+}
+
+func TestRegexMapper(t *testing.T) {
+	m, err := NewRegexMapper(`^logs/(\d{4})/(.*)$`, "archive/$1/$2")
+	assert.NoError(t, err)
+	assert.Equal(t, "archive/2024/a.log", m.MapKey("logs/2024/a.log"))
+	assert.Equal(t, "other", m.MapKey("other"))
+
+	_, err = NewRegexMapper("(", "")
+	assert.Error(t, err)
+}
+
+func TestMigrationTargetKey(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	mgr := NewMigrationManager(&S3ClientSession{Bucket: "source-bucket"}, &S3ClientSession{Bucket: "target-bucket"},
+		&ProgressTracker{}, logger, logger, 100)
+	assert.Equal(t, "k", mgr.targetKey("k"))
+
+	mgr.WithUseSourceAsPrefixOnTarget(true)
+	assert.Equal(t, "source-bucket/k", mgr.targetKey("k"))
+
+	mgr.WithKeyMapper(NewPrefixMapper("", "consolidated/"))
+	assert.Equal(t, "consolidated/k", mgr.targetKey("k"))
+}
+
+func verifyDiffs(t *testing.T, srcObjs, tgtObjs []*s3.Object, opts VerifyOptions) []Diff {
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: srcObjs}, nil)
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: tgtObjs}, nil)
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+	return verifyDiffsWith(t, srcS3c, tgtS3c, opts)
+}
+
+func verifyDiffsWith(t *testing.T, srcS3c, tgtS3c *S3ClientSession, opts VerifyOptions) []Diff {
+	var buf bytes.Buffer
+	assert.NoError(t, RunVerificationWithOptions(srcS3c, tgtS3c, opts, &buf))
+	var diffs []Diff
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var d Diff
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &d))
+		diffs = append(diffs, d)
+	}
+	return diffs
+}
+
+func TestVerificationUsesKeyMapper(t *testing.T) {
+	// legacy bucket-name prefix
+	diffs := verifyDiffs(t,
+		[]*s3.Object{{Key: str("k"), Size: int64p(1)}},
+		[]*s3.Object{{Key: str("source-bucket/k"), Size: int64p(1)}, {Key: str("source-bucket/z"), Size: int64p(2)}},
+		VerifyOptions{UseSourceAsPrefixOnTarget: true})
+	assert.Equal(t, []Diff{{Type: Extra, Key: "z", TargetKey: "source-bucket/z", TargetSize: 2}}, diffs)
+
+	// a regex rewrite reorders keys, so the source is sorted by mapped key
+	m, err := NewRegexMapper(`^(a|b)/(.*)$`, "$2/$1")
+	assert.NoError(t, err)
+	diffs = verifyDiffs(t,
+		[]*s3.Object{{Key: str("a/2"), Size: int64p(1)}, {Key: str("b/1"), Size: int64p(1)}},
+		[]*s3.Object{{Key: str("1/b"), Size: int64p(1)}, {Key: str("3/c"), Size: int64p(5)}},
+		VerifyOptions{KeyMapper: m})
+	assert.Equal(t, []Diff{
+		{Type: Missing, Key: "a/2", TargetKey: "2/a", SourceSize: 1},
+		{Type: Extra, Key: "3/c", TargetSize: 5},
+	}, diffs)
+}
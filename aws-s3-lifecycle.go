@@ -0,0 +1,459 @@
+package alfredo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	LifecycleAdd    = "add"
+	LifecycleChange = "change"
+	LifecycleRemove = "remove"
+)
+
+// LifecycleTransitionSpec moves objects to StorageClass Days after creation,
+// or for noncurrent transitions, Days after they become noncurrent.
+type LifecycleTransitionSpec struct {
+	Days         int64  `json:"days" yaml:"days"`
+	StorageClass string `json:"storageClass" yaml:"storageClass"`
+}
+
+// LifecycleRuleSpec is one rule of a desired lifecycle configuration. The
+// filter criteria (prefix, tags and size bounds) must all hold for a rule to
+// apply to an object; at least one action must be set.
+type LifecycleRuleSpec struct {
+	ID       string `json:"id" yaml:"id"`
+	Disabled bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+
+	Prefix  string            `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	MinSize int64             `json:"minSize,omitempty" yaml:"minSize,omitempty"` // objects larger than this
+	MaxSize int64             `json:"maxSize,omitempty" yaml:"maxSize,omitempty"` // objects smaller than this
+
+	ExpirationDays            int64     `json:"expirationDays,omitempty" yaml:"expirationDays,omitempty"`
+	ExpirationDate            time.Time `json:"expirationDate,omitempty" yaml:"expirationDate,omitempty"`
+	ExpiredObjectDeleteMarker bool      `json:"expiredObjectDeleteMarker,omitempty" yaml:"expiredObjectDeleteMarker,omitempty"`
+	NoncurrentExpirationDays  int64     `json:"noncurrentExpirationDays,omitempty" yaml:"noncurrentExpirationDays,omitempty"`
+	// NewerNoncurrentVersions keeps that many noncurrent versions from expiring
+	NewerNoncurrentVersions int64                     `json:"newerNoncurrentVersions,omitempty" yaml:"newerNoncurrentVersions,omitempty"`
+	Transitions             []LifecycleTransitionSpec `json:"transitions,omitempty" yaml:"transitions,omitempty"`
+	NoncurrentTransitions   []LifecycleTransitionSpec `json:"noncurrentTransitions,omitempty" yaml:"noncurrentTransitions,omitempty"`
+	AbortIncompleteMPUDays  int64                     `json:"abortIncompleteMultipartUploadDays,omitempty" yaml:"abortIncompleteMultipartUploadDays,omitempty"`
+}
+
+// LifecyclePolicy is the complete lifecycle configuration a bucket should
+// have: applying it adds and changes rules to match, and removes the rules it
+// does not name.
+type LifecyclePolicy struct {
+	Rules []LifecycleRuleSpec `json:"rules" yaml:"rules"`
+}
+
+// LoadLifecyclePolicy reads a policy from a JSON file, or a YAML one when
+// the file name ends in .yaml or .yml, and validates it.
+func LoadLifecyclePolicy(path string) (*LifecyclePolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lifecycle policy %s: %v", path, err)
+	}
+	var policy LifecyclePolicy
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &policy)
+	default:
+		err = json.Unmarshal(content, &policy)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lifecycle policy %s: %v", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid lifecycle policy %s: %v", path, err)
+	}
+	return &policy, nil
+}
+
+// Validate reports the mistakes S3 would otherwise reject the whole
+// configuration for, naming the rule at fault.
+func (p *LifecyclePolicy) Validate() error {
+	seen := make(map[string]bool, len(p.Rules))
+	for i, r := range p.Rules {
+		if len(r.ID) == 0 {
+			return fmt.Errorf("rule %d has no id", i+1)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("rule id %q is used more than once", r.ID)
+		}
+		seen[r.ID] = true
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rule %q: %v", r.ID, err)
+		}
+	}
+	return nil
+}
+
+func (r LifecycleRuleSpec) validate() error {
+	if r.ExpirationDays < 0 || r.NoncurrentExpirationDays < 0 || r.NewerNoncurrentVersions < 0 || r.AbortIncompleteMPUDays < 0 || r.MinSize < 0 || r.MaxSize < 0 {
+		return errors.New("days, versions and sizes cannot be negative")
+	}
+	expirations := 0
+	for _, set := range []bool{r.ExpirationDays > 0, !r.ExpirationDate.IsZero(), r.ExpiredObjectDeleteMarker} {
+		if set {
+			expirations++
+		}
+	}
+	if expirations > 1 {
+		return errors.New("expirationDays, expirationDate and expiredObjectDeleteMarker are mutually exclusive")
+	}
+	if r.NewerNoncurrentVersions > 0 && r.NoncurrentExpirationDays == 0 {
+		return errors.New("newerNoncurrentVersions needs noncurrentExpirationDays")
+	}
+	if r.MaxSize > 0 && r.MinSize >= r.MaxSize {
+		return fmt.Errorf("minSize %d must be below maxSize %d", r.MinSize, r.MaxSize)
+	}
+	if r.ExpiredObjectDeleteMarker && (len(r.Tags) > 0 || r.MinSize > 0 || r.MaxSize > 0) {
+		return errors.New("expiredObjectDeleteMarker cannot be combined with tag or size filters")
+	}
+	for _, t := range append(append([]LifecycleTransitionSpec{}, r.Transitions...), r.NoncurrentTransitions...) {
+		if len(t.StorageClass) == 0 || t.Days < 0 {
+			return errors.New("transitions need a storage class and non-negative days")
+		}
+	}
+	if expirations == 0 && r.NoncurrentExpirationDays == 0 && len(r.Transitions) == 0 && len(r.NoncurrentTransitions) == 0 && r.AbortIncompleteMPUDays == 0 {
+		return errors.New("no action")
+	}
+	return nil
+}
+
+// Rule converts the spec to the SDK's form. A filter on anything beyond the
+// prefix, or on several tags, becomes an And of all criteria.
+func (r LifecycleRuleSpec) Rule() *s3.LifecycleRule {
+	status := s3.ExpirationStatusEnabled
+	if r.Disabled {
+		status = s3.ExpirationStatusDisabled
+	}
+	rule := &s3.LifecycleRule{ID: aws.String(r.ID), Status: aws.String(status), Filter: &s3.LifecycleRuleFilter{}}
+
+	var tags []*s3.Tag
+	for _, k := range sortedMapKeys(r.Tags) {
+		tags = append(tags, &s3.Tag{Key: aws.String(k), Value: aws.String(r.Tags[k])})
+	}
+	criteria := len(tags)
+	if len(r.Prefix) > 0 {
+		criteria++
+	}
+	if r.MinSize > 0 {
+		criteria++
+	}
+	if r.MaxSize > 0 {
+		criteria++
+	}
+	switch {
+	case criteria > 1:
+		and := &s3.LifecycleRuleAndOperator{Tags: tags}
+		if len(r.Prefix) > 0 {
+			and.Prefix = aws.String(r.Prefix)
+		}
+		if r.MinSize > 0 {
+			and.ObjectSizeGreaterThan = aws.Int64(r.MinSize)
+		}
+		if r.MaxSize > 0 {
+			and.ObjectSizeLessThan = aws.Int64(r.MaxSize)
+		}
+		rule.Filter.And = and
+	case len(tags) == 1:
+		rule.Filter.Tag = tags[0]
+	case r.MinSize > 0:
+		rule.Filter.ObjectSizeGreaterThan = aws.Int64(r.MinSize)
+	case r.MaxSize > 0:
+		rule.Filter.ObjectSizeLessThan = aws.Int64(r.MaxSize)
+	default:
+		rule.Filter.Prefix = aws.String(r.Prefix)
+	}
+
+	switch {
+	case r.ExpirationDays > 0:
+		rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(r.ExpirationDays)}
+	case !r.ExpirationDate.IsZero():
+		rule.Expiration = &s3.LifecycleExpiration{Date: aws.Time(r.ExpirationDate.UTC())}
+	case r.ExpiredObjectDeleteMarker:
+		rule.Expiration = &s3.LifecycleExpiration{ExpiredObjectDeleteMarker: aws.Bool(true)}
+	}
+	if r.NoncurrentExpirationDays > 0 {
+		rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(r.NoncurrentExpirationDays)}
+		if r.NewerNoncurrentVersions > 0 {
+			rule.NoncurrentVersionExpiration.NewerNoncurrentVersions = aws.Int64(r.NewerNoncurrentVersions)
+		}
+	}
+	for _, t := range r.Transitions {
+		rule.Transitions = append(rule.Transitions, &s3.Transition{Days: aws.Int64(t.Days), StorageClass: aws.String(t.StorageClass)})
+	}
+	for _, t := range r.NoncurrentTransitions {
+		rule.NoncurrentVersionTransitions = append(rule.NoncurrentVersionTransitions, &s3.NoncurrentVersionTransition{NoncurrentDays: aws.Int64(t.Days), StorageClass: aws.String(t.StorageClass)})
+	}
+	if r.AbortIncompleteMPUDays > 0 {
+		rule.AbortIncompleteMultipartUpload = &s3.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int64(r.AbortIncompleteMPUDays)}
+	}
+	return rule
+}
+
+// LifecycleRuleSpecFromRule is the inverse of Rule, for comparing a bucket's
+// rules with a policy. Rules using the legacy top-level prefix are read as if
+// it were in the filter.
+func LifecycleRuleSpecFromRule(rule *s3.LifecycleRule) LifecycleRuleSpec {
+	r := LifecycleRuleSpec{
+		ID:       aws.StringValue(rule.ID),
+		Disabled: aws.StringValue(rule.Status) == s3.ExpirationStatusDisabled,
+		Prefix:   aws.StringValue(rule.Prefix),
+	}
+	addTag := func(tag *s3.Tag) {
+		if r.Tags == nil {
+			r.Tags = make(map[string]string)
+		}
+		r.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	if f := rule.Filter; f != nil {
+		if f.Prefix != nil {
+			r.Prefix = *f.Prefix
+		}
+		if f.Tag != nil {
+			addTag(f.Tag)
+		}
+		r.MinSize = aws.Int64Value(f.ObjectSizeGreaterThan)
+		r.MaxSize = aws.Int64Value(f.ObjectSizeLessThan)
+		if and := f.And; and != nil {
+			r.Prefix = aws.StringValue(and.Prefix)
+			for _, tag := range and.Tags {
+				addTag(tag)
+			}
+			r.MinSize = aws.Int64Value(and.ObjectSizeGreaterThan)
+			r.MaxSize = aws.Int64Value(and.ObjectSizeLessThan)
+		}
+	}
+	if e := rule.Expiration; e != nil {
+		r.ExpirationDays = aws.Int64Value(e.Days)
+		if e.Date != nil {
+			r.ExpirationDate = e.Date.UTC()
+		}
+		r.ExpiredObjectDeleteMarker = aws.BoolValue(e.ExpiredObjectDeleteMarker)
+	}
+	if e := rule.NoncurrentVersionExpiration; e != nil {
+		r.NoncurrentExpirationDays = aws.Int64Value(e.NoncurrentDays)
+		r.NewerNoncurrentVersions = aws.Int64Value(e.NewerNoncurrentVersions)
+	}
+	for _, t := range rule.Transitions {
+		r.Transitions = append(r.Transitions, LifecycleTransitionSpec{Days: aws.Int64Value(t.Days), StorageClass: aws.StringValue(t.StorageClass)})
+	}
+	for _, t := range rule.NoncurrentVersionTransitions {
+		r.NoncurrentTransitions = append(r.NoncurrentTransitions, LifecycleTransitionSpec{Days: aws.Int64Value(t.NoncurrentDays), StorageClass: aws.StringValue(t.StorageClass)})
+	}
+	if a := rule.AbortIncompleteMultipartUpload; a != nil {
+		r.AbortIncompleteMPUDays = aws.Int64Value(a.DaysAfterInitiation)
+	}
+	return r
+}
+
+// LifecycleRuleChange is one step of a LifecyclePlan. Current is nil for an
+// added rule and Desired is nil for a removed one.
+type LifecycleRuleChange struct {
+	Action  string             `json:"action"`
+	ID      string             `json:"id"`
+	Current *LifecycleRuleSpec `json:"current,omitempty"`
+	Desired *LifecycleRuleSpec `json:"desired,omitempty"`
+}
+
+// Fields names the settings a change sets or alters, in order.
+func (c LifecycleRuleChange) Fields() []string {
+	current, desired := specFields(c.Current), specFields(c.Desired)
+	var names []string
+	for name := range desired {
+		if !reflect.DeepEqual(current[name], desired[name]) {
+			names = append(names, name)
+		}
+	}
+	for name := range current {
+		if _, ok := desired[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// specFields flattens a spec into its JSON fields, leaving out the unset ones.
+func specFields(r *LifecycleRuleSpec) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if r == nil {
+		return fields
+	}
+	b, _ := json.Marshal(r)
+	json.Unmarshal(b, &fields)
+	delete(fields, "id")
+	if r.ExpirationDate.IsZero() {
+		delete(fields, "expirationDate")
+	}
+	return fields
+}
+
+// LifecyclePlan is the difference between a bucket's lifecycle rules and a
+// LifecyclePolicy; print it to review what ApplyLifecyclePlan will do.
+type LifecyclePlan struct {
+	Bucket    string                `json:"bucket"`
+	Changes   []LifecycleRuleChange `json:"changes"`
+	Unchanged []string              `json:"unchanged,omitempty"`
+
+	policy *LifecyclePolicy
+}
+
+func (p *LifecyclePlan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// String renders the plan one rule per line, "+" for rules to add, "~" for
+// rules to change (with each altered setting), and "-" for rules to remove.
+func (p *LifecyclePlan) String() string {
+	var sb strings.Builder
+	if !p.HasChanges() {
+		fmt.Fprintf(&sb, "Lifecycle rules of bucket %s are up to date (%d rules)\n", p.Bucket, len(p.Unchanged))
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Lifecycle plan for bucket %s:\n", p.Bucket)
+	for _, c := range p.Changes {
+		current, desired := specFields(c.Current), specFields(c.Desired)
+		switch c.Action {
+		case LifecycleAdd:
+			fmt.Fprintf(&sb, "  + %s\n", c.ID)
+			for _, name := range c.Fields() {
+				fmt.Fprintf(&sb, "      %s: %s\n", name, planValue(desired[name]))
+			}
+		case LifecycleChange:
+			fmt.Fprintf(&sb, "  ~ %s\n", c.ID)
+			for _, name := range c.Fields() {
+				fmt.Fprintf(&sb, "      %s: %s -> %s\n", name, planValue(current[name]), planValue(desired[name]))
+			}
+		case LifecycleRemove:
+			fmt.Fprintf(&sb, "  - %s\n", c.ID)
+		}
+	}
+	counts := map[string]int{}
+	for _, c := range p.Changes {
+		counts[c.Action]++
+	}
+	fmt.Fprintf(&sb, "%d to add, %d to change, %d to remove, %d unchanged\n", counts[LifecycleAdd], counts[LifecycleChange], counts[LifecycleRemove], len(p.Unchanged))
+	return sb.String()
+}
+
+func planValue(v interface{}) string {
+	if v == nil {
+		return "(unset)"
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// bucketLifecycleSpecs returns the bucket's current rules as specs; a bucket
+// without a lifecycle configuration has none.
+func (s3c *S3ClientSession) bucketLifecycleSpecs() ([]LifecycleRuleSpec, error) {
+	rules, err := s3c.GetBucketLifecycleRules()
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	specs := make([]LifecycleRuleSpec, 0, len(rules))
+	for _, rule := range rules {
+		specs = append(specs, LifecycleRuleSpecFromRule(rule))
+	}
+	return specs, nil
+}
+
+// PlanLifecyclePolicy compares the bucket's lifecycle rules, matched by ID,
+// with policy. Changes follow the policy's rule order, removals last.
+func (s3c *S3ClientSession) PlanLifecyclePolicy(policy *LifecyclePolicy) (*LifecyclePlan, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	current, err := s3c.bucketLifecycleSpecs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle rules of bucket %s: %v", s3c.Bucket, err)
+	}
+	byID := make(map[string]*LifecycleRuleSpec, len(current))
+	for i := range current {
+		byID[current[i].ID] = &current[i]
+	}
+
+	plan := &LifecyclePlan{Bucket: s3c.Bucket, policy: policy}
+	wanted := make(map[string]bool, len(policy.Rules))
+	for i := range policy.Rules {
+		desired := &policy.Rules[i]
+		wanted[desired.ID] = true
+		have := byID[desired.ID]
+		change := LifecycleRuleChange{ID: desired.ID, Current: have, Desired: desired}
+		switch {
+		case have == nil:
+			change.Action = LifecycleAdd
+		case len(change.Fields()) > 0:
+			change.Action = LifecycleChange
+		default:
+			plan.Unchanged = append(plan.Unchanged, desired.ID)
+			continue
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	for i := range current {
+		if !wanted[current[i].ID] {
+			plan.Changes = append(plan.Changes, LifecycleRuleChange{Action: LifecycleRemove, ID: current[i].ID, Current: &current[i]})
+		}
+	}
+	return plan, nil
+}
+
+// ApplyLifecyclePlan puts the planned policy on the bucket through
+// PutLifecycleRulesCustomHeaders, replacing the whole configuration; a policy
+// without rules deletes it. A plan without changes does nothing.
+func (s3c *S3ClientSession) ApplyLifecyclePlan(plan *LifecyclePlan, customHeaders map[string]string) error {
+	if !plan.HasChanges() {
+		return nil
+	}
+	if plan.policy == nil {
+		return errors.New("lifecycle plan was not made by PlanLifecyclePolicy")
+	}
+	if plan.Bucket != s3c.Bucket {
+		return fmt.Errorf("lifecycle plan is for bucket %s, not %s", plan.Bucket, s3c.Bucket)
+	}
+	if len(plan.policy.Rules) == 0 {
+		if err := s3c.DeleteEntireBucketLifeCyclePolicy(); err != nil {
+			return fmt.Errorf("failed to delete lifecycle configuration of bucket %s: %v", s3c.Bucket, err)
+		}
+		return nil
+	}
+	rules := make([]*s3.LifecycleRule, 0, len(plan.policy.Rules))
+	for _, r := range plan.policy.Rules {
+		rules = append(rules, r.Rule())
+	}
+	if err := s3c.PutLifecycleRulesCustomHeaders(rules, customHeaders); err != nil {
+		return fmt.Errorf("failed to apply lifecycle policy to bucket %s: %v", s3c.Bucket, err)
+	}
+	return nil
+}
+
+func sortedMapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
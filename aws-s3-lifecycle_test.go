@@ -0,0 +1,128 @@
+package alfredo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+)
+
+const lifecyclePolicyYAML = `
+rules:
+  - id: expire-logs
+    prefix: logs/
+    expirationDays: 30
+    noncurrentExpirationDays: 7
+    newerNoncurrentVersions: 2
+  - id: archive-large
+    tags:
+      class: archive
+    minSize: 1048576
+    transitions:
+      - days: 90
+        storageClass: GLACIER
+  - id: mpu
+    abortIncompleteMultipartUploadDays: 3
+`
+
+func TestLoadLifecyclePolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(lifecyclePolicyYAML), 0644))
+	policy, err := LoadLifecyclePolicy(path)
+	if assert.NoError(t, err) && assert.Len(t, policy.Rules, 3) {
+		assert.Equal(t, int64(2), policy.Rules[0].NewerNoncurrentVersions)
+		assert.Equal(t, map[string]string{"class": "archive"}, policy.Rules[1].Tags)
+	}
+
+	path = filepath.Join(dir, "policy.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"id": "a", "expirationDays": 1}, {"id": "a", "expirationDays": 2}]}`), 0644))
+	_, err = LoadLifecyclePolicy(path)
+	assert.ErrorContains(t, err, "more than once")
+
+	for _, r := range []LifecycleRuleSpec{
+		{ID: "none"},
+		{ID: "both", ExpirationDays: 1, ExpiredObjectDeleteMarker: true},
+		{ID: "sizes", ExpirationDays: 1, MinSize: 10, MaxSize: 5},
+		{ID: "newer", NewerNoncurrentVersions: 1, ExpirationDays: 1},
+	} {
+		assert.Error(t, (&LifecyclePolicy{Rules: []LifecycleRuleSpec{r}}).Validate(), r.ID)
+	}
+}
+
+func TestLifecycleRuleRoundTrip(t *testing.T) {
+	for _, r := range []LifecycleRuleSpec{
+		{ID: "prefix", Prefix: "logs/", ExpirationDays: 30},
+		{ID: "tag", Tags: map[string]string{"a": "b"}, ExpirationDays: 1},
+		{ID: "size", MaxSize: 100, AbortIncompleteMPUDays: 1},
+		{ID: "and", Prefix: "p/", Tags: map[string]string{"a": "b", "c": "d"}, MinSize: 1, Disabled: true, NoncurrentExpirationDays: 5},
+	} {
+		assert.Equal(t, r, LifecycleRuleSpecFromRule(r.Rule()), r.ID)
+	}
+	rule := LifecycleRuleSpec{ID: "and", Prefix: "p/", MinSize: 1, ExpirationDays: 1}.Rule()
+	if assert.NotNil(t, rule.Filter.And) {
+		assert.Equal(t, "p/", aws.StringValue(rule.Filter.And.Prefix))
+	}
+}
+
+func TestLifecyclePlanAndApply(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yml")
+	assert.NoError(t, os.WriteFile(path, []byte(lifecyclePolicyYAML), 0644))
+	policy, err := LoadLifecyclePolicy(path)
+	assert.NoError(t, err)
+
+	srv := s3fake.New()
+	defer srv.Close()
+	s3c := fakeSession(t, srv, "bucket")
+	assert.NoError(t, s3c.AddLifecycleRule(&s3.LifecycleRule{
+		ID:         aws.String("expire-logs"),
+		Status:     aws.String("Enabled"),
+		Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+		Expiration: &s3.LifecycleExpiration{Days: aws.Int64(60)},
+	}))
+	assert.NoError(t, s3c.AddLifecycleRule(&s3.LifecycleRule{
+		ID:     aws.String("legacy"),
+		Status: aws.String("Enabled"),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String("")},
+		Transitions: []*s3.Transition{
+			{Days: aws.Int64(10), StorageClass: aws.String("GLACIER")},
+		},
+	}))
+
+	plan, err := s3c.PlanLifecyclePolicy(policy)
+	assert.NoError(t, err)
+	if assert.Len(t, plan.Changes, 4) {
+		assert.Equal(t, LifecycleChange, plan.Changes[0].Action)
+		assert.Equal(t, []string{"expirationDays", "newerNoncurrentVersions", "noncurrentExpirationDays"}, plan.Changes[0].Fields())
+		assert.Equal(t, LifecycleAdd, plan.Changes[1].Action)
+		assert.Equal(t, LifecycleAdd, plan.Changes[2].Action)
+		assert.Equal(t, LifecycleRemove, plan.Changes[3].Action)
+		assert.Equal(t, "legacy", plan.Changes[3].ID)
+	}
+	out := plan.String()
+	assert.Contains(t, out, "  ~ expire-logs\n      expirationDays: 60 -> 30\n")
+	assert.Contains(t, out, "  - legacy\n")
+	assert.Contains(t, out, "2 to add, 1 to change, 1 to remove, 0 unchanged")
+
+	// applied through the custom-headers path, which hand-encodes the XML
+	assert.NoError(t, s3c.ApplyLifecyclePlan(plan, map[string]string{"x-custom-policy": "test"}))
+	plan, err = s3c.PlanLifecyclePolicy(policy)
+	assert.NoError(t, err)
+	assert.False(t, plan.HasChanges(), plan.String())
+	assert.Len(t, plan.Unchanged, 3)
+
+	// an empty policy removes the configuration
+	empty := &LifecyclePolicy{}
+	plan, err = s3c.PlanLifecyclePolicy(empty)
+	assert.NoError(t, err)
+	assert.Len(t, plan.Changes, 3)
+	assert.NoError(t, s3c.ApplyLifecyclePlan(plan, nil))
+	plan, err = s3c.PlanLifecyclePolicy(empty)
+	assert.NoError(t, err)
+	assert.False(t, plan.HasChanges())
+}
@@ -0,0 +1,348 @@
+package alfredo
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// WithPreserveMetadata makes the copy functions carry system and user
+// metadata, object tags, the object ACL, and Object Lock retention/legal hold
+// across to the target instead of only the bytes.
+func (mgr *MigrationMgrStruct) WithPreserveMetadata(preserve bool) *MigrationMgrStruct {
+	mgr.PreserveMetadata = preserve
+	return mgr
+}
+
+// loadSourceTagging fetches the tags of the source object, encoded the way
+// the Tagging header of PutObject/CreateMultipartUpload expects them.
+func (mgr *MigrationMgrStruct) loadSourceTagging() error {
+	mgr.sourceTagging = ""
+	if !mgr.PreserveMetadata {
+		return nil
+	}
+	var out *s3.GetObjectTaggingOutput
+	err := mgr.retry(func() error {
+		var err error
+		mgr.sourceRequest()
+		out, err = mgr.SourceS3.Client.GetObjectTaggingWithContext(mgr.SourceS3.ctx, &s3.GetObjectTaggingInput{
+			Bucket:    aws.String(mgr.SourceS3.Bucket),
+			Key:       aws.String(mgr.SourceS3.ObjectKey),
+			VersionId: versionIdOrNil(mgr.SourceVersionId),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get source object tags: %v", err)
+	}
+	mgr.sourceTagging = encodeTagging(out.TagSet)
+	return nil
+}
+
+func encodeTagging(tags []*s3.Tag) string {
+	values := url.Values{}
+	for _, tag := range tags {
+		values.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	return values.Encode()
+}
+
+func (mgr *MigrationMgrStruct) applyMetadataToPut(input *s3.PutObjectInput) {
+	if !mgr.PreserveMetadata || mgr.SourceHead == nil {
+		return
+	}
+	h := mgr.SourceHead
+	input.ContentType = h.ContentType
+	input.CacheControl = h.CacheControl
+	input.ContentDisposition = h.ContentDisposition
+	input.ContentEncoding = h.ContentEncoding
+	input.ContentLanguage = h.ContentLanguage
+	input.Expires = parseExpires(h.Expires)
+	input.Metadata = h.Metadata
+	if len(mgr.sourceTagging) > 0 {
+		input.Tagging = aws.String(mgr.sourceTagging)
+	}
+}
+
+func (mgr *MigrationMgrStruct) applyMetadataToCreateMPU(input *s3.CreateMultipartUploadInput) {
+	if !mgr.PreserveMetadata || mgr.SourceHead == nil {
+		return
+	}
+	h := mgr.SourceHead
+	input.ContentType = h.ContentType
+	input.CacheControl = h.CacheControl
+	input.ContentDisposition = h.ContentDisposition
+	input.ContentEncoding = h.ContentEncoding
+	input.ContentLanguage = h.ContentLanguage
+	input.Expires = parseExpires(h.Expires)
+	input.Metadata = h.Metadata
+	if len(mgr.sourceTagging) > 0 {
+		input.Tagging = aws.String(mgr.sourceTagging)
+	}
+}
+
+// HeadObjectOutput carries Expires as the raw header string while the put
+// inputs want a time.
+func parseExpires(expires *string) *time.Time {
+	if expires == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC1123, *expires)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// applyObjectLock re-creates the source retention and legal hold on the
+// freshly written target version. Retention is applied in whole days, so the
+// target is never released earlier than the source.
+func (mgr *MigrationMgrStruct) applyObjectLock() error {
+	if !mgr.PreserveMetadata || mgr.SourceHead == nil {
+		return nil
+	}
+	h := mgr.SourceHead
+	if h.ObjectLockMode != nil && h.ObjectLockRetainUntilDate != nil && time.Until(*h.ObjectLockRetainUntilDate) > 0 {
+		days := int(math.Ceil(time.Until(*h.ObjectLockRetainUntilDate).Hours() / 24))
+		var err error
+		switch aws.StringValue(h.ObjectLockMode) {
+		case s3.ObjectLockRetentionModeCompliance:
+			err = mgr.TargetS3.PutObjectRetentionComplianceDays(mgr.TargetS3.ObjectKey, mgr.TargetVersionId, days)
+		default:
+			err = mgr.TargetS3.PutObjectRetentionGovernanceDays(mgr.TargetS3.ObjectKey, mgr.TargetVersionId, days)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set retention on target object: %v", err)
+		}
+	}
+	if aws.StringValue(h.ObjectLockLegalHoldStatus) == s3.ObjectLockLegalHoldStatusOn {
+		if err := mgr.TargetS3.PutObjectLegalHold(mgr.TargetS3.ObjectKey, mgr.TargetVersionId, true); err != nil {
+			return fmt.Errorf("failed to set legal hold on target object: %v", err)
+		}
+	}
+	return nil
+}
+
+// applyObjectACL re-creates the grants of the source object's ACL on the
+// freshly written target version. Grants to the source owner go to the target
+// owner, as the two buckets may belong to different accounts. An ACL that only
+// gives the owner full control is what every new object gets, so it is not
+// written again.
+func (mgr *MigrationMgrStruct) applyObjectACL() error {
+	if !mgr.PreserveMetadata {
+		return nil
+	}
+	var src *s3.GetObjectAclOutput
+	err := mgr.retry(func() error {
+		var err error
+		mgr.sourceRequest()
+		src, err = mgr.SourceS3.Client.GetObjectAclWithContext(mgr.SourceS3.ctx, &s3.GetObjectAclInput{
+			Bucket:    aws.String(mgr.SourceS3.Bucket),
+			Key:       aws.String(mgr.SourceS3.ObjectKey),
+			VersionId: versionIdOrNil(mgr.SourceVersionId),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get source object ACL: %v", err)
+	}
+	if isOwnerOnlyACL(src.Owner, src.Grants) {
+		return nil
+	}
+	var tgt *s3.GetObjectAclOutput
+	err = mgr.retry(func() error {
+		var err error
+		mgr.targetRequest()
+		tgt, err = mgr.TargetS3.Client.GetObjectAclWithContext(mgr.TargetS3.ctx, &s3.GetObjectAclInput{
+			Bucket:    aws.String(mgr.TargetS3.Bucket),
+			Key:       aws.String(mgr.TargetS3.ObjectKey),
+			VersionId: versionIdOrNil(mgr.TargetVersionId),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get target object ACL: %v", err)
+	}
+	srcOwner := ownerID(src.Owner)
+	var grants []*s3.Grant
+	for _, g := range src.Grants {
+		if g == nil || g.Grantee == nil {
+			continue
+		}
+		grantee := *g.Grantee
+		if aws.StringValue(grantee.ID) == srcOwner && tgt.Owner != nil {
+			grantee.ID, grantee.DisplayName = tgt.Owner.ID, tgt.Owner.DisplayName
+		}
+		grants = append(grants, &s3.Grant{Grantee: &grantee, Permission: g.Permission})
+	}
+	err = mgr.retry(func() error {
+		mgr.targetRequest()
+		_, err := mgr.TargetS3.Client.PutObjectAclWithContext(mgr.TargetS3.ctx, &s3.PutObjectAclInput{
+			Bucket:              aws.String(mgr.TargetS3.Bucket),
+			Key:                 aws.String(mgr.TargetS3.ObjectKey),
+			VersionId:           versionIdOrNil(mgr.TargetVersionId),
+			AccessControlPolicy: &s3.AccessControlPolicy{Owner: tgt.Owner, Grants: grants},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set ACL on target object: %v", err)
+	}
+	return nil
+}
+
+func ownerID(owner *s3.Owner) string {
+	if owner == nil {
+		return ""
+	}
+	return aws.StringValue(owner.ID)
+}
+
+// aclGrants renders grants as sorted "grantee:permission" strings. Grants to
+// owner read "owner", so the ACLs of objects owned by different accounts can
+// be compared directly.
+func aclGrants(owner *s3.Owner, grants []*s3.Grant) []string {
+	var rendered []string
+	for _, g := range grants {
+		if g == nil || g.Grantee == nil {
+			continue
+		}
+		grantee := g.Grantee
+		var who string
+		switch {
+		case len(aws.StringValue(grantee.URI)) > 0:
+			who = "uri=" + aws.StringValue(grantee.URI)
+		case len(aws.StringValue(grantee.EmailAddress)) > 0:
+			who = "email=" + aws.StringValue(grantee.EmailAddress)
+		case aws.StringValue(grantee.ID) == ownerID(owner):
+			who = "owner"
+		default:
+			who = "id=" + aws.StringValue(grantee.ID)
+		}
+		rendered = append(rendered, who+":"+aws.StringValue(g.Permission))
+	}
+	sort.Strings(rendered)
+	return rendered
+}
+
+func isOwnerOnlyACL(owner *s3.Owner, grants []*s3.Grant) bool {
+	rendered := aclGrants(owner, grants)
+	return len(rendered) == 0 || (len(rendered) == 1 && rendered[0] == "owner:"+s3.PermissionFullControl)
+}
+
+// compareObjectMetadata lists the metadata fields of tgt that do not match
+// src. A target retention that outlasts the source is accepted, as migrated
+// retention is rounded up to whole days.
+func compareObjectMetadata(src, tgt *s3.HeadObjectOutput) []string {
+	var fields []string
+	check := func(name string, a, b *string) {
+		if aws.StringValue(a) != aws.StringValue(b) {
+			fields = append(fields, name)
+		}
+	}
+	check("content_type", src.ContentType, tgt.ContentType)
+	check("cache_control", src.CacheControl, tgt.CacheControl)
+	check("content_disposition", src.ContentDisposition, tgt.ContentDisposition)
+	check("content_encoding", src.ContentEncoding, tgt.ContentEncoding)
+	check("content_language", src.ContentLanguage, tgt.ContentLanguage)
+	check("expires", src.Expires, tgt.Expires)
+	check("object_lock_mode", src.ObjectLockMode, tgt.ObjectLockMode)
+	check("legal_hold", src.ObjectLockLegalHoldStatus, tgt.ObjectLockLegalHoldStatus)
+
+	if src.ObjectLockRetainUntilDate != nil &&
+		(tgt.ObjectLockRetainUntilDate == nil || tgt.ObjectLockRetainUntilDate.Before(*src.ObjectLockRetainUntilDate)) {
+		fields = append(fields, "retain_until")
+	}
+
+	if !sameUserMetadata(src.Metadata, tgt.Metadata) {
+		fields = append(fields, "user_metadata")
+	}
+	return fields
+}
+
+func sameUserMetadata(a, b map[string]*string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	lower := make(map[string]string, len(b))
+	for k, v := range b {
+		lower[strings.ToLower(k)] = aws.StringValue(v)
+	}
+	for k, v := range a {
+		w, ok := lower[strings.ToLower(k)]
+		if !ok || w != aws.StringValue(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// objectTagging returns the tags of key encoded with their keys sorted, so two
+// tag sets can be compared directly.
+func (s3c *S3ClientSession) objectTagging(key string) (string, error) {
+	out, err := s3c.Client.GetObjectTagging(&s3.GetObjectTaggingInput{
+		Bucket: aws.String(s3c.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	return encodeTagging(out.TagSet), nil
+}
+
+// objectACL returns the grants of key as rendered by aclGrants.
+func (s3c *S3ClientSession) objectACL(key string) (string, error) {
+	out, err := s3c.Client.GetObjectAcl(&s3.GetObjectAclInput{
+		Bucket: aws.String(s3c.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(aclGrants(out.Owner, out.Grants), ","), nil
+}
+
+// metadataMismatch heads both copies of an object and reports the fields,
+// tags and ACL included, that differ between them.
+func metadataMismatch(srcs3c, tgts3c *S3ClientSession, srcKey, tgtKey string) ([]string, error) {
+	srcHead, err := srcs3c.Client.HeadObject(srcs3c.encryptHead(&s3.HeadObjectInput{Bucket: aws.String(srcs3c.Bucket), Key: aws.String(srcKey)}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to head source object %s: %v", srcKey, err)
+	}
+	tgtHead, err := tgts3c.Client.HeadObject(tgts3c.encryptHead(&s3.HeadObjectInput{Bucket: aws.String(tgts3c.Bucket), Key: aws.String(tgtKey)}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to head target object %s: %v", tgtKey, err)
+	}
+	fields := compareObjectMetadata(srcHead, tgtHead)
+
+	srcTags, err := srcs3c.objectTagging(srcKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags of source object %s: %v", srcKey, err)
+	}
+	tgtTags, err := tgts3c.objectTagging(tgtKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags of target object %s: %v", tgtKey, err)
+	}
+	if srcTags != tgtTags {
+		fields = append(fields, "tags")
+	}
+
+	srcACL, err := srcs3c.objectACL(srcKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ACL of source object %s: %v", srcKey, err)
+	}
+	tgtACL, err := tgts3c.objectACL(tgtKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ACL of target object %s: %v", tgtKey, err)
+	}
+	if srcACL != tgtACL {
+		fields = append(fields, "acl")
+	}
+	return fields, nil
+}
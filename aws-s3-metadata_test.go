@@ -0,0 +1,246 @@
+package alfredo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockS3Client) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	// a function answers each listing from its prefix and delimiter
+	if fn, ok := args.Get(0).(func(*s3.ListObjectsV2Input) *s3.ListObjectsV2Output); ok {
+		return fn(input), args.Error(1)
+	}
+	return args.Get(0).(*s3.ListObjectsV2Output), args.Error(1)
+}
+
+func (m *MockS3Client) GetObjectTagging(input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectTaggingOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetObjectTaggingWithContext(ctx context.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectTaggingOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutObjectRetention(input *s3.PutObjectRetentionInput) (*s3.PutObjectRetentionOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.PutObjectRetentionOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutObjectLegalHold(input *s3.PutObjectLegalHoldInput) (*s3.PutObjectLegalHoldOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.PutObjectLegalHoldOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetObjectAcl(input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectAclOutput), args.Error(1)
+}
+
+func (m *MockS3Client) GetObjectAclWithContext(ctx context.Context, input *s3.GetObjectAclInput, opts ...request.Option) (*s3.GetObjectAclOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetObjectAclOutput), args.Error(1)
+}
+
+func (m *MockS3Client) PutObjectAclWithContext(ctx context.Context, input *s3.PutObjectAclInput, opts ...request.Option) (*s3.PutObjectAclOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.PutObjectAclOutput), args.Error(1)
+}
+
+func ownerGrant(id string) *s3.Grant {
+	return &s3.Grant{Grantee: &s3.Grantee{Type: str(s3.TypeCanonicalUser), ID: str(id)}, Permission: str(s3.PermissionFullControl)}
+}
+
+var publicRead = &s3.Grant{Grantee: &s3.Grantee{Type: str(s3.TypeGroup), URI: str("http://acs.amazonaws.com/groups/global/AllUsers")}, Permission: str(s3.PermissionRead)}
+
+func TestCopyRegularPreservesMetadata(t *testing.T) {
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	logger := log.New(io.Discard, "", 0)
+	retainUntil := time.Now().Add(36 * time.Hour)
+
+	mockSourceS3.On("GetObjectTaggingWithContext", mock.Anything, mock.Anything).Return(&s3.GetObjectTaggingOutput{
+		TagSet: []*s3.Tag{{Key: str("team"), Value: str("storage")}, {Key: str("env"), Value: str("prod")}},
+	}, nil)
+	mockSourceS3.On("GetObjectWithContext", mock.Anything, mock.Anything).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("data"))}, nil)
+	mockTargetS3.On("PutObjectWithContext", mock.Anything, mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+		return aws.StringValue(in.ContentType) == "text/plain" &&
+			aws.StringValue(in.CacheControl) == "no-cache" &&
+			aws.StringValue(in.Metadata["Owner"]) == "alice" &&
+			aws.StringValue(in.Tagging) == "env=prod&team=storage"
+	})).Return(&s3.PutObjectOutput{VersionId: str("v9")}, nil)
+	mockTargetS3.On("PutObjectRetention", mock.MatchedBy(func(in *s3.PutObjectRetentionInput) bool {
+		return aws.StringValue(in.VersionId) == "v9" &&
+			aws.StringValue(in.Retention.Mode) == s3.ObjectLockRetentionModeCompliance &&
+			!in.Retention.RetainUntilDate.Before(retainUntil)
+	})).Return(&s3.PutObjectRetentionOutput{}, nil)
+	mockTargetS3.On("PutObjectLegalHold", mock.MatchedBy(func(in *s3.PutObjectLegalHoldInput) bool {
+		return aws.StringValue(in.VersionId) == "v9" && aws.StringValue(in.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn
+	})).Return(&s3.PutObjectLegalHoldOutput{}, nil)
+	mockSourceS3.On("GetObjectAclWithContext", mock.Anything, mock.Anything).Return(&s3.GetObjectAclOutput{
+		Owner:  &s3.Owner{ID: str("src-owner")},
+		Grants: []*s3.Grant{ownerGrant("src-owner"), publicRead},
+	}, nil)
+	mockTargetS3.On("GetObjectAclWithContext", mock.Anything, mock.Anything).Return(&s3.GetObjectAclOutput{
+		Owner:  &s3.Owner{ID: str("tgt-owner")},
+		Grants: []*s3.Grant{ownerGrant("tgt-owner")},
+	}, nil)
+	// the source owner's grant goes to the target owner
+	mockTargetS3.On("PutObjectAclWithContext", mock.Anything, mock.MatchedBy(func(in *s3.PutObjectAclInput) bool {
+		p := in.AccessControlPolicy
+		return aws.StringValue(in.VersionId) == "v9" && ownerID(p.Owner) == "tgt-owner" && len(p.Grants) == 2 &&
+			aws.StringValue(p.Grants[0].Grantee.ID) == "tgt-owner" && p.Grants[1].Grantee.URI == publicRead.Grantee.URI
+	})).Return(&s3.PutObjectAclOutput{}, nil)
+
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket"}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket"}
+	mgr := NewMigrationManager(srcS3c, tgtS3c, &ProgressTracker{}, logger, logger, 100).WithPreserveMetadata(true)
+	mgr.SourceS3.ObjectKey = "k"
+	mgr.TargetS3.ObjectKey = "k"
+	mgr.SourceHead = &s3.HeadObjectOutput{
+		ContentLength:             aws.Int64(4),
+		ContentType:               aws.String("text/plain"),
+		CacheControl:              aws.String("no-cache"),
+		Metadata:                  map[string]*string{"Owner": aws.String("alice")},
+		ObjectLockMode:            aws.String(s3.ObjectLockRetentionModeCompliance),
+		ObjectLockRetainUntilDate: aws.Time(retainUntil),
+		ObjectLockLegalHoldStatus: aws.String(s3.ObjectLockLegalHoldStatusOn),
+	}
+
+	assert.NoError(t, mgr.CopyObjectBetweenBucketsRegular())
+	assert.Equal(t, "v9", mgr.TargetVersionId)
+	mockSourceS3.AssertExpectations(t)
+	mockTargetS3.AssertExpectations(t)
+}
+
+func TestCompareObjectMetadata(t *testing.T) {
+	until := time.Now().Add(time.Hour)
+	src := &s3.HeadObjectOutput{
+		ContentType:               aws.String("text/plain"),
+		Metadata:                  map[string]*string{"Owner": aws.String("alice")},
+		ObjectLockRetainUntilDate: aws.Time(until),
+	}
+	tgt := &s3.HeadObjectOutput{
+		ContentType:               aws.String("text/plain"),
+		Metadata:                  map[string]*string{"owner": aws.String("alice")},
+		ObjectLockRetainUntilDate: aws.Time(until.Add(24 * time.Hour)),
+	}
+	assert.Empty(t, compareObjectMetadata(src, tgt))
+
+	tgt.ContentType = aws.String("application/octet-stream")
+	tgt.Metadata = nil
+	tgt.ObjectLockRetainUntilDate = aws.Time(until.Add(-time.Minute))
+	assert.Equal(t, []string{"content_type", "retain_until", "user_metadata"}, compareObjectMetadata(src, tgt))
+}
+
+func TestACLGrants(t *testing.T) {
+	src := aclGrants(&s3.Owner{ID: str("a")}, []*s3.Grant{publicRead, ownerGrant("a")})
+	tgt := aclGrants(&s3.Owner{ID: str("b")}, []*s3.Grant{ownerGrant("b"), publicRead})
+	assert.Equal(t, src, tgt)
+	assert.Equal(t, "owner:FULL_CONTROL", src[0])
+	assert.True(t, isOwnerOnlyACL(&s3.Owner{ID: str("a")}, []*s3.Grant{ownerGrant("a")}))
+	assert.False(t, isOwnerOnlyACL(&s3.Owner{ID: str("a")}, []*s3.Grant{ownerGrant("b")}))
+	assert.False(t, isOwnerOnlyACL(&s3.Owner{ID: str("a")}, []*s3.Grant{ownerGrant("a"), publicRead}))
+}
+
+func TestVerificationFlagsMetadataMismatch(t *testing.T) {
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	listing := &s3.ListObjectsV2Output{Contents: []*s3.Object{{Key: str("k"), Size: int64p(4)}}}
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(listing, nil)
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(listing, nil)
+	mockSourceS3.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ContentType: aws.String("text/plain")}, nil)
+	mockTargetS3.On("HeadObject", mock.Anything).Return(&s3.HeadObjectOutput{ContentType: aws.String("binary/octet-stream")}, nil)
+	mockSourceS3.On("GetObjectTagging", mock.Anything).Return(&s3.GetObjectTaggingOutput{TagSet: []*s3.Tag{{Key: str("a"), Value: str("b")}}}, nil)
+	mockTargetS3.On("GetObjectTagging", mock.Anything).Return(&s3.GetObjectTaggingOutput{}, nil)
+	mockSourceS3.On("GetObjectAcl", mock.Anything).Return(&s3.GetObjectAclOutput{
+		Owner:  &s3.Owner{ID: str("src-owner")},
+		Grants: []*s3.Grant{ownerGrant("src-owner"), publicRead},
+	}, nil)
+	mockTargetS3.On("GetObjectAcl", mock.Anything).Return(&s3.GetObjectAclOutput{
+		Owner:  &s3.Owner{ID: str("tgt-owner")},
+		Grants: []*s3.Grant{ownerGrant("tgt-owner")},
+	}, nil)
+
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+
+	var buf bytes.Buffer
+	assert.NoError(t, RunVerification(srcS3c, tgtS3c, false, &buf))
+	assert.Empty(t, buf.String())
+
+	assert.NoError(t, RunVerificationWithOptions(srcS3c, tgtS3c, VerifyOptions{CompareMetadata: true}, &buf))
+	var d Diff
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &d))
+	assert.Equal(t, MetadataMismatch, d.Type)
+	assert.Equal(t, "k", d.Key)
+	assert.Equal(t, []string{"content_type", "tags", "acl"}, d.Fields)
+}
+
+func TestPreserveMetadataCopiesACL(t *testing.T) {
+	srcSrv, tgtSrv := s3fake.New(), s3fake.New()
+	defer srcSrv.Close()
+	defer tgtSrv.Close()
+	src, tgt := fakeSession(t, srcSrv, "source"), fakeSession(t, tgtSrv, "target")
+	_, err := src.Client.PutObject(&s3.PutObjectInput{Bucket: aws.String("source"), Key: aws.String("k"), Body: strings.NewReader("data"), ACL: aws.String(s3.ObjectCannedACLPublicRead)})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger := log.New(io.Discard, "", 0)
+	mgr := NewMigrationManager(src, tgt, &ProgressTracker{}, logger, logger, 100).WithPreserveMetadata(true)
+	mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey = "k", "k"
+	mgr.SourceHead, err = src.Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("source"), Key: aws.String("k")})
+	assert.NoError(t, err)
+	assert.NoError(t, mgr.CopyObjectBetweenBucketsRegular())
+
+	acl, err := tgt.Client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String("target"), Key: aws.String("k")})
+	if assert.NoError(t, err) && assert.Len(t, acl.Grants, 2) {
+		assert.Equal(t, s3.PermissionRead, aws.StringValue(acl.Grants[1].Permission))
+	}
+	assert.NoError(t, RunVerificationWithOptions(src, tgt, VerifyOptions{CompareMetadata: true}, &buf))
+	assert.Empty(t, buf.String())
+
+	_, err = tgt.Client.PutObjectAcl(&s3.PutObjectAclInput{Bucket: aws.String("target"), Key: aws.String("k"), ACL: aws.String(s3.ObjectCannedACLPrivate)})
+	assert.NoError(t, err)
+	assert.NoError(t, RunVerificationWithOptions(src, tgt, VerifyOptions{CompareMetadata: true}, &buf))
+	assert.Contains(t, buf.String(), `"acl"`)
+}
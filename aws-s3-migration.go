@@ -27,7 +27,20 @@ type MigrationMgrStruct struct {
 	WorkerPool                chan struct{}
 	SuccessLog                *log.Logger
 	FailLog                   *log.Logger
-	UseSourceAsPrefixOnTarget bool // if true, use source bucket name as prefix on target bucket
+	UseSourceAsPrefixOnTarget bool                 // if true, use source bucket name as prefix on target bucket
+	Checkpoint                *MigrationCheckpoint // if set, MigrationLoop resumes from and persists to it
+	SourceVersionId           string               // if set, copy this version of the source object instead of the latest
+	TargetVersionId           string               // version id assigned by the target to the last copy
+	PreserveMetadata          bool                 // if true, copy metadata, tags, ACL and object lock settings as well
+	Filter                    *ObjectFilter        // if set, only matching objects are migrated
+	Throttle                  *TransferThrottle    // if set, paces requests and bandwidth on each side
+	KeyMapper                 KeyMapper            // if set, rewrites source keys into target keys
+	Retry                     *RetryPolicy         // retry policy for every S3 call; see WithRetryPolicy
+	Journal                   *ResultJournal       // if set, every CopyResult is appended to it
+	sourceTagging             string
+	serverCopy                *serverCopyState
+	copyMethod                string // how the last MigrateObject handled the object
+	targetETag                string // ETag the target reported for the last copy
 }
 
 func (mgr *MigrationMgrStruct) Lock() {
@@ -53,6 +66,14 @@ func (mgr *MigrationMgrStruct) DeepCopy() *MigrationMgrStruct {
 	newMgr.SuccessLog = mgr.SuccessLog
 	newMgr.FailLog = mgr.FailLog
 	newMgr.UseSourceAsPrefixOnTarget = mgr.UseSourceAsPrefixOnTarget
+	newMgr.Checkpoint = mgr.Checkpoint
+	newMgr.PreserveMetadata = mgr.PreserveMetadata
+	newMgr.Filter = mgr.Filter
+	newMgr.KeyMapper = mgr.KeyMapper
+	newMgr.Throttle = mgr.Throttle
+	newMgr.Retry = mgr.Retry
+	newMgr.Journal = mgr.Journal
+	newMgr.serverCopy = mgr.serverCopy
 	return &newMgr
 }
 
@@ -67,14 +88,16 @@ func NewMigrationManager(sourceS3 *S3ClientSession, targetS3 *S3ClientSession, p
 
 	progress.FailedObjects = make(map[string]error)
 
-	return &MigrationMgrStruct{
+	mgr := &MigrationMgrStruct{
 		SourceS3:   sourceS3,
 		TargetS3:   targetS3,
 		Progress:   progress,
 		SuccessLog: sucessLog,
 		FailLog:    failLog,
 		WorkerPool: make(chan struct{}, sourceS3.GetConcurrency()),
+		serverCopy: &serverCopyState{},
 	}
+	return mgr.WithRetryPolicy(sourceS3.RetryPolicy)
 }
 
 func (mgr *MigrationMgrStruct) WithUseSourceAsPrefixOnTarget(usePrefix bool) *MigrationMgrStruct {
@@ -82,7 +105,31 @@ func (mgr *MigrationMgrStruct) WithUseSourceAsPrefixOnTarget(usePrefix bool) *Mi
 	return mgr
 }
 
+// WithCheckpoint resumes the migration from cp (continuation token, counters
+// and failed keys) and has MigrationLoop persist it after every completed page.
+func (mgr *MigrationMgrStruct) WithCheckpoint(cp *MigrationCheckpoint) *MigrationMgrStruct {
+	mgr.Checkpoint = cp
+	if cp != nil {
+		cp.seed(mgr.Progress)
+		mgr.SourceS3.ContinuationToken = cp.ContinuationToken
+		if cp.PagesCompleted > 0 {
+			log.Printf("Resuming migration from checkpoint %s after %d pages (%d objects)\n", cp.GetPath(), cp.PagesCompleted, cp.TotalObjects)
+		}
+	}
+	return mgr
+}
+
 func (mgr *MigrationMgrStruct) MigrationLoop(wg *sync.WaitGroup, ResultsChan *chan CopyResult) error {
+	if mgr.Checkpoint != nil {
+		if err := mgr.Checkpoint.checkBuckets(mgr.SourceS3.Bucket, mgr.TargetS3.Bucket); err != nil {
+			return fmt.Errorf("MigrationLoop:: %v", err)
+		}
+		if mgr.Checkpoint.IsComplete() {
+			log.Printf("MigrationLoop:: checkpoint %s is already complete, nothing to list\n", mgr.Checkpoint.GetPath())
+			mgr.output = nil
+			return nil
+		}
+	}
 	// Create input with pagination token
 	input := &s3.ListObjectsV2Input{
 		Bucket:            aws.String(mgr.SourceS3.Bucket),
@@ -90,22 +137,33 @@ func (mgr *MigrationMgrStruct) MigrationLoop(wg *sync.WaitGroup, ResultsChan *ch
 		ContinuationToken: mgr.SourceS3.ContinuationToken,
 	}
 	// Get one page of results
-	var err error
-	mgr.output, err = mgr.SourceS3.Client.ListObjectsV2WithContext(mgr.SourceS3.ctx, input)
+	err := mgr.retry(func() error {
+		var err error
+		mgr.sourceRequest()
+		mgr.output, err = mgr.SourceS3.Client.ListObjectsV2WithContext(mgr.SourceS3.ctx, input)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("MigrationLoop:: failed to list objects: %v", err)
 	}
 
 	log.Printf("found %d objects in bucket %s, in this page\n", len(mgr.output.Contents), mgr.SourceS3.Bucket)
 
+	// S3 only echoes the continuation token of pages after the first
 	if mgr.output.ContinuationToken != nil {
 		log.Printf("NextContinuationToken: %s\n", *mgr.output.ContinuationToken)
 	} else {
-		log.Printf("MigrationLoop:: NextContinuationToken is nil\n")
-		panic("")
+		log.Printf("MigrationLoop:: listing the first page\n")
 	}
 
+	page := mgr.Checkpoint.beginPage(mgr.output.NextContinuationToken, mgr.IsDone(), len(mgr.output.Contents))
+
 	for _, obj := range mgr.output.Contents {
+		if !mgr.Filter.Match(*obj.Key, *obj.Size, aws.TimeValue(obj.LastModified), aws.StringValue(obj.StorageClass)) {
+			mgr.countFiltered(*obj.Size)
+			mgr.Checkpoint.recordFiltered(page, *obj.Size)
+			continue
+		}
 		atomic.AddInt64(&mgr.Progress.TotalObjects, 1)
 		atomic.AddInt64(&mgr.Progress.TotalBytes, *obj.Size)
 
@@ -116,16 +174,13 @@ func (mgr *MigrationMgrStruct) MigrationLoop(wg *sync.WaitGroup, ResultsChan *ch
 		newMgr := mgr.DeepCopy()
 		mgr.Unlock()
 		newMgr.SourceS3.ObjectKey = key
-		newMgr.TargetS3.ObjectKey = key
-		if mgr.UseSourceAsPrefixOnTarget {
-			newMgr.TargetS3.ObjectKey = mgr.SourceS3.Bucket + "/" + key
-		}
+		newMgr.TargetS3.ObjectKey = mgr.targetKey(key)
 		wg.Add(1)
 		go func(innerMgr *MigrationMgrStruct, objectSize int64) {
 			defer wg.Done()
 
-			innerMgr.WorkerPool <- struct{}{}
-			defer func() { <-mgr.WorkerPool }()
+			mgr.acquireWorker()
+			defer mgr.releaseWorker()
 
 			startTime := time.Now()
 			// err := sourceS3.CopyObjectBetweenBuckets(
@@ -155,15 +210,9 @@ func (mgr *MigrationMgrStruct) MigrationLoop(wg *sync.WaitGroup, ResultsChan *ch
 			// if err != nil {
 			// 	log.Printf("\tWith error=: %v", err)
 			// }
-			result := CopyResult{
-				SourceKey:   innerMgr.SourceS3.ObjectKey,
-				TargetKey:   innerMgr.TargetS3.ObjectKey,
-				Success:     err == nil,
-				Error:       err,
-				Duration:    time.Since(startTime),
-				BytesCopied: objectSize,
-				WasSkipped:  innerMgr.TargetS3.WasSkipped,
-			}
+			result := innerMgr.copyResult(err, time.Since(startTime), objectSize)
+			innerMgr.Checkpoint.record(page, result)
+			innerMgr.journalResult(result)
 			if result.Success {
 				if !result.WasSkipped {
 					VerbosePrintf("Uploaded object to s3://%s/%s", innerMgr.TargetS3.Bucket, result.SourceKey)
@@ -211,9 +260,13 @@ func (mgr *MigrationMgrStruct) MigrationLoop(wg *sync.WaitGroup, ResultsChan *ch
 // }
 
 func ParseKeyList(key string) (string, int64) {
-	// key := "key1|100.0"
-	name := strings.Split(key, "|")[0]
-	sizeFloat, err := strconv.ParseFloat(strings.Split(key, "|")[1], 64)
+	// key := "key1|100.0"; the size follows the last '|' so keys may contain one
+	i := strings.LastIndex(key, "|")
+	if i < 0 {
+		log.Fatalf("failed to parse size: no size in %q", key)
+	}
+	name := key[:i]
+	sizeFloat, err := strconv.ParseFloat(key[i+1:], 64)
 	if err != nil {
 		log.Fatalf("failed to parse size: %v", err)
 	}
@@ -249,6 +302,10 @@ func (mgr *MigrationMgrStruct) MigrationBatch(keys []string, wg *sync.WaitGroup,
 	for i := 0; i < len(keys); i++ {
 		key, size := ParseKeyList(keys[i])
 		//fmt.Println("MigrationBatch::workking on key=", key, " i=", i)
+		if !mgr.Filter.MatchKeyAndSize(key, size) {
+			mgr.countFiltered(size)
+			continue
+		}
 		atomic.AddInt64(&mgr.Progress.TotalObjects, 1)
 		atomic.AddInt64(&mgr.Progress.TotalBytes, size)
 
@@ -256,11 +313,7 @@ func (mgr *MigrationMgrStruct) MigrationBatch(keys []string, wg *sync.WaitGroup,
 		newMgr := mgr.DeepCopy()
 		mgr.Unlock()
 		newMgr.SourceS3.ObjectKey = key
-		newMgr.TargetS3.ObjectKey = key
-
-		if mgr.UseSourceAsPrefixOnTarget {
-			newMgr.TargetS3.ObjectKey = mgr.SourceS3.Bucket + "/" + key
-		}
+		newMgr.TargetS3.ObjectKey = mgr.targetKey(key)
 
 
 		//fmt.Println("MigrationBatch::(launch go task) workking on key=", key, " i=", i)
@@ -268,8 +321,19 @@ func (mgr *MigrationMgrStruct) MigrationBatch(keys []string, wg *sync.WaitGroup,
 		go func(innerMgr *MigrationMgrStruct, objectSize int64) {
 			defer wg.Done()
 
-			mgr.WorkerPool <- struct{}{}
-			defer func() { <-mgr.WorkerPool }()
+			mgr.acquireWorker()
+			defer mgr.releaseWorker()
+
+			if innerMgr.Filter.NeedsObjectDetails() {
+				include, err := innerMgr.matchesFilterDetails(objectSize)
+				if err == nil && !include {
+					atomic.AddInt64(&mgr.Progress.TotalObjects, -1)
+					atomic.AddInt64(&mgr.Progress.TotalBytes, -objectSize)
+					mgr.countFiltered(objectSize)
+					return
+				}
+				// on error fall through; MigrateObject will surface it
+			}
 
 			startTime := time.Now()
 			// err := sourceS3.CopyObjectBetweenBuckets(
@@ -304,16 +368,8 @@ func (mgr *MigrationMgrStruct) MigrationBatch(keys []string, wg *sync.WaitGroup,
 			} else {
 				log.Printf("\terror = %v", err)
 			}
-			result := CopyResult{
-				SourceKey:   innerMgr.SourceS3.ObjectKey,
-				TargetKey:   innerMgr.TargetS3.ObjectKey,
-				Bucket:      innerMgr.SourceS3.Bucket,
-				Success:     err == nil,
-				Error:       err,
-				Duration:    time.Since(startTime),
-				BytesCopied: objectSize,
-				WasSkipped:  innerMgr.TargetS3.WasSkipped,
-			}
+			result := innerMgr.copyResult(err, time.Since(startTime), objectSize)
+			innerMgr.journalResult(result)
 
 			if result.Success {
 				// if !result.WasSkipped {
@@ -364,39 +420,37 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsMPU() error {
 	VerbosePrintf("BEGIN CopyObjectBetweenBucketsMPU(%s, %s)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey)
 	VerbosePrintf("(ALIVE! 1) CopyObjectBetweenBucketsMPU(...%s ==> %s)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey)
 	if len(mgr.TargetS3.ObjectKey) == 0 {
-		mgr.TargetS3.ObjectKey = mgr.SourceS3.ObjectKey
-		if mgr.UseSourceAsPrefixOnTarget {
-			mgr.TargetS3.ObjectKey = mgr.SourceS3.Bucket + "/" + mgr.SourceS3.ObjectKey
-		}
+		mgr.TargetS3.ObjectKey = mgr.targetKey(mgr.SourceS3.ObjectKey)
 	}
 	// Get source object details
 	// For large files, use multipart upload with streaming
 	log.Printf("Creating MPU for s3://%s/%s", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey)
-	createOutput, err := mgr.TargetS3.Client.CreateMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.CreateMultipartUploadInput{
+	if err := mgr.loadSourceTagging(); err != nil {
+		return err
+	}
+	createInput := mgr.TargetS3.encryptCreateMPU(&s3.CreateMultipartUploadInput{
 		Bucket: aws.String(mgr.TargetS3.Bucket),
 		Key:    aws.String(mgr.TargetS3.ObjectKey),
 	})
+	mgr.applyMetadataToCreateMPU(createInput)
+	var createOutput *s3.CreateMultipartUploadOutput
+	err := mgr.retry(func() error {
+		var err error
+		mgr.targetRequest()
+		createOutput, err = mgr.TargetS3.Client.CreateMultipartUploadWithContext(mgr.TargetS3.ctx, createInput)
+		return err
+	})
 	if err != nil {
 		VerbosePrintf("(DIE! 1) CopyObjectBetweenBucketsMPU(...%s ==> %s)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey)
 		return fmt.Errorf("failed to create multipart upload: %v", err)
 	}
 
 	// partSize := CalculatePartSize(*headOutputSrc.ContentLength)
-	if mgr.SourceHead.ContentLength == nil {
+	objectSize, partSize, partsCount, err := mgr.sourcePartLayout()
+	if err != nil {
 		VerbosePrintf("(DIE! 2) CopyObjectBetweenBucketsMPU(...%s ==> %s)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey)
-		return fmt.Errorf("source object does not have a content length")
-	}
-
-	objectSize := *mgr.SourceHead.ContentLength
-	var partsCount int64
-	if mgr.SourceHead.PartsCount == nil {
-		log.Printf("!! Source object (s3://%s/%s) missing partsCount in header", mgr.SourceS3.Bucket, mgr.SourceS3.ObjectKey)
-		partsCount = CalculateTotalParts(objectSize, CalculatePartSize(objectSize))
-	} else {
-		partsCount = *mgr.SourceHead.PartsCount
+		return err
 	}
-	partSize := (objectSize + partsCount - 1) / partsCount
-	partSize = ((partSize + 1048575) / 1048576) * 1048576 // Round up to nearest MB
 
 	//partSize := *log.Printf("Using partsize: %s", HumanReadableStorageCapacity(partSize))
 	//totalParts := CalculateTotalParts(*headOutputSrc.ContentLength, partSize)
@@ -433,39 +487,47 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsMPU() error {
 					endByte = objectSize - 1
 				}
 
-				// Get the part from source
-				getPartOutput, err := mgr.SourceS3.Client.GetObjectWithContext(mgr.SourceS3.ctx, &s3.GetObjectInput{
-					Bucket: aws.String(mgr.SourceS3.Bucket),
-					Key:    aws.String(mgr.SourceS3.ObjectKey),
-					Range:  aws.String(fmt.Sprintf("bytes=%d-%d", startByte, endByte)),
+				// Get the part from source; a body cut short is retried like a failed GET
+				var body []byte
+				err := mgr.retry(func() error {
+					mgr.sourceRequest()
+					getPartOutput, err := mgr.SourceS3.Client.GetObjectWithContext(mgr.SourceS3.ctx, mgr.SourceS3.encryptGet(&s3.GetObjectInput{
+						Bucket:    aws.String(mgr.SourceS3.Bucket),
+						Key:       aws.String(mgr.SourceS3.ObjectKey),
+						Range:     aws.String(fmt.Sprintf("bytes=%d-%d", startByte, endByte)),
+						VersionId: versionIdOrNil(mgr.SourceVersionId),
+					}))
+					if err != nil {
+						return err
+					}
+					defer getPartOutput.Body.Close()
+					body, err = io.ReadAll(mgr.sourceReader(getPartOutput.Body))
+					return err
 				})
 				if err != nil {
 					VerbosePrintf("(DIE! -- in part loop) CopyObjectBetweenBucketsMPU(...%s ==> %s; worker=%d, part=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, i, partNumber)
 					errorsChan <- fmt.Errorf("failed to get part %d: %v", partNumber, err)
 					return
 				}
-				body, err := io.ReadAll(getPartOutput.Body)
-				if err != nil {
-					VerbosePrintf("(DIE! -- attempting to read getpartoutput) CopyObjectBetweenBucketsMPU(...%s ==> %s; worker=%d, part=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, i, partNumber)
-					return
-				}
-				defer getPartOutput.Body.Close()
-
-				// Create an io.ReadSeeker from the byte slice
-				readSeeker := bytes.NewReader(body)
 
 				// Upload the part
 				log.Printf("Uploading part of MPU for s3://%s/%s part #: %d of %d", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey, partNumber, partsCount)
 				VerbosePrintf("(ALIVE! right before uploadpart) CopyObjectBetweenBucketsMPU(...%s ==> %s; worker=%d, part=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, i, partNumber)
 
-				uploadOutput, err := mgr.TargetS3.Client.UploadPartWithContext(mgr.TargetS3.ctx, &s3.UploadPartInput{
-					Bucket:     aws.String(mgr.TargetS3.Bucket),
-					Key:        aws.String(mgr.TargetS3.ObjectKey),
-					PartNumber: aws.Int64(partNumber),
-					UploadId:   createOutput.UploadId,
-					Body:       readSeeker,
+				var uploadOutput *s3.UploadPartOutput
+				err = mgr.retry(func() error {
+					var err error
+					mgr.targetBytes(int64(len(body)))
+					mgr.targetRequest()
+					uploadOutput, err = mgr.TargetS3.Client.UploadPartWithContext(mgr.TargetS3.ctx, mgr.TargetS3.encryptUploadPart(&s3.UploadPartInput{
+						Bucket:     aws.String(mgr.TargetS3.Bucket),
+						Key:        aws.String(mgr.TargetS3.ObjectKey),
+						PartNumber: aws.Int64(partNumber),
+						UploadId:   createOutput.UploadId,
+						Body:       bytes.NewReader(body),
+					}))
+					return err
 				})
-				getPartOutput.Body.Close()
 
 				if err != nil {
 					VerbosePrintf("(DIE! -- in failing to upload part) CopyObjectBetweenBucketsMPU(...%s ==> %s; worker=%d, part=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, i, partNumber)
@@ -496,10 +558,14 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsMPU() error {
 		// Abort multipart upload
 		log.Printf("Aborting MPU for s3://%s/%s due to error: %s", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey, err.Error())
 
-		_, abortErr := mgr.TargetS3.Client.AbortMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.AbortMultipartUploadInput{
-			Bucket:   aws.String(mgr.TargetS3.Bucket),
-			Key:      aws.String(mgr.TargetS3.ObjectKey),
-			UploadId: createOutput.UploadId,
+		abortErr := mgr.retry(func() error {
+			mgr.targetRequest()
+			_, err := mgr.TargetS3.Client.AbortMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(mgr.TargetS3.Bucket),
+				Key:      aws.String(mgr.TargetS3.ObjectKey),
+				UploadId: createOutput.UploadId,
+			})
+			return err
 		})
 		if abortErr != nil {
 			log.Printf("WARNING: failed to abort multipart upload: %v (original error: %v)", abortErr, err)
@@ -545,15 +611,24 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsMPU() error {
 	} else {
 
 		// Complete multipart upload
-		_, err = mgr.TargetS3.Client.CompleteMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.CompleteMultipartUploadInput{
-			Bucket:   aws.String(mgr.TargetS3.Bucket),
-			Key:      aws.String(mgr.TargetS3.ObjectKey),
-			UploadId: createOutput.UploadId,
-			MultipartUpload: &s3.CompletedMultipartUpload{
-				Parts: parts,
-			},
+		var completeOutput *s3.CompleteMultipartUploadOutput
+		err = mgr.retry(func() error {
+			var err error
+			mgr.targetRequest()
+			completeOutput, err = mgr.TargetS3.Client.CompleteMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.CompleteMultipartUploadInput{
+				Bucket:   aws.String(mgr.TargetS3.Bucket),
+				Key:      aws.String(mgr.TargetS3.ObjectKey),
+				UploadId: createOutput.UploadId,
+				MultipartUpload: &s3.CompletedMultipartUpload{
+					Parts: parts,
+				},
+			})
+			return err
 		})
-
+		if err == nil && completeOutput != nil {
+			mgr.TargetVersionId = aws.StringValue(completeOutput.VersionId)
+			mgr.targetETag = aws.StringValue(completeOutput.ETag)
+		}
 	}
 	if err != nil {
 		log.Printf("MPU for s3://%s/%s => s3://%s/%s  failed to complete", mgr.SourceS3.Bucket, mgr.SourceS3.ObjectKey, mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey)
@@ -561,6 +636,12 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsMPU() error {
 		return err
 	}
 	log.Printf("Completing MPU for s3://%s/%s", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey)
+	if err := mgr.applyObjectLock(); err != nil {
+		return err
+	}
+	if err := mgr.applyObjectACL(); err != nil {
+		return err
+	}
 
 	//log success after return
 	//mgr.SuccessLog.Printf("MPU: s3://%s/%s", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey)
@@ -573,18 +654,52 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsMPU() error {
 	return nil
 }
 
+// sourcePartLayout splits the source object into parts for a multipart copy,
+// following the source's own part count when the HEAD reported one.
+func (mgr *MigrationMgrStruct) sourcePartLayout() (objectSize, partSize, partsCount int64, err error) {
+	if mgr.SourceHead == nil || mgr.SourceHead.ContentLength == nil {
+		return 0, 0, 0, fmt.Errorf("source object does not have a content length")
+	}
+	objectSize = *mgr.SourceHead.ContentLength
+	if mgr.SourceHead.PartsCount == nil {
+		log.Printf("!! Source object (s3://%s/%s) missing partsCount in header", mgr.SourceS3.Bucket, mgr.SourceS3.ObjectKey)
+		partsCount = CalculateTotalParts(objectSize, CalculatePartSize(objectSize))
+	} else {
+		partsCount = *mgr.SourceHead.PartsCount
+	}
+	partSize = (objectSize + partsCount - 1) / partsCount
+	partSize = ((partSize + 1048575) / 1048576) * 1048576 // Round up to nearest MB
+	if partSize < defaultPartSizeMin {
+		// every part but the last must be at least 5 MiB
+		partSize = defaultPartSizeMin
+		partsCount = (objectSize + partSize - 1) / partSize
+	}
+	return objectSize, partSize, partsCount, nil
+}
+
 func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsRegular() error {
-	tgtKey := mgr.TargetS3.ObjectKey
 	if len(mgr.TargetS3.ObjectKey) == 0 {
-		mgr.TargetS3.ObjectKey = mgr.SourceS3.ObjectKey
-		if mgr.UseSourceAsPrefixOnTarget {
-			mgr.TargetS3.ObjectKey = mgr.SourceS3.Bucket + "/" + mgr.SourceS3.ObjectKey
-		}
+		mgr.TargetS3.ObjectKey = mgr.targetKey(mgr.SourceS3.ObjectKey)
 	}
-	// Get the object
-	getOutput, err := mgr.SourceS3.Client.GetObjectWithContext(mgr.SourceS3.ctx, &s3.GetObjectInput{
-		Bucket: aws.String(mgr.SourceS3.Bucket),
-		Key:    aws.String(mgr.SourceS3.ObjectKey),
+	tgtKey := mgr.TargetS3.ObjectKey
+	// Get the object; a body cut short is retried like a failed GET
+	var body []byte
+	err := mgr.retry(func() error {
+		mgr.sourceRequest()
+		getOutput, err := mgr.SourceS3.Client.GetObjectWithContext(mgr.SourceS3.ctx, mgr.SourceS3.encryptGet(&s3.GetObjectInput{
+			Bucket:    aws.String(mgr.SourceS3.Bucket),
+			Key:       aws.String(mgr.SourceS3.ObjectKey),
+			VersionId: versionIdOrNil(mgr.SourceVersionId),
+		}))
+		if err != nil {
+			return err
+		}
+		defer getOutput.Body.Close()
+		body, err = io.ReadAll(mgr.sourceReader(getOutput.Body))
+		if err != nil {
+			fmt.Printf("Error reading body, err=%s\n", err.Error())
+		}
+		return err
 	})
 	if err != nil {
 		return err
@@ -608,29 +723,37 @@ func (mgr *MigrationMgrStruct) CopyObjectBetweenBucketsRegular() error {
 		// return fmt.Errorf("default error state source object: %v", err)
 
 	}
-	defer getOutput.Body.Close()
-
-	body, err := io.ReadAll(getOutput.Body)
-	if err != nil {
-		fmt.Printf("Error reading body, err=%s\n", err.Error())
+	if err := mgr.loadSourceTagging(); err != nil {
 		return err
 	}
-	defer getOutput.Body.Close()
-
-	// Create an io.ReadSeeker from the byte slice
-	readSeeker := bytes.NewReader(body)
-
-	// Now you can use readSeeker where io.ReadSeeker is expected
-
 	// Put the object
-	_, err = mgr.TargetS3.Client.PutObjectWithContext(mgr.TargetS3.ctx, &s3.PutObjectInput{
+	putInput := mgr.TargetS3.encryptPut(&s3.PutObjectInput{
 		Bucket: aws.String(mgr.TargetS3.Bucket),
 		Key:    aws.String(tgtKey),
-		Body:   readSeeker,
+	})
+	mgr.applyMetadataToPut(putInput)
+	var putOutput *s3.PutObjectOutput
+	err = mgr.retry(func() error {
+		var err error
+		putInput.Body = bytes.NewReader(body)
+		mgr.targetBytes(int64(len(body)))
+		mgr.targetRequest()
+		putOutput, err = mgr.TargetS3.Client.PutObjectWithContext(mgr.TargetS3.ctx, putInput)
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to put object: %v", err)
 	}
+	if putOutput != nil {
+		mgr.TargetVersionId = aws.StringValue(putOutput.VersionId)
+		mgr.targetETag = aws.StringValue(putOutput.ETag)
+	}
+	if err := mgr.applyObjectLock(); err != nil {
+		return err
+	}
+	if err := mgr.applyObjectACL(); err != nil {
+		return err
+	}
 	atomic.AddInt64(&mgr.Progress.CompletedBytes, *mgr.SourceHead.ContentLength)
 	return nil
 }
@@ -656,12 +779,13 @@ func (mgr *MigrationMgrStruct) MigrateObject(size int64) error {
 	// skip if the target already has the object and it's newer
 
 	//any prerequistites / checks etc
-	err := withRetry(func() error {
+	err := mgr.retry(func() error {
 		var err error
-		mgr.SourceHead, err = mgr.SourceS3.Client.HeadObjectWithContext(mgr.SourceS3.ctx, &s3.HeadObjectInput{
+		mgr.sourceRequest()
+		mgr.SourceHead, err = mgr.SourceS3.Client.HeadObjectWithContext(mgr.SourceS3.ctx, mgr.SourceS3.encryptHead(&s3.HeadObjectInput{
 			Bucket: aws.String(mgr.SourceS3.Bucket),
 			Key:    aws.String(mgr.SourceS3.ObjectKey),
-		})
+		}))
 		return err
 	})
 	VerbosePrintf("(ALIVE! 3) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
@@ -679,12 +803,18 @@ func (mgr *MigrationMgrStruct) MigrateObject(size int64) error {
 		panic("TargetS3 is nil")
 	}
 	mgr.TargetS3.WasSkipped = false
+	mgr.targetRequest()
 	if mgr.TargetS3.ObjectExists() {
 		//object exists, see if it's newer
 		log.Printf("Target object s3://%s/%s already exists\n", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey)
-		mgr.TargetHead, err = mgr.TargetS3.Client.HeadObjectWithContext(mgr.TargetS3.ctx, &s3.HeadObjectInput{
-			Bucket: aws.String(mgr.TargetS3.Bucket),
-			Key:    aws.String(mgr.TargetS3.ObjectKey),
+		err = mgr.retry(func() error {
+			var err error
+			mgr.targetRequest()
+			mgr.TargetHead, err = mgr.TargetS3.Client.HeadObjectWithContext(mgr.TargetS3.ctx, mgr.TargetS3.encryptHead(&s3.HeadObjectInput{
+				Bucket: aws.String(mgr.TargetS3.Bucket),
+				Key:    aws.String(mgr.TargetS3.ObjectKey),
+			}))
+			return err
 		})
 		if err != nil {
 			VerbosePrintf("(DIE! 4) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
@@ -696,6 +826,8 @@ func (mgr *MigrationMgrStruct) MigrateObject(size int64) error {
 			atomic.AddInt64(&mgr.Progress.CompletedBytes, size)
 			//atomic.AddInt64(&mgr.Progress.MigratedObjects, 1) // added migration object for skipped object; don't do this
 			mgr.TargetS3.WasSkipped = true
+			mgr.copyMethod = CopyMethodSkipped
+			mgr.targetETag = aws.StringValue(mgr.TargetHead.ETag)
 			return nil
 		}
 		VerbosePrintln("--- target exists, but it's older... moving on ---")
@@ -705,9 +837,16 @@ func (mgr *MigrationMgrStruct) MigrateObject(size int64) error {
 	VerbosePrintf("(ALIVE! 5) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
 	VerbosePrintln("--- if size is less than defaultPartSizeMin, go regular, otherwise, go MPU ---")
 
-	// determine if using MPU or not; if so, go MPU function otherwise regular copy
-	if size < defaultPartSizeMin {
+	// copy server side if the endpoints allow it; otherwise determine if using
+	// MPU or not; if so, go MPU function otherwise regular copy
+	if copied, err := mgr.tryServerSideCopy(size); err != nil {
+		VerbosePrintf("(DIE! 5.0) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
+		return err
+	} else if copied {
+		VerbosePrintln("--- copied server side ---")
+	} else if size < defaultPartSizeMin {
 		VerbosePrintln("--- going regular copy ---")
+		mgr.copyMethod = CopyMethodRegular
 		if err := mgr.CopyObjectBetweenBucketsRegular(); err != nil {
 			//log.Printf("Caught error during regular copy: %v", err)
 			VerbosePrintf("(DIE! 5.1) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
@@ -716,6 +855,7 @@ func (mgr *MigrationMgrStruct) MigrateObject(size int64) error {
 	} else {
 		VerbosePrintf("(ALIVE! 5.2 but die in this function) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
 		VerbosePrintln("--- going MPU copy ---")
+		mgr.copyMethod = CopyMethodMPU
 		if err := mgr.CopyObjectBetweenBucketsMPU(); err != nil {
 			VerbosePrintf("(DIE! 5.2) MigrateObject(...%s ==> %s, size=%d)\n", mgr.SourceS3.ObjectKey, mgr.TargetS3.ObjectKey, size)
 			log.Printf("Caught error during MPU copy: %v", err)
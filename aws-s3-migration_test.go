@@ -57,6 +57,9 @@ func (m *MockS3Client) GetObjectWithContext(ctx context.Context, input *s3.GetOb
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
+	if fn, ok := args.Get(0).(func(*s3.GetObjectInput) *s3.GetObjectOutput); ok {
+		return fn(input), args.Error(1)
+	}
 	return args.Get(0).(*s3.GetObjectOutput), args.Error(1)
 }
 
@@ -13,9 +13,13 @@ import (
 
 // MPUUpload represents a pending or in-progress multipart upload
 type MPUUpload struct {
-	Key       string
-	UploadID  string
-	Initiated time.Time
+	Key          string
+	UploadID     string
+	Initiated    time.Time
+	Initiator    string `json:",omitempty"`
+	StorageClass string `json:",omitempty"`
+	Parts        int64  `json:",omitempty"`
+	Size         int64  `json:",omitempty"`
 }
 
 // ListMultipartUploads returns all pending or in-progress multipart uploads for a bucket
@@ -36,11 +40,7 @@ func (s3c S3ClientSession) ListMultipartUploads() ([]MPUUpload, error) {
 	err := s3c.Client.ListMultipartUploadsPages(input,
 		func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
 			for _, u := range page.Uploads {
-				uploads = append(uploads, MPUUpload{
-					Key:       aws.StringValue(u.Key),
-					UploadID:  aws.StringValue(u.UploadId),
-					Initiated: aws.TimeValue(u.Initiated),
-				})
+				uploads = append(uploads, mpuUpload(u))
 			}
 			return !lastPage
 		})
@@ -51,6 +51,22 @@ func (s3c S3ClientSession) ListMultipartUploads() ([]MPUUpload, error) {
 	return uploads, nil
 }
 
+func mpuUpload(u *s3.MultipartUpload) MPUUpload {
+	upload := MPUUpload{
+		Key:          aws.StringValue(u.Key),
+		UploadID:     aws.StringValue(u.UploadId),
+		Initiated:    aws.TimeValue(u.Initiated),
+		StorageClass: aws.StringValue(u.StorageClass),
+	}
+	if u.Initiator != nil {
+		upload.Initiator = aws.StringValue(u.Initiator.DisplayName)
+		if len(upload.Initiator) == 0 {
+			upload.Initiator = aws.StringValue(u.Initiator.ID)
+		}
+	}
+	return upload
+}
+
 // AbortMultipartUploads aborts all multipart uploads older than cutoff
 func (s3c S3ClientSession) AbortMultipartUploads(uploads []MPUUpload, cutoff time.Duration) error {
 	VerbosePrintln("BEGIN S3ClientSession::AbortMultipartUploads()")
@@ -126,10 +142,10 @@ func (s3c S3ClientSession) CreateIncompleteMultipartUpload(key string, numParts
 	}
 
 	// Step 1: initiate MPU
-	createResp, err := s3c.Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+	createResp, err := s3c.Client.CreateMultipartUpload(s3c.encryptCreateMPU(&s3.CreateMultipartUploadInput{
 		Bucket: aws.String(s3c.Bucket),
 		Key:    aws.String(key),
-	})
+	}))
 	if err != nil {
 		return "", fmt.Errorf("failed to initiate MPU: %w", err)
 	}
@@ -143,13 +159,13 @@ func (s3c S3ClientSession) CreateIncompleteMultipartUpload(key string, numParts
 		data := make([]byte, partSize)
 		rand.Read(data) // fill with random data
 
-		_, err := s3c.Client.UploadPart(&s3.UploadPartInput{
+		_, err := s3c.Client.UploadPart(s3c.encryptUploadPart(&s3.UploadPartInput{
 			Bucket:     aws.String(s3c.Bucket),
 			Key:        aws.String(key),
 			PartNumber: aws.Int64(int64(i)),
 			UploadId:   aws.String(uploadID),
 			Body:       bytes.NewReader(data),
-		})
+		}))
 		if err != nil {
 			return uploadID, fmt.Errorf("failed to upload part %d: %w", i, err)
 		}
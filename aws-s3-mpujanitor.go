@@ -0,0 +1,296 @@
+package alfredo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MPUJanitorOptions configures RunMPUJanitor.
+type MPUJanitorOptions struct {
+	// Buckets limits the janitor to these buckets; all buckets of the
+	// endpoint otherwise
+	Buckets []string
+	// Cutoff is the age past which an upload is aborted, and BucketCutoffs
+	// overrides it per bucket. A bucket whose cutoff is zero is only reported.
+	Cutoff        time.Duration
+	BucketCutoffs map[string]time.Duration
+	// Prefix and Initiator restrict which uploads are considered. Initiator
+	// matches the initiator's display name, or its ID when it has none.
+	Prefix    string
+	Initiator string
+	DryRun    bool
+}
+
+func (opts MPUJanitorOptions) cutoff(bucket string) time.Duration {
+	if cutoff, ok := opts.BucketCutoffs[bucket]; ok {
+		return cutoff
+	}
+	return opts.Cutoff
+}
+
+// MPUBucketReport is what the janitor found and did in one bucket. Uploads
+// lists every upload considered, Stale those past the bucket's cutoff and
+// Aborted those actually aborted.
+type MPUBucketReport struct {
+	Bucket       string            `json:"bucket"`
+	Cutoff       time.Duration     `json:"cutoff"`
+	Uploads      []MPUUpload       `json:"uploads,omitempty"`
+	Parts        int64             `json:"parts"`
+	Bytes        int64             `json:"bytes"`
+	Stale        int64             `json:"stale"`
+	StaleBytes   int64             `json:"staleBytes"`
+	Aborted      int64             `json:"aborted"`
+	AbortedBytes int64             `json:"abortedBytes"`
+	Failed       map[string]string `json:"failed,omitempty"`
+}
+
+// MPUJanitorReport sums up a janitor run over all buckets.
+type MPUJanitorReport struct {
+	DryRun       bool              `json:"dryRun"`
+	Buckets      []MPUBucketReport `json:"buckets"`
+	Uploads      int64             `json:"uploads"`
+	Bytes        int64             `json:"bytes"`
+	Stale        int64             `json:"stale"`
+	StaleBytes   int64             `json:"staleBytes"`
+	Aborted      int64             `json:"aborted"`
+	AbortedBytes int64             `json:"abortedBytes"`
+	Failed       int64             `json:"failed"`
+}
+
+// String renders the report for people.
+func (r *MPUJanitorReport) String() string {
+	var sb strings.Builder
+	now := time.Now()
+	for _, b := range r.Buckets {
+		fmt.Fprintf(&sb, "%s: %d uploads, %s parts, %s", b.Bucket, len(b.Uploads), HumanReadableBigNumber(b.Parts), HumanReadableStorageCapacity(b.Bytes))
+		if b.Cutoff > 0 {
+			fmt.Fprintf(&sb, ", %d older than %s (%s)", b.Stale, b.Cutoff, HumanReadableStorageCapacity(b.StaleBytes))
+		}
+		sb.WriteString("\n")
+		for _, u := range b.Uploads {
+			fmt.Fprintf(&sb, "  %-40s %s  age %-14s %4d parts %10s  %s\n", u.Key, u.UploadID, now.Sub(u.Initiated).Truncate(time.Second), u.Parts, HumanReadableStorageCapacity(u.Size), u.Initiator)
+		}
+		for _, id := range sortedMapKeys(b.Failed) {
+			fmt.Fprintf(&sb, "  failed %s: %s\n", id, b.Failed[id])
+		}
+	}
+	fmt.Fprintf(&sb, "Total: %s uploads holding %s, %s stale holding %s",
+		HumanReadableBigNumber(r.Uploads), HumanReadableStorageCapacity(r.Bytes),
+		HumanReadableBigNumber(r.Stale), HumanReadableStorageCapacity(r.StaleBytes))
+	if r.DryRun {
+		sb.WriteString(" (dry run, nothing aborted)")
+	} else {
+		fmt.Fprintf(&sb, ", %s aborted freeing %s", HumanReadableBigNumber(r.Aborted), HumanReadableStorageCapacity(r.AbortedBytes))
+	}
+	if r.Failed > 0 {
+		fmt.Fprintf(&sb, ", %d failures", r.Failed)
+	}
+	return sb.String()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *MPUJanitorReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// listBucketUploads lists the uploads of bucket under prefix.
+func (s3c *S3ClientSession) listBucketUploads(bucket, prefix string) ([]MPUUpload, error) {
+	var uploads []MPUUpload
+	input := &s3.ListMultipartUploadsInput{Bucket: aws.String(bucket)}
+	if len(prefix) > 0 {
+		input.Prefix = aws.String(prefix)
+	}
+	err := s3c.retry(func() error {
+		uploads = uploads[:0]
+		return s3c.Client.ListMultipartUploadsPagesWithContext(s3c.ctx, input,
+			func(page *s3.ListMultipartUploadsOutput, lastPage bool) bool {
+				for _, u := range page.Uploads {
+					uploads = append(uploads, mpuUpload(u))
+				}
+				return !lastPage
+			})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list multipart uploads of bucket %s: %v", bucket, err)
+	}
+	return uploads, nil
+}
+
+// sizeUpload fills in the number and total size of the parts uploaded so far.
+func (s3c *S3ClientSession) sizeUpload(bucket string, u *MPUUpload) error {
+	return s3c.retry(func() error {
+		u.Parts, u.Size = 0, 0
+		return s3c.Client.ListPartsPagesWithContext(s3c.ctx, &s3.ListPartsInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(u.Key),
+			UploadId: aws.String(u.UploadID),
+		}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+			for _, p := range page.Parts {
+				u.Parts++
+				u.Size += aws.Int64Value(p.Size)
+			}
+			return !lastPage
+		})
+	})
+}
+
+// awsEndpointPattern matches the global and regional AWS S3 endpoints, with
+// or without a scheme.
+var awsEndpointPattern = regexp.MustCompile(`^(https?://)?s3([.-][a-z0-9-]+)?\.amazonaws\.com/?$`)
+
+// regionalEndpoint is the endpoint serving region: AWS endpoints are swapped
+// for that region's, any other endpoint is assumed to serve every region.
+func regionalEndpoint(endpoint, region string) string {
+	m := awsEndpointPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(endpoint)))
+	if m == nil {
+		return endpoint
+	}
+	return m[1] + "s3." + region + ".amazonaws.com"
+}
+
+// bucketSession returns a session for the region bucket lives in: s3c itself
+// when that is the session's region, otherwise one established for the
+// region and kept in sessions for the next bucket there. When the region
+// cannot be read, s3c is used as is.
+func (s3c *S3ClientSession) bucketSession(bucket string, sessions map[string]*S3ClientSession) (*S3ClientSession, error) {
+	var out *s3.GetBucketLocationOutput
+	err := s3c.retry(func() error {
+		var err error
+		out, err = s3c.Client.GetBucketLocationWithContext(s3c.ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+		return err
+	})
+	if err != nil {
+		log.Printf("WARNING: failed to get region of bucket %s, assuming %s: %v", bucket, s3c.Region, err)
+		return s3c, nil
+	}
+	region := s3.NormalizeBucketLocation(aws.StringValue(out.LocationConstraint))
+	if region == s3.NormalizeBucketLocation(s3c.Region) {
+		return s3c, nil
+	}
+	if regional, ok := sessions[region]; ok {
+		return regional, nil
+	}
+	regional := s3c.DeepCopy()
+	regional.Region = region
+	regional.Endpoint = regionalEndpoint(s3c.Endpoint, region)
+	regional.established = false
+	if err := regional.EstablishSession(); err != nil {
+		return nil, fmt.Errorf("error establishing session for region %s: %v", region, err)
+	}
+	regional.ctx = s3c.ctx
+	sessions[region] = &regional
+	return &regional, nil
+}
+
+// RunMPUJanitor walks the in-progress multipart uploads of every bucket on
+// the endpoint, or of opts.Buckets, sizing each from its parts, and aborts
+// those older than the bucket's cutoff unless opts.DryRun is set. Failures
+// are recorded per bucket and do not stop the run; the report is returned
+// along with an error counting them. Each bucket is worked on through a
+// client for its own region.
+func (s3c *S3ClientSession) RunMPUJanitor(opts MPUJanitorOptions) (*MPUJanitorReport, error) {
+	VerbosePrintln("BEGIN S3ClientSession::RunMPUJanitor()")
+	defer VerbosePrintln("END S3ClientSession::RunMPUJanitor()")
+	if err := s3c.EstablishSession(); err != nil {
+		return nil, err
+	}
+	if s3c.ctx == nil {
+		s3c.ctx = aws.BackgroundContext()
+	}
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		var out *s3.ListBucketsOutput
+		err := s3c.retry(func() error {
+			var err error
+			out, err = s3c.Client.ListBucketsWithContext(s3c.ctx, &s3.ListBucketsInput{})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list buckets: %v", err)
+		}
+		for _, b := range out.Buckets {
+			buckets = append(buckets, aws.StringValue(b.Name))
+		}
+	}
+	if len(buckets) == 0 {
+		return nil, errors.New("no buckets to clean up")
+	}
+
+	report := &MPUJanitorReport{DryRun: opts.DryRun}
+	now := time.Now()
+	sessions := map[string]*S3ClientSession{}
+	for _, bucket := range buckets {
+		b := MPUBucketReport{Bucket: bucket, Cutoff: opts.cutoff(bucket), Failed: map[string]string{}}
+		bs, err := s3c.bucketSession(bucket, sessions)
+		if err != nil {
+			b.Failed[bucket] = err.Error()
+			bs = s3c
+		}
+		uploads, err := bs.listBucketUploads(bucket, opts.Prefix)
+		if err != nil {
+			b.Failed[bucket] = err.Error()
+		}
+		for _, u := range uploads {
+			if len(opts.Initiator) > 0 && u.Initiator != opts.Initiator {
+				continue
+			}
+			id := u.Key + "@" + u.UploadID
+			if err := bs.sizeUpload(bucket, &u); err != nil {
+				b.Failed[id] = fmt.Sprintf("failed to list parts: %v", err)
+			}
+			b.Uploads = append(b.Uploads, u)
+			b.Parts += u.Parts
+			b.Bytes += u.Size
+			if b.Cutoff <= 0 || now.Sub(u.Initiated) < b.Cutoff {
+				continue
+			}
+			b.Stale++
+			b.StaleBytes += u.Size
+			if opts.DryRun {
+				fmt.Printf("(dry run) abort MPU: Bucket=%s, Key=%s, UploadID=%s, Age=%s\n", bucket, u.Key, u.UploadID, now.Sub(u.Initiated))
+				continue
+			}
+			err := bs.retry(func() error {
+				_, err := bs.Client.AbortMultipartUploadWithContext(bs.ctx, &s3.AbortMultipartUploadInput{
+					Bucket:   aws.String(bucket),
+					Key:      aws.String(u.Key),
+					UploadId: aws.String(u.UploadID),
+				})
+				return err
+			})
+			if err != nil {
+				b.Failed[id] = fmt.Sprintf("failed to abort: %v", err)
+				continue
+			}
+			VerbosePrintf("Aborted MPU: Bucket=%s, Key=%s, UploadID=%s\n", bucket, u.Key, u.UploadID)
+			b.Aborted++
+			b.AbortedBytes += u.Size
+		}
+		sort.Slice(b.Uploads, func(i, j int) bool { return b.Uploads[i].Initiated.Before(b.Uploads[j].Initiated) })
+
+		report.Buckets = append(report.Buckets, b)
+		report.Uploads += int64(len(b.Uploads))
+		report.Bytes += b.Bytes
+		report.Stale += b.Stale
+		report.StaleBytes += b.StaleBytes
+		report.Aborted += b.Aborted
+		report.AbortedBytes += b.AbortedBytes
+		report.Failed += int64(len(b.Failed))
+	}
+	if report.Failed > 0 {
+		return report, fmt.Errorf("multipart upload janitor had %d failures", report.Failed)
+	}
+	return report, nil
+}
@@ -0,0 +1,115 @@
+package alfredo
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// startUpload leaves an upload of key with one part of size bytes in bucket.
+func startUpload(t *testing.T, s3c *S3ClientSession, bucket, key string, size int) string {
+	out, err := s3c.Client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	assert.NoError(t, err)
+	_, err = s3c.Client.UploadPart(&s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   out.UploadId,
+		PartNumber: aws.Int64(1),
+		Body:       bytes.NewReader(make([]byte, size)),
+	})
+	assert.NoError(t, err)
+	return aws.StringValue(out.UploadId)
+}
+
+func TestRunMPUJanitor(t *testing.T) {
+	srv := s3fake.New()
+	defer srv.Close()
+	s3c := fakeSession(t, srv, "one")
+	_, err := s3c.Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("two")})
+	assert.NoError(t, err)
+
+	srv.Now = func() time.Time { return time.Now().Add(-10 * 24 * time.Hour) }
+	startUpload(t, s3c, "one", "tmp/old", 100)
+	startUpload(t, s3c, "one", "keep/old", 200)
+	startUpload(t, s3c, "two", "tmp/old", 300)
+	srv.Now = time.Now
+	startUpload(t, s3c, "one", "tmp/new", 400)
+
+	opts := MPUJanitorOptions{
+		Cutoff:        7 * 24 * time.Hour,
+		BucketCutoffs: map[string]time.Duration{"two": 30 * 24 * time.Hour},
+		DryRun:        true,
+	}
+	report, err := s3c.RunMPUJanitor(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, report.Buckets, 2) {
+		assert.Equal(t, "one", report.Buckets[0].Bucket)
+		assert.Len(t, report.Buckets[0].Uploads, 3)
+		assert.Equal(t, int64(700), report.Buckets[0].Bytes)
+		assert.Equal(t, int64(2), report.Buckets[0].Stale)
+		assert.Equal(t, int64(0), report.Buckets[1].Stale)
+	}
+	assert.Equal(t, int64(1000), report.Bytes)
+	assert.Equal(t, int64(300), report.StaleBytes)
+	assert.Equal(t, int64(0), report.Aborted)
+	assert.Contains(t, report.String(), "(dry run, nothing aborted)")
+
+	// an initiator that started none of the uploads matches nothing
+	report, err = s3c.RunMPUJanitor(MPUJanitorOptions{Cutoff: time.Hour, Initiator: "someone-else"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), report.Uploads)
+
+	opts.DryRun, opts.Prefix = false, "tmp/"
+	report, err = s3c.RunMPUJanitor(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), report.Aborted)
+	assert.Equal(t, int64(100), report.AbortedBytes)
+
+	left, err := s3c.RunMPUJanitor(MPUJanitorOptions{Buckets: []string{"one"}})
+	assert.NoError(t, err)
+	keys := []string{}
+	for _, u := range left.Buckets[0].Uploads {
+		keys = append(keys, u.Key)
+	}
+	assert.ElementsMatch(t, []string{"keep/old", "tmp/new"}, keys)
+}
+
+func TestRegionalEndpoint(t *testing.T) {
+	assert.Equal(t, "https://s3.eu-west-1.amazonaws.com", regionalEndpoint("https://s3.amazonaws.com", "eu-west-1"))
+	assert.Equal(t, "https://s3.eu-west-1.amazonaws.com", regionalEndpoint("https://s3.us-east-2.amazonaws.com/", "eu-west-1"))
+	assert.Equal(t, "s3.eu-west-1.amazonaws.com", regionalEndpoint("s3-us-west-2.amazonaws.com", "eu-west-1"))
+	assert.Equal(t, "https://objects.example.com", regionalEndpoint("https://objects.example.com", "eu-west-1"))
+}
+
+func TestMPUJanitorUsesBucketRegion(t *testing.T) {
+	srv := s3fake.New()
+	defer srv.Close()
+	s3c := fakeSession(t, srv, "home")
+	_, err := s3c.Client.CreateBucket(&s3.CreateBucketInput{
+		Bucket:                    aws.String("away"),
+		CreateBucketConfiguration: &s3.CreateBucketConfiguration{LocationConstraint: aws.String("eu-west-1")},
+	})
+	assert.NoError(t, err)
+	startUpload(t, s3c, "away", "tmp/a", 100)
+
+	report, err := s3c.RunMPUJanitor(MPUJanitorOptions{Cutoff: time.Nanosecond})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), report.Aborted)
+
+	sessions := map[string]*S3ClientSession{}
+	home, err := s3c.bucketSession("home", sessions)
+	assert.NoError(t, err)
+	assert.Same(t, s3c, home)
+	away, err := s3c.bucketSession("away", sessions)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "eu-west-1", away.Region)
+		assert.Equal(t, srv.URL, away.Endpoint)
+	}
+	again, _ := s3c.bucketSession("away", sessions)
+	assert.Same(t, away, again)
+}
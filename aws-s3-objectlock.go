@@ -184,3 +184,17 @@ func (s3c *S3ClientSession) GetObjectRetention(key, versionID string,
 		VersionId: aws.String(versionID),
 	})
 }
+
+func (s3c *S3ClientSession) PutObjectLegalHold(key, versionID string, on bool) error {
+	status := s3.ObjectLockLegalHoldStatusOff
+	if on {
+		status = s3.ObjectLockLegalHoldStatusOn
+	}
+	_, err := s3c.Client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String(s3c.Bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(status)},
+	})
+	return err
+}
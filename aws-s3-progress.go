@@ -0,0 +1,266 @@
+package alfredo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProgressSnapshot is a point-in-time view of a ProgressTracker, as printed by
+// a ProgressReporter and served by its HTTP endpoint.
+type ProgressSnapshot struct {
+	Time             time.Time `json:"time"`
+	ElapsedSeconds   int64     `json:"elapsed_seconds"`
+	TotalObjects     int64     `json:"total_objects"`
+	TotalBytes       int64     `json:"total_bytes"`
+	ProcessedObjects int64     `json:"processed_objects"`
+	MigratedObjects  int64     `json:"migrated_objects"`
+	SkippedObjects   int64     `json:"skipped_objects"`
+	FailedObjects    int64     `json:"failed_objects"`
+	FilteredObjects  int64     `json:"filtered_objects"`
+	CompletedBytes   int64     `json:"completed_bytes"`
+	ObjectsPerSec    float64   `json:"objects_per_sec"`
+	BytesPerSec      float64   `json:"bytes_per_sec"`
+	MBPerSec         float64   `json:"mb_per_sec"`
+	PercentObjects   float64   `json:"percent_objects"`
+	PercentBytes     float64   `json:"percent_bytes"`
+	ETASeconds       int64     `json:"eta_seconds"`
+}
+
+func (s ProgressSnapshot) String() string {
+	eta := "unknown"
+	if s.ETASeconds > 0 {
+		eta = HumanReadableSeconds(s.ETASeconds)
+	} else if s.TotalObjects > 0 && s.ProcessedObjects >= s.TotalObjects {
+		eta = "done"
+	}
+	return fmt.Sprintf("Progress: %s/%s objects (%.1f%%), %s/%s (%.1f%%), %.1f obj/s, %.2f MB/s, %d failed, ETA %s",
+		HumanReadableBigNumber(s.ProcessedObjects), HumanReadableBigNumber(s.TotalObjects), s.PercentObjects,
+		HumanReadableStorageCapacity(s.CompletedBytes), HumanReadableStorageCapacity(s.TotalBytes), s.PercentBytes,
+		s.ObjectsPerSec, s.MBPerSec, s.FailedObjects, eta)
+}
+
+// ProgressReporter periodically logs throughput, percent done and ETA of a
+// ProgressTracker and can serve the same figures as JSON over HTTP.
+//
+// The expected totals come from a BucketSummary when one is given, since the
+// tracker's own totals only grow as the listing advances; the larger of the
+// two is used, less any objects the migration filtered out. Rates only count
+// work done since Start, so a resumed migration does not report the
+// checkpointed objects as instant throughput.
+type ProgressReporter struct {
+	Progress *ProgressTracker
+	Interval time.Duration
+	Logger   *log.Logger // defaults to the standard logger
+
+	mu              sync.Mutex
+	expectedObjects int64
+	expectedBytes   int64
+	start           time.Time
+	startObjects    int64
+	startBytes      int64
+	stop            chan struct{}
+	done            chan struct{}
+	server          *http.Server
+	listener        net.Listener
+}
+
+func NewProgressReporter(progress *ProgressTracker, interval time.Duration) *ProgressReporter {
+	return &ProgressReporter{Progress: progress, Interval: interval, start: time.Now()}
+}
+
+// WithSummary sets the expected totals, typically from GetBucketSummary.
+func (r *ProgressReporter) WithSummary(summary BucketSummary) *ProgressReporter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expectedObjects = summary.TotalObjects
+	r.expectedBytes = summary.TotalSize
+	return r
+}
+
+// SeedFromBucket lists the bucket under prefix to set the expected totals.
+func (r *ProgressReporter) SeedFromBucket(s3c *S3ClientSession, prefix string) error {
+	summary, err := s3c.GetBucketSummary(prefix)
+	if err != nil {
+		return fmt.Errorf("failed to summarize bucket %s: %v", s3c.Bucket, err)
+	}
+	r.WithSummary(summary)
+	return nil
+}
+
+func (r *ProgressReporter) processed() (objects int64, failed int64) {
+	r.Progress.Lock()
+	failed = int64(len(r.Progress.FailedObjects))
+	r.Progress.Unlock()
+	objects = atomic.LoadInt64(&r.Progress.MigratedObjects) + atomic.LoadInt64(&r.Progress.SkippedObjects) + failed
+	return objects, failed
+}
+
+func (r *ProgressReporter) Snapshot() ProgressSnapshot {
+	r.mu.Lock()
+	start, startObjects, startBytes := r.start, r.startObjects, r.startBytes
+	expectedObjects, expectedBytes := r.expectedObjects, r.expectedBytes
+	r.mu.Unlock()
+
+	now := time.Now()
+	s := ProgressSnapshot{
+		Time:            now.UTC(),
+		ElapsedSeconds:  int64(now.Sub(start).Seconds()),
+		MigratedObjects: atomic.LoadInt64(&r.Progress.MigratedObjects),
+		SkippedObjects:  atomic.LoadInt64(&r.Progress.SkippedObjects),
+		FilteredObjects: atomic.LoadInt64(&r.Progress.FilteredObjects),
+		CompletedBytes:  atomic.LoadInt64(&r.Progress.CompletedBytes),
+	}
+	s.ProcessedObjects, s.FailedObjects = r.processed()
+
+	s.TotalObjects = atomic.LoadInt64(&r.Progress.TotalObjects)
+	if expected := expectedObjects - s.FilteredObjects; expected > s.TotalObjects {
+		s.TotalObjects = expected
+	}
+	s.TotalBytes = atomic.LoadInt64(&r.Progress.TotalBytes)
+	if expected := expectedBytes - atomic.LoadInt64(&r.Progress.FilteredBytes); expected > s.TotalBytes {
+		s.TotalBytes = expected
+	}
+	if s.TotalObjects > 0 {
+		s.PercentObjects = 100 * float64(s.ProcessedObjects) / float64(s.TotalObjects)
+	}
+	if s.TotalBytes > 0 {
+		s.PercentBytes = 100 * float64(s.CompletedBytes) / float64(s.TotalBytes)
+	}
+
+	s.ObjectsPerSec = CalculateRateOfChange(s.ProcessedObjects-startObjects, start.Unix(), now.Unix())
+	s.BytesPerSec = CalculateRateOfChange(s.CompletedBytes-startBytes, start.Unix(), now.Unix())
+	s.MBPerSec = s.BytesPerSec / (1024 * 1024)
+
+	// bytes give the steadier estimate when a few large objects dominate
+	if s.TotalBytes > 0 && s.BytesPerSec > 0 {
+		s.ETASeconds = CalculateETARaw(max(s.TotalBytes-s.CompletedBytes, 0), s.BytesPerSec)
+	} else {
+		s.ETASeconds = CalculateETARaw(max(s.TotalObjects-s.ProcessedObjects, 0), s.ObjectsPerSec)
+	}
+	return s
+}
+
+func (r *ProgressReporter) logf(format string, v ...interface{}) {
+	if r.Logger != nil {
+		r.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// Start resets the rate baseline and logs a snapshot every Interval until
+// Stop is called.
+func (r *ProgressReporter) Start() {
+	r.mu.Lock()
+	r.start = time.Now()
+	r.startObjects, _ = r.processed()
+	r.startBytes = atomic.LoadInt64(&r.Progress.CompletedBytes)
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	stop, done := r.stop, r.done
+	r.mu.Unlock()
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.logf("%s", r.Snapshot())
+			}
+		}
+	}()
+}
+
+// ServeHTTP answers with the current ProgressSnapshot as JSON.
+func (r *ProgressReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.Snapshot())
+}
+
+// ListenAndServe serves the snapshot on addr (e.g. "127.0.0.1:9090"; port 0
+// picks a free one, see Addr) until Stop is called. Only the listen error is
+// returned; the server itself runs in the background.
+func (r *ProgressReporter) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/progress", r)
+	mux.Handle("/", r)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	r.mu.Lock()
+	r.server = server
+	r.listener = listener
+	r.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			r.logf("WARNING: progress endpoint on %s stopped: %v", listener.Addr(), err)
+		}
+	}()
+	r.logf("Serving migration progress on http://%s/progress", listener.Addr())
+	return nil
+}
+
+// Addr is the address the HTTP endpoint listens on, or "" if there is none.
+func (r *ProgressReporter) Addr() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.listener == nil {
+		return ""
+	}
+	return r.listener.Addr().String()
+}
+
+// Stop ends periodic reporting and the HTTP endpoint, then logs a final
+// snapshot.
+func (r *ProgressReporter) Stop() {
+	r.mu.Lock()
+	stop, done, server := r.stop, r.done, r.server
+	r.stop, r.server, r.listener = nil, nil, nil
+	r.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+	r.logf("%s", r.Snapshot())
+}
+
+// StartProgressReporter seeds a reporter from a summary of the source bucket
+// and starts it; httpAddr, if not empty, also serves progress as JSON.
+func (mgr *MigrationMgrStruct) StartProgressReporter(interval time.Duration, httpAddr string) (*ProgressReporter, error) {
+	r := NewProgressReporter(mgr.Progress, interval)
+	if err := r.SeedFromBucket(mgr.SourceS3, ""); err != nil {
+		return nil, err
+	}
+	if len(httpAddr) > 0 {
+		if err := r.ListenAndServe(httpAddr); err != nil {
+			return nil, err
+		}
+	}
+	r.Start()
+	return r, nil
+}
@@ -0,0 +1,84 @@
+package alfredo
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockS3Client) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	args := m.Called(input)
+	if page, ok := args.Get(0).(*s3.ListObjectsV2Output); ok && page != nil {
+		fn(page, true)
+	}
+	return args.Error(1)
+}
+
+func TestProgressSnapshot(t *testing.T) {
+	progress := &ProgressTracker{
+		TotalObjects:    10, // the listing has only reached part of the bucket
+		TotalBytes:      1000,
+		MigratedObjects: 15,
+		SkippedObjects:  4,
+		CompletedBytes:  2000,
+		FilteredObjects: 20,
+		FilteredBytes:   2000,
+		FailedObjects:   map[string]error{"x": errors.New("boom")},
+	}
+	r := NewProgressReporter(progress, time.Minute).WithSummary(BucketSummary{TotalObjects: 100, TotalSize: 10000})
+	r.start = time.Now().Add(-10 * time.Second)
+
+	s := r.Snapshot()
+	assert.Equal(t, int64(80), s.TotalObjects)
+	assert.Equal(t, int64(8000), s.TotalBytes)
+	assert.Equal(t, int64(20), s.ProcessedObjects)
+	assert.Equal(t, int64(1), s.FailedObjects)
+	assert.InDelta(t, 25.0, s.PercentObjects, 0.001)
+	assert.InDelta(t, 25.0, s.PercentBytes, 0.001)
+	assert.InDelta(t, 2.0, s.ObjectsPerSec, 0.01)
+	assert.InDelta(t, 200.0, s.BytesPerSec, 0.1)
+	assert.Equal(t, int64(30), s.ETASeconds) // 6000 bytes left at 200 B/s
+	assert.Contains(t, s.String(), "20/80 objects (25.0%)")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/progress", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var served ProgressSnapshot
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, s.TotalObjects, served.TotalObjects)
+}
+
+func TestProgressReporterServesAndSeeds(t *testing.T) {
+	mockS3 := new(MockS3Client)
+	mockS3.On("ListObjectsV2Pages", mock.Anything).Return(&s3.ListObjectsV2Output{Contents: []*s3.Object{
+		{Key: str("a"), Size: int64p(10)}, {Key: str("b"), Size: int64p(30)},
+	}}, nil)
+
+	progress := &ProgressTracker{FailedObjects: map[string]error{}}
+	r := NewProgressReporter(progress, 10*time.Millisecond)
+	r.Logger = log.New(io.Discard, "", 0)
+	assert.NoError(t, r.SeedFromBucket(&S3ClientSession{Client: mockS3, Bucket: "bucket"}, ""))
+	assert.NoError(t, r.ListenAndServe("127.0.0.1:0"))
+	r.Start()
+
+	resp, err := http.Get("http://" + r.Addr() + "/progress")
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		var s ProgressSnapshot
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&s))
+		assert.Equal(t, int64(2), s.TotalObjects)
+		assert.Equal(t, int64(40), s.TotalBytes)
+	}
+
+	r.Stop()
+	assert.Equal(t, "", r.Addr())
+}
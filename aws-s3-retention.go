@@ -0,0 +1,519 @@
+package alfredo
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	RetentionExtended  = "extended"
+	RetentionUnchanged = "unchanged"
+	RetentionFailed    = "failed"
+
+	retentionModeNone         = "NONE"
+	defaultRetentionExpiring  = 30 * 24 * time.Hour
+	defaultRetentionExamples  = 20
+	noObjectLockConfiguration = "NoSuchObjectLockConfiguration"
+)
+
+// ObjectRetention is the Object Lock state of one object version.
+type ObjectRetention struct {
+	Key         string    `json:"key"`
+	VersionId   string    `json:"versionId"`
+	IsLatest    bool      `json:"isLatest"`
+	Size        int64     `json:"size"`
+	Mode        string    `json:"mode,omitempty"`
+	RetainUntil time.Time `json:"retainUntil,omitempty"`
+	LegalHold   bool      `json:"legalHold"`
+}
+
+// retentionHorizons groups versions by how long their retention has left.
+var retentionHorizons = []struct {
+	label string
+	limit time.Duration
+}{
+	{"expired", 0},
+	{"< 30 days", 30 * 24 * time.Hour},
+	{"30-90 days", 90 * 24 * time.Hour},
+	{"90 days-1 year", 365 * 24 * time.Hour},
+	{"1-7 years", 7 * 365 * 24 * time.Hour},
+}
+
+const retentionHorizonBeyond = "> 7 years"
+
+func retentionHorizon(remaining time.Duration) string {
+	for _, h := range retentionHorizons {
+		if remaining <= h.limit {
+			return h.label
+		}
+	}
+	return retentionHorizonBeyond
+}
+
+// objectRetention reads the retention and legal hold of a version. Versions
+// without either are reported as such rather than as errors.
+func (s3c *S3ClientSession) objectRetention(v ObjectVersion) (ObjectRetention, error) {
+	r := ObjectRetention{Key: v.Key, VersionId: v.VersionId, IsLatest: v.IsLatest, Size: v.Size}
+	err := s3c.retry(func() error {
+		out, err := s3c.Client.GetObjectRetentionWithContext(s3c.ctx, &s3.GetObjectRetentionInput{
+			Bucket:    aws.String(s3c.Bucket),
+			Key:       aws.String(v.Key),
+			VersionId: versionIdOrNil(v.VersionId),
+		})
+		if ErrorCode(err) == noObjectLockConfiguration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if out.Retention != nil {
+			r.Mode = aws.StringValue(out.Retention.Mode)
+			r.RetainUntil = aws.TimeValue(out.Retention.RetainUntilDate).UTC()
+		}
+		return nil
+	})
+	if err != nil {
+		return r, fmt.Errorf("failed to get retention of s3://%s/%s (%s): %v", s3c.Bucket, v.Key, v.VersionId, err)
+	}
+	err = s3c.retry(func() error {
+		out, err := s3c.Client.GetObjectLegalHoldWithContext(s3c.ctx, &s3.GetObjectLegalHoldInput{
+			Bucket:    aws.String(s3c.Bucket),
+			Key:       aws.String(v.Key),
+			VersionId: versionIdOrNil(v.VersionId),
+		})
+		if ErrorCode(err) == noObjectLockConfiguration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r.LegalHold = out.LegalHold != nil && aws.StringValue(out.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn
+		return nil
+	})
+	if err != nil {
+		return r, fmt.Errorf("failed to get legal hold of s3://%s/%s (%s): %v", s3c.Bucket, v.Key, v.VersionId, err)
+	}
+	return r, nil
+}
+
+// lockedVersions lists the versions under prefix that can carry a retention,
+// leaving out delete markers and, with currentOnly, noncurrent versions.
+func (s3c *S3ClientSession) lockedVersions(prefix string, currentOnly bool) ([]ObjectVersion, error) {
+	versions, err := s3c.ListAllObjectVersions(prefix)
+	if err != nil {
+		return nil, err
+	}
+	kept := versions[:0]
+	for _, v := range versions {
+		if v.IsDeleteMarker || (currentOnly && !v.IsLatest) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept, nil
+}
+
+// forEachRetention reads the retention of every version with up to
+// GetConcurrency() requests in flight and hands it to fn, which must be safe
+// for concurrent use.
+func (s3c *S3ClientSession) forEachRetention(versions []ObjectVersion, fn func(ObjectRetention, error)) {
+	work := make(chan ObjectVersion)
+	var wg sync.WaitGroup
+	for i := 0; i < min(s3c.GetConcurrency(), max(len(versions), 1)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range work {
+				fn(s3c.objectRetention(v))
+			}
+		}()
+	}
+	for _, v := range versions {
+		work <- v
+	}
+	close(work)
+	wg.Wait()
+}
+
+// RetentionAuditOptions selects the versions AuditRetention looks at.
+type RetentionAuditOptions struct {
+	Prefix      string
+	CurrentOnly bool // skip noncurrent versions
+	// ExpiringWithin is how close to expiry a retention must be to be listed
+	// in the report; 30 days by default
+	ExpiringWithin time.Duration
+	// MaxExpiring caps the versions listed as expiring, soonest first; 20 by
+	// default and unlimited when negative
+	MaxExpiring int
+}
+
+// RetentionAuditReport summarizes the Object Lock state of a bucket's
+// versions. Versions without a retention count under mode "NONE".
+type RetentionAuditReport struct {
+	Bucket     string           `json:"bucket"`
+	AuditedAt  time.Time        `json:"auditedAt"`
+	Versions   int64            `json:"versions"`
+	Bytes      int64            `json:"bytes"`
+	ByMode     map[string]int64 `json:"byMode"`
+	ByHorizon  map[string]int64 `json:"byHorizon"`
+	LegalHolds int64            `json:"legalHolds"`
+	// Unprotected versions have neither an unexpired retention nor a legal hold
+	Unprotected int64 `json:"unprotected"`
+	// Expiring lists the versions whose retention ends within the audit's
+	// window, soonest first, and ExpiringCount counts all of them
+	Expiring      []ObjectRetention `json:"expiring,omitempty"`
+	ExpiringCount int64             `json:"expiringCount"`
+	Failed        map[string]string `json:"failed,omitempty"`
+
+	expiringWithin time.Duration
+}
+
+// String renders the report for people.
+func (r *RetentionAuditReport) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Retention audit of bucket %s: %s versions, %s\n", r.Bucket, HumanReadableBigNumber(r.Versions), HumanReadableStorageCapacity(r.Bytes))
+	modes := make([]string, 0, len(r.ByMode))
+	for mode := range r.ByMode {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	for _, mode := range modes {
+		fmt.Fprintf(&sb, "  %-16s %s versions\n", mode, HumanReadableBigNumber(r.ByMode[mode]))
+	}
+	sb.WriteString("Retention remaining:\n")
+	for _, h := range retentionHorizons {
+		fmt.Fprintf(&sb, "  %-16s %s versions\n", h.label, HumanReadableBigNumber(r.ByHorizon[h.label]))
+	}
+	fmt.Fprintf(&sb, "  %-16s %s versions\n", retentionHorizonBeyond, HumanReadableBigNumber(r.ByHorizon[retentionHorizonBeyond]))
+	fmt.Fprintf(&sb, "Legal holds: %s, unprotected: %s\n", HumanReadableBigNumber(r.LegalHolds), HumanReadableBigNumber(r.Unprotected))
+	if r.ExpiringCount > 0 {
+		fmt.Fprintf(&sb, "%s versions expire within %s:\n", HumanReadableBigNumber(r.ExpiringCount), r.expiringWithin)
+		for _, e := range r.Expiring {
+			fmt.Fprintf(&sb, "  %s %-10s %s (%s)\n", e.RetainUntil.Format(time.RFC3339), e.Mode, e.Key, e.VersionId)
+		}
+	}
+	if len(r.Failed) > 0 {
+		fmt.Fprintf(&sb, "%d versions could not be read\n", len(r.Failed))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *RetentionAuditReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// AuditRetention reads the retention and legal hold of every version under
+// opts.Prefix and reports how the bucket is protected and what expires soon.
+// Versions whose state cannot be read are listed in the report's Failed map
+// and make the audit return an error alongside the report.
+func (s3c *S3ClientSession) AuditRetention(opts RetentionAuditOptions) (*RetentionAuditReport, error) {
+	if err := s3c.EstablishSession(); err != nil {
+		return nil, fmt.Errorf("error establishing session for bucket %s: %v", s3c.Bucket, err)
+	}
+	if s3c.ctx == nil {
+		s3c.ctx = aws.BackgroundContext()
+	}
+	if opts.ExpiringWithin <= 0 {
+		opts.ExpiringWithin = defaultRetentionExpiring
+	}
+	if opts.MaxExpiring == 0 {
+		opts.MaxExpiring = defaultRetentionExamples
+	}
+	versions, err := s3c.lockedVersions(opts.Prefix, opts.CurrentOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	report := &RetentionAuditReport{
+		Bucket:         s3c.Bucket,
+		AuditedAt:      now,
+		ByMode:         map[string]int64{},
+		ByHorizon:      map[string]int64{},
+		Failed:         map[string]string{},
+		expiringWithin: opts.ExpiringWithin,
+	}
+	var mu sync.Mutex
+	s3c.forEachRetention(versions, func(r ObjectRetention, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			report.Failed[r.Key+"@"+r.VersionId] = err.Error()
+			return
+		}
+		report.Versions++
+		report.Bytes += r.Size
+		if r.LegalHold {
+			report.LegalHolds++
+		}
+		if len(r.Mode) == 0 {
+			report.ByMode[retentionModeNone]++
+			if !r.LegalHold {
+				report.Unprotected++
+			}
+			return
+		}
+		report.ByMode[r.Mode]++
+		remaining := r.RetainUntil.Sub(now)
+		report.ByHorizon[retentionHorizon(remaining)]++
+		if remaining <= 0 && !r.LegalHold {
+			report.Unprotected++
+		}
+		if remaining > 0 && remaining <= opts.ExpiringWithin {
+			report.ExpiringCount++
+			report.Expiring = append(report.Expiring, r)
+		}
+	})
+
+	sort.Slice(report.Expiring, func(i, j int) bool {
+		a, b := report.Expiring[i], report.Expiring[j]
+		if !a.RetainUntil.Equal(b.RetainUntil) {
+			return a.RetainUntil.Before(b.RetainUntil)
+		}
+		return a.Key < b.Key
+	})
+	if opts.MaxExpiring > 0 && len(report.Expiring) > opts.MaxExpiring {
+		report.Expiring = report.Expiring[:opts.MaxExpiring]
+	}
+	if len(report.Failed) > 0 {
+		return report, fmt.Errorf("failed to read the retention of %d versions", len(report.Failed))
+	}
+	return report, nil
+}
+
+// RetentionChange records what ExtendRetention did, or with DryRun would do,
+// to one version; it is also the line format of the extension journal.
+type RetentionChange struct {
+	Time      time.Time `json:"time"`
+	Bucket    string    `json:"bucket"`
+	Key       string    `json:"key"`
+	VersionId string    `json:"versionId"`
+	Action    string    `json:"action"`
+	Mode      string    `json:"mode,omitempty"`
+	From      time.Time `json:"from,omitempty"`
+	To        time.Time `json:"to,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// RetentionExtendOptions describes a bulk retention extension.
+type RetentionExtendOptions struct {
+	Prefix      string
+	CurrentOnly bool // leave noncurrent versions alone
+	// RetainUntil is the date every selected version should be retained
+	// until at least
+	RetainUntil time.Time
+	// Mode is used for versions that have no retention yet; versions that
+	// have one keep their mode
+	Mode   string
+	DryRun bool
+	// JournalPath, if set, gets a RetentionChange per version. Rerunning with
+	// the same journal skips the versions it already records as extended or
+	// unchanged, so an interrupted run can be resumed.
+	JournalPath string
+}
+
+// ReadRetentionJournal reads the changes recorded by ExtendRetention in order.
+func ReadRetentionJournal(path string) ([]RetentionChange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open retention journal %s: %v", path, err)
+	}
+	defer f.Close()
+	var changes []RetentionChange
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var c RetentionChange
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("malformed record in retention journal %s: %v", path, err)
+		}
+		changes = append(changes, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read retention journal %s: %v", path, err)
+	}
+	return changes, nil
+}
+
+// retentionJournal appends RetentionChanges as JSON lines; a nil journal
+// discards them.
+type retentionJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (j *retentionJournal) write(c RetentionChange) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	b, _ := json.Marshal(c)
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		log.Printf("WARNING: failed to write retention journal entry for %s (%s): %v", c.Key, c.VersionId, err)
+	}
+}
+
+// retentionDone returns the versions of bucket the journal at path records as
+// retained until at least until; a missing journal has none. Journal entries
+// from a run with an earlier date do not count, so a rerun with a later date
+// extends those versions again.
+func retentionDone(path, bucket string, until time.Time) (map[string]bool, error) {
+	done := make(map[string]bool)
+	if !FileExistsEasy(path) {
+		return done, nil
+	}
+	changes, err := ReadRetentionJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range changes {
+		if c.Bucket == bucket {
+			done[c.Key+"@"+c.VersionId] = c.Action != RetentionFailed && !c.To.Before(until)
+		}
+	}
+	return done, nil
+}
+
+// planRetention decides what extending r to opts.RetainUntil takes. A
+// retention is never shortened, and a version keeps its mode unless its
+// retention has lapsed.
+func planRetention(r ObjectRetention, opts RetentionExtendOptions, now time.Time) (RetentionChange, error) {
+	c := RetentionChange{Key: r.Key, VersionId: r.VersionId, Mode: r.Mode, From: r.RetainUntil, To: opts.RetainUntil}
+	if !r.RetainUntil.Before(opts.RetainUntil) {
+		c.Action, c.To = RetentionUnchanged, r.RetainUntil
+		return c, nil
+	}
+	if len(r.Mode) == 0 || !r.RetainUntil.After(now) {
+		if len(opts.Mode) > 0 {
+			c.Mode = opts.Mode
+		}
+	}
+	if c.Mode != s3.ObjectLockRetentionModeGovernance && c.Mode != s3.ObjectLockRetentionModeCompliance {
+		return c, fmt.Errorf("no valid retention mode for a version without retention: %q", c.Mode)
+	}
+	c.Action = RetentionExtended
+	return c, nil
+}
+
+// ExtendRetention raises the retention of every version under opts.Prefix to
+// at least opts.RetainUntil, with up to GetConcurrency() versions at a time.
+// Retentions already reaching that date are left alone. The changes made, or
+// with DryRun planned, are returned ordered by key; failures are recorded
+// and do not stop the others.
+func (s3c *S3ClientSession) ExtendRetention(opts RetentionExtendOptions) ([]RetentionChange, error) {
+	if opts.RetainUntil.IsZero() {
+		return nil, errors.New("no retain-until date to extend retention to")
+	}
+	if len(opts.Mode) > 0 && opts.Mode != s3.ObjectLockRetentionModeGovernance && opts.Mode != s3.ObjectLockRetentionModeCompliance {
+		return nil, fmt.Errorf("invalid retention mode: %s", opts.Mode)
+	}
+	if err := s3c.EstablishSession(); err != nil {
+		return nil, fmt.Errorf("error establishing session for bucket %s: %v", s3c.Bucket, err)
+	}
+	if s3c.ctx == nil {
+		s3c.ctx = aws.BackgroundContext()
+	}
+	opts.RetainUntil = opts.RetainUntil.UTC().Truncate(time.Second)
+
+	versions, err := s3c.lockedVersions(opts.Prefix, opts.CurrentOnly)
+	if err != nil {
+		return nil, err
+	}
+	var journal *retentionJournal
+	if len(opts.JournalPath) > 0 {
+		done, err := retentionDone(opts.JournalPath, s3c.Bucket, opts.RetainUntil)
+		if err != nil {
+			return nil, err
+		}
+		pending := versions[:0]
+		for _, v := range versions {
+			if !done[v.Key+"@"+v.VersionId] {
+				pending = append(pending, v)
+			}
+		}
+		if skipped := len(versions) - len(pending); skipped > 0 {
+			log.Printf("Resuming retention extension from %s, %d versions already done", opts.JournalPath, skipped)
+		}
+		versions = pending
+		if !opts.DryRun {
+			f, err := os.OpenFile(opts.JournalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open retention journal %s: %v", opts.JournalPath, err)
+			}
+			defer f.Close()
+			journal = &retentionJournal{file: f}
+		}
+	}
+
+	now := time.Now().UTC()
+	var changes []RetentionChange
+	var mu sync.Mutex
+	var failed int64
+	s3c.forEachRetention(versions, func(r ObjectRetention, err error) {
+		var c RetentionChange
+		if err == nil {
+			c, err = planRetention(r, opts, now)
+		}
+		if err == nil && c.Action == RetentionExtended && !opts.DryRun {
+			err = s3c.retry(func() error {
+				_, err := s3c.Client.PutObjectRetentionWithContext(s3c.ctx, &s3.PutObjectRetentionInput{
+					Bucket:    aws.String(s3c.Bucket),
+					Key:       aws.String(r.Key),
+					VersionId: versionIdOrNil(r.VersionId),
+					Retention: &s3.ObjectLockRetention{
+						Mode:            aws.String(c.Mode),
+						RetainUntilDate: aws.Time(c.To),
+					},
+				})
+				return err
+			})
+		}
+		c.Time, c.Bucket, c.Key, c.VersionId = time.Now().UTC(), s3c.Bucket, r.Key, r.VersionId
+		if err != nil {
+			log.Printf("Failed to extend retention of s3://%s/%s (%s): %v", s3c.Bucket, r.Key, r.VersionId, err)
+			c.Action, c.Error = RetentionFailed, err.Error()
+			atomic.AddInt64(&failed, 1)
+		}
+		journal.write(c)
+		mu.Lock()
+		changes = append(changes, c)
+		mu.Unlock()
+	})
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Key != changes[j].Key {
+			return changes[i].Key < changes[j].Key
+		}
+		return changes[i].VersionId < changes[j].VersionId
+	})
+	if opts.DryRun {
+		for _, c := range changes {
+			if c.Action == RetentionExtended {
+				fmt.Printf("(dry run) extend %s (%s) %s until %s\n", c.Key, c.VersionId, c.Mode, c.To.Format(time.RFC3339))
+			}
+		}
+	}
+	if failed > 0 {
+		return changes, fmt.Errorf("failed to extend the retention of %d versions", failed)
+	}
+	return changes, nil
+}
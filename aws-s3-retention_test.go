@@ -0,0 +1,145 @@
+package alfredo
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+)
+
+// lockedFakeSession returns a session for an Object Lock bucket on srv.
+func lockedFakeSession(t *testing.T, srv *s3fake.Server, bucket string) *S3ClientSession {
+	var s3c S3ClientSession
+	s3c.WithEndpoint(srv.URL).WithRegion("us-east-1").WithBucket(bucket).
+		WithCredentials(S3credStruct{AccessKey: "key", SecretKey: "secret"})
+	assert.NoError(t, s3c.EstablishSession())
+	_, err := s3c.Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket), ObjectLockEnabledForBucket: aws.Bool(true)})
+	assert.NoError(t, err)
+	return &s3c
+}
+
+func putLocked(t *testing.T, s3c *S3ClientSession, key, mode string, until time.Time) {
+	input := &s3.PutObjectInput{Bucket: aws.String(s3c.Bucket), Key: aws.String(key), Body: strings.NewReader(key)}
+	if len(mode) > 0 {
+		input.ObjectLockMode, input.ObjectLockRetainUntilDate = aws.String(mode), aws.Time(until)
+	}
+	_, err := s3c.Client.PutObject(input)
+	assert.NoError(t, err, key)
+}
+
+func TestRetentionHorizon(t *testing.T) {
+	day := 24 * time.Hour
+	assert.Equal(t, "expired", retentionHorizon(-day))
+	assert.Equal(t, "< 30 days", retentionHorizon(day))
+	assert.Equal(t, "30-90 days", retentionHorizon(60*day))
+	assert.Equal(t, "90 days-1 year", retentionHorizon(200*day))
+	assert.Equal(t, "1-7 years", retentionHorizon(3*365*day))
+	assert.Equal(t, "> 7 years", retentionHorizon(10*365*day))
+}
+
+func TestAuditRetention(t *testing.T) {
+	srv := s3fake.New()
+	defer srv.Close()
+	s3c := lockedFakeSession(t, srv, "locked")
+	now := time.Now().UTC()
+	putLocked(t, s3c, "soon/a", s3.ObjectLockRetentionModeGovernance, now.Add(10*24*time.Hour))
+	putLocked(t, s3c, "soon/b", s3.ObjectLockRetentionModeCompliance, now.Add(2*24*time.Hour))
+	putLocked(t, s3c, "long/c", s3.ObjectLockRetentionModeCompliance, now.AddDate(2, 0, 0))
+	putLocked(t, s3c, "open/d", "", time.Time{})
+	putLocked(t, s3c, "held/e", "", time.Time{})
+	_, err := s3c.Client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket:    aws.String("locked"),
+		Key:       aws.String("held/e"),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(s3.ObjectLockLegalHoldStatusOn)},
+	})
+	assert.NoError(t, err)
+
+	report, err := s3c.AuditRetention(RetentionAuditOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), report.Versions)
+	assert.Equal(t, map[string]int64{"GOVERNANCE": 1, "COMPLIANCE": 2, "NONE": 2}, report.ByMode)
+	assert.Equal(t, int64(2), report.ByHorizon["< 30 days"])
+	assert.Equal(t, int64(1), report.ByHorizon["1-7 years"])
+	assert.Equal(t, int64(1), report.LegalHolds)
+	assert.Equal(t, int64(1), report.Unprotected)
+	if assert.Len(t, report.Expiring, 2) {
+		assert.Equal(t, "soon/b", report.Expiring[0].Key)
+		assert.Equal(t, "soon/a", report.Expiring[1].Key)
+	}
+	assert.Contains(t, report.String(), "2 versions expire within")
+
+	report, err = s3c.AuditRetention(RetentionAuditOptions{Prefix: "soon/", MaxExpiring: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), report.ExpiringCount)
+	assert.Len(t, report.Expiring, 1)
+}
+
+func TestExtendRetention(t *testing.T) {
+	srv := s3fake.New()
+	defer srv.Close()
+	s3c := lockedFakeSession(t, srv, "locked")
+	now := time.Now().UTC()
+	target := now.AddDate(7, 0, 0)
+	putLocked(t, s3c, "x/short", s3.ObjectLockRetentionModeCompliance, now.Add(24*time.Hour))
+	putLocked(t, s3c, "x/long", s3.ObjectLockRetentionModeGovernance, now.AddDate(10, 0, 0))
+	putLocked(t, s3c, "x/none", "", time.Time{})
+	putLocked(t, s3c, "y/other", s3.ObjectLockRetentionModeGovernance, now.Add(24*time.Hour))
+
+	// without a mode the unretained version cannot be extended
+	changes, err := s3c.ExtendRetention(RetentionExtendOptions{Prefix: "x/", RetainUntil: target, DryRun: true})
+	assert.ErrorContains(t, err, "1 versions")
+	if assert.Len(t, changes, 3) {
+		assert.Equal(t, RetentionUnchanged, changes[0].Action) // x/long
+		assert.Equal(t, RetentionFailed, changes[1].Action)    // x/none
+		assert.Equal(t, RetentionExtended, changes[2].Action)  // x/short
+	}
+	r, err := s3c.GetObjectRetention("x/short", "")
+	assert.NoError(t, err)
+	assert.True(t, aws.TimeValue(r.Retention.RetainUntilDate).Before(target), "dry run must not change retention")
+
+	journal := filepath.Join(t.TempDir(), "retention.jsonl")
+	opts := RetentionExtendOptions{Prefix: "x/", RetainUntil: target, Mode: s3.ObjectLockRetentionModeGovernance, JournalPath: journal}
+	changes, err = s3c.ExtendRetention(opts)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+	for key, mode := range map[string]string{"x/short": "COMPLIANCE", "x/none": "GOVERNANCE"} {
+		r, err := s3c.GetObjectRetention(key, "")
+		if assert.NoError(t, err, key) {
+			assert.Equal(t, mode, aws.StringValue(r.Retention.Mode), key)
+			assert.False(t, aws.TimeValue(r.Retention.RetainUntilDate).Before(target.Truncate(time.Second)), key)
+		}
+	}
+	r, err = s3c.GetObjectRetention("x/long", "")
+	assert.NoError(t, err)
+	assert.True(t, aws.TimeValue(r.Retention.RetainUntilDate).After(target), "retention must never be shortened")
+	r, err = s3c.GetObjectRetention("y/other", "")
+	assert.NoError(t, err)
+	assert.True(t, aws.TimeValue(r.Retention.RetainUntilDate).Before(target), "outside the prefix")
+
+	recorded, err := ReadRetentionJournal(journal)
+	assert.NoError(t, err)
+	assert.Len(t, recorded, 3)
+
+	// a rerun with the journal has nothing left to do
+	changes, err = s3c.ExtendRetention(opts)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// a later date extends again despite the journal; x/long already
+	// reaches past it
+	opts.RetainUntil = target.AddDate(1, 0, 0)
+	changes, err = s3c.ExtendRetention(opts)
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, RetentionExtended, changes[0].Action)
+		assert.Equal(t, RetentionExtended, changes[1].Action)
+	}
+	r, err = s3c.GetObjectRetention("x/short", "")
+	assert.NoError(t, err)
+	assert.False(t, aws.TimeValue(r.Retention.RetainUntilDate).Before(opts.RetainUntil.Truncate(time.Second)))
+}
@@ -0,0 +1,361 @@
+package alfredo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RetryPolicy retries S3 operations that failed for a transient reason, with
+// exponential backoff and jitter. Throttling responses are also reported to
+// Limiter, if set, so a job sheds concurrency while the endpoint keeps
+// pushing back.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first; 0 leaves only MaxElapsed
+	BaseDelay   time.Duration // delay before the first retry, doubled for each further one
+	MaxDelay    time.Duration // cap on a single delay
+	MaxElapsed  time.Duration // stop retrying once this much time has passed; 0 means no limit
+	Jitter      float64       // fraction (0..1) of each delay that is randomised
+	Limiter     *ConcurrencyLimiter
+}
+
+const (
+	defaultRetryAttempts   = 5
+	defaultRetryBaseDelay  = 500 * time.Millisecond
+	defaultRetryMaxDelay   = 30 * time.Second
+	defaultRetryMaxElapsed = 5 * time.Minute
+	defaultRetryJitter     = 0.5
+)
+
+var defaultRetryPolicy = NewRetryPolicy()
+
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: defaultRetryAttempts,
+		BaseDelay:   defaultRetryBaseDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+		MaxElapsed:  defaultRetryMaxElapsed,
+		Jitter:      defaultRetryJitter,
+	}
+}
+
+// WithLimiter returns a copy of the policy that reports throttling to l.
+func (p *RetryPolicy) WithLimiter(l *ConcurrencyLimiter) *RetryPolicy {
+	if p == nil {
+		p = defaultRetryPolicy
+	}
+	newPolicy := *p
+	newPolicy.Limiter = l
+	return &newPolicy
+}
+
+// Do runs operation until it succeeds, fails with an error that is not worth
+// retrying, or the policy's attempts or elapsed time run out. A nil policy
+// uses the defaults.
+func (p *RetryPolicy) Do(ctx context.Context, operation func() error) error {
+	if p == nil {
+		p = defaultRetryPolicy
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil {
+			p.Limiter.Succeeded()
+			return nil
+		}
+		if IsThrottleError(err) {
+			p.Limiter.Throttled()
+		}
+		if !IsRetryableError(err) {
+			return err
+		}
+		if (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) || (p.MaxAttempts <= 0 && p.MaxElapsed <= 0) {
+			return fmt.Errorf("operation failed after %d attempts: %v", attempt, err)
+		}
+		delay := p.backoff(attempt)
+		if p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed {
+			return fmt.Errorf("operation failed after %d attempts in %s: %v", attempt, time.Since(start).Round(time.Millisecond), err)
+		}
+		VerbosePrintf("retrying in %s after attempt %d: %v", delay, attempt, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("operation abandoned after %d attempts: %v (last error: %v)", attempt, ctx.Err(), err)
+		}
+	}
+}
+
+// backoff is the delay after the given (1-based) failed attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 && delay > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// throttleCodes are the error codes S3 and compatible endpoints use to ask
+// clients to slow down.
+var throttleCodes = map[string]bool{
+	"SlowDown":                               true,
+	"ServiceUnavailable":                     true,
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"RequestLimitExceeded":                   true,
+	"TooManyRequests":                        true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+}
+
+// transientCodes fail for reasons unrelated to the request itself.
+var transientCodes = map[string]bool{
+	"RequestTimeout":          true,
+	"RequestTimeoutException": true,
+	"InternalError":           true,
+	"OperationAborted":        true,
+}
+
+// IsThrottleError reports whether err is the endpoint asking us to back off.
+func IsThrottleError(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	if throttleCodes[aerr.Code()] {
+		return true
+	}
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) {
+		return rerr.StatusCode() == http.StatusServiceUnavailable || rerr.StatusCode() == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// IsRetryableError reports whether err is worth another attempt: throttling,
+// timeouts, 5xx responses other than 501 and connection failures are; missing
+// keys or buckets, access errors, 501 and other 4xx responses are not. Errors
+// that did not come from the SDK are assumed to be transient.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if IsThrottleError(err) {
+		return true
+	}
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return true
+	}
+	if aerr.Code() == request.CanceledErrorCode {
+		return false
+	}
+	if transientCodes[aerr.Code()] {
+		return true
+	}
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) && rerr.StatusCode() != 0 {
+		// 501 is a capability the server lacks, not a passing fault
+		return rerr.StatusCode() >= 500 && rerr.StatusCode() != http.StatusNotImplemented
+	}
+	return request.IsErrorRetryable(err)
+}
+
+// withRetry runs operation under the default policy.
+func withRetry(operation func() error) error {
+	return defaultRetryPolicy.Do(context.Background(), operation)
+}
+
+const (
+	defaultShrinkAfter    = 3
+	defaultGrowAfter      = 50
+	defaultThrottleWindow = 10 * time.Second
+)
+
+// ConcurrencyLimiter caps how many workers run at once, below the size of the
+// worker pool they already hold a slot in. When throttling persists
+// (ShrinkAfter throttled responses within Window) the limit is halved; after
+// GrowAfter successes without throttling it grows back by one, up to the
+// original maximum. A nil limiter does nothing.
+type ConcurrencyLimiter struct {
+	ShrinkAfter int
+	GrowAfter   int
+	Window      time.Duration
+
+	mu            sync.Mutex
+	cond          *sync.Cond
+	max           int
+	limit         int
+	active        int
+	throttles     int
+	firstThrottle time.Time
+	successes     int
+}
+
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	if max < 1 {
+		max = 1
+	}
+	l := &ConcurrencyLimiter{
+		ShrinkAfter: defaultShrinkAfter,
+		GrowAfter:   defaultGrowAfter,
+		Window:      defaultThrottleWindow,
+		max:         max,
+		limit:       max,
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Acquire blocks until fewer than Limit() workers are active.
+func (l *ConcurrencyLimiter) Acquire() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+}
+
+func (l *ConcurrencyLimiter) Release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+func (l *ConcurrencyLimiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Throttled records a throttled response and halves the limit once
+// throttling has persisted.
+func (l *ConcurrencyLimiter) Throttled() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.successes = 0
+	if l.throttles == 0 || now.Sub(l.firstThrottle) > l.Window {
+		l.throttles = 0
+		l.firstThrottle = now
+	}
+	l.throttles++
+	if l.throttles < l.ShrinkAfter || l.limit == 1 {
+		return
+	}
+	l.throttles = 0
+	l.limit /= 2
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	log.Printf("Endpoint keeps throttling; reducing concurrency to %d", l.limit)
+}
+
+// Succeeded records a successful request and grows the limit back once the
+// endpoint has stopped throttling for a while.
+func (l *ConcurrencyLimiter) Succeeded() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.limit >= l.max {
+		l.mu.Unlock()
+		return
+	}
+	l.successes++
+	if l.successes < l.GrowAfter {
+		l.mu.Unlock()
+		return
+	}
+	l.successes = 0
+	l.limit++
+	log.Printf("Endpoint has recovered; raising concurrency to %d", l.limit)
+	l.mu.Unlock()
+	l.cond.Signal()
+}
+
+// WithRetryPolicy sets the policy used by the session's sync, delete and copy
+// helpers.
+func (s3c *S3ClientSession) WithRetryPolicy(p *RetryPolicy) *S3ClientSession {
+	s3c.RetryPolicy = p
+	return s3c
+}
+
+func (s3c *S3ClientSession) retry(operation func() error) error {
+	return s3c.RetryPolicy.Do(s3c.ctx, operation)
+}
+
+// WithRetryPolicy sets the policy for every S3 call of the migration. Unless
+// the policy already has one, it is given a ConcurrencyLimiter sized to the
+// worker pool so persistent throttling reduces the number of concurrent copies.
+func (mgr *MigrationMgrStruct) WithRetryPolicy(p *RetryPolicy) *MigrationMgrStruct {
+	if p == nil || p.Limiter == nil {
+		p = p.WithLimiter(NewConcurrencyLimiter(cap(mgr.WorkerPool)))
+	}
+	mgr.Retry = p
+	return mgr
+}
+
+func (mgr *MigrationMgrStruct) retry(operation func() error) error {
+	return mgr.Retry.Do(mgr.SourceS3.ctx, operation)
+}
+
+// acquireWorker takes a worker pool slot and then waits for the adaptive limit.
+func (mgr *MigrationMgrStruct) acquireWorker() {
+	mgr.WorkerPool <- struct{}{}
+	mgr.Retry.limiter().Acquire()
+}
+
+func (mgr *MigrationMgrStruct) releaseWorker() {
+	mgr.Retry.limiter().Release()
+	<-mgr.WorkerPool
+}
+
+func (p *RetryPolicy) limiter() *ConcurrencyLimiter {
+	if p == nil {
+		return nil
+	}
+	return p.Limiter
+}
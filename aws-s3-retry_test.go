@@ -0,0 +1,148 @@
+package alfredo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockS3Client) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	args := m.Called(input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
+}
+
+func fastRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, Jitter: 0.5}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	slowDown := awserr.NewRequestFailure(awserr.New("SlowDown", "reduce your request rate", nil), 503, "req")
+	assert.True(t, IsThrottleError(slowDown))
+	assert.True(t, IsRetryableError(slowDown))
+	assert.True(t, IsThrottleError(awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 503, "req")))
+	assert.True(t, IsRetryableError(awserr.New("RequestTimeout", "", nil)))
+	assert.False(t, IsThrottleError(awserr.New("RequestTimeout", "", nil)))
+	assert.True(t, IsRetryableError(awserr.NewRequestFailure(awserr.New("InternalError", "", nil), 500, "req")))
+	assert.True(t, IsRetryableError(errors.New("connection reset by peer")))
+
+	assert.False(t, IsRetryableError(awserr.NewRequestFailure(awserr.New("NoSuchKey", "", nil), 404, "req")))
+	assert.False(t, IsRetryableError(awserr.NewRequestFailure(awserr.New("AccessDenied", "", nil), 403, "req")))
+	assert.False(t, IsRetryableError(awserr.NewRequestFailure(awserr.New("NotImplemented", "", nil), 501, "req")))
+	assert.False(t, IsRetryableError(context.Canceled))
+	assert.False(t, IsRetryableError(nil))
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	p := fastRetryPolicy()
+	calls := 0
+	err := p.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return awserr.New("SlowDown", "", nil)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	// not retryable: the error comes back as is
+	calls = 0
+	noKey := awserr.New("NoSuchKey", "", nil)
+	err = p.Do(context.Background(), func() error { calls++; return noKey })
+	assert.Equal(t, noKey, err)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	err = p.Do(context.Background(), func() error { calls++; return awserr.New("InternalError", "", nil) })
+	assert.Error(t, err)
+	assert.Equal(t, 4, calls)
+
+	// the elapsed time bound stops retries before the attempts run out
+	p = &RetryPolicy{BaseDelay: 20 * time.Millisecond, MaxElapsed: 50 * time.Millisecond}
+	calls = 0
+	start := time.Now()
+	err = p.Do(context.Background(), func() error { calls++; return awserr.New("SlowDown", "", nil) })
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, 2, calls)
+
+	for attempt := 1; attempt < 10; attempt++ {
+		d := fastRetryPolicy().backoff(attempt)
+		assert.LessOrEqual(t, d, 5*time.Millisecond)
+		assert.Greater(t, d, time.Duration(0))
+	}
+}
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	l := NewConcurrencyLimiter(8)
+	l.ShrinkAfter = 2
+	l.GrowAfter = 3
+
+	l.Throttled()
+	assert.Equal(t, 8, l.Limit())
+	l.Throttled()
+	assert.Equal(t, 4, l.Limit())
+	for i := 0; i < 10; i++ {
+		l.Throttled()
+	}
+	assert.Equal(t, 1, l.Limit())
+
+	for i := 0; i < 3; i++ {
+		l.Succeeded()
+	}
+	assert.Equal(t, 2, l.Limit())
+
+	// a lowered limit blocks the next worker until one is released
+	l.Acquire()
+	l.Acquire()
+	acquired := make(chan struct{})
+	go func() {
+		l.Acquire()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquired beyond the limit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	l.Release()
+	<-acquired
+
+	// the policy feeds the limiter
+	p := fastRetryPolicy().WithLimiter(NewConcurrencyLimiter(4))
+	p.Limiter.ShrinkAfter = 2
+	calls := 0
+	assert.NoError(t, p.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return awserr.New("SlowDown", "", nil)
+		}
+		return nil
+	}))
+	assert.Equal(t, 2, p.Limiter.Limit())
+
+	var none *ConcurrencyLimiter
+	none.Acquire()
+	none.Throttled()
+	none.Release()
+}
+
+func TestDeleteObjectRetriesThrottling(t *testing.T) {
+	mockS3 := new(MockS3Client)
+	mockS3.On("DeleteObject", mock.Anything).Return(nil, awserr.NewRequestFailure(awserr.New("SlowDown", "", nil), 503, "req")).Once()
+	mockS3.On("DeleteObject", mock.Anything).Return(&s3.DeleteObjectOutput{}, nil).Once()
+	s3c := &S3ClientSession{Client: mockS3, Bucket: "bucket"}
+	s3c.WithRetryPolicy(fastRetryPolicy())
+
+	assert.NoError(t, s3c.DeleteObject("key"))
+	mockS3.AssertNumberOfCalls(t, "DeleteObject", 2)
+}
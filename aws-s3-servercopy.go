@@ -0,0 +1,307 @@
+package alfredo
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	CopyMethodServer    = "server"
+	CopyMethodServerMPU = "server-mpu"
+)
+
+// serverCopyState is shared by every copy of a MigrationMgrStruct so that a
+// rejection of server-side copy as such switches the whole job to streaming.
+type serverCopyState struct {
+	disabled int32
+	attempts int64
+}
+
+// begin counts a server-side copy attempt and reports whether it is the
+// job's first.
+func (s *serverCopyState) begin() bool {
+	return atomic.AddInt64(&s.attempts, 1) == 1
+}
+
+func (s *serverCopyState) usable() bool {
+	return s != nil && atomic.LoadInt32(&s.disabled) == 0
+}
+
+func (s *serverCopyState) reject(err error) {
+	if atomic.CompareAndSwapInt32(&s.disabled, 0, 1) {
+		log.Printf("Server-side copy rejected (%v); streaming through this host instead", err)
+	}
+}
+
+// WithServerSideCopy turns server-side copies on or off. They are on by
+// default and only used when SameEndpoint reports the two sides can see each
+// other's buckets.
+func (mgr *MigrationMgrStruct) WithServerSideCopy(enabled bool) *MigrationMgrStruct {
+	if enabled {
+		mgr.serverCopy = &serverCopyState{}
+	} else {
+		mgr.serverCopy = nil
+	}
+	return mgr
+}
+
+func normalizeEndpoint(endpoint string) string {
+	endpoint = strings.ToLower(strings.TrimSpace(endpoint))
+	endpoint = strings.TrimPrefix(endpoint, "https://")
+	endpoint = strings.TrimPrefix(endpoint, "http://")
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// SameEndpoint reports whether a and b talk to the same S3 service with the
+// same identity, so the target can read the source bucket directly. Sessions
+// that name neither credentials nor a profile are never considered the same.
+func SameEndpoint(a, b *S3ClientSession) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if len(a.Credentials.AccessKey) == 0 && len(a.Credentials.Profile) == 0 {
+		return false
+	}
+	return normalizeEndpoint(a.Endpoint) == normalizeEndpoint(b.Endpoint) &&
+		a.Region == b.Region &&
+		a.Credentials.AccessKey == b.Credentials.AccessKey &&
+		a.Credentials.SecretKey == b.Credentials.SecretKey &&
+		a.Credentials.Profile == b.Credentials.Profile
+}
+
+// copySource is the x-amz-copy-source value for the current source object.
+func (mgr *MigrationMgrStruct) copySource() string {
+	source := (&url.URL{Path: mgr.SourceS3.Bucket + "/" + mgr.SourceS3.ObjectKey}).EscapedPath()
+	if len(mgr.SourceVersionId) > 0 {
+		source += "?versionId=" + url.QueryEscape(mgr.SourceVersionId)
+	}
+	return source
+}
+
+// isServerCopyUnsupported reports whether err means the server does not
+// implement server-side copy at all.
+func isServerCopyUnsupported(err error) bool {
+	switch ErrorCode(err) {
+	case "NotImplemented", "XNotImplemented":
+		return true
+	}
+	var rerr awserr.RequestFailure
+	return errors.As(err, &rerr) && rerr.StatusCode() == http.StatusNotImplemented
+}
+
+// isServerCopyRefused reports whether the server refused to copy this object
+// server side, which streaming it may still get around.
+func isServerCopyRefused(err error) bool {
+	switch ErrorCode(err) {
+	case "InvalidRequest", "MethodNotAllowed", "AccessDenied":
+		return true
+	}
+	return false
+}
+
+// tryServerSideCopy copies the object without streaming it through this host
+// when the endpoints allow it. copied is false when the caller should stream
+// instead, either because server-side copy does not apply or because the
+// server rejected it.
+func (mgr *MigrationMgrStruct) tryServerSideCopy(size int64) (copied bool, err error) {
+	if !mgr.serverCopy.usable() || !SameEndpoint(mgr.SourceS3, mgr.TargetS3) {
+		return false, nil
+	}
+	first := mgr.serverCopy.begin()
+	if size < defaultPartSizeMin {
+		mgr.copyMethod = CopyMethodServer
+		err = mgr.CopyObjectServerSide()
+	} else {
+		mgr.copyMethod = CopyMethodServerMPU
+		err = mgr.CopyObjectServerSideMPU()
+	}
+	switch {
+	case err == nil:
+		return true, nil
+	// a refusal of the job's first copy is taken to be about the buckets;
+	// later ones are about the object, so only that object is streamed
+	case isServerCopyUnsupported(err) || (first && isServerCopyRefused(err)):
+		mgr.serverCopy.reject(err)
+		return false, nil
+	case isServerCopyRefused(err):
+		log.Printf("Server-side copy of s3://%s/%s refused (%v); streaming it instead", mgr.SourceS3.Bucket, mgr.SourceS3.ObjectKey, err)
+		return false, nil
+	}
+	return false, err
+}
+
+// CopyObjectServerSide copies the object with a single CopyObject request.
+// Metadata, tags and the ACL come along only when PreserveMetadata is set,
+// matching the streaming copy.
+func (mgr *MigrationMgrStruct) CopyObjectServerSide() error {
+	if len(mgr.TargetS3.ObjectKey) == 0 {
+		mgr.TargetS3.ObjectKey = mgr.targetKey(mgr.SourceS3.ObjectKey)
+	}
+	input := mgr.TargetS3.encryptCopy(&s3.CopyObjectInput{
+		Bucket:     aws.String(mgr.TargetS3.Bucket),
+		Key:        aws.String(mgr.TargetS3.ObjectKey),
+		CopySource: aws.String(mgr.copySource()),
+	}, mgr.SourceS3)
+	if !mgr.PreserveMetadata {
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+	}
+	var output *s3.CopyObjectOutput
+	err := mgr.retry(func() error {
+		var err error
+		mgr.targetRequest()
+		output, err = mgr.TargetS3.Client.CopyObjectWithContext(mgr.TargetS3.ctx, input)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy object server side: %v", err)
+	}
+	mgr.TargetVersionId = aws.StringValue(output.VersionId)
+	if output.CopyObjectResult != nil {
+		mgr.targetETag = aws.StringValue(output.CopyObjectResult.ETag)
+	}
+	if err := mgr.applyObjectLock(); err != nil {
+		return err
+	}
+	if err := mgr.applyObjectACL(); err != nil {
+		return err
+	}
+	if mgr.SourceHead != nil {
+		atomic.AddInt64(&mgr.Progress.CompletedBytes, aws.Int64Value(mgr.SourceHead.ContentLength))
+	}
+	return nil
+}
+
+// CopyObjectServerSideMPU copies the object as a multipart upload whose parts
+// are UploadPartCopy ranges of the source.
+func (mgr *MigrationMgrStruct) CopyObjectServerSideMPU() error {
+	if len(mgr.TargetS3.ObjectKey) == 0 {
+		mgr.TargetS3.ObjectKey = mgr.targetKey(mgr.SourceS3.ObjectKey)
+	}
+	objectSize, partSize, partsCount, err := mgr.sourcePartLayout()
+	if err != nil {
+		return err
+	}
+	if err := mgr.loadSourceTagging(); err != nil {
+		return err
+	}
+	createInput := mgr.TargetS3.encryptCreateMPU(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String(mgr.TargetS3.Bucket),
+		Key:    aws.String(mgr.TargetS3.ObjectKey),
+	})
+	mgr.applyMetadataToCreateMPU(createInput)
+	var createOutput *s3.CreateMultipartUploadOutput
+	err = mgr.retry(func() error {
+		var err error
+		mgr.targetRequest()
+		createOutput, err = mgr.TargetS3.Client.CreateMultipartUploadWithContext(mgr.TargetS3.ctx, createInput)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload: %v", err)
+	}
+	log.Printf("Copying s3://%s/%s to s3://%s/%s server side in %d parts", mgr.SourceS3.Bucket, mgr.SourceS3.ObjectKey,
+		mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey, partsCount)
+
+	parts := make([]*s3.CompletedPart, partsCount)
+	partsChan := make(chan int64, partsCount)
+	for i := int64(1); i <= partsCount; i++ {
+		partsChan <- i
+	}
+	close(partsChan)
+
+	// bytes of the parts copied so far, taken back off the progress if the
+	// upload is abandoned, as the object is then streamed or failed whole
+	var copiedBytes int64
+	uncount := func() {
+		atomic.AddInt64(&mgr.Progress.CompletedBytes, -atomic.LoadInt64(&copiedBytes))
+	}
+	var firstErr error
+	var errOnce sync.Once
+	var uploadWg sync.WaitGroup
+	for i := 0; i < mgr.SourceS3.GetConcurrency(); i++ {
+		uploadWg.Add(1)
+		go func() {
+			defer uploadWg.Done()
+			for partNumber := range partsChan {
+				startByte := (partNumber - 1) * partSize
+				endByte := min(startByte+partSize, objectSize) - 1
+				var output *s3.UploadPartCopyOutput
+				err := mgr.retry(func() error {
+					var err error
+					mgr.targetRequest()
+					output, err = mgr.TargetS3.Client.UploadPartCopyWithContext(mgr.TargetS3.ctx, mgr.TargetS3.encryptUploadPartCopy(&s3.UploadPartCopyInput{
+						Bucket:          aws.String(mgr.TargetS3.Bucket),
+						Key:             aws.String(mgr.TargetS3.ObjectKey),
+						PartNumber:      aws.Int64(partNumber),
+						UploadId:        createOutput.UploadId,
+						CopySource:      aws.String(mgr.copySource()),
+						CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", startByte, endByte)),
+					}, mgr.SourceS3))
+					return err
+				})
+				if err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("failed to copy part %d: %v", partNumber, err) })
+					return
+				}
+				parts[partNumber-1] = &s3.CompletedPart{
+					ETag:       output.CopyPartResult.ETag,
+					PartNumber: aws.Int64(partNumber),
+				}
+				atomic.AddInt64(&mgr.Progress.CompletedBytes, endByte-startByte+1)
+				atomic.AddInt64(&copiedBytes, endByte-startByte+1)
+			}
+		}()
+	}
+	uploadWg.Wait()
+
+	if firstErr != nil {
+		uncount()
+		abortErr := mgr.retry(func() error {
+			mgr.targetRequest()
+			_, err := mgr.TargetS3.Client.AbortMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(mgr.TargetS3.Bucket),
+				Key:      aws.String(mgr.TargetS3.ObjectKey),
+				UploadId: createOutput.UploadId,
+			})
+			return err
+		})
+		if abortErr != nil {
+			log.Printf("WARNING: failed to abort multipart upload: %v (original error: %v)", abortErr, firstErr)
+		}
+		return firstErr
+	}
+
+	var completeOutput *s3.CompleteMultipartUploadOutput
+	err = mgr.retry(func() error {
+		var err error
+		mgr.targetRequest()
+		completeOutput, err = mgr.TargetS3.Client.CompleteMultipartUploadWithContext(mgr.TargetS3.ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(mgr.TargetS3.Bucket),
+			Key:             aws.String(mgr.TargetS3.ObjectKey),
+			UploadId:        createOutput.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		return err
+	})
+	if err != nil {
+		uncount()
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	mgr.TargetVersionId = aws.StringValue(completeOutput.VersionId)
+	mgr.targetETag = aws.StringValue(completeOutput.ETag)
+	if err := mgr.applyObjectLock(); err != nil {
+		return err
+	}
+	return mgr.applyObjectACL()
+}
@@ -0,0 +1,176 @@
+package alfredo
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockS3Client) CopyObjectWithContext(ctx context.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.CopyObjectOutput), args.Error(1)
+}
+
+func (m *MockS3Client) UploadPartCopyWithContext(ctx context.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.UploadPartCopyOutput), args.Error(1)
+}
+
+func newServerCopyMgr(client *MockS3Client, size int64) *MigrationMgrStruct {
+	logger := log.New(io.Discard, "", 0)
+	cred := S3credStruct{AccessKey: "ak", SecretKey: "sk"}
+	src := &S3ClientSession{Client: client, Bucket: "source-bucket", Endpoint: "https://s3.example.com", Credentials: cred}
+	tgt := &S3ClientSession{Client: client, Bucket: "target-bucket", Endpoint: "s3.example.com/", Credentials: cred}
+	mgr := NewMigrationManager(src, tgt, &ProgressTracker{}, logger, logger, 100).WithRetryPolicy(fastRetryPolicy())
+	mgr.SourceS3.ObjectKey = "dir/a b.txt"
+	mgr.TargetS3.ObjectKey = "dir/a b.txt"
+	mgr.SourceHead = &s3.HeadObjectOutput{ContentLength: aws.Int64(size)}
+	return mgr
+}
+
+func TestSameEndpoint(t *testing.T) {
+	cred := S3credStruct{AccessKey: "ak", SecretKey: "sk"}
+	a := &S3ClientSession{Endpoint: "https://S3.example.com/", Credentials: cred}
+	assert.True(t, SameEndpoint(a, &S3ClientSession{Endpoint: "s3.example.com", Credentials: cred}))
+	assert.False(t, SameEndpoint(a, &S3ClientSession{Endpoint: "s3.other.com", Credentials: cred}))
+	assert.False(t, SameEndpoint(a, &S3ClientSession{Endpoint: "s3.example.com", Credentials: S3credStruct{AccessKey: "other", SecretKey: "sk"}}))
+	assert.False(t, SameEndpoint(a, nil))
+	assert.False(t, SameEndpoint(&S3ClientSession{}, &S3ClientSession{}))
+}
+
+func TestServerSideCopy(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("CopyObjectWithContext", mock.Anything, mock.MatchedBy(func(in *s3.CopyObjectInput) bool {
+		return *in.CopySource == "source-bucket/dir/a%20b.txt" && *in.MetadataDirective == s3.MetadataDirectiveReplace
+	})).Return(&s3.CopyObjectOutput{CopyObjectResult: &s3.CopyObjectResult{ETag: aws.String(`"e"`)}}, nil)
+	mgr := newServerCopyMgr(client, 100)
+
+	copied, err := mgr.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.True(t, copied)
+	assert.Equal(t, CopyMethodServer, mgr.copyMethod)
+	assert.Equal(t, `"e"`, mgr.targetETag)
+	assert.Equal(t, int64(100), mgr.Progress.CompletedBytes)
+
+	// a different endpoint streams
+	mgr.TargetS3.Endpoint = "s3.other.com"
+	copied, err = mgr.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	client.AssertNumberOfCalls(t, "CopyObjectWithContext", 1)
+}
+
+func TestServerSideCopyFallsBackWhenRejected(t *testing.T) {
+	client := new(MockS3Client)
+	client.On("CopyObjectWithContext", mock.Anything, mock.Anything).
+		Return(nil, awserr.NewRequestFailure(awserr.New("NotImplemented", "cross-bucket copy is not supported", nil), 501, "req"))
+	mgr := newServerCopyMgr(client, 100)
+
+	copied, err := mgr.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+
+	// the rejection is remembered by every copy of the manager
+	other := newServerCopyMgr(client, 100)
+	other.serverCopy = mgr.serverCopy
+	copied, err = other.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	client.AssertNumberOfCalls(t, "CopyObjectWithContext", 1)
+
+	// access denied on the first copy is about the buckets, so it disables
+	// server-side copy too
+	denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "req")
+	client1 := new(MockS3Client)
+	client1.On("CopyObjectWithContext", mock.Anything, mock.Anything).Return(nil, denied)
+	mgr = newServerCopyMgr(client1, 100)
+	copied, err = mgr.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	assert.False(t, mgr.serverCopy.usable())
+
+	// other failures are reported, not streamed around
+	client2 := new(MockS3Client)
+	client2.On("CopyObjectWithContext", mock.Anything, mock.Anything).
+		Return(nil, awserr.NewRequestFailure(awserr.New("NoSuchKey", "", nil), 404, "req"))
+	_, err = newServerCopyMgr(client2, 100).tryServerSideCopy(100)
+	assert.Error(t, err)
+}
+
+func TestServerSideCopyRefusedForOneObject(t *testing.T) {
+	denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), 403, "req")
+	client := new(MockS3Client)
+	client.On("CopyObjectWithContext", mock.Anything, mock.Anything).
+		Return(&s3.CopyObjectOutput{CopyObjectResult: &s3.CopyObjectResult{ETag: aws.String(`"e"`)}}, nil).Once()
+	client.On("CopyObjectWithContext", mock.Anything, mock.Anything).Return(nil, denied)
+	mgr := newServerCopyMgr(client, 100)
+
+	copied, err := mgr.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.True(t, copied)
+
+	// a later refusal only streams that object
+	copied, err = mgr.tryServerSideCopy(100)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	assert.True(t, mgr.serverCopy.usable())
+}
+
+func TestServerSideCopyMPUFallbackUncountsParts(t *testing.T) {
+	const size = 12 * 1024 * 1024
+	client := new(MockS3Client)
+	client.On("CreateMultipartUploadWithContext", mock.Anything, mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("u")}, nil)
+	client.On("UploadPartCopyWithContext", mock.Anything, mock.MatchedBy(func(in *s3.UploadPartCopyInput) bool {
+		return aws.Int64Value(in.PartNumber) < 3
+	})).Return(&s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"p"`)}}, nil)
+	client.On("UploadPartCopyWithContext", mock.Anything, mock.Anything).
+		Return(nil, awserr.NewRequestFailure(awserr.New("NotImplemented", "", nil), 501, "req"))
+	client.On("AbortMultipartUploadWithContext", mock.Anything, mock.Anything).Return(&s3.AbortMultipartUploadOutput{}, nil)
+	mgr := newServerCopyMgr(client, size)
+
+	copied, err := mgr.tryServerSideCopy(size)
+	assert.NoError(t, err)
+	assert.False(t, copied)
+	assert.Equal(t, int64(0), mgr.Progress.CompletedBytes, "the streamed copy counts the bytes again")
+	client.AssertCalled(t, "AbortMultipartUploadWithContext", mock.Anything, mock.Anything)
+}
+
+func TestServerSideCopyMPU(t *testing.T) {
+	const size = 12 * 1024 * 1024
+	client := new(MockS3Client)
+	client.On("CreateMultipartUploadWithContext", mock.Anything, mock.Anything).Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String("u")}, nil)
+	client.On("UploadPartCopyWithContext", mock.Anything, mock.Anything).Return(&s3.UploadPartCopyOutput{CopyPartResult: &s3.CopyPartResult{ETag: aws.String(`"p"`)}}, nil)
+	client.On("CompleteMultipartUploadWithContext", mock.Anything, mock.MatchedBy(func(in *s3.CompleteMultipartUploadInput) bool {
+		return len(in.MultipartUpload.Parts) == 3
+	})).Return(&s3.CompleteMultipartUploadOutput{ETag: aws.String(`"m-3"`)}, nil)
+	mgr := newServerCopyMgr(client, size)
+
+	copied, err := mgr.tryServerSideCopy(size)
+	assert.NoError(t, err)
+	assert.True(t, copied)
+	assert.Equal(t, CopyMethodServerMPU, mgr.copyMethod)
+	assert.Equal(t, int64(size), mgr.Progress.CompletedBytes)
+
+	var ranges []string
+	for _, call := range client.Calls {
+		if call.Method == "UploadPartCopyWithContext" {
+			ranges = append(ranges, *call.Arguments.Get(1).(*s3.UploadPartCopyInput).CopySourceRange)
+		}
+	}
+	// parts are never below the 5 MiB minimum
+	assert.ElementsMatch(t, []string{"bytes=0-5242879", "bytes=5242880-10485759", "bytes=10485760-12582911"}, ranges)
+}
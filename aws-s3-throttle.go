@@ -0,0 +1,243 @@
+package alfredo
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// TokenBucket limits a rate of units (bytes or requests) per second with a
+// burst of one second's worth. A rate of zero or less means unlimited. Callers
+// may take more than the burst at once; the bucket then goes into debt and the
+// caller waits until it is repaid, so large parts are paced rather than refused.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64) *TokenBucket {
+	return &TokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// SetRate changes the rate at runtime; waiters pick it up on their next take.
+func (tb *TokenBucket) SetRate(rate float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	tb.rate = rate
+	if tb.tokens > rate {
+		tb.tokens = rate
+	}
+}
+
+func (tb *TokenBucket) Rate() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.rate
+}
+
+// refill adds the tokens earned since the last call; the caller holds tb.mu.
+func (tb *TokenBucket) refill() {
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.rate {
+		tb.tokens = tb.rate
+	}
+	tb.last = now
+}
+
+// WaitN takes n tokens, blocking until the bucket can afford them or ctx ends.
+func (tb *TokenBucket) WaitN(ctx context.Context, n int64) error {
+	if tb == nil || n <= 0 {
+		return nil
+	}
+	tb.mu.Lock()
+	if tb.rate <= 0 {
+		tb.mu.Unlock()
+		return nil
+	}
+	tb.refill()
+	tb.tokens -= float64(n)
+	var wait time.Duration
+	if tb.tokens < 0 {
+		wait = time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	}
+	tb.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ThrottleLimits are the limits for one side of a migration; zero means
+// unlimited.
+type ThrottleLimits struct {
+	BytesPerSec    int64   `json:"bytesPerSec"`
+	RequestsPerSec float64 `json:"requestsPerSec"`
+}
+
+// TransferLimits is also the format of the throttle control file.
+type TransferLimits struct {
+	Source ThrottleLimits `json:"source"`
+	Target ThrottleLimits `json:"target"`
+}
+
+type Throttle struct {
+	Bytes    *TokenBucket
+	Requests *TokenBucket
+}
+
+func newThrottle(limits ThrottleLimits) *Throttle {
+	return &Throttle{
+		Bytes:    NewTokenBucket(float64(limits.BytesPerSec)),
+		Requests: NewTokenBucket(limits.RequestsPerSec),
+	}
+}
+
+func (t *Throttle) setLimits(limits ThrottleLimits) {
+	t.Bytes.SetRate(float64(limits.BytesPerSec))
+	t.Requests.SetRate(limits.RequestsPerSec)
+}
+
+// TransferThrottle paces the source and target sides of a migration
+// independently. It is shared by every copy of a MigrationMgrStruct, so the
+// limits hold for the job as a whole rather than per worker.
+type TransferThrottle struct {
+	Source *Throttle
+	Target *Throttle
+}
+
+func NewTransferThrottle(limits TransferLimits) *TransferThrottle {
+	return &TransferThrottle{
+		Source: newThrottle(limits.Source),
+		Target: newThrottle(limits.Target),
+	}
+}
+
+func (tt *TransferThrottle) SetLimits(limits TransferLimits) {
+	tt.Source.setLimits(limits.Source)
+	tt.Target.setLimits(limits.Target)
+	log.Printf("Throttle limits now source=%s/s %.1f req/s, target=%s/s %.1f req/s",
+		HumanReadableStorageCapacity(limits.Source.BytesPerSec), limits.Source.RequestsPerSec,
+		HumanReadableStorageCapacity(limits.Target.BytesPerSec), limits.Target.RequestsPerSec)
+}
+
+func (tt *TransferThrottle) Limits() TransferLimits {
+	return TransferLimits{
+		Source: ThrottleLimits{BytesPerSec: int64(tt.Source.Bytes.Rate()), RequestsPerSec: tt.Source.Requests.Rate()},
+		Target: ThrottleLimits{BytesPerSec: int64(tt.Target.Bytes.Rate()), RequestsPerSec: tt.Target.Requests.Rate()},
+	}
+}
+
+// WatchControlFile applies the TransferLimits in the JSON file at path
+// whenever it changes (checked every interval) or the process receives
+// SIGHUP, until stop is closed. A missing or malformed file keeps the current
+// limits.
+func (tt *TransferThrottle) WatchControlFile(path string, interval time.Duration, stop <-chan struct{}) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var lastMod time.Time
+		load := func(force bool) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return
+			}
+			if !force && !info.ModTime().After(lastMod) {
+				return
+			}
+			lastMod = info.ModTime()
+			var limits TransferLimits
+			if err := ReadStructFromJSONFile(path, &limits); err != nil {
+				log.Printf("WARNING: ignoring throttle control file %s: %v", path, err)
+				return
+			}
+			tt.SetLimits(limits)
+		}
+
+		load(true)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-sigChan:
+				load(true)
+			case <-ticker.C:
+				load(false)
+			}
+		}
+	}()
+}
+
+// WithThrottle paces the copy paths with the given limits; see
+// TransferThrottle.WatchControlFile to change them while the job runs.
+func (mgr *MigrationMgrStruct) WithThrottle(throttle *TransferThrottle) *MigrationMgrStruct {
+	mgr.Throttle = throttle
+	return mgr
+}
+
+func (mgr *MigrationMgrStruct) sourceRequest() {
+	if mgr.Throttle != nil {
+		mgr.Throttle.Source.Requests.WaitN(mgr.SourceS3.ctx, 1)
+	}
+}
+
+func (mgr *MigrationMgrStruct) targetRequest() {
+	if mgr.Throttle != nil {
+		mgr.Throttle.Target.Requests.WaitN(mgr.TargetS3.ctx, 1)
+	}
+}
+
+// targetBytes is taken before an upload since the SDK may read the body more
+// than once (signing, retries).
+func (mgr *MigrationMgrStruct) targetBytes(n int64) {
+	if mgr.Throttle != nil {
+		mgr.Throttle.Target.Bytes.WaitN(mgr.TargetS3.ctx, n)
+	}
+}
+
+// sourceReader paces reads of a download body against the source bandwidth.
+func (mgr *MigrationMgrStruct) sourceReader(r io.Reader) io.Reader {
+	if mgr.Throttle == nil {
+		return r
+	}
+	return &throttledReader{r: r, bucket: mgr.Throttle.Source.Bytes, ctx: mgr.SourceS3.ctx}
+}
+
+type throttledReader struct {
+	r      io.Reader
+	bucket *TokenBucket
+	ctx    context.Context
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if werr := tr.bucket.WaitN(tr.ctx, int64(n)); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,73 @@
+package alfredo
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketPaces(t *testing.T) {
+	tb := NewTokenBucket(100)
+	ctx := context.Background()
+
+	start := time.Now()
+	assert.NoError(t, tb.WaitN(ctx, 100)) // the initial burst is free
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	start = time.Now()
+	assert.NoError(t, tb.WaitN(ctx, 20))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	// lifting the limit makes takes immediate
+	tb.SetRate(0)
+	start = time.Now()
+	assert.NoError(t, tb.WaitN(ctx, 1<<30))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+
+	var none *TokenBucket
+	assert.NoError(t, none.WaitN(ctx, 10))
+}
+
+func TestTokenBucketHonoursContext(t *testing.T) {
+	tb := NewTokenBucket(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, tb.WaitN(ctx, 1000))
+}
+
+func TestThrottledReader(t *testing.T) {
+	mgr := &MigrationMgrStruct{
+		SourceS3: &S3ClientSession{ctx: context.Background()},
+		Throttle: NewTransferThrottle(TransferLimits{Source: ThrottleLimits{BytesPerSec: 1000}}),
+	}
+	start := time.Now()
+	data, err := io.ReadAll(mgr.sourceReader(bytes.NewReader(make([]byte, 1200))))
+	assert.NoError(t, err)
+	assert.Len(t, data, 1200)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	unthrottled := &MigrationMgrStruct{}
+	r := bytes.NewReader(nil)
+	assert.Equal(t, io.Reader(r), unthrottled.sourceReader(r))
+}
+
+func TestThrottleControlFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "throttle.json")
+	tt := NewTransferThrottle(TransferLimits{})
+	stop := make(chan struct{})
+	defer close(stop)
+
+	want := TransferLimits{
+		Source: ThrottleLimits{BytesPerSec: 1 << 20, RequestsPerSec: 50},
+		Target: ThrottleLimits{BytesPerSec: 2 << 20, RequestsPerSec: 25},
+	}
+	assert.NoError(t, WriteStructToJSONFile(path, want))
+	tt.WatchControlFile(path, 10*time.Millisecond, stop)
+
+	assert.Eventually(t, func() bool { return tt.Limits() == want }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,275 @@
+package alfredo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const (
+	SyncUpload = "upload"
+	SyncDelete = "delete"
+
+	// syncMtimeMetadata holds the local modification time (Unix seconds) of
+	// an uploaded file, so later syncs can tell whether it has changed.
+	syncMtimeMetadata = "Mtime"
+)
+
+// SyncOperation is an upload or delete that S3SyncDirectoryToBucketWithOptions
+// performed, or with SyncOptions.DryRun would perform.
+type SyncOperation struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (op SyncOperation) String() string {
+	if op.Action == SyncDelete {
+		return fmt.Sprintf("delete %s", op.Key)
+	}
+	return fmt.Sprintf("upload %s -> %s (%s)", op.Path, op.Key, op.Reason)
+}
+
+type localFile struct {
+	path string
+	key  string
+	info os.FileInfo
+}
+
+// uploadReason says why the local file must be uploaded, or is empty when the
+// object already holds it. Without Checksum, a file is unchanged when its
+// modification time matches the one recorded at upload or, for objects
+// uploaded by other tools, is not newer than the object.
+func (s3c *S3ClientSession) uploadReason(f localFile, obj *s3.Object, checksum bool) (string, error) {
+	switch {
+	case GetForce():
+		return "forced", nil
+	case obj == nil:
+		return "new", nil
+	case aws.Int64Value(obj.Size) != f.info.Size():
+		return "size changed", nil
+	case checksum:
+		same, err := fileMatchesETag(f.path, f.info.Size(), aws.StringValue(obj.ETag))
+		if err != nil || same {
+			return "", err
+		}
+		return "content changed", nil
+	}
+	var head *s3.HeadObjectOutput
+	err := s3c.retry(func() error {
+		var err error
+		head, err = s3c.Client.HeadObjectWithContext(s3c.ctx, s3c.encryptHead(&s3.HeadObjectInput{
+			Bucket: aws.String(s3c.Bucket),
+			Key:    aws.String(f.key),
+		}))
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to head s3://%s/%s: %v", s3c.Bucket, f.key, err)
+	}
+	for k, v := range head.Metadata {
+		if strings.EqualFold(k, syncMtimeMetadata) {
+			if aws.StringValue(v) == strconv.FormatInt(f.info.ModTime().Unix(), 10) {
+				return "", nil
+			}
+			return "modified", nil
+		}
+	}
+	if f.info.ModTime().After(aws.TimeValue(head.LastModified)) {
+		return "modified", nil
+	}
+	return "", nil
+}
+
+// uploadFile uploads a local file, recording its modification time.
+func (s3c *S3ClientSession) uploadFile(uploader *s3manager.Uploader, f localFile) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	metadata := map[string]*string{syncMtimeMetadata: aws.String(strconv.FormatInt(f.info.ModTime().Unix(), 10))}
+	return s3c.retry(func() error {
+		// each attempt re-reads the file from the start
+		if _, err := file.Seek(0, 0); err != nil {
+			return err
+		}
+		if f.info.Size() < uploader.PartSize {
+			_, err := s3c.Client.PutObjectWithContext(s3c.ctx, s3c.encryptPut(&s3.PutObjectInput{
+				Bucket:   aws.String(s3c.Bucket),
+				Key:      aws.String(f.key),
+				Body:     file,
+				Metadata: metadata,
+			}))
+			return err
+		}
+		_, err := uploader.UploadWithContext(s3c.ctx, s3c.encryptUpload(&s3manager.UploadInput{
+			Bucket:   aws.String(s3c.Bucket),
+			Key:      aws.String(f.key),
+			Body:     file,
+			Metadata: metadata,
+		}))
+		return err
+	})
+}
+
+// S3SyncDirectoryToBucketWithOptions uploads the files under dirPath that are
+// new or changed to opts.Prefix in the bucket, up to GetConcurrency() at a
+// time; with opts.Delete, objects under the prefix that have no local file
+// are deleted. With opts.DryRun nothing is changed. The uploads and deletes,
+// performed or planned, are returned ordered by key; failed uploads are
+// recorded in progress.FailedObjects and do not stop the others.
+func (s3c S3ClientSession) S3SyncDirectoryToBucketWithOptions(dirPath string, opts SyncOptions, progress *ProgressTracker) ([]SyncOperation, error) {
+	if err := s3c.EstablishSession(); err != nil {
+		return nil, fmt.Errorf("error establishing session for bucket %s: %v", s3c.Bucket, err)
+	}
+	if s3c.ctx == nil {
+		s3c.ctx = aws.BackgroundContext()
+	}
+	if progress.FailedObjects == nil {
+		progress.FailedObjects = make(map[string]error)
+	}
+
+	var files []localFile
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %v", err)
+		}
+		files = append(files, localFile{path: path, key: opts.Prefix + filepath.ToSlash(rel), info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking the directory: %v", err)
+	}
+
+	objects := make(map[string]*s3.Object)
+	it := NewS3Iter(&s3c, &s3.ListObjectsV2Input{Bucket: aws.String(s3c.Bucket), Prefix: aws.String(opts.Prefix)})
+	for {
+		obj, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bucket %s: %v", s3c.Bucket, err)
+		}
+		if obj == nil {
+			break
+		}
+		objects[aws.StringValue(obj.Key)] = obj
+	}
+
+	uploader := s3manager.NewUploaderWithClient(s3c.Client)
+	var ops []SyncOperation
+	var opsMu sync.Mutex
+	var failed int64
+	fail := func(key string, err error) {
+		log.Printf("Failed to sync %s: %v", key, err)
+		progress.Lock()
+		progress.FailedObjects[key] = err
+		progress.Unlock()
+		atomic.AddInt64(&failed, 1)
+	}
+
+	work := make(chan localFile)
+	var wg sync.WaitGroup
+	for i := 0; i < s3c.GetConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range work {
+				reason, err := s3c.uploadReason(f, objects[f.key], opts.Checksum)
+				if err != nil {
+					fail(f.key, err)
+					continue
+				}
+				if len(reason) == 0 {
+					VerbosePrintf("Skipping %s, s3://%s/%s is up to date", f.path, s3c.Bucket, f.key)
+					atomic.AddInt64(&progress.SkippedObjects, 1)
+					atomic.AddInt64(&progress.CompletedBytes, f.info.Size())
+					continue
+				}
+				op := SyncOperation{Action: SyncUpload, Key: f.key, Path: f.path, Size: f.info.Size(), Reason: reason}
+				if !opts.DryRun {
+					start := time.Now()
+					if err := s3c.uploadFile(uploader, f); err != nil {
+						fail(f.key, fmt.Errorf("failed to upload file %s: %v", f.path, err))
+						continue
+					}
+					if s3c.logging {
+						log.Printf("Uploaded %s to s3://%s/%s in %s", f.path, s3c.Bucket, f.key, time.Since(start).Round(time.Millisecond))
+					}
+					atomic.AddInt64(&progress.MigratedObjects, 1)
+					atomic.AddInt64(&progress.CompletedBytes, f.info.Size())
+				}
+				opsMu.Lock()
+				ops = append(ops, op)
+				opsMu.Unlock()
+			}
+		}()
+	}
+	local := make(map[string]bool, len(files))
+	for _, f := range files {
+		local[f.key] = true
+		atomic.AddInt64(&progress.TotalObjects, 1)
+		atomic.AddInt64(&progress.TotalBytes, f.info.Size())
+		work <- f
+	}
+	close(work)
+	wg.Wait()
+
+	if opts.Delete {
+		for key, obj := range objects {
+			if local[key] || strings.HasSuffix(key, "/") {
+				continue
+			}
+			if !opts.DryRun {
+				err := s3c.retry(func() error {
+					_, err := s3c.Client.DeleteObjectWithContext(s3c.ctx, &s3.DeleteObjectInput{
+						Bucket: aws.String(s3c.Bucket),
+						Key:    aws.String(key),
+					})
+					return err
+				})
+				if err != nil {
+					fail(key, fmt.Errorf("failed to delete s3://%s/%s: %v", s3c.Bucket, key, err))
+					continue
+				}
+				if s3c.logging {
+					log.Printf("Deleted s3://%s/%s, no longer in %s", s3c.Bucket, key, dirPath)
+				}
+			}
+			ops = append(ops, SyncOperation{Action: SyncDelete, Key: key, Size: aws.Int64Value(obj.Size)})
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Key < ops[j].Key })
+	if opts.DryRun {
+		for _, op := range ops {
+			fmt.Printf("(dry run) %s\n", op)
+		}
+	}
+	if failed > 0 {
+		return ops, fmt.Errorf("%d objects failed to sync. Check FailedObjects map for details", failed)
+	}
+	if s3c.logging {
+		log.Printf("Sync has concluded for bucket %s", s3c.Bucket)
+	}
+	return ops, nil
+}
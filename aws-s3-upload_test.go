@@ -0,0 +1,82 @@
+package alfredo
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestS3SyncDirectoryToBucketWithOptions(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo", "c.txt": "charlie"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		assert.NoError(t, os.Chtimes(path, t0, t0))
+	}
+
+	mockS3 := new(MockS3Client)
+	mockS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("backup/a.txt"), Size: int64p(5), LastModified: aws.Time(t0), ETag: aws.String(`"` + MD5SumString("alpha") + `"`)},
+		&s3.Object{Key: str("backup/old.txt"), Size: int64p(3), LastModified: aws.Time(t0)},
+		&s3.Object{Key: str("backup/sub/b.txt"), Size: int64p(4), LastModified: aws.Time(t0)},
+		&s3.Object{Key: str("other/x"), Size: int64p(1), LastModified: aws.Time(t0)},
+	), nil)
+	mockS3.On("HeadObjectWithContext", mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{
+		LastModified: aws.Time(t0.Add(-time.Hour)),
+		Metadata:     map[string]*string{"Mtime": aws.String(strconv.FormatInt(t0.Unix(), 10))},
+	}, nil)
+	mockS3.On("PutObjectWithContext", mock.Anything, mock.MatchedBy(func(in *s3.PutObjectInput) bool {
+		return aws.StringValue(in.Metadata[syncMtimeMetadata]) == strconv.FormatInt(t0.Unix(), 10)
+	})).Return(&s3.PutObjectOutput{}, nil)
+	mockS3.On("DeleteObjectWithContext", mock.Anything, mock.Anything).Return(&s3.DeleteObjectOutput{}, nil)
+	s3c := S3ClientSession{Client: mockS3, Bucket: "bucket", established: true}
+
+	want := []SyncOperation{
+		{Action: SyncUpload, Key: "backup/c.txt", Path: filepath.Join(dir, "c.txt"), Size: 7, Reason: "new"},
+		{Action: SyncDelete, Key: "backup/old.txt", Size: 3},
+		{Action: SyncUpload, Key: "backup/sub/b.txt", Path: filepath.Join(dir, "sub", "b.txt"), Size: 5, Reason: "size changed"},
+	}
+	opts := SyncOptions{Prefix: "backup/", Delete: true, DryRun: true}
+	ops, err := s3c.S3SyncDirectoryToBucketWithOptions(dir, opts, &ProgressTracker{})
+	assert.NoError(t, err)
+	assert.Equal(t, want, ops)
+	mockS3.AssertNotCalled(t, "PutObjectWithContext", mock.Anything, mock.Anything)
+	mockS3.AssertNotCalled(t, "DeleteObjectWithContext", mock.Anything, mock.Anything)
+
+	opts.DryRun = false
+	progress := &ProgressTracker{}
+	ops, err = s3c.S3SyncDirectoryToBucketWithOptions(dir, opts, progress)
+	assert.NoError(t, err)
+	assert.Equal(t, want, ops)
+	assert.Equal(t, int64(2), progress.MigratedObjects)
+	assert.Equal(t, int64(1), progress.SkippedObjects)
+	mockS3.AssertNumberOfCalls(t, "PutObjectWithContext", 2)
+	mockS3.AssertNumberOfCalls(t, "DeleteObjectWithContext", 1)
+
+	// a touched file is uploaded again; with checksums only its content counts
+	t1 := t0.Add(time.Minute)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "a.txt"), t1, t1))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "c.txt")))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "sub", "b.txt")))
+	ops, err = s3c.S3SyncDirectoryToBucketWithOptions(dir, SyncOptions{Prefix: "backup/", DryRun: true}, &ProgressTracker{})
+	assert.NoError(t, err)
+	if assert.Len(t, ops, 1) {
+		assert.Equal(t, "modified", ops[0].Reason)
+	}
+	before := len(mockS3.Calls)
+	ops, err = s3c.S3SyncDirectoryToBucketWithOptions(dir, SyncOptions{Prefix: "backup/", DryRun: true, Checksum: true}, &ProgressTracker{})
+	assert.NoError(t, err)
+	assert.Empty(t, ops)
+	for _, call := range mockS3.Calls[before:] {
+		assert.NotEqual(t, "HeadObjectWithContext", call.Method)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"strings"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
 
@@ -36,10 +38,12 @@ func NewS3Iter(s3c *S3ClientSession, input *s3.ListObjectsV2Input) *S3Iter {
 func (it *S3Iter) Next() (*s3.Object, error) {
 	VerbosePrintf("BEGIN S3Iter.Next()")
 	defer VerbosePrintln("END S3Iter.Next()")
-	if it.done {
-		return nil, nil
-	}
-	if it.page == nil || it.idx >= len(it.page) {
+	// an empty page may still be followed by more, so keep listing until
+	// there is an object to return or the listing is exhausted
+	for it.page == nil || it.idx >= len(it.page) {
+		if it.done {
+			return nil, nil
+		}
 		if it.svc == nil {
 			return nil, fmt.Errorf("S3Iter has nil svc")
 		}
@@ -58,9 +62,6 @@ func (it *S3Iter) Next() (*s3.Object, error) {
 		} else {
 			it.done = true
 		}
-		if len(it.page) == 0 {
-			return nil, nil
-		}
 	}
 	obj := it.page[it.idx]
 	it.idx++
@@ -73,37 +74,255 @@ const (
 	Missing      DiffType = "missing"
 	Extra        DiffType = "extra"
 	SizeMismatch DiffType = "size_mismatch"
+	// MetadataMismatch is only reported when VerifyOptions.CompareMetadata is set
+	MetadataMismatch DiffType = "metadata_mismatch"
+	// ContentMismatch is only reported when VerifyOptions.DeepVerify is set
+	ContentMismatch DiffType = "content_mismatch"
 )
 
 type Diff struct {
 	Type       DiffType `json:"type"`
 	Key        string   `json:"key"`
+	TargetKey  string   `json:"target_key,omitempty"` // set when the target key differs from Key
 	SourceSize int64    `json:"source_size,omitempty"`
 	TargetSize int64    `json:"target_size,omitempty"`
+	Fields     []string `json:"fields,omitempty"`
+	// SourceSum and TargetSum are the ETags or SHA-256 sums that differ
+	SourceSum string `json:"source_sum,omitempty"`
+	TargetSum string `json:"target_sum,omitempty"`
+}
+
+type VerifyOptions struct {
+	UseSourceAsPrefixOnTarget bool
+	CompareMetadata           bool // HEAD both sides of every matching key and compare metadata and tags
+	// Filter limits the comparison to the migrated slice. Source objects are
+	// matched on every criterion; target objects only on prefix and glob, since
+	// their size, modification time and storage class reflect the migration.
+	Filter *ObjectFilter
+	// KeyMapper compares source objects against their rewritten target keys;
+	// it takes precedence over UseSourceAsPrefixOnTarget
+	KeyMapper KeyMapper
+	// DeepVerify compares the content of objects whose sizes match, which
+	// reads every checked object in full
+	DeepVerify DeepVerifyMode
+	// SamplePercent limits DeepVerify to roughly this share of the objects;
+	// 0 checks them all. The sample depends only on the keys, so a rerun
+	// checks the same objects.
+	SamplePercent float64
+	// PartSize is the part size the copies were made with, when known. It is
+	// tried first when recomputing multipart ETags.
+	PartSize int64
+	// MaxExamples caps the Diffs kept in a VerificationReport; 0 keeps 10 and
+	// a negative value none
+	MaxExamples int
 }
 
 func RunVerification(srcs3c, tgts3c *S3ClientSession, UseSourceAsPrefixOnTarget bool, out io.Writer) error {
-	VerbosePrintf("BEGIN RunVerification(srcs3c!=nil %t, tgts3c!=nil %t, UseSourceAsPrefixOnTarget=%t)", srcs3c != nil, tgts3c != nil, UseSourceAsPrefixOnTarget)
+	return RunVerificationWithOptions(srcs3c, tgts3c, VerifyOptions{UseSourceAsPrefixOnTarget: UseSourceAsPrefixOnTarget}, out)
+}
+
+// RunVerificationWithOptions compares the source bucket with the target and
+// writes one JSON Diff per difference to out. When keys are not rewritten, or
+// only given a fixed prefix, the buckets are split into shards by top-level
+// prefix and up to srcs3c.GetConcurrency() shards are compared at once; the
+// diffs of different shards are then interleaved.
+func RunVerificationWithOptions(srcs3c, tgts3c *S3ClientSession, opts VerifyOptions, out io.Writer) error {
+	_, err := RunVerificationWithReport(srcs3c, tgts3c, opts, out)
+	return err
+}
+
+// RunVerificationWithReport is RunVerificationWithOptions that also returns a
+// summary of the differences; out may be nil when only the report is wanted.
+// The report covers what was compared before an error, if any.
+func RunVerificationWithReport(srcs3c, tgts3c *S3ClientSession, opts VerifyOptions, out io.Writer) (*VerificationReport, error) {
+	maxExamples := opts.MaxExamples
+	if maxExamples == 0 {
+		maxExamples = defaultVerifyExamples
+	}
+	report := NewVerificationReport(max(maxExamples, 0))
+	return report, runVerification(srcs3c, tgts3c, opts, out, report)
+}
+
+func runVerification(srcs3c, tgts3c *S3ClientSession, opts VerifyOptions, out io.Writer, report *VerificationReport) error {
+	VerbosePrintf("BEGIN RunVerification(srcs3c!=nil %t, tgts3c!=nil %t, UseSourceAsPrefixOnTarget=%t)", srcs3c != nil, tgts3c != nil, opts.UseSourceAsPrefixOnTarget)
 	defer VerbosePrintln("END RunVerification()")
-	enc := json.NewEncoder(out)
+	if err := srcs3c.EstablishSession(); err != nil {
+		return fmt.Errorf("error establishing session for source bucket %s: %v", srcs3c.Bucket, err)
+	}
+	if err := tgts3c.EstablishSession(); err != nil {
+		return fmt.Errorf("error establishing session for target bucket %s: %v", tgts3c.Bucket, err)
+	}
 
-	srcIter := NewS3Iter(srcs3c, &s3.ListObjectsV2Input{
-		Bucket: aws.String(srcs3c.Bucket),
-	})
-	if srcIter.svc == nil {
-		return fmt.Errorf("error establishing session for source bucket %s", srcs3c.Bucket)
+	var encMu sync.Mutex
+	var enc *json.Encoder
+	if out != nil {
+		enc = json.NewEncoder(out)
 	}
-	prefix := ""
-	if UseSourceAsPrefixOnTarget {
-		prefix = srcs3c.Bucket + "/"
-	} else {
-		prefix = ""
+	emit := func(d Diff) {
+		encMu.Lock()
+		defer encMu.Unlock()
+		report.add(d)
+		if enc != nil {
+			enc.Encode(d)
+		}
 	}
 
-	dstIter := NewS3Iter(tgts3c, &s3.ListObjectsV2Input{
-		Bucket: aws.String(tgts3c.Bucket),
-		Prefix: aws.String(prefix),
-	})
+	mapper := resolveKeyMapper(opts.KeyMapper, opts.UseSourceAsPrefixOnTarget, srcs3c.Bucket)
+	shards, err := verifyShards(srcs3c, tgts3c, mapper)
+	if err != nil {
+		return err
+	}
+	concurrency := min(srcs3c.GetConcurrency(), len(shards))
+	if concurrency <= 1 {
+		for _, shard := range shards {
+			if err := runVerifyShard(srcs3c, tgts3c, opts, mapper, shard, emit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	VerbosePrintf("verifying %d shards, %d at a time", len(shards), concurrency)
+	shardChan := make(chan verifyShard)
+	var firstErr error
+	var errOnce sync.Once
+	var failed int32
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for shard := range shardChan {
+				if err := runVerifyShard(srcs3c, tgts3c, opts, mapper, shard, emit); err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("failed to verify prefix %q: %v", shard.SourcePrefix, err) })
+					atomic.StoreInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+	for _, shard := range shards {
+		if atomic.LoadInt32(&failed) != 0 {
+			break
+		}
+		shardChan <- shard
+	}
+	close(shardChan)
+	wg.Wait()
+	return firstErr
+}
+
+// verifyShard is the part of a verification that covers the source keys under
+// SourcePrefix and the target keys under TargetPrefix. With a Delimiter, only
+// the keys directly under the prefixes are listed.
+type verifyShard struct {
+	SourcePrefix string
+	TargetPrefix string
+	Delimiter    string
+}
+
+// verifyShards splits the verification by top-level prefix of either bucket,
+// plus one shard for the keys at the top level itself. Mappers other than a
+// plain added prefix can move keys between prefixes, so those are verified in
+// a single shard.
+func verifyShards(srcs3c, tgts3c *S3ClientSession, mapper KeyMapper) ([]verifyShard, error) {
+	targetPrefix := ""
+	if prefixed, ok := mapper.(prefixedKeyMapper); ok {
+		targetPrefix = prefixed.TargetPrefix()
+	}
+	if prefixMapper, ok := mapper.(*PrefixMapper); mapper != nil && (!ok || len(prefixMapper.Strip) > 0) {
+		return []verifyShard{{TargetPrefix: targetPrefix}}, nil
+	}
+	mapKey := func(key string) string { return key }
+	unmapKey := func(key string) (string, bool) { return key, true }
+	if mapper != nil {
+		mapKey = mapper.MapKey
+		unmapKey = mapper.(ReversibleKeyMapper).UnmapKey
+	}
+
+	prefixes := map[string]bool{}
+	sourcePrefixes, err := topLevelPrefixes(srcs3c, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prefixes of source bucket %s: %v", srcs3c.Bucket, err)
+	}
+	for _, prefix := range sourcePrefixes {
+		prefixes[prefix] = true
+	}
+	targetPrefixes, err := topLevelPrefixes(tgts3c, targetPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prefixes of target bucket %s: %v", tgts3c.Bucket, err)
+	}
+	for _, prefix := range targetPrefixes {
+		if sourcePrefix, ok := unmapKey(prefix); ok {
+			prefixes[sourcePrefix] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(prefixes))
+	for prefix := range prefixes {
+		sorted = append(sorted, prefix)
+	}
+	sort.Strings(sorted)
+	shards := []verifyShard{{TargetPrefix: targetPrefix, Delimiter: "/"}}
+	for _, prefix := range sorted {
+		shards = append(shards, verifyShard{SourcePrefix: prefix, TargetPrefix: mapKey(prefix)})
+	}
+	return shards, nil
+}
+
+// topLevelPrefixes lists the common prefixes one level below prefix.
+func topLevelPrefixes(s3c *S3ClientSession, prefix string) ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s3c.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}
+	var prefixes []string
+	for {
+		out, err := s3c.Client.ListObjectsV2(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, cp := range out.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(cp.Prefix))
+		}
+		if !aws.BoolValue(out.IsTruncated) {
+			return prefixes, nil
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+}
+
+func listInput(bucket, prefix, delimiter string) *s3.ListObjectsV2Input {
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	if len(delimiter) > 0 {
+		input.Delimiter = aws.String(delimiter)
+	}
+	return input
+}
+
+// runVerifyShard merges the source and target listings of one shard in target
+// key order and emits a Diff for every difference.
+func runVerifyShard(srcs3c, tgts3c *S3ClientSession, opts VerifyOptions, mapper KeyMapper, shard verifyShard, emit func(Diff)) error {
+	mapKey := func(key string) string {
+		if mapper == nil {
+			return key
+		}
+		return mapper.MapKey(key)
+	}
+	// target-only objects are reported and filtered by their source key, which
+	// needs a reverse mapping unless keys are not rewritten at all
+	reversible, isReversible := mapper.(ReversibleKeyMapper)
+	canFilterTarget := mapper == nil || isReversible
+
+	var srcIter ObjectIter = &S3Iter{svc: srcs3c.Client, input: listInput(srcs3c.Bucket, shard.SourcePrefix, shard.Delimiter)}
+	if ordered, ok := mapper.(orderedKeyMapper); mapper != nil && (!ok || !ordered.PreservesOrder()) {
+		sorted, err := newSortedIter(srcIter, mapKey)
+		if err != nil {
+			return err
+		}
+		srcIter = sorted
+	}
+	dstIter := &S3Iter{svc: tgts3c.Client, input: listInput(tgts3c.Bucket, shard.TargetPrefix, shard.Delimiter)}
 
 	src, err := srcIter.Next()
 	if err != nil {
@@ -115,33 +334,69 @@ func RunVerification(srcs3c, tgts3c *S3ClientSession, UseSourceAsPrefixOnTarget
 	}
 
 	for src != nil || dst != nil {
-		var sk, dk string
+		var sk, mk, tk string
 		if src != nil {
 			sk = *src.Key
+			mk = mapKey(sk)
 		}
 		if dst != nil {
-			if UseSourceAsPrefixOnTarget {
-				dk = strings.TrimPrefix(*dst.Key, srcs3c.Bucket+"/")
-			} else {
-				dk = *dst.Key
-			}
+			tk = *dst.Key
+		}
+		// produced is false for target keys this mapping could not have written
+		targetOnlyKey, produced := tk, true
+		if isReversible && dst != nil {
+			targetOnlyKey, produced = reversible.UnmapKey(tk)
 		}
 
+		// a source object outside the filter is ignored, together with its
+		// target copy if one exists
+		srcExcluded := src != nil && !opts.Filter.Match(sk, *src.Size, aws.TimeValue(src.LastModified), aws.StringValue(src.StorageClass))
+
 		switch {
-		case src != nil && (dst == nil || sk < dk):
-			enc.Encode(Diff{Type: Missing, Key: sk, SourceSize: *src.Size})
+		case srcExcluded && (dst == nil || mk <= tk):
+			if dst != nil && mk == tk {
+				dst, err = dstIter.Next()
+				if err != nil {
+					return err
+				}
+			}
+			src, err = srcIter.Next()
+		case dst != nil && (src == nil || tk < mk) && (!produced || canFilterTarget && !opts.Filter.MatchKey(targetOnlyKey)):
+			dst, err = dstIter.Next()
+		case src != nil && (dst == nil || mk < tk):
+			emit(Diff{Type: Missing, Key: sk, TargetKey: differingKey(mk, sk), SourceSize: *src.Size})
 			src, err = srcIter.Next()
-		case dst != nil && (src == nil || dk < sk):
-			enc.Encode(Diff{Type: Extra, Key: dk, TargetSize: *dst.Size})
+		case dst != nil && (src == nil || tk < mk):
+			emit(Diff{Type: Extra, Key: targetOnlyKey, TargetKey: differingKey(tk, targetOnlyKey), TargetSize: *dst.Size})
 			dst, err = dstIter.Next()
 		default:
 			if *src.Size != *dst.Size {
-				enc.Encode(Diff{
+				emit(Diff{
 					Type:       SizeMismatch,
 					Key:        sk,
+					TargetKey:  differingKey(tk, sk),
 					SourceSize: *src.Size,
 					TargetSize: *dst.Size,
 				})
+			} else {
+				if opts.CompareMetadata {
+					fields, err := metadataMismatch(srcs3c, tgts3c, sk, tk)
+					if err != nil {
+						return err
+					}
+					if len(fields) > 0 {
+						emit(Diff{Type: MetadataMismatch, Key: sk, TargetKey: differingKey(tk, sk), Fields: fields})
+					}
+				}
+				if opts.DeepVerify != DeepVerifyNone && inSample(sk, opts.SamplePercent) {
+					srcSum, tgtSum, err := contentMismatch(srcs3c, tgts3c, src, dst, opts)
+					if err != nil {
+						return err
+					}
+					if len(srcSum) > 0 {
+						emit(Diff{Type: ContentMismatch, Key: sk, TargetKey: differingKey(tk, sk), SourceSum: srcSum, TargetSum: tgtSum})
+					}
+				}
 			}
 			src, err = srcIter.Next()
 			if err != nil {
@@ -155,3 +410,48 @@ func RunVerification(srcs3c, tgts3c *S3ClientSession, UseSourceAsPrefixOnTarget
 	}
 	return nil
 }
+
+// differingKey returns targetKey only when it tells the reader something the
+// source key does not.
+func differingKey(targetKey, sourceKey string) string {
+	if targetKey == sourceKey {
+		return ""
+	}
+	return targetKey
+}
+
+// sliceIter serves objects that were already listed and reordered.
+type sliceIter struct {
+	objs []*s3.Object
+	idx  int
+}
+
+func (it *sliceIter) Next() (*s3.Object, error) {
+	if it.idx >= len(it.objs) {
+		return nil, nil
+	}
+	obj := it.objs[it.idx]
+	it.idx++
+	return obj, nil
+}
+
+// newSortedIter drains it and orders the objects by their mapped key. This
+// holds the whole source listing in memory, so it is only used for mappers
+// that do not preserve key order.
+func newSortedIter(it ObjectIter, mapKey func(string) string) (*sliceIter, error) {
+	var objs []*s3.Object
+	for {
+		obj, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if obj == nil {
+			break
+		}
+		objs = append(objs, obj)
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return mapKey(*objs[i].Key) < mapKey(*objs[j].Key)
+	})
+	return &sliceIter{objs: objs}, nil
+}
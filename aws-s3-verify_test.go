@@ -1,7 +1,14 @@
 package alfredo
 
 import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 type fakeIter struct {
@@ -33,3 +40,72 @@ func (f *fakeIter) Next() (*s3.Object, error) {
 
 func str(s string) *string  { return &s }
 func int64p(i int64) *int64 { return &i }
+
+// fakeListing answers ListObjectsV2 like S3 would for a bucket holding objs,
+// honouring Prefix and Delimiter.
+func fakeListing(objs ...*s3.Object) func(*s3.ListObjectsV2Input) *s3.ListObjectsV2Output {
+	return func(in *s3.ListObjectsV2Input) *s3.ListObjectsV2Output {
+		prefix, delimiter := aws.StringValue(in.Prefix), aws.StringValue(in.Delimiter)
+		out := &s3.ListObjectsV2Output{}
+		seen := map[string]bool{}
+		for _, obj := range objs {
+			if !strings.HasPrefix(*obj.Key, prefix) {
+				continue
+			}
+			rest := strings.TrimPrefix(*obj.Key, prefix)
+			if i := strings.Index(rest, delimiter); len(delimiter) > 0 && i >= 0 {
+				cp := prefix + rest[:i+len(delimiter)]
+				if !seen[cp] {
+					seen[cp] = true
+					out.CommonPrefixes = append(out.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(cp)})
+				}
+				continue
+			}
+			out.Contents = append(out.Contents, obj)
+		}
+		sort.Slice(out.Contents, func(i, j int) bool { return *out.Contents[i].Key < *out.Contents[j].Key })
+		return out
+	}
+}
+
+func TestVerificationShardsByPrefix(t *testing.T) {
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("a/1"), Size: int64p(1)},
+		&s3.Object{Key: str("a/2"), Size: int64p(1)},
+		&s3.Object{Key: str("b/1"), Size: int64p(1)},
+		&s3.Object{Key: str("root"), Size: int64p(1)},
+	), nil)
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("source-bucket/a/1"), Size: int64p(1)},
+		&s3.Object{Key: str("source-bucket/b/1"), Size: int64p(2)},
+		&s3.Object{Key: str("source-bucket/c/9"), Size: int64p(1)},
+		&s3.Object{Key: str("source-bucket/root"), Size: int64p(1)},
+	), nil)
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+	srcS3c.SetConcurrency(4)
+
+	diffs := verifyDiffsWith(t, srcS3c, tgtS3c, VerifyOptions{UseSourceAsPrefixOnTarget: true})
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	assert.Equal(t, []Diff{
+		{Type: Missing, Key: "a/2", TargetKey: "source-bucket/a/2", SourceSize: 1},
+		{Type: SizeMismatch, Key: "b/1", TargetKey: "source-bucket/b/1", SourceSize: 1, TargetSize: 2},
+		{Type: Extra, Key: "c/9", TargetKey: "source-bucket/c/9", TargetSize: 1},
+	}, diffs)
+
+	// the target-only prefix got a shard of its own
+	var prefixes []string
+	for _, call := range mockTargetS3.Calls {
+		in := call.Arguments.Get(0).(*s3.ListObjectsV2Input)
+		if in.Delimiter == nil {
+			prefixes = append(prefixes, *in.Prefix)
+		}
+	}
+	assert.ElementsMatch(t, []string{"source-bucket/a/", "source-bucket/b/", "source-bucket/c/"}, prefixes)
+
+	// one at a time gives the same result
+	srcS3c.SetConcurrency(1)
+	assert.Len(t, verifyDiffsWith(t, srcS3c, tgtS3c, VerifyOptions{UseSourceAsPrefixOnTarget: true}), 3)
+}
@@ -0,0 +1,120 @@
+package alfredo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	VerifyExitClean       = 0 // the buckets match
+	VerifyExitDifferences = 1 // verification ran and found differences
+	VerifyExitError       = 2 // verification could not be completed
+
+	defaultVerifyExamples = 10
+)
+
+// VerificationReport summarizes the Diffs of a verification run.
+type VerificationReport struct {
+	Counts map[DiffType]int64 `json:"counts"`
+	// Bytes totals the source size of each difference, or the target size for
+	// extra objects
+	Bytes    map[DiffType]int64 `json:"bytes"`
+	Examples []Diff             `json:"examples,omitempty"`
+
+	maxExamples int
+}
+
+func NewVerificationReport(maxExamples int) *VerificationReport {
+	return &VerificationReport{
+		Counts:      map[DiffType]int64{},
+		Bytes:       map[DiffType]int64{},
+		maxExamples: maxExamples,
+	}
+}
+
+// add counts d; callers serialize calls.
+func (r *VerificationReport) add(d Diff) {
+	r.Counts[d.Type]++
+	if d.Type == Extra {
+		r.Bytes[d.Type] += d.TargetSize
+	} else {
+		r.Bytes[d.Type] += d.SourceSize
+	}
+	if len(r.Examples) < r.maxExamples {
+		r.Examples = append(r.Examples, d)
+	}
+}
+
+// Differences is the total number of differences found.
+func (r *VerificationReport) Differences() int64 {
+	var total int64
+	for _, n := range r.Counts {
+		total += n
+	}
+	return total
+}
+
+func (r *VerificationReport) Clean() bool {
+	return r.Differences() == 0
+}
+
+func (r *VerificationReport) diffTypes() []DiffType {
+	types := make([]DiffType, 0, len(r.Counts))
+	for t := range r.Counts {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// String renders the report for people.
+func (r *VerificationReport) String() string {
+	if r.Clean() {
+		return "Verification passed: no differences found"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Verification found %s differences:\n", HumanReadableBigNumber(r.Differences()))
+	for _, t := range r.diffTypes() {
+		fmt.Fprintf(&sb, "  %-18s %s objects, %s\n", t, HumanReadableBigNumber(r.Counts[t]), HumanReadableStorageCapacity(r.Bytes[t]))
+	}
+	if len(r.Examples) > 0 {
+		sb.WriteString("Examples:\n")
+		for _, d := range r.Examples {
+			fmt.Fprintf(&sb, "  %-18s %s", d.Type, d.Key)
+			if len(d.TargetKey) > 0 {
+				fmt.Fprintf(&sb, " -> %s", d.TargetKey)
+			}
+			if d.Type == SizeMismatch {
+				fmt.Fprintf(&sb, " (%d != %d bytes)", d.SourceSize, d.TargetSize)
+			}
+			if len(d.Fields) > 0 {
+				fmt.Fprintf(&sb, " (%s)", strings.Join(d.Fields, ", "))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *VerificationReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// VerificationExitCode maps the outcome of RunVerificationWithReport to a
+// process exit code: VerifyExitClean, VerifyExitDifferences or VerifyExitError.
+func VerificationExitCode(report *VerificationReport, err error) int {
+	switch {
+	case err != nil || report == nil:
+		return VerifyExitError
+	case report.Clean():
+		return VerifyExitClean
+	default:
+		return VerifyExitDifferences
+	}
+}
@@ -0,0 +1,56 @@
+package alfredo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVerificationReport(t *testing.T) {
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	mockSourceS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("a"), Size: int64p(10)},
+		&s3.Object{Key: str("b"), Size: int64p(20)},
+		&s3.Object{Key: str("c"), Size: int64p(30)},
+		&s3.Object{Key: str("d"), Size: int64p(5)},
+	), nil)
+	mockTargetS3.On("ListObjectsV2", mock.Anything).Return(fakeListing(
+		&s3.Object{Key: str("c"), Size: int64p(31)},
+		&s3.Object{Key: str("d"), Size: int64p(5)},
+		&s3.Object{Key: str("e"), Size: int64p(7)},
+	), nil)
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket", established: true}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket", established: true}
+
+	report, err := RunVerificationWithReport(srcS3c, tgtS3c, VerifyOptions{MaxExamples: 2}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[DiffType]int64{Missing: 2, SizeMismatch: 1, Extra: 1}, report.Counts)
+	assert.Equal(t, map[DiffType]int64{Missing: 30, SizeMismatch: 30, Extra: 7}, report.Bytes)
+	assert.Equal(t, int64(4), report.Differences())
+	assert.Len(t, report.Examples, 2)
+	assert.Equal(t, VerifyExitDifferences, VerificationExitCode(report, err))
+
+	text := report.String()
+	assert.Contains(t, text, "Verification found 4 differences")
+	assert.Contains(t, text, "missing            2 objects")
+	assert.Contains(t, text, "Examples:\n  missing            a")
+
+	var buf bytes.Buffer
+	assert.NoError(t, report.WriteJSON(&buf))
+	var decoded VerificationReport
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, report.Counts, decoded.Counts)
+	assert.Equal(t, report.Examples, decoded.Examples)
+
+	clean := NewVerificationReport(defaultVerifyExamples)
+	assert.Equal(t, "Verification passed: no differences found", clean.String())
+	assert.Equal(t, VerifyExitClean, VerificationExitCode(clean, nil))
+	assert.Equal(t, VerifyExitError, VerificationExitCode(clean, errors.New("listing failed")))
+	assert.Equal(t, VerifyExitError, VerificationExitCode(nil, nil))
+}
@@ -0,0 +1,438 @@
+package alfredo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectVersion is one entry of a version-aware listing: either a stored
+// version of a key or a delete marker.
+type ObjectVersion struct {
+	Key            string    `json:"key"`
+	VersionId      string    `json:"versionId"`
+	LastModified   time.Time `json:"lastModified"`
+	Size           int64     `json:"size"`
+	ETag           string    `json:"etag,omitempty"`
+	IsLatest       bool      `json:"isLatest"`
+	IsDeleteMarker bool      `json:"isDeleteMarker"`
+}
+
+// VersionManifestEntry maps one replayed source version to the version id the
+// target assigned to it; one entry is written per line of the manifest.
+type VersionManifestEntry struct {
+	SourceBucket    string    `json:"sourceBucket"`
+	SourceKey       string    `json:"sourceKey"`
+	SourceVersionId string    `json:"sourceVersionId"`
+	TargetBucket    string    `json:"targetBucket"`
+	TargetKey       string    `json:"targetKey"`
+	TargetVersionId string    `json:"targetVersionId,omitempty"`
+	LastModified    time.Time `json:"lastModified"`
+	DeleteMarker    bool      `json:"deleteMarker"`
+	Error           string    `json:"error,omitempty"`
+}
+
+type versionManifest struct {
+	file *os.File
+	enc  *json.Encoder
+	mu   sync.Mutex
+}
+
+// newVersionManifest opens path for appending so reruns extend the audit trail
+// rather than replacing it.
+func newVersionManifest(path string) (*versionManifest, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open version manifest %s: %v", path, err)
+	}
+	return &versionManifest{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (m *versionManifest) write(entry VersionManifestEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.enc.Encode(entry); err != nil {
+		log.Printf("WARNING: failed to write version manifest entry for %s (%s): %v", entry.SourceKey, entry.SourceVersionId, err)
+	}
+}
+
+func (m *versionManifest) Close() error {
+	return m.file.Close()
+}
+
+// ReadVersionManifest loads the entries of the version manifest at path.
+func ReadVersionManifest(path string) ([]VersionManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open version manifest %s: %v", path, err)
+	}
+	defer f.Close()
+	var entries []VersionManifestEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e VersionManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("malformed entry in version manifest %s: %v", path, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read version manifest %s: %v", path, err)
+	}
+	return entries, nil
+}
+
+// replayedVersions returns the versions of bucket the manifest at path
+// records as replayed, keyed by key and version id. A missing manifest means
+// nothing has been replayed yet.
+func replayedVersions(path, bucket string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	if !FileExistsEasy(path) {
+		return done, nil
+	}
+	entries, err := ReadVersionManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.SourceBucket == bucket && len(e.Error) == 0 {
+			done[e.SourceKey+"@"+e.SourceVersionId] = true
+		}
+	}
+	return done, nil
+}
+
+func versionIdOrNil(versionId string) *string {
+	if len(versionId) == 0 {
+		return nil
+	}
+	return aws.String(versionId)
+}
+
+// pageVersions flattens one page of a version listing, versions before
+// delete markers.
+func pageVersions(page *s3.ListObjectVersionsOutput) []ObjectVersion {
+	var versions []ObjectVersion
+	for _, ver := range page.Versions {
+		if ver == nil {
+			continue
+		}
+		versions = append(versions, ObjectVersion{
+			Key:          aws.StringValue(ver.Key),
+			VersionId:    aws.StringValue(ver.VersionId),
+			LastModified: aws.TimeValue(ver.LastModified),
+			Size:         aws.Int64Value(ver.Size),
+			ETag:         aws.StringValue(ver.ETag),
+			IsLatest:     aws.BoolValue(ver.IsLatest),
+		})
+	}
+	for _, marker := range page.DeleteMarkers {
+		if marker == nil {
+			continue
+		}
+		versions = append(versions, ObjectVersion{
+			Key:            aws.StringValue(marker.Key),
+			VersionId:      aws.StringValue(marker.VersionId),
+			LastModified:   aws.TimeValue(marker.LastModified),
+			IsLatest:       aws.BoolValue(marker.IsLatest),
+			IsDeleteMarker: true,
+		})
+	}
+	return versions
+}
+
+// ListAllObjectVersions returns every version and delete marker under prefix,
+// in the order the listing returned them.
+func (s3c *S3ClientSession) ListAllObjectVersions(prefix string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	err := s3c.Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(s3c.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		versions = append(versions, pageVersions(page)...)
+		return !lastPage
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list object versions of bucket %s: %v", s3c.Bucket, err)
+	}
+	return versions, nil
+}
+
+// forEachVersionHistory lists the versions under prefix and hands the history
+// of each key, oldest first, to fn as soon as the listing has moved past that
+// key. Only the current page and the key it ends on are held in memory, so
+// buckets of any size can be walked.
+func (s3c *S3ClientSession) forEachVersionHistory(prefix string, fn func(key string, history []ObjectVersion)) error {
+	var pending []ObjectVersion
+	err := s3c.Client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{
+		Bucket: aws.String(s3c.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		pending = append(pending, pageVersions(page)...)
+		// the key the page ended on may continue on the next page
+		open := ""
+		if !lastPage {
+			open = aws.StringValue(page.NextKeyMarker)
+		}
+		var complete, carry []ObjectVersion
+		for _, v := range pending {
+			if len(open) > 0 && v.Key == open {
+				carry = append(carry, v)
+			} else {
+				complete = append(complete, v)
+			}
+		}
+		keys, byKey := groupVersionsByKey(complete)
+		for _, key := range keys {
+			fn(key, byKey[key])
+		}
+		pending = carry
+		return !lastPage
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list object versions of bucket %s: %v", s3c.Bucket, err)
+	}
+	return nil
+}
+
+// groupVersionsByKey splits a listing into per-key histories ordered oldest
+// first. Entries sharing a LastModified, such as a put and a delete within
+// the timestamp resolution, are ordered with the latest entry last and delete
+// markers after versions; versions still tied keep the reverse of listing
+// order, since S3 lists the versions of a key newest first.
+func groupVersionsByKey(versions []ObjectVersion) ([]string, map[string][]ObjectVersion) {
+	byKey := make(map[string][]ObjectVersion)
+	var keys []string
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if _, ok := byKey[v.Key]; !ok {
+			keys = append(keys, v.Key)
+		}
+		byKey[v.Key] = append(byKey[v.Key], v)
+	}
+	for _, history := range byKey {
+		sort.SliceStable(history, func(i, j int) bool {
+			a, b := history[i], history[j]
+			if !a.LastModified.Equal(b.LastModified) {
+				return a.LastModified.Before(b.LastModified)
+			}
+			if a.IsLatest != b.IsLatest {
+				return b.IsLatest
+			}
+			return !a.IsDeleteMarker && b.IsDeleteMarker
+		})
+	}
+	sort.Strings(keys)
+	return keys, byKey
+}
+
+func (mgr *MigrationMgrStruct) checkTargetVersioning() error {
+	mgr.targetRequest()
+	out, err := mgr.TargetS3.Client.GetBucketVersioningWithContext(mgr.TargetS3.ctx, &s3.GetBucketVersioningInput{
+		Bucket: aws.String(mgr.TargetS3.Bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get versioning status of target bucket %s: %v", mgr.TargetS3.Bucket, err)
+	}
+	if aws.StringValue(out.Status) != s3.BucketVersioningStatusEnabled {
+		return fmt.Errorf("target bucket %s must have versioning enabled to preserve version history", mgr.TargetS3.Bucket)
+	}
+	return nil
+}
+
+// MigrateAllVersions replays every version and delete marker of the source
+// bucket onto the versioned target bucket, oldest first per key, and appends
+// the source-to-target version id mapping to the manifest at manifestPath.
+// Versions the manifest already records as replayed are skipped, so a rerun
+// picks up where an interrupted one stopped.
+func (mgr *MigrationMgrStruct) MigrateAllVersions(manifestPath string) error {
+	if err := mgr.checkTargetVersioning(); err != nil {
+		return err
+	}
+	done, err := replayedVersions(manifestPath, mgr.SourceS3.Bucket)
+	if err != nil {
+		return err
+	}
+	manifest, err := newVersionManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	// versions of one key are replayed sequentially to keep their order;
+	// distinct keys are spread over a fixed pool of workers
+	histories := make(chan []ObjectVersion)
+	var wg sync.WaitGroup
+	for i := 0; i < mgr.SourceS3.GetConcurrency(); i++ {
+		mgr.Lock()
+		innerMgr := mgr.DeepCopy()
+		mgr.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for history := range histories {
+				mgr.acquireWorker()
+				innerMgr.replayVersions(history, manifest, done)
+				mgr.releaseWorker()
+			}
+		}()
+	}
+
+	var versions, keys int
+	err = mgr.SourceS3.forEachVersionHistory("", func(key string, history []ObjectVersion) {
+		versions += len(history)
+		keys++
+		// only the key criteria apply, so a history is migrated whole or not at all
+		if !mgr.Filter.MatchKey(key) {
+			for _, v := range history {
+				mgr.countFiltered(v.Size)
+			}
+			return
+		}
+		for _, v := range history {
+			if !v.IsDeleteMarker {
+				atomic.AddInt64(&mgr.Progress.TotalObjects, 1)
+				atomic.AddInt64(&mgr.Progress.TotalBytes, v.Size)
+			}
+		}
+		histories <- history
+	})
+	close(histories)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	log.Printf("found %d versions of %d keys in bucket %s\n", versions, keys, mgr.SourceS3.Bucket)
+
+	if len(mgr.Progress.FailedObjects) > 0 {
+		log.Printf("Failed versions: %s", PrettyPrint(mgr.Progress.FailedObjects))
+		return fmt.Errorf("some object versions failed to copy. Check FailedObjects map for details")
+	}
+	return nil
+}
+
+// replayVersions recreates the history of a single key on the target,
+// skipping the versions in done. The replay stops at the first failure, as
+// later versions would otherwise land out of order.
+func (mgr *MigrationMgrStruct) replayVersions(history []ObjectVersion, manifest *versionManifest, done map[string]bool) {
+	for _, v := range history {
+		if done[v.Key+"@"+v.VersionId] {
+			if !v.IsDeleteMarker {
+				atomic.AddInt64(&mgr.Progress.SkippedObjects, 1)
+				atomic.AddInt64(&mgr.Progress.CompletedBytes, v.Size)
+			}
+			VerbosePrintf("s3://%s/%s?versionId=%s already replayed\n", mgr.SourceS3.Bucket, v.Key, v.VersionId)
+			continue
+		}
+		mgr.SourceS3.ObjectKey = v.Key
+		mgr.TargetS3.ObjectKey = mgr.targetKey(v.Key)
+		mgr.SourceVersionId = v.VersionId
+		mgr.TargetVersionId = ""
+
+		var err error
+		if v.IsDeleteMarker {
+			err = mgr.replayDeleteMarker()
+		} else {
+			err = mgr.replayVersion(v.Size)
+		}
+
+		entry := VersionManifestEntry{
+			SourceBucket:    mgr.SourceS3.Bucket,
+			SourceKey:       v.Key,
+			SourceVersionId: v.VersionId,
+			TargetBucket:    mgr.TargetS3.Bucket,
+			TargetKey:       mgr.TargetS3.ObjectKey,
+			TargetVersionId: mgr.TargetVersionId,
+			LastModified:    v.LastModified,
+			DeleteMarker:    v.IsDeleteMarker,
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		manifest.write(entry)
+
+		if err != nil {
+			mgr.Lock()
+			mgr.Progress.FailedObjects[fmt.Sprintf("%s?versionId=%s", v.Key, v.VersionId)] = err
+			mgr.Unlock()
+			mgr.FailLog.Printf("s3://%s/%s?versionId=%s: %v", mgr.SourceS3.Bucket, v.Key, v.VersionId, err)
+			return
+		}
+		mgr.SuccessLog.Printf("s3://%s/%s?versionId=%s => %s", mgr.TargetS3.Bucket, mgr.TargetS3.ObjectKey, v.VersionId, mgr.TargetVersionId)
+	}
+}
+
+func (mgr *MigrationMgrStruct) replayDeleteMarker() error {
+	var out *s3.DeleteObjectOutput
+	err := mgr.retry(func() error {
+		var err error
+		mgr.targetRequest()
+		out, err = mgr.TargetS3.Client.DeleteObjectWithContext(mgr.TargetS3.ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(mgr.TargetS3.Bucket),
+			Key:    aws.String(mgr.TargetS3.ObjectKey),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create delete marker: %v", err)
+	}
+	mgr.TargetVersionId = aws.StringValue(out.VersionId)
+	return nil
+}
+
+// replayVersion copies mgr.SourceVersionId unconditionally; unlike
+// MigrateObject there is no newer-target skip, as every version is wanted.
+func (mgr *MigrationMgrStruct) replayVersion(size int64) error {
+	if size > defaultPartSizeMax*10000 {
+		return fmt.Errorf("content length of %d is too large to process; api limitation exceeded", size)
+	}
+	err := mgr.retry(func() error {
+		var err error
+		mgr.sourceRequest()
+		mgr.SourceHead, err = mgr.SourceS3.Client.HeadObjectWithContext(mgr.SourceS3.ctx, mgr.SourceS3.encryptHead(&s3.HeadObjectInput{
+			Bucket:    aws.String(mgr.SourceS3.Bucket),
+			Key:       aws.String(mgr.SourceS3.ObjectKey),
+			VersionId: versionIdOrNil(mgr.SourceVersionId),
+		}))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get source object version details: %v", err)
+	}
+	var copied bool
+	if copied, err = mgr.tryServerSideCopy(size); err == nil && !copied {
+		if size < defaultPartSizeMin {
+			err = mgr.CopyObjectBetweenBucketsRegular()
+		} else {
+			err = mgr.CopyObjectBetweenBucketsMPU()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&mgr.Progress.MigratedObjects, 1)
+	return nil
+}
+
+// CopyAllVersions migrates the full version history of the source bucket; see
+// MigrationMgrStruct.MigrateAllVersions.
+func (sourceS3 *S3ClientSession) CopyAllVersions(
+	targetS3 *S3ClientSession,
+	progress *ProgressTracker, successLog *log.Logger, failLog *log.Logger, manifestPath string) error {
+
+	return NewMigrationManager(sourceS3, targetS3, progress, successLog, failLog, 0).MigrateAllVersions(manifestPath)
+}
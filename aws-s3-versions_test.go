@@ -0,0 +1,208 @@
+package alfredo
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/cmd184psu/alfredo/s3fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func (m *MockS3Client) ListObjectVersionsPages(input *s3.ListObjectVersionsInput, fn func(*s3.ListObjectVersionsOutput, bool) bool) error {
+	args := m.Called(input)
+	if page, ok := args.Get(0).(*s3.ListObjectVersionsOutput); ok && page != nil {
+		fn(page, true)
+	}
+	return args.Error(1)
+}
+
+func (m *MockS3Client) GetBucketVersioningWithContext(ctx context.Context, input *s3.GetBucketVersioningInput, opts ...request.Option) (*s3.GetBucketVersioningOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.GetBucketVersioningOutput), args.Error(1)
+}
+
+func (m *MockS3Client) DeleteObjectWithContext(ctx context.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	args := m.Called(ctx, input)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*s3.DeleteObjectOutput), args.Error(1)
+}
+
+func TestListAndGroupObjectVersions(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockS3 := new(MockS3Client)
+	// S3 lists versions newest first, delete markers separately
+	mockS3.On("ListObjectVersionsPages", mock.Anything).Return(&s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			{Key: str("b"), VersionId: str("b1"), LastModified: aws.Time(t0), Size: int64p(3), IsLatest: aws.Bool(true)},
+			{Key: str("a"), VersionId: str("a2"), LastModified: aws.Time(t0.Add(time.Hour)), Size: int64p(2)},
+			{Key: str("a"), VersionId: str("a1"), LastModified: aws.Time(t0), Size: int64p(1)},
+		},
+		DeleteMarkers: []*s3.DeleteMarkerEntry{
+			{Key: str("a"), VersionId: str("a3"), LastModified: aws.Time(t0.Add(2 * time.Hour)), IsLatest: aws.Bool(true)},
+		},
+	}, nil)
+
+	s3c := &S3ClientSession{Client: mockS3, Bucket: "source-bucket"}
+	versions, err := s3c.ListAllObjectVersions("")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 4)
+
+	keys, byKey := groupVersionsByKey(versions)
+	assert.Equal(t, []string{"a", "b"}, keys)
+	var ids []string
+	for _, v := range byKey["a"] {
+		ids = append(ids, v.VersionId)
+	}
+	assert.Equal(t, []string{"a1", "a2", "a3"}, ids)
+	assert.True(t, byKey["a"][2].IsDeleteMarker)
+	assert.Len(t, byKey["b"], 1)
+}
+
+func TestGroupVersionsBreaksTimestampTies(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// a put and a delete within the same second; markers are listed after
+	// versions, so listing order alone would replay the marker first
+	listing := []ObjectVersion{
+		{Key: "a", VersionId: "a2", LastModified: t0},
+		{Key: "a", VersionId: "a1", LastModified: t0.Add(-time.Hour)},
+		{Key: "a", VersionId: "a3", LastModified: t0, IsLatest: true, IsDeleteMarker: true},
+		{Key: "b", VersionId: "b2", LastModified: t0, IsLatest: true},
+		{Key: "b", VersionId: "b1", LastModified: t0, IsDeleteMarker: true},
+	}
+	_, byKey := groupVersionsByKey(listing)
+	ids := func(history []ObjectVersion) []string {
+		var ids []string
+		for _, v := range history {
+			ids = append(ids, v.VersionId)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"a1", "a2", "a3"}, ids(byKey["a"]))
+	// the latest entry wins even when it is a version put over a marker
+	assert.Equal(t, []string{"b1", "b2"}, ids(byKey["b"]))
+}
+
+func TestReplayVersionsWritesManifest(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockSourceS3 := new(MockS3Client)
+	mockTargetS3 := new(MockS3Client)
+	logger := log.New(io.Discard, "", 0)
+
+	mockSourceS3.On("HeadObjectWithContext", mock.Anything, mock.Anything).Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(4)}, nil)
+	mockSourceS3.On("GetObjectWithContext", mock.Anything, mock.MatchedBy(func(in *s3.GetObjectInput) bool {
+		return aws.StringValue(in.VersionId) == "a1"
+	})).Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("old!"))}, nil)
+	mockTargetS3.On("PutObjectWithContext", mock.Anything, mock.Anything).Return(&s3.PutObjectOutput{VersionId: str("t1")}, nil)
+	mockTargetS3.On("DeleteObjectWithContext", mock.Anything, mock.Anything).Return(&s3.DeleteObjectOutput{VersionId: str("t2"), DeleteMarker: aws.Bool(true)}, nil)
+	mockTargetS3.On("GetBucketVersioningWithContext", mock.Anything, mock.Anything).Return(&s3.GetBucketVersioningOutput{Status: aws.String("Suspended")}, nil)
+
+	srcS3c := &S3ClientSession{Client: mockSourceS3, Bucket: "source-bucket"}
+	tgtS3c := &S3ClientSession{Client: mockTargetS3, Bucket: "target-bucket"}
+	progress := &ProgressTracker{}
+	mgr := NewMigrationManager(srcS3c, tgtS3c, progress, logger, logger, 100)
+
+	assert.Error(t, mgr.checkTargetVersioning())
+
+	path := filepath.Join(t.TempDir(), "versions.jsonl")
+	manifest, err := newVersionManifest(path)
+	assert.NoError(t, err)
+	mgr.replayVersions([]ObjectVersion{
+		{Key: "a", VersionId: "a1", LastModified: t0, Size: 4},
+		{Key: "a", VersionId: "a2", LastModified: t0.Add(time.Hour), IsDeleteMarker: true},
+	}, manifest, nil)
+	assert.NoError(t, manifest.Close())
+
+	assert.Empty(t, progress.FailedObjects)
+	assert.Equal(t, int64(1), progress.MigratedObjects)
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var entries []VersionManifestEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e VersionManifestEntry
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "a1", entries[0].SourceVersionId)
+	assert.Equal(t, "t1", entries[0].TargetVersionId)
+	assert.False(t, entries[0].DeleteMarker)
+	assert.Equal(t, "a2", entries[1].SourceVersionId)
+	assert.Equal(t, "t2", entries[1].TargetVersionId)
+	assert.True(t, entries[1].DeleteMarker)
+}
+
+// versionedFakeSession returns a session for a versioned bucket on srv.
+func versionedFakeSession(t *testing.T, srv *s3fake.Server, bucket string) *S3ClientSession {
+	s3c := fakeSession(t, srv, bucket)
+	_, err := s3c.Client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket:                  aws.String(bucket),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusEnabled)},
+	})
+	assert.NoError(t, err)
+	return s3c
+}
+
+func countVersions(t *testing.T, s3c *S3ClientSession) int {
+	versions, err := s3c.ListAllObjectVersions("")
+	assert.NoError(t, err)
+	return len(versions)
+}
+
+func TestMigrateAllVersionsResumes(t *testing.T) {
+	srcSrv, tgtSrv := s3fake.New(), s3fake.New()
+	defer srcSrv.Close()
+	defer tgtSrv.Close()
+	// small pages split the histories of keys across listing pages
+	srcSrv.MaxKeys = 2
+	src, tgt := versionedFakeSession(t, srcSrv, "source"), versionedFakeSession(t, tgtSrv, "target")
+	for _, body := range []string{"a1", "a2", "a3"} {
+		_, err := src.Client.PutObject(&s3.PutObjectInput{Bucket: aws.String("source"), Key: aws.String("a"), Body: strings.NewReader(body)})
+		assert.NoError(t, err)
+	}
+	for _, key := range []string{"b", "c"} {
+		_, err := src.Client.PutObject(&s3.PutObjectInput{Bucket: aws.String("source"), Key: aws.String(key), Body: strings.NewReader(key)})
+		assert.NoError(t, err)
+	}
+	_, err := src.Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("source"), Key: aws.String("b")})
+	assert.NoError(t, err)
+
+	logger := log.New(io.Discard, "", 0)
+	manifestPath := filepath.Join(t.TempDir(), "versions.jsonl")
+	progress := &ProgressTracker{}
+	assert.NoError(t, src.CopyAllVersions(tgt, progress, logger, logger, manifestPath))
+	assert.Equal(t, int64(5), progress.MigratedObjects)
+	assert.Equal(t, 6, countVersions(t, tgt))
+	got, _ := tgtSrv.Object("target", "a")
+	assert.Equal(t, "a3", string(got))
+
+	entries, err := ReadVersionManifest(manifestPath)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 6)
+
+	// a rerun skips everything the manifest records
+	progress = &ProgressTracker{}
+	assert.NoError(t, src.CopyAllVersions(tgt, progress, logger, logger, manifestPath))
+	assert.Equal(t, int64(0), progress.MigratedObjects)
+	assert.Equal(t, int64(5), progress.SkippedObjects)
+	assert.Equal(t, 6, countVersions(t, tgt))
+}
@@ -31,7 +31,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"gopkg.in/ini.v1"
 )
 
@@ -71,8 +70,10 @@ type S3ClientSession struct {
 	BatchSize           int `json:"batchSize"`
 	WasSkipped          bool
 	enforceCertificates bool
-	Owner               *s3.Owner `json:"owner,omitempty"`
-	EnableObjectLock    bool      `json:"enableObjectLock,omitempty"`
+	Owner               *s3.Owner     `json:"owner,omitempty"`
+	EnableObjectLock    bool          `json:"enableObjectLock,omitempty"`
+	RetryPolicy         *RetryPolicy  `json:"-"`
+	Encryption          *S3Encryption `json:"encryption,omitempty"`
 }
 
 type S3Objects struct {
@@ -107,6 +108,8 @@ func (s3c *S3ClientSession) DeepCopy() S3ClientSession {
 	retValue.Response = nil
 	retValue.ContinuationToken = nil
 	retValue.BatchSize = s3c.BatchSize
+	retValue.RetryPolicy = s3c.RetryPolicy
+	retValue.Encryption = s3c.Encryption
 
 	if err := retValue.EstablishSession(); err != nil {
 		panic(err.Error())
@@ -219,6 +222,12 @@ func (s3c *S3ClientSession) EstablishSession() error {
 		panic("missing region")
 	}
 
+	if s3c.Encryption != nil {
+		if err := s3c.Encryption.Validate(); err != nil {
+			return fmt.Errorf("invalid encryption settings: %v", err)
+		}
+	}
+
 	if GetDebug() {
 		VerbosePrintf("!!! alfredo::s3c:EstablishSession ep:%s, ak/sk: %s/%s, fps: %s, r: %s", s3c.Endpoint, s3c.Credentials.AccessKey, s3c.Credentials.SecretKey, TrueIsYes(true), s3c.Region)
 	}
@@ -760,10 +769,13 @@ func (this S3ClientSession) SyncInner(trimsz int, localPath string) error {
 				return err
 			}
 
-			_, err = this.Client.PutObject(&s3.PutObjectInput{
-				Bucket: aws.String(this.Bucket),
-				Key:    aws.String(s3ObjectKey),
-				Body:   aws.ReadSeekCloser(strings.NewReader(string(fileContent))),
+			err = this.retry(func() error {
+				_, err := this.Client.PutObject(this.encryptPut(&s3.PutObjectInput{
+					Bucket: aws.String(this.Bucket),
+					Key:    aws.String(s3ObjectKey),
+					Body:   aws.ReadSeekCloser(strings.NewReader(string(fileContent))),
+				}))
+				return err
 			})
 			if err != nil {
 				return err
@@ -915,32 +927,38 @@ func (s3c S3ClientSession) RecursiveBucketDelete() error {
 
 	VerbosePrintln("bucket=" + s3c.Bucket)
 
-	err = s3c.Client.ListObjectsV2Pages(listObjectsInput, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
-		VerbosePrintln("inside ListObjectsV2Pages")
-		VerbosePrintln(fmt.Sprintf("len(page.Content)=%d", len(page.Contents)))
-		for _, obj := range page.Contents {
-			// Delete each object.
+	// deletes are idempotent, so a listing that fails part way is simply redone
+	err = s3c.retry(func() error {
+		return s3c.Client.ListObjectsV2Pages(listObjectsInput, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			VerbosePrintln("inside ListObjectsV2Pages")
+			VerbosePrintln(fmt.Sprintf("len(page.Content)=%d", len(page.Contents)))
+			for _, obj := range page.Contents {
+				// Delete each object.
 
-			deleteObjectInput := &s3.DeleteObjectInput{
-				Bucket: aws.String(s3c.Bucket),
-				Key:    obj.Key,
-			}
-			def := *obj.Key
-			VerbosePrintln(fmt.Sprintf("delete object: %s", def))
-			_, err := s3c.Client.DeleteObject(deleteObjectInput)
-			if err != nil {
-				if aerr, ok := err.(awserr.Error); ok {
-					fmt.Println("AWS Error:", aerr.Code(), aerr.Message())
+				deleteObjectInput := &s3.DeleteObjectInput{
+					Bucket: aws.String(s3c.Bucket),
+					Key:    obj.Key,
+				}
+				def := *obj.Key
+				VerbosePrintln(fmt.Sprintf("delete object: %s", def))
+				err := s3c.retry(func() error {
+					_, err := s3c.Client.DeleteObject(deleteObjectInput)
+					return err
+				})
+				if err != nil {
+					if aerr, ok := err.(awserr.Error); ok {
+						fmt.Println("AWS Error:", aerr.Code(), aerr.Message())
+					} else {
+						fmt.Println("Error:", err.Error())
+					}
 				} else {
-					fmt.Println("Error:", err.Error())
+					fmt.Printf("Deleted object: %s\n", *obj.Key)
 				}
-			} else {
-				fmt.Printf("Deleted object: %s\n", *obj.Key)
-			}
 
-		}
+			}
 
-		return !lastPage
+			return !lastPage
+		})
 	})
 
 	if err != nil {
@@ -958,7 +976,10 @@ func (s3c S3ClientSession) RecursiveBucketDelete() error {
 	}
 	VerbosePrintln("attempt : DeleteBucket()")
 
-	_, err = s3c.Client.DeleteBucket(deleteBucketInput)
+	err = s3c.retry(func() error {
+		_, err := s3c.Client.DeleteBucket(deleteBucketInput)
+		return err
+	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			if strings.Contains(aerr.Code(), "BucketNotEmpty") {
@@ -997,51 +1018,59 @@ func (s3c S3ClientSession) recursiveBucketDeleteWithVersions() error {
 
 	VerbosePrintln("bucket=" + s3c.Bucket)
 
-	err = s3c.Client.ListObjectVersionsPages(listVersionsInput, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
-		VerbosePrintln("inside ListObjectVersionsPages")
-		VerbosePrintln(fmt.Sprintf("len(page.Versions)=%d", len(page.Versions)))
-		for _, version := range page.Versions {
-			// Delete each object version.
-			deleteObjectInput := &s3.DeleteObjectInput{
-				Bucket:    aws.String(s3c.Bucket),
-				Key:       version.Key,
-				VersionId: version.VersionId,
-			}
-			VerbosePrintln(fmt.Sprintf("delete object version: %s (version ID: %s)", *version.Key, *version.VersionId))
-			_, err := s3c.Client.DeleteObject(deleteObjectInput)
-			if err != nil {
-				if aerr, ok := err.(awserr.Error); ok {
-					fmt.Println("AWS Error:", aerr.Code(), aerr.Message())
+	err = s3c.retry(func() error {
+		return s3c.Client.ListObjectVersionsPages(listVersionsInput, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+			VerbosePrintln("inside ListObjectVersionsPages")
+			VerbosePrintln(fmt.Sprintf("len(page.Versions)=%d", len(page.Versions)))
+			for _, version := range page.Versions {
+				// Delete each object version.
+				deleteObjectInput := &s3.DeleteObjectInput{
+					Bucket:    aws.String(s3c.Bucket),
+					Key:       version.Key,
+					VersionId: version.VersionId,
+				}
+				VerbosePrintln(fmt.Sprintf("delete object version: %s (version ID: %s)", *version.Key, *version.VersionId))
+				err := s3c.retry(func() error {
+					_, err := s3c.Client.DeleteObject(deleteObjectInput)
+					return err
+				})
+				if err != nil {
+					if aerr, ok := err.(awserr.Error); ok {
+						fmt.Println("AWS Error:", aerr.Code(), aerr.Message())
+					} else {
+						fmt.Println("Error:", err.Error())
+					}
 				} else {
-					fmt.Println("Error:", err.Error())
+					fmt.Printf("Deleted object version: %s (version ID: %s)\n", *version.Key, *version.VersionId)
 				}
-			} else {
-				fmt.Printf("Deleted object version: %s (version ID: %s)\n", *version.Key, *version.VersionId)
 			}
-		}
 
-		VerbosePrintln(fmt.Sprintf("len(page.DeleteMarkers)=%d", len(page.DeleteMarkers)))
-		for _, marker := range page.DeleteMarkers {
-			// Delete each delete marker.
-			deleteMarkerInput := &s3.DeleteObjectInput{
-				Bucket:    aws.String(s3c.Bucket),
-				Key:       marker.Key,
-				VersionId: marker.VersionId,
-			}
-			VerbosePrintln(fmt.Sprintf("delete marker: %s (version ID: %s)", *marker.Key, *marker.VersionId))
-			_, err := s3c.Client.DeleteObject(deleteMarkerInput)
-			if err != nil {
-				if aerr, ok := err.(awserr.Error); ok {
-					fmt.Println("AWS Error:", aerr.Code(), aerr.Message())
+			VerbosePrintln(fmt.Sprintf("len(page.DeleteMarkers)=%d", len(page.DeleteMarkers)))
+			for _, marker := range page.DeleteMarkers {
+				// Delete each delete marker.
+				deleteMarkerInput := &s3.DeleteObjectInput{
+					Bucket:    aws.String(s3c.Bucket),
+					Key:       marker.Key,
+					VersionId: marker.VersionId,
+				}
+				VerbosePrintln(fmt.Sprintf("delete marker: %s (version ID: %s)", *marker.Key, *marker.VersionId))
+				err := s3c.retry(func() error {
+					_, err := s3c.Client.DeleteObject(deleteMarkerInput)
+					return err
+				})
+				if err != nil {
+					if aerr, ok := err.(awserr.Error); ok {
+						fmt.Println("AWS Error:", aerr.Code(), aerr.Message())
+					} else {
+						fmt.Println("Error:", err.Error())
+					}
 				} else {
-					fmt.Println("Error:", err.Error())
+					fmt.Printf("Deleted delete marker: %s (version ID: %s)\n", *marker.Key, *marker.VersionId)
 				}
-			} else {
-				fmt.Printf("Deleted delete marker: %s (version ID: %s)\n", *marker.Key, *marker.VersionId)
 			}
-		}
 
-		return !lastPage
+			return !lastPage
+		})
 	})
 
 	if err != nil {
@@ -1059,7 +1088,10 @@ func (s3c S3ClientSession) recursiveBucketDeleteWithVersions() error {
 	}
 	VerbosePrintln("attempt : DeleteBucket()")
 
-	_, err = s3c.Client.DeleteBucket(deleteBucketInput)
+	err = s3c.retry(func() error {
+		_, err := s3c.Client.DeleteBucket(deleteBucketInput)
+		return err
+	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			if strings.Contains(aerr.Code(), "BucketNotEmpty") {
@@ -1085,7 +1117,10 @@ func (s3c S3ClientSession) DeleteObject(object string) error {
 	if len(object) == 0 {
 		return errors.New("missing object, coding mistake")
 	}
-	_, err := s3c.Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(s3c.Bucket), Key: aws.String(object)})
+	err := s3c.retry(func() error {
+		_, err := s3c.Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(s3c.Bucket), Key: aws.String(object)})
+		return err
+	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
 			if strings.Contains(aerr.Code(), "NoSuchKey") {
@@ -1110,19 +1145,28 @@ func (s3c S3ClientSession) DeleteObjectVersions(object string) error {
 		Prefix: aws.String(object),
 	}
 
-	err := s3c.Client.ListObjectVersionsPages(listVersionsInput, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
-		for _, version := range page.Versions {
-			_, err := s3c.Client.DeleteObject(&s3.DeleteObjectInput{
-				Bucket:    aws.String(s3c.Bucket),
-				Key:       version.Key,
-				VersionId: version.VersionId,
-			})
-			if err != nil {
-				return false
+	var deleteErr error
+	err := s3c.retry(func() error {
+		return s3c.Client.ListObjectVersionsPages(listVersionsInput, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+			for _, version := range page.Versions {
+				deleteErr = s3c.retry(func() error {
+					_, err := s3c.Client.DeleteObject(&s3.DeleteObjectInput{
+						Bucket:    aws.String(s3c.Bucket),
+						Key:       version.Key,
+						VersionId: version.VersionId,
+					})
+					return err
+				})
+				if deleteErr != nil {
+					return false
+				}
 			}
-		}
-		return !lastPage
+			return !lastPage
+		})
 	})
+	if err == nil {
+		err = deleteErr
+	}
 
 	return err
 }
@@ -1131,8 +1175,13 @@ func (s3c S3ClientSession) RecursiveBucketDeleteAlt() error {
 	VerbosePrintln("BEGIN: RecursiveBucketDelete()")
 
 	// Get the list of objects in the bucket
-	objects, err := s3c.Client.ListObjectsV2(&s3.ListObjectsV2Input{
-		Bucket: aws.String(s3c.Bucket),
+	var objects *s3.ListObjectsV2Output
+	err := s3c.retry(func() error {
+		var err error
+		objects, err = s3c.Client.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket: aws.String(s3c.Bucket),
+		})
+		return err
 	})
 	if err != nil {
 		return err
@@ -1142,9 +1191,12 @@ func (s3c S3ClientSession) RecursiveBucketDeleteAlt() error {
 	for _, obj := range objects.Contents {
 		key := *obj.Key
 		VerbosePrintf("Deleting %s\n", key)
-		_, err = s3c.Client.DeleteObject(&s3.DeleteObjectInput{
-			Bucket: aws.String(s3c.Bucket),
-			Key:    obj.Key,
+		err = s3c.retry(func() error {
+			_, err := s3c.Client.DeleteObject(&s3.DeleteObjectInput{
+				Bucket: aws.String(s3c.Bucket),
+				Key:    obj.Key,
+			})
+			return err
 		})
 		if err != nil {
 			return err
@@ -1153,8 +1205,11 @@ func (s3c S3ClientSession) RecursiveBucketDeleteAlt() error {
 
 	// Delete the bucket if it is empty
 	if len(objects.Contents) == 0 {
-		_, err = s3c.Client.DeleteBucket(&s3.DeleteBucketInput{
-			Bucket: aws.String(s3c.Bucket),
+		err = s3c.retry(func() error {
+			_, err := s3c.Client.DeleteBucket(&s3.DeleteBucketInput{
+				Bucket: aws.String(s3c.Bucket),
+			})
+			return err
 		})
 	}
 
@@ -1530,10 +1585,10 @@ func (s3c *S3ClientSession) PresignedURL(expiredHours int) (string, error) {
 
 func (s3c *S3ClientSession) GetObject() ([]byte, error) {
 	// Get the object from S3
-	result, err := s3c.Client.GetObject(&s3.GetObjectInput{
+	result, err := s3c.Client.GetObject(s3c.encryptGet(&s3.GetObjectInput{
 		Bucket: aws.String(s3c.Bucket),
 		Key:    aws.String(s3c.ObjectKey),
-	})
+	}))
 	if err != nil {
 		return make([]byte, 0), err
 	}
@@ -1542,10 +1597,10 @@ func (s3c *S3ClientSession) GetObject() ([]byte, error) {
 }
 
 func (s3c *S3ClientSession) HeadObject() (bool, error) {
-	_, err := s3c.Client.HeadObject(&s3.HeadObjectInput{
+	_, err := s3c.Client.HeadObject(s3c.encryptHead(&s3.HeadObjectInput{
 		Bucket: aws.String(s3c.Bucket),
 		Key:    aws.String(s3c.ObjectKey),
-	})
+	}))
 
 	if err != nil {
 
@@ -1638,87 +1693,12 @@ func (s3c *S3ClientSession) EnableLogging(l bool) {
 	// 	log.Println("Logging is now enabled (S3ClientSession)")
 	// }
 }
-func (s3c S3ClientSession) S3SyncDirectoryToBucket(dirPath string, progress *ProgressTracker) error {
-	uploader := s3manager.NewUploader(s3c.GetSession())
-	skip := false
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
-		skip = false
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		file, err := os.Open(path)
-		if err != nil {
-			return fmt.Errorf("failed to open file %s: %v", path, err)
-		}
-		defer file.Close()
-
-		key, err := filepath.Rel(dirPath, path)
-		if err != nil {
-			return fmt.Errorf("failed to get relative path: %v", err)
-		}
-
-		// Create a progress reader
-		progressReader := &ProgressReader{
-			Reader: file,
-			Total:  info.Size(),
-			Key:    key,
-		}
-		s3c.ctx = context.Background()
-		headOutput, herr := s3c.Client.HeadObjectWithContext(s3c.ctx, &s3.HeadObjectInput{
-			Bucket: aws.String(s3c.Bucket),
-			Key:    aws.String(key),
-		})
-		if herr == nil {
-			VerbosePrintf("headOutput: Etag: %s", *headOutput.ETag)
-			if !GetForce() {
-				log.Printf("Skipping object s3://%s/%s, already exists on target", s3c.Bucket, key)
-				skip = true
-
-			}
-		}
-
-		if skip && !GetForce() {
-			if s3c.logging {
-				log.Printf("\nSkipped upload for file %s to s3://%s/%s, object already exists\n", path, s3c.Bucket, key)
-			}
-			fmt.Printf("\nSkipped upload for file %s to s3://%s/%s, object already exists\n", path, s3c.Bucket, key)
-			VerbosePrintf("migrated/skipped before: %d/%d object:%s", progress.MigratedObjects, progress.SkippedObjects, key)
-			atomic.AddInt64(&progress.SkippedObjects, 1)
-			VerbosePrintf("migrated/skipped after: %d/%d object:%s", progress.MigratedObjects, progress.SkippedObjects, key)
 
-		} else {
-			_, err = uploader.Upload(&s3manager.UploadInput{
-				Bucket: aws.String(s3c.Bucket),
-				Key:    aws.String(key),
-				Body:   progressReader,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to upload file %s: %v", path, err)
-			}
-			if s3c.logging {
-				log.Printf("\nUploaded %s to s3://%s/%s\n", path, s3c.Bucket, key)
-			}
-			fmt.Printf("\nUploaded %s to s3://%s/%s\n", path, s3c.Bucket, key)
-			VerbosePrintf("migrated/skipped before: %d/%d object:%s", progress.MigratedObjects, progress.SkippedObjects, key)
-			atomic.AddInt64(&progress.MigratedObjects, 1) // after upload of an object via sync directory?
-			VerbosePrintf("migrated/skipped after: %d/%d object:%s", progress.MigratedObjects, progress.SkippedObjects, key)
-		}
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("error walking the directory: %v", err)
-	}
-	if s3c.logging {
-		log.Printf("\nSync has concluded for bucket %s\n", s3c.Bucket)
-	}
-
-	return nil
+// S3SyncDirectoryToBucket uploads the new and changed files under dirPath;
+// see S3SyncDirectoryToBucketWithOptions.
+func (s3c S3ClientSession) S3SyncDirectoryToBucket(dirPath string, progress *ProgressTracker) error {
+	_, err := s3c.S3SyncDirectoryToBucketWithOptions(dirPath, SyncOptions{}, progress)
+	return err
 }
 
 const (
@@ -1726,9 +1706,7 @@ const (
 	defaultPartSizeMax int64 = defaultPartSizeMin * 1024 // 5GB per part
 	//defaultPartSizeMax int64 = defaultPartSizeMin + 1024*1024 // 5KB+10 bytes? per part
 	//maxConcurrency           = 10                      // Maximum number of concurrent part uploads
-	maxRetries = 3               // Maximum number of retries for failed operations
-	retryDelay = 1 * time.Second // Delay between retries
-	maxParts   = 10000           // per AMZ specification
+	maxParts = 10000 // per AMZ specification
 	//maxParts              = 10 // per AMZ specification
 	defaultMaxConcurrency = 10
 )
@@ -1739,6 +1717,8 @@ type ProgressTracker struct {
 	SkippedObjects  int64
 	TotalBytes      int64
 	CompletedBytes  int64
+	FilteredObjects int64 // excluded by the migration's ObjectFilter; not part of TotalObjects
+	FilteredBytes   int64
 	FailedObjects   map[string]error
 	mu              sync.Mutex
 }
@@ -1759,6 +1739,9 @@ type CopyResult struct {
 	BytesCopied int64
 	Duration    time.Duration
 	WasSkipped  bool
+	Method      string // CopyMethodRegular, CopyMethodMPU or CopyMethodSkipped
+	SourceETag  string
+	TargetETag  string
 }
 
 // type EndpointInfo struct {
@@ -1767,24 +1750,6 @@ type CopyResult struct {
 // 	Bucket   string
 // }
 
-func withRetry(operation func() error) error {
-	var lastErr error
-	for i := 0; i < maxRetries; i++ {
-		if err := operation(); err != nil {
-			lastErr = err
-			if aerr, ok := err.(awserr.Error); ok {
-				if aerr.Code() == "NoSuchKey" || aerr.Code() == "NoSuchBucket" {
-					return err
-				}
-			}
-			time.Sleep(retryDelay * time.Duration(i+1))
-			continue
-		}
-		return nil
-	}
-	return fmt.Errorf("operation failed after %d retries: %v", maxRetries, lastErr)
-}
-
 // CopyAllObjects copies all objects between S3-compatible systems
 func (sourceS3 S3ClientSession) CopyAllObjectsDoNotUse(
 	targetS3 *S3ClientSession,
@@ -1795,7 +1760,12 @@ func (sourceS3 S3ClientSession) CopyAllObjectsDoNotUse(
 
 	progress.FailedObjects = make(map[string]error)
 
-	// Create worker pool for concurrent object copying
+	// Create worker pool for concurrent object copying; the limiter sheds
+	// workers while the endpoints keep throttling
+	if sourceS3.RetryPolicy.limiter() == nil {
+		sourceS3.RetryPolicy = sourceS3.RetryPolicy.WithLimiter(NewConcurrencyLimiter(sourceS3.GetConcurrency()))
+	}
+	limiter := sourceS3.RetryPolicy.Limiter
 	workerPool := make(chan struct{}, sourceS3.GetConcurrency())
 	var wg sync.WaitGroup
 	resultsChan := make(chan CopyResult, sourceS3.GetConcurrency())
@@ -1829,6 +1799,8 @@ func (sourceS3 S3ClientSession) CopyAllObjectsDoNotUse(
 					defer func() {
 						<-workerPool // Release worker
 					}()
+					limiter.Acquire()
+					defer limiter.Release()
 
 					startTime := time.Now()
 					err := sourceS3.CopyObjectBetweenBuckets(targetS3,
@@ -1968,12 +1940,12 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 
 	var headOutputSrc *s3.HeadObjectOutput
 	var headOutputTgt *s3.HeadObjectOutput
-	err := withRetry(func() error {
+	err := sourceS3.retry(func() error {
 		var err error
-		headOutputSrc, err = sourceS3.Client.HeadObjectWithContext(sourceS3.ctx, &s3.HeadObjectInput{
+		headOutputSrc, err = sourceS3.Client.HeadObjectWithContext(sourceS3.ctx, sourceS3.encryptHead(&s3.HeadObjectInput{
 			Bucket: aws.String(sourceS3.Bucket),
 			Key:    aws.String(sourceKey),
-		})
+		}))
 		return err
 	})
 	if err != nil {
@@ -1990,9 +1962,13 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 		return fmt.Errorf("content length of %d is too large to process", *headOutputSrc.ContentLength)
 	}
 
-	headOutputTgt, err = targetS3.Client.HeadObjectWithContext(targetS3.ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(targetS3.Bucket),
-		Key:    aws.String(targetKey),
+	err = sourceS3.retry(func() error {
+		var err error
+		headOutputTgt, err = targetS3.Client.HeadObjectWithContext(targetS3.ctx, targetS3.encryptHead(&s3.HeadObjectInput{
+			Bucket: aws.String(targetS3.Bucket),
+			Key:    aws.String(targetKey),
+		}))
+		return err
 	})
 	VerbosePrintf("headOutputSrc: Etag: %s", *headOutputSrc.ETag)
 	if err == nil {
@@ -2009,33 +1985,35 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 
 	// For small files, use GET and PUT instead of COPY
 	if *headOutputSrc.ContentLength < defaultPartSizeMin {
-		// Get the object
-		getOutput, err := sourceS3.Client.GetObjectWithContext(sourceS3.ctx, &s3.GetObjectInput{
-			Bucket: aws.String(sourceS3.Bucket),
-			Key:    aws.String(sourceKey),
+		// Get the object; a body cut short is retried like a failed GET
+		var body []byte
+		err := sourceS3.retry(func() error {
+			getOutput, err := sourceS3.Client.GetObjectWithContext(sourceS3.ctx, sourceS3.encryptGet(&s3.GetObjectInput{
+				Bucket: aws.String(sourceS3.Bucket),
+				Key:    aws.String(sourceKey),
+			}))
+			if err != nil {
+				return err
+			}
+			defer getOutput.Body.Close()
+			body, err = io.ReadAll(getOutput.Body)
+			if err != nil {
+				fmt.Printf("Error reading body, err=%s\n", err.Error())
+			}
+			return err
 		})
 		if err != nil {
 			return fmt.Errorf("failed to get source object: %v", err)
 		}
-		defer getOutput.Body.Close()
-
-		body, err := io.ReadAll(getOutput.Body)
-		if err != nil {
-			fmt.Printf("Error reading body, err=%s\n", err.Error())
-			return err
-		}
-		defer getOutput.Body.Close()
-
-		// Create an io.ReadSeeker from the byte slice
-		readSeeker := bytes.NewReader(body)
-
-		// Now you can use readSeeker where io.ReadSeeker is expected
 
 		// Put the object
-		_, err = targetS3.Client.PutObjectWithContext(sourceS3.ctx, &s3.PutObjectInput{
-			Bucket: aws.String(targetS3.Bucket),
-			Key:    aws.String(targetKey),
-			Body:   readSeeker,
+		err = sourceS3.retry(func() error {
+			_, err := targetS3.Client.PutObjectWithContext(sourceS3.ctx, targetS3.encryptPut(&s3.PutObjectInput{
+				Bucket: aws.String(targetS3.Bucket),
+				Key:    aws.String(targetKey),
+				Body:   bytes.NewReader(body),
+			}))
+			return err
 		})
 		if err != nil {
 			return fmt.Errorf("failed to put object: %v", err)
@@ -2049,9 +2027,14 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 
 	// For large files, use multipart upload with streaming
 	log.Printf("Creating MPU for s3://%s/%s", targetS3.Bucket, targetKey)
-	createOutput, err := targetS3.Client.CreateMultipartUploadWithContext(targetS3.ctx, &s3.CreateMultipartUploadInput{
-		Bucket: aws.String(targetS3.Bucket),
-		Key:    aws.String(targetKey),
+	var createOutput *s3.CreateMultipartUploadOutput
+	err = sourceS3.retry(func() error {
+		var err error
+		createOutput, err = targetS3.Client.CreateMultipartUploadWithContext(targetS3.ctx, targetS3.encryptCreateMPU(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String(targetS3.Bucket),
+			Key:    aws.String(targetKey),
+		}))
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create multipart upload: %v", err)
@@ -2092,35 +2075,40 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 				}
 
 				// Get the part from source
-				getPartOutput, err := sourceS3.Client.GetObjectWithContext(sourceS3.ctx, &s3.GetObjectInput{
-					Bucket: aws.String(sourceS3.Bucket),
-					Key:    aws.String(sourceKey),
-					Range:  aws.String(fmt.Sprintf("bytes=%d-%d", startByte, endByte)),
+				var body []byte
+				err := sourceS3.retry(func() error {
+					getPartOutput, err := sourceS3.Client.GetObjectWithContext(sourceS3.ctx, sourceS3.encryptGet(&s3.GetObjectInput{
+						Bucket: aws.String(sourceS3.Bucket),
+						Key:    aws.String(sourceKey),
+						Range:  aws.String(fmt.Sprintf("bytes=%d-%d", startByte, endByte)),
+					}))
+					if err != nil {
+						return err
+					}
+					defer getPartOutput.Body.Close()
+					body, err = io.ReadAll(getPartOutput.Body)
+					return err
 				})
 				if err != nil {
 					errorsChan <- fmt.Errorf("failed to get part %d: %v", partNumber, err)
 					return
 				}
-				body, err := io.ReadAll(getPartOutput.Body)
-				if err != nil {
-					return
-				}
-				defer getPartOutput.Body.Close()
-
-				// Create an io.ReadSeeker from the byte slice
-				readSeeker := bytes.NewReader(body)
 
 				// Upload the part
 				log.Printf("Uploading part of MPU for s3://%s/%s part #: %d of %d", targetS3.Bucket, targetKey, partNumber, totalParts)
 
-				uploadOutput, err := targetS3.Client.UploadPartWithContext(targetS3.ctx, &s3.UploadPartInput{
-					Bucket:     aws.String(targetS3.Bucket),
-					Key:        aws.String(targetKey),
-					PartNumber: aws.Int64(partNumber),
-					UploadId:   createOutput.UploadId,
-					Body:       readSeeker,
+				var uploadOutput *s3.UploadPartOutput
+				err = sourceS3.retry(func() error {
+					var err error
+					uploadOutput, err = targetS3.Client.UploadPartWithContext(targetS3.ctx, targetS3.encryptUploadPart(&s3.UploadPartInput{
+						Bucket:     aws.String(targetS3.Bucket),
+						Key:        aws.String(targetKey),
+						PartNumber: aws.Int64(partNumber),
+						UploadId:   createOutput.UploadId,
+						Body:       bytes.NewReader(body),
+					}))
+					return err
 				})
-				getPartOutput.Body.Close()
 
 				if err != nil {
 					log.Printf("Failed to upload part %d: %v", partNumber, err)
@@ -2148,10 +2136,13 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 		// Abort multipart upload
 		log.Printf("Aborting MPU for s3://%s/%s due to error: %s", targetS3.Bucket, targetKey, err.Error())
 
-		_, abortErr := targetS3.Client.AbortMultipartUploadWithContext(targetS3.ctx, &s3.AbortMultipartUploadInput{
-			Bucket:   aws.String(targetS3.Bucket),
-			Key:      aws.String(targetKey),
-			UploadId: createOutput.UploadId,
+		abortErr := sourceS3.retry(func() error {
+			_, err := targetS3.Client.AbortMultipartUploadWithContext(targetS3.ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(targetS3.Bucket),
+				Key:      aws.String(targetKey),
+				UploadId: createOutput.UploadId,
+			})
+			return err
 		})
 		if abortErr != nil {
 			return fmt.Errorf("failed to abort multipart upload: %v (original error: %v)", abortErr, err)
@@ -2166,13 +2157,16 @@ func (sourceS3 S3ClientSession) CopyObjectBetweenBuckets(
 	log.Printf("Completing MPU for s3://%s/%s", targetS3.Bucket, targetKey)
 
 	// Complete multipart upload
-	_, err = targetS3.Client.CompleteMultipartUploadWithContext(targetS3.ctx, &s3.CompleteMultipartUploadInput{
-		Bucket:   aws.String(targetS3.Bucket),
-		Key:      aws.String(targetKey),
-		UploadId: createOutput.UploadId,
-		MultipartUpload: &s3.CompletedMultipartUpload{
-			Parts: parts,
-		},
+	err = sourceS3.retry(func() error {
+		_, err := targetS3.Client.CompleteMultipartUploadWithContext(targetS3.ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String(targetS3.Bucket),
+			Key:      aws.String(targetKey),
+			UploadId: createOutput.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{
+				Parts: parts,
+			},
+		})
+		return err
 	})
 	if err != nil {
 		log.Printf("MPU for s3://%s/%s failed to complete", targetS3.Bucket, targetKey)
@@ -2275,10 +2269,10 @@ func (sourceS3 S3ClientSession) SetBucketACL(aclJson string) error {
 // return nil
 
 func (s3c *S3ClientSession) GetSizeOfObject() (int64, error) {
-	headObjectOutput, err := s3c.Client.HeadObject(&s3.HeadObjectInput{
+	headObjectOutput, err := s3c.Client.HeadObject(s3c.encryptHead(&s3.HeadObjectInput{
 		Bucket: &s3c.Bucket,
 		Key:    &s3c.ObjectKey,
-	})
+	}))
 	if err != nil {
 		return 0, err
 	}
@@ -2297,11 +2291,11 @@ func (s3c *S3ClientSession) GetHashOfObjectRange(fromChunk int64, chunkSize int6
 	}
 
 	rangeHeader := fmt.Sprintf("bytes=%d-%d", fromChunk, fromChunk+chunkSize-1)
-	getObjectOutput, err := s3c.Client.GetObject(&s3.GetObjectInput{
+	getObjectOutput, err := s3c.Client.GetObject(s3c.encryptGet(&s3.GetObjectInput{
 		Bucket: &s3c.Bucket,
 		Key:    &s3c.ObjectKey,
 		Range:  &rangeHeader,
-	})
+	}))
 	if err != nil {
 		return "", err
 	}
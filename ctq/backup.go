@@ -0,0 +1,184 @@
+package ctq
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/cmd184psu/alfredo"
+)
+
+const backupFilePrefix = "ctq-backup-"
+
+// requiredTables must all be present in a database before it can be restored
+var requiredTables = []string{"tasks", "task_executions", "task_locks", "queue_state", "task_metrics"}
+
+func quoteSQL(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Snapshot writes a consistent copy of the live database to destPath. VACUUM
+// INTO runs inside a read transaction, so workers can keep writing meanwhile.
+func (db *DB) Snapshot(destPath string) error {
+	if alfredo.FileExistsEasy(destPath) {
+		return fmt.Errorf("snapshot target %s already exists", destPath)
+	}
+	if err := db.Query("VACUUM INTO " + quoteSQL(destPath) + ";"); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
+
+// ValidateSnapshot checks that path is an intact ctq database whose schema
+// this binary understands
+func ValidateSnapshot(path string) error {
+	if !alfredo.FileExistsEasy(path) {
+		return fmt.Errorf("snapshot %s not found", path)
+	}
+	snap := alfredo.NewSQLiteDB().WithDbPath(path)
+
+	if err := snap.Query("PRAGMA integrity_check;"); err != nil {
+		return fmt.Errorf("snapshot %s is not a readable sqlite database: %w", path, err)
+	}
+	if result := snap.GetResult(); result != "ok" {
+		return fmt.Errorf("snapshot %s failed integrity check: %s", path, result)
+	}
+
+	version, err := detectSchemaVersion(snap)
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("snapshot %s has schema version %d, newer than this binary supports (%d)", path, version, SchemaVersion)
+	}
+
+	for _, table := range requiredTables {
+		if err := snap.Query(fmt.Sprintf("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = '%s';", table)); err != nil {
+			return err
+		}
+		if snap.GetResultInt64() != 1 {
+			return fmt.Errorf("snapshot %s is missing table %q", path, table)
+		}
+	}
+	return nil
+}
+
+// Restore validates srcPath and atomically replaces the live database with it
+func (db *DB) Restore(srcPath string) error {
+	if err := ValidateSnapshot(srcPath); err != nil {
+		return err
+	}
+
+	// stage next to the live database so the rename stays on one filesystem
+	staged := fmt.Sprintf("%s.restore-%d", db.DbPath, time.Now().UnixNano())
+	if _, err := alfredo.CopyFile(srcPath, staged); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to stage restore: %w", err)
+	}
+	if err := os.Rename(staged, db.DbPath); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("failed to replace database: %w", err)
+	}
+
+	// bring an older snapshot up to the current schema
+	if _, err := InitDB(db.DbPath); err != nil {
+		return fmt.Errorf("restored database could not be initialized: %w", err)
+	}
+	return nil
+}
+
+// BackupConfig controls periodic snapshots taken by the coordinator
+type BackupConfig struct {
+	Dir      string                   // local directory for snapshots (required)
+	Interval time.Duration            // 0 disables periodic snapshots
+	Keep     int                      // snapshots to retain locally; 0 keeps all
+	S3       *alfredo.S3ClientSession // optional; Bucket and ObjectKey (as prefix) name the upload target
+}
+
+func (bc BackupConfig) Enabled() bool {
+	return bc.Interval > 0 && bc.Dir != ""
+}
+
+func backupFileName(t time.Time) string {
+	return backupFilePrefix + t.UTC().Format("20060102T150405Z") + ".sqlite"
+}
+
+// runBackup takes one snapshot into bc.Dir, uploads it if S3 is configured,
+// and prunes old local snapshots
+func (db *DB) runBackup(bc BackupConfig) (string, error) {
+	if err := os.MkdirAll(bc.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	path := filepath.Join(bc.Dir, backupFileName(time.Now()))
+	if err := db.Snapshot(path); err != nil {
+		return "", err
+	}
+
+	if bc.S3 != nil {
+		if err := uploadBackup(bc.S3, path); err != nil {
+			return path, err
+		}
+	}
+
+	if bc.Keep > 0 {
+		if err := pruneBackups(bc.Dir, bc.Keep); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+func uploadBackup(s3c *alfredo.S3ClientSession, path string) error {
+	if err := s3c.EstablishSession(); err != nil {
+		return fmt.Errorf("failed to establish S3 session: %w", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	key := strings.TrimSuffix(s3c.ObjectKey, "/")
+	if key != "" {
+		key += "/"
+	}
+	key += filepath.Base(path)
+
+	uploader := s3manager.NewUploader(s3c.GetSession())
+	if _, err := uploader.Upload(&s3manager.UploadInput{
+		Bucket: aws.String(s3c.Bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	}); err != nil {
+		return fmt.Errorf("failed to upload backup to s3://%s/%s: %w", s3c.Bucket, key, err)
+	}
+	log.Printf("[coordinator] Uploaded backup to s3://%s/%s", s3c.Bucket, key)
+	return nil
+}
+
+// pruneBackups removes all but the newest keep snapshots in dir
+func pruneBackups(dir string, keep int) error {
+	matches, err := filepath.Glob(filepath.Join(dir, backupFilePrefix+"*.sqlite"))
+	if err != nil {
+		return err
+	}
+	if len(matches) <= keep {
+		return nil
+	}
+	// names embed a sortable UTC timestamp
+	sort.Strings(matches)
+	for _, old := range matches[:len(matches)-keep] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
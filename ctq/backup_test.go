@@ -0,0 +1,81 @@
+package ctq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cmd184psu/alfredo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := InitDB(filepath.Join(tmpDir, "test.sqlite"))
+	require.NoError(t, err)
+
+	require.NoError(t, db.AddTask(&Task{Name: "keep-me", Enabled: true, TaskType: "shell", Args: `{"shell":"echo keep"}`}))
+
+	snap := filepath.Join(tmpDir, "snap.sqlite")
+	require.NoError(t, db.Snapshot(snap))
+	require.Error(t, db.Snapshot(snap), "snapshot must not overwrite an existing file")
+	require.NoError(t, ValidateSnapshot(snap))
+
+	// change the live database, then roll it back
+	require.NoError(t, db.DeleteTask("keep-me"))
+	require.NoError(t, db.AddTask(&Task{Name: "added-later", Enabled: true, TaskType: "shell", Args: `{"shell":"echo later"}`}))
+
+	require.NoError(t, db.Restore(snap))
+
+	task, err := db.GetTask("keep-me")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	task, err = db.GetTask("added-later")
+	require.NoError(t, err)
+	require.Nil(t, task)
+}
+
+func TestValidateSnapshotRejects(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	garbage := filepath.Join(tmpDir, "garbage.sqlite")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a database at all, just some text"), 0644))
+	require.Error(t, ValidateSnapshot(garbage))
+
+	require.Error(t, ValidateSnapshot(filepath.Join(tmpDir, "missing.sqlite")))
+
+	// a sqlite file that is not a ctq database
+	other := alfredo.NewSQLiteDB().WithDbPath(filepath.Join(tmpDir, "other.sqlite"))
+	require.NoError(t, other.Query("CREATE TABLE unrelated (id INTEGER);"))
+	require.Error(t, ValidateSnapshot(other.DbPath))
+
+	// a ctq database from a newer binary
+	newer, err := InitDB(filepath.Join(tmpDir, "newer.sqlite"))
+	require.NoError(t, err)
+	require.NoError(t, newer.Query("INSERT INTO schema_version (version, description, applied_at) VALUES (9999, 'from the future', 0);"))
+	require.Error(t, ValidateSnapshot(newer.DbPath))
+}
+
+func TestRunBackupPrunes(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := InitDB(filepath.Join(tmpDir, "test.sqlite"))
+	require.NoError(t, err)
+
+	backupDir := filepath.Join(tmpDir, "backups")
+	// pre-existing older snapshots
+	require.NoError(t, os.MkdirAll(backupDir, 0755))
+	for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour} {
+		old := filepath.Join(backupDir, backupFileName(time.Now().Add(-age)))
+		require.NoError(t, os.WriteFile(old, []byte("old"), 0644))
+	}
+
+	path, err := db.runBackup(BackupConfig{Dir: backupDir, Interval: time.Hour, Keep: 2})
+	require.NoError(t, err)
+	require.NoError(t, ValidateSnapshot(path))
+
+	matches, err := filepath.Glob(filepath.Join(backupDir, backupFilePrefix+"*.sqlite"))
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	require.Contains(t, matches, path)
+}
@@ -3,10 +3,12 @@ package ctq
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
@@ -20,6 +22,7 @@ type Coordinator struct {
 	db         *DB
 	httpAddr   string
 	httpServer *http.Server
+	backup     BackupConfig
 }
 
 func NewCoordinator(db *DB, httpAddr string) *Coordinator {
@@ -29,6 +32,12 @@ func NewCoordinator(db *DB, httpAddr string) *Coordinator {
 	}
 }
 
+// WithBackups enables periodic snapshots of the database
+func (c *Coordinator) WithBackups(bc BackupConfig) *Coordinator {
+	c.backup = bc
+	return c
+}
+
 // Start begins the coordinator service
 func (c *Coordinator) Start() error {
 	fmt.Printf("[coordinator] Starting on %q...\n", c.httpAddr)
@@ -43,17 +52,28 @@ func (c *Coordinator) Start() error {
 	mux.HandleFunc("/tasks/disable", c.handleDisableTask)
 	mux.HandleFunc("/tasks/delete", c.handleDeleteTask)
 	mux.HandleFunc("/tasks/refresh", c.handleRefreshTask)
+	mux.HandleFunc("/tasks/status", c.handleTaskStatus)
 
 	// Queue management endpoints
 	mux.HandleFunc("/queue/pause", c.handlePauseQueue)
 	mux.HandleFunc("/queue/resume", c.handleResumeQueue)
 	mux.HandleFunc("/queue/status", c.handleQueueStatus)
+	mux.HandleFunc("/queues", c.handleQueues)
+	mux.HandleFunc("/queues/add", c.handleAddQueue)
 
 	// Observability endpoints
 	mux.HandleFunc("/metrics", c.handleMetrics)
 	mux.HandleFunc("/executions", c.handleExecutions)
+	mux.HandleFunc("/workers", c.handleWorkers)
 	mux.HandleFunc("/health", c.handleHealth)
 
+	// Database administration endpoints
+	mux.HandleFunc("/admin/backup", c.handleBackup)
+	mux.HandleFunc("/admin/restore", c.handleRestore)
+
+	// Web dashboard
+	c.serveDashboard(mux)
+
 	c.httpServer = &http.Server{
 		Addr:    alfredo.StripProtocol(c.httpAddr),
 		Handler: mux,
@@ -63,9 +83,15 @@ func (c *Coordinator) Start() error {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	stopBackups := make(chan struct{})
+	if c.backup.Enabled() {
+		go c.runPeriodicBackups(stopBackups)
+	}
+
 	go func() {
 		<-sigChan
 		fmt.Printf("[coordinator] Received shutdown signal\n")
+		close(stopBackups)
 		c.httpServer.Close()
 	}()
 
@@ -96,6 +122,23 @@ func (c *Coordinator) handleTasks(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tasks)
 }
 
+// handleTaskStatus lists all tasks with their last result and next eligible time
+func (c *Coordinator) handleTaskStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses, err := c.db.ListTaskStatus()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
 // handleAddTask adds or updates a task
 func (c *Coordinator) handleAddTask(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -218,6 +261,19 @@ func (c *Coordinator) handlePauseQueue(w http.ResponseWriter, r *http.Request) {
 		pausedBy = "coordinator"
 	}
 
+	// A named queue pauses independently; without one the whole queue stops
+	if queue := r.URL.Query().Get("queue"); queue != "" {
+		if err := c.db.SetNamedQueuePaused(queue, true, pausedBy); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		fmt.Printf("[coordinator] Queue '%s' paused by %s\n", queue, pausedBy)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "paused", "queue": queue})
+		return
+	}
+
 	if err := c.db.SetQueuePaused(true, pausedBy); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -235,6 +291,18 @@ func (c *Coordinator) handleResumeQueue(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if queue := r.URL.Query().Get("queue"); queue != "" {
+		if err := c.db.SetNamedQueuePaused(queue, false, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		fmt.Printf("[coordinator] Queue '%s' resumed\n", queue)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "running", "queue": queue})
+		return
+	}
+
 	if err := c.db.SetQueuePaused(false, ""); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -257,6 +325,22 @@ func (c *Coordinator) handleQueueStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if queue := r.URL.Query().Get("queue"); queue != "" {
+		q, err := c.db.GetQueue(queue)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if q == nil {
+			http.Error(w, fmt.Sprintf("queue %q not found", queue), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(q)
+		return
+	}
+
 	if err := c.db.Query(getQueueStatusFmt); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -296,12 +380,62 @@ func (c *Coordinator) handleQueueStatus(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	queues, err := c.db.ListQueues()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp["queues"] = queues
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleQueues lists the named queues
+func (c *Coordinator) handleQueues(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queues, err := c.db.ListQueues()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queues)
+}
+
+// handleAddQueue adds a named queue or updates its priority
+func (c *Coordinator) handleAddQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var queue Queue
+	if err := json.NewDecoder(r.Body).Decode(&queue); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if queue.Name == "" {
+		http.Error(w, "Missing 'name' field", http.StatusBadRequest)
+		return
+	}
+
+	if err := c.db.AddQueue(queue.Name, queue.Priority); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
 const metricsQueryFmt = `
-SELECT json_group_array(value)
+SELECT json_group_array(json(value))
 FROM (
   SELECT json_object(
     'task_name',      t.name,
@@ -371,13 +505,13 @@ func (c *Coordinator) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type Metric struct {
-		TaskName      string     `json:"task_name"`
-		SuccessCount  int        `json:"success_count"`
-		FailedCount   int        `json:"failed_count"`
-		AvgDurationMs *float64   `json:"avg_duration_ms"`
-		MinDurationMs *int64     `json:"min_duration_ms"`
-		MaxDurationMs *int64     `json:"max_duration_ms"`
-		LastExecution *time.Time `json:"last_execution"`
+		TaskName      string             `json:"task_name"`
+		SuccessCount  int                `json:"success_count"`
+		FailedCount   int                `json:"failed_count"`
+		AvgDurationMs *float64           `json:"avg_duration_ms"`
+		MinDurationMs *int64             `json:"min_duration_ms"`
+		MaxDurationMs *int64             `json:"max_duration_ms"`
+		LastExecution *alfredo.EpochTime `json:"last_execution"`
 	}
 
 	var metrics []Metric
@@ -434,6 +568,16 @@ func (c *Coordinator) handleExecutions(w http.ResponseWriter, r *http.Request) {
 		whereClause = fmt.Sprintf("AND t.name = '%s'", taskName)
 	}
 
+	// since: epoch ms; only executions started at or after it
+	if sinceStr := r.URL.Query().Get("since"); sinceStr != "" {
+		since, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid 'since' parameter", http.StatusBadRequest)
+			return
+		}
+		whereClause += fmt.Sprintf(" AND te.started_at >= %d", since)
+	}
+
 	payload := fmt.Sprintf(executionsQueryFmt, whereClause, limit)
 
 	if err := c.db.Query(payload); err != nil {
@@ -448,16 +592,16 @@ func (c *Coordinator) handleExecutions(w http.ResponseWriter, r *http.Request) {
 	alfredo.VerbosePrintln("=================")
 
 	type ExecutionDetail struct {
-		ID           int64      `json:"id"`
-		TaskID       int64      `json:"task_id"`
-		TaskName     string     `json:"task_name"`
-		StartedAt    *time.Time `json:"started_at"`
-		FinishedAt   *time.Time `json:"finished_at"`
-		Status       string     `json:"status"`
-		ErrorMessage *string    `json:"error_message"`
-		RetryCount   int        `json:"retry_count"`
-		WorkerID     *string    `json:"worker_id"`
-		DurationMs   *int64     `json:"duration_ms"`
+		ID           int64              `json:"id"`
+		TaskID       int64              `json:"task_id"`
+		TaskName     string             `json:"task_name"`
+		StartedAt    *alfredo.EpochTime `json:"started_at"`
+		FinishedAt   *alfredo.EpochTime `json:"finished_at"`
+		Status       string             `json:"status"`
+		ErrorMessage *string            `json:"error_message"`
+		RetryCount   int                `json:"retry_count"`
+		WorkerID     *string            `json:"worker_id"`
+		DurationMs   *int64             `json:"duration_ms"`
 	}
 
 	var executions []ExecutionDetail
@@ -478,6 +622,113 @@ func (c *Coordinator) handleExecutions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(executions)
 }
 
+// handleWorkers lists workers seen in the execution history
+func (c *Coordinator) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	workers, err := c.db.ListWorkers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workers)
+}
+
+// runPeriodicBackups snapshots the database every backup.Interval until stop closes
+func (c *Coordinator) runPeriodicBackups(stop chan struct{}) {
+	fmt.Printf("[coordinator] Backing up every %v to %s\n", c.backup.Interval, c.backup.Dir)
+	ticker := time.NewTicker(c.backup.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			path, err := c.db.runBackup(c.backup)
+			if err != nil {
+				fmt.Printf("[coordinator] Warning: backup failed: %v\n", err)
+				continue
+			}
+			fmt.Printf("[coordinator] Backup written to %s\n", path)
+		}
+	}
+}
+
+// handleBackup streams a consistent snapshot of the database
+func (c *Coordinator) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ctq-backup")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	name := backupFileName(time.Now())
+	path := filepath.Join(tmpDir, name)
+	if err := c.db.Snapshot(path); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	fmt.Printf("[coordinator] Serving backup %s\n", name)
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	io.Copy(w, f)
+}
+
+// handleRestore replaces the database with the uploaded snapshot after validating it
+func (c *Coordinator) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.db.DbPath), "ctq-upload-*.sqlite")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r.Body)
+	f.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ValidateSnapshot(f.Name()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.db.Restore(f.Name()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("[coordinator] Database restored from upload\n")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "restored"})
+}
+
 func (c *Coordinator) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -6,10 +6,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"text/tabwriter"
-	"time"
 
 	"github.com/cmd184psu/alfredo"
 )
@@ -49,7 +50,7 @@ func RunCLI() {
 	case "add":
 		handleAdd(coordinatorURL)
 	case "list":
-		handleList(coordinatorURL)
+		handleList(coordinatorURL, subArgs)
 	case "enable":
 		handleEnable(coordinatorURL, true)
 	case "disable":
@@ -59,17 +60,25 @@ func RunCLI() {
 	case "refresh":
 		handleRefresh(coordinatorURL)
 	case "pause":
-		handlePause(coordinatorURL)
+		handlePause(coordinatorURL, subArgs)
 	case "resume":
-		handleResume(coordinatorURL)
+		handleResume(coordinatorURL, subArgs)
 	case "status":
-		handleStatus(coordinatorURL)
+		handleStatus(coordinatorURL, subArgs)
+	case "queues":
+		handleQueues(coordinatorURL, subArgs)
+	case "add-queue":
+		handleAddQueue(coordinatorURL, subArgs)
 	case "metrics":
-		handleMetrics(coordinatorURL)
+		handleMetrics(coordinatorURL, subArgs)
 	case "executions":
-		handleExecutions(coordinatorURL)
+		handleExecutions(coordinatorURL, subArgs)
 	case "health":
 		handleHealth(coordinatorURL)
+	case "backup":
+		handleBackup(coordinatorURL, subArgs)
+	case "restore":
+		handleRestore(coordinatorURL, subArgs)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		printUsage()
@@ -87,12 +96,23 @@ Commands:
   disable     Disable a task (-name required)
   delete      Delete a task (-name required)
   refresh     Clear execution history so task can run again (-name required)
-  pause       Pause the queue
-  resume      Resume the queue
-  status      Show queue status
+  pause       Pause the queue (-queue optional, pauses only that queue)
+  resume      Resume the queue (-queue optional, resumes only that queue)
+  status      Show queue status (-queue optional)
+  queues      List named queues
+  add-queue   Add a named queue or change its priority (-name required, -priority optional)
   metrics     Show task metrics (-task optional, -hours optional)
   executions  Show recent executions (-task optional, -limit optional)
   health      Check coordinator health
+  backup      Download a consistent snapshot of the database (-out required)
+  restore     Replace the database with a snapshot after validating it (-in required)
+
+Read commands (list, status, queues, metrics, executions) also accept:
+  -o table|wide|json|yaml     Output format (default table)
+  -filter key=value[,...]     Keep records whose fields match, e.g. queue=default for list or
+                              status=failed,worker=host1 for executions; unknown keys are rejected
+  -since 2h                   Keep records newer than a duration (s, m, h, d); list, metrics
+                              (by last execution) and executions only
 
 Options:
   -url string
@@ -108,6 +128,7 @@ Examples:
     "cooldown_seconds": 3600,
     "max_retries": 3,
     "requeue": true,
+    "queue": "default",
     "task_type": "shell",
     "args": "{\"shell\": \"tar -czf /backup/data.tar.gz /data\"}"
   }
@@ -119,11 +140,27 @@ Examples:
   # Pause queue
   ctqctl pause
 
+  # Pause only the maintenance queue, leaving the others running
+  ctqctl add-queue -name maintenance -priority 200
+  ctqctl pause -queue maintenance
+
   # Refresh a one-shot task to run it again
   ctqctl refresh -name migrate-v2
 
   # View metrics
   ctqctl metrics -task backup -hours 24
+
+  # Snapshot the database, then restore it
+  ctqctl backup -out /tmp/state.sqlite
+  ctqctl restore -in /tmp/state.sqlite
+
+  # Enabled tasks of the default queue
+  ctqctl list -filter queue=default,enabled=true
+
+  # Failed executions from the last 2 hours as JSON
+  ctqctl executions -o json -filter status=failed -since 2h | jq .
+
+The coordinator also serves a web dashboard at <url>/ui/
 `)
 }
 
@@ -161,7 +198,12 @@ func handleAdd(baseURL string) {
 	fmt.Println("Task added successfully")
 }
 
-func handleList(baseURL string) {
+func handleList(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	out := addOutputFlags(fs)
+	fs.Parse(subArgs)
+	out.mustParse()
+
 	resp, err := http.Get(baseURL + "/tasks")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -169,28 +211,40 @@ func handleList(baseURL string) {
 	}
 	defer resp.Body.Close()
 
-	// Optional: Log body without consuming for decoder
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading body: %v\n", err)
-		os.Exit(1)
-	}
-	resp.Body = io.NopCloser(bytes.NewReader(body)) // Reset for decoder
-
 	var tasks []Task
 	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
 		fmt.Fprintf(os.Stderr, "Error decoding response (1): %v\n", err)
 		os.Exit(1)
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tNAME\tENABLED\tPRIORITY\tCOOLDOWN\tRETRIES\tREQUEUE\tTYPE")
-	for _, task := range tasks {
-		fmt.Fprintf(w, "%d\t%s\t%v\t%d\t%ds\t%d\t%v\t%s\n",
-			task.ID, task.Name, task.Enabled, task.Priority,
-			task.CooldownSeconds, task.MaxRetries, task.Requeue, task.TaskType)
+	keep, err := out.matchIndexes(tasks, "updated_at")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering tasks: %v\n", err)
+		os.Exit(1)
 	}
-	w.Flush()
+	filtered := []Task{}
+	for _, i := range keep {
+		filtered = append(filtered, tasks[i])
+	}
+
+	out.mustRender(filtered, func(wide bool) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if wide {
+			fmt.Fprintln(w, "ID\tNAME\tQUEUE\tENABLED\tPRIORITY\tCOOLDOWN\tRETRIES\tREQUEUE\tTYPE\tUPDATED\tARGS")
+		} else {
+			fmt.Fprintln(w, "ID\tNAME\tQUEUE\tENABLED\tPRIORITY\tCOOLDOWN\tRETRIES\tREQUEUE\tTYPE")
+		}
+		for _, task := range filtered {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%v\t%d\t%ds\t%d\t%v\t%s",
+				task.ID, task.Name, task.Queue, task.Enabled, task.Priority,
+				task.CooldownSeconds, task.MaxRetries, task.Requeue, task.TaskType)
+			if wide {
+				fmt.Fprintf(w, "\t%s\t%s", task.UpdatedAt.Format("2006-01-02 15:04:05"), task.Args)
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	})
 }
 
 func handleEnable(baseURL string, enable bool) {
@@ -294,8 +348,17 @@ func handleRefresh(baseURL string) {
 	fmt.Printf("Task '%s' refreshed - execution history cleared, will run again\n", *name)
 }
 
-func handlePause(baseURL string) {
-	resp, err := http.Post(baseURL+"/queue/pause", "application/json", nil)
+func handlePause(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("pause", flag.ExitOnError)
+	queue := fs.String("queue", "", "Named queue to pause (default: whole queue)")
+	fs.Parse(subArgs)
+
+	endpoint := baseURL + "/queue/pause?by=ctqctl"
+	if *queue != "" {
+		endpoint += "&queue=" + url.QueryEscape(*queue)
+	}
+
+	resp, err := http.Post(endpoint, "application/json", nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -308,11 +371,24 @@ func handlePause(baseURL string) {
 		os.Exit(1)
 	}
 
+	if *queue != "" {
+		fmt.Printf("Queue '%s' paused\n", *queue)
+		return
+	}
 	fmt.Println("Queue paused")
 }
 
-func handleResume(baseURL string) {
-	resp, err := http.Post(baseURL+"/queue/resume", "application/json", nil)
+func handleResume(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	queue := fs.String("queue", "", "Named queue to resume (default: whole queue)")
+	fs.Parse(subArgs)
+
+	endpoint := baseURL + "/queue/resume"
+	if *queue != "" {
+		endpoint += "?queue=" + url.QueryEscape(*queue)
+	}
+
+	resp, err := http.Post(endpoint, "application/json", nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -325,10 +401,30 @@ func handleResume(baseURL string) {
 		os.Exit(1)
 	}
 
+	if *queue != "" {
+		fmt.Printf("Queue '%s' resumed\n", *queue)
+		return
+	}
 	fmt.Println("Queue resumed")
 }
 
-func handleStatus(baseURL string) {
+func handleStatus(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	queue := fs.String("queue", "", "Named queue (optional)")
+	out := addOutputFlags(fs)
+	fs.Parse(subArgs)
+	out.mustParse()
+
+	if *queue != "" {
+		if out.filterStr != "" || out.sinceStr != "" {
+			fmt.Fprintf(os.Stderr, "Error: -filter and -since cannot be combined with -queue\n")
+			os.Exit(1)
+		}
+		q := fetchQueue(baseURL, *queue)
+		out.mustRender(q, func(bool) { printQueueStatus(q) })
+		return
+	}
+
 	resp, err := http.Get(baseURL + "/queue/status")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -336,36 +432,178 @@ func handleStatus(baseURL string) {
 	}
 	defer resp.Body.Close()
 
-	var status map[string]interface{}
+	var status struct {
+		Paused   bool    `json:"paused"`
+		PausedAt *string `json:"paused_at,omitempty"`
+		PausedBy *string `json:"paused_by,omitempty"`
+		Queues   []Queue `json:"queues"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
 		fmt.Fprintf(os.Stderr, "Error decoding response(2): %v\n", err)
 		os.Exit(1)
 	}
 
-	paused := status["paused"].(bool)
-	if paused {
-		fmt.Println("Queue Status: PAUSED")
-		if pausedAt, ok := status["paused_at"].(string); ok {
-			fmt.Printf("Paused At: %s\n", pausedAt)
+	keep, err := out.matchIndexes(status.Queues, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering queues: %v\n", err)
+		os.Exit(1)
+	}
+	queues := []Queue{}
+	for _, i := range keep {
+		queues = append(queues, status.Queues[i])
+	}
+	status.Queues = queues
+
+	out.mustRender(status, func(wide bool) {
+		if status.Paused {
+			fmt.Println("Queue Status: PAUSED")
+			if status.PausedAt != nil {
+				fmt.Printf("Paused At: %s\n", *status.PausedAt)
+			}
+			if status.PausedBy != nil {
+				fmt.Printf("Paused By: %s\n", *status.PausedBy)
+			}
+		} else {
+			fmt.Println("Queue Status: RUNNING")
 		}
-		if pausedBy, ok := status["paused_by"].(string); ok {
-			fmt.Printf("Paused By: %s\n", pausedBy)
+
+		if len(status.Queues) > 0 {
+			fmt.Println()
+			printQueues(status.Queues)
+		}
+	})
+}
+
+func fetchQueue(baseURL, name string) Queue {
+	resp, err := http.Get(baseURL + "/queue/status?queue=" + url.QueryEscape(name))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	var q Queue
+	if err := json.NewDecoder(resp.Body).Decode(&q); err != nil {
+		fmt.Fprintf(os.Stderr, "Error decoding response: %v\n", err)
+		os.Exit(1)
+	}
+	return q
+}
+
+func printQueueStatus(q Queue) {
+	if q.Paused {
+		fmt.Printf("Queue '%s' Status: PAUSED\n", q.Name)
+		if q.PausedAt != nil {
+			fmt.Printf("Paused At: %s\n", q.PausedAt.Format("2006-01-02 15:04:05"))
+		}
+		if q.PausedBy != nil {
+			fmt.Printf("Paused By: %s\n", *q.PausedBy)
 		}
 	} else {
-		fmt.Println("Queue Status: RUNNING")
+		fmt.Printf("Queue '%s' Status: RUNNING\n", q.Name)
 	}
+	fmt.Printf("Priority: %d\n", q.Priority)
 }
 
-func handleMetrics(baseURL string) {
-	var taskName string
-	var hours int
-	flag.StringVar(&taskName, "task", "", "Task name (optional)")
-	flag.IntVar(&hours, "hours", 24, "Hours to look back")
-	flag.CommandLine.Parse(os.Args[2:])
+func printQueues(queues []Queue) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUE\tPRIORITY\tSTATUS\tPAUSED_BY")
+	for _, q := range queues {
+		state := "RUNNING"
+		pausedBy := ""
+		if q.Paused {
+			state = "PAUSED"
+			if q.PausedBy != nil {
+				pausedBy = *q.PausedBy
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", q.Name, q.Priority, state, pausedBy)
+	}
+	w.Flush()
+}
+
+func handleQueues(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("queues", flag.ExitOnError)
+	out := addOutputFlags(fs)
+	fs.Parse(subArgs)
+	out.mustParse()
+
+	resp, err := http.Get(baseURL + "/queues")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
 
-	url := fmt.Sprintf("%s/metrics?hours=%d", baseURL, hours)
-	if taskName != "" {
-		url += "&task=" + taskName
+	var queues []Queue
+	if err := json.NewDecoder(resp.Body).Decode(&queues); err != nil {
+		fmt.Fprintf(os.Stderr, "Error decoding response: %v\n", err)
+		os.Exit(1)
+	}
+
+	keep, err := out.matchIndexes(queues, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering queues: %v\n", err)
+		os.Exit(1)
+	}
+	filtered := []Queue{}
+	for _, i := range keep {
+		filtered = append(filtered, queues[i])
+	}
+
+	out.mustRender(filtered, func(bool) { printQueues(filtered) })
+}
+
+func handleAddQueue(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("add-queue", flag.ExitOnError)
+	name := fs.String("name", "", "Queue name")
+	priority := fs.Int("priority", 100, "Queue priority (lower runs first)")
+	fs.Parse(subArgs)
+
+	if *name == "" {
+		fmt.Fprintf(os.Stderr, "Error: -name is required\n")
+		os.Exit(1)
+	}
+
+	payload, _ := json.Marshal(Queue{Name: *name, Priority: *priority})
+	resp, err := http.Post(baseURL+"/queues/add", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Printf("Queue '%s' saved with priority %d\n", *name, *priority)
+}
+
+func handleMetrics(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("metrics", flag.ExitOnError)
+	taskName := fs.String("task", "", "Task name (optional)")
+	hours := fs.Int("hours", 24, "Hours to look back")
+	out := addOutputFlags(fs)
+	fs.Parse(subArgs)
+	out.mustParse()
+
+	// -since is the finer grained form of -hours; the API counts whole hours
+	if out.since > 0 {
+		*hours = int(math.Ceil(out.since.Hours()))
+	}
+
+	url := fmt.Sprintf("%s/metrics?hours=%d", baseURL, *hours)
+	if *taskName != "" {
+		url += "&task=" + *taskName
 	}
 
 	resp, err := http.Get(url)
@@ -376,13 +614,13 @@ func handleMetrics(baseURL string) {
 	defer resp.Body.Close()
 
 	var metrics []struct {
-		TaskName      string     `json:"task_name"`
-		SuccessCount  int        `json:"success_count"`
-		FailedCount   int        `json:"failed_count"`
-		AvgDurationMs *float64   `json:"avg_duration_ms"`
-		MinDurationMs *int64     `json:"min_duration_ms"`
-		MaxDurationMs *int64     `json:"max_duration_ms"`
-		LastExecution *time.Time `json:"last_execution"`
+		TaskName      string             `json:"task_name"`
+		SuccessCount  int                `json:"success_count"`
+		FailedCount   int                `json:"failed_count"`
+		AvgDurationMs *float64           `json:"avg_duration_ms"`
+		MinDurationMs *int64             `json:"min_duration_ms"`
+		MaxDurationMs *int64             `json:"max_duration_ms"`
+		LastExecution *alfredo.EpochTime `json:"last_execution"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
@@ -390,42 +628,71 @@ func handleMetrics(baseURL string) {
 		os.Exit(1)
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "TASK\tSUCCESS\tFAILED\tAVG_MS\tMIN_MS\tMAX_MS\tLAST_EXEC")
-	for _, m := range metrics {
-		avgMs := "N/A"
-		if m.AvgDurationMs != nil {
-			avgMs = fmt.Sprintf("%.0f", *m.AvgDurationMs)
-		}
-		minMs := "N/A"
-		if m.MinDurationMs != nil {
-			minMs = fmt.Sprintf("%d", *m.MinDurationMs)
-		}
-		maxMs := "N/A"
-		if m.MaxDurationMs != nil {
-			maxMs = fmt.Sprintf("%d", *m.MaxDurationMs)
-		}
-		lastExec := "Never"
-		if m.LastExecution != nil {
-			lastExec = m.LastExecution.Format("2006-01-02 15:04:05")
+	keep, err := out.matchIndexes(metrics, "last_execution")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering metrics: %v\n", err)
+		os.Exit(1)
+	}
+	filtered := metrics[:0]
+	for _, i := range keep {
+		filtered = append(filtered, metrics[i])
+	}
+
+	out.mustRender(filtered, func(wide bool) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if wide {
+			fmt.Fprintln(w, "TASK\tSUCCESS\tFAILED\tFAIL_RATE\tAVG_MS\tMIN_MS\tMAX_MS\tLAST_EXEC")
+		} else {
+			fmt.Fprintln(w, "TASK\tSUCCESS\tFAILED\tAVG_MS\tMIN_MS\tMAX_MS\tLAST_EXEC")
 		}
+		for _, m := range filtered {
+			avgMs := "N/A"
+			if m.AvgDurationMs != nil {
+				avgMs = fmt.Sprintf("%.0f", *m.AvgDurationMs)
+			}
+			minMs := "N/A"
+			if m.MinDurationMs != nil {
+				minMs = fmt.Sprintf("%d", *m.MinDurationMs)
+			}
+			maxMs := "N/A"
+			if m.MaxDurationMs != nil {
+				maxMs = fmt.Sprintf("%d", *m.MaxDurationMs)
+			}
+			lastExec := "Never"
+			if m.LastExecution != nil {
+				lastExec = m.LastExecution.Format("2006-01-02 15:04:05")
+			}
 
-		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
-			m.TaskName, m.SuccessCount, m.FailedCount, avgMs, minMs, maxMs, lastExec)
-	}
-	w.Flush()
+			if wide {
+				failRate := "N/A"
+				if total := m.SuccessCount + m.FailedCount; total > 0 {
+					failRate = fmt.Sprintf("%.1f%%", 100*float64(m.FailedCount)/float64(total))
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+					m.TaskName, m.SuccessCount, m.FailedCount, failRate, avgMs, minMs, maxMs, lastExec)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+				m.TaskName, m.SuccessCount, m.FailedCount, avgMs, minMs, maxMs, lastExec)
+		}
+		w.Flush()
+	})
 }
 
-func handleExecutions(baseURL string) {
-	var taskName string
-	var limit int
-	flag.StringVar(&taskName, "task", "", "Task name (optional)")
-	flag.IntVar(&limit, "limit", 50, "Number of executions to show")
-	flag.CommandLine.Parse(os.Args[2:])
+func handleExecutions(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("executions", flag.ExitOnError)
+	taskName := fs.String("task", "", "Task name (optional)")
+	limit := fs.Int("limit", 50, "Number of executions to show")
+	out := addOutputFlags(fs)
+	fs.Parse(subArgs)
+	out.mustParse()
 
-	url := fmt.Sprintf("%s/executions?limit=%d", baseURL, limit)
-	if taskName != "" {
-		url += "&task=" + taskName
+	url := fmt.Sprintf("%s/executions?limit=%d", baseURL, *limit)
+	if *taskName != "" {
+		url += "&task=" + *taskName
+	}
+	if cutoff := out.cutoff(); !cutoff.IsZero() {
+		url += fmt.Sprintf("&since=%d", cutoff.UnixMilli())
 	}
 
 	resp, err := http.Get(url)
@@ -436,14 +703,15 @@ func handleExecutions(baseURL string) {
 	defer resp.Body.Close()
 
 	var executions []struct {
-		ID           int64      `json:"id"`
-		TaskName     string     `json:"task_name"`
-		StartedAt    *time.Time `json:"started_at"`
-		FinishedAt   *time.Time `json:"finished_at"`
-		Status       string     `json:"status"`
-		ErrorMessage *string    `json:"error_message"`
-		RetryCount   int        `json:"retry_count"`
-		DurationMs   *int64     `json:"duration_ms"`
+		ID           int64              `json:"id"`
+		TaskName     string             `json:"task_name"`
+		StartedAt    *alfredo.EpochTime `json:"started_at"`
+		FinishedAt   *alfredo.EpochTime `json:"finished_at"`
+		Status       string             `json:"status"`
+		ErrorMessage *string            `json:"error_message"`
+		RetryCount   int                `json:"retry_count"`
+		WorkerID     *string            `json:"worker_id"`
+		DurationMs   *int64             `json:"duration_ms"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&executions); err != nil {
@@ -451,29 +719,59 @@ func handleExecutions(baseURL string) {
 		os.Exit(1)
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "ID\tTASK\tSTATUS\tDURATION\tRETRIES\tFINISHED\tERROR")
-	for _, e := range executions {
-		duration := "N/A"
-		if e.DurationMs != nil {
-			duration = fmt.Sprintf("%dms", *e.DurationMs)
-		}
-		finished := "N/A"
-		if e.FinishedAt != nil {
-			finished = e.FinishedAt.Format("2006-01-02 15:04:05")
+	keep, err := out.matchIndexes(executions, "started_at")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error filtering executions: %v\n", err)
+		os.Exit(1)
+	}
+	filtered := executions[:0]
+	for _, i := range keep {
+		filtered = append(filtered, executions[i])
+	}
+
+	out.mustRender(filtered, func(wide bool) {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if wide {
+			fmt.Fprintln(w, "ID\tTASK\tSTATUS\tWORKER\tDURATION\tRETRIES\tSTARTED\tFINISHED\tERROR")
+		} else {
+			fmt.Fprintln(w, "ID\tTASK\tSTATUS\tDURATION\tRETRIES\tFINISHED\tERROR")
 		}
-		errMsg := ""
-		if e.ErrorMessage != nil {
-			errMsg = *e.ErrorMessage
+		for _, e := range filtered {
+			duration := "N/A"
+			if e.DurationMs != nil {
+				duration = fmt.Sprintf("%dms", *e.DurationMs)
+			}
+			finished := "N/A"
+			if e.FinishedAt != nil {
+				finished = e.FinishedAt.Format("2006-01-02 15:04:05")
+			}
+			errMsg := ""
+			if e.ErrorMessage != nil {
+				errMsg = *e.ErrorMessage
+			}
+
+			if wide {
+				worker := ""
+				if e.WorkerID != nil {
+					worker = *e.WorkerID
+				}
+				started := "N/A"
+				if e.StartedAt != nil {
+					started = e.StartedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+					e.ID, e.TaskName, e.Status, worker, duration, e.RetryCount, started, finished, errMsg)
+				continue
+			}
+
 			if len(errMsg) > 50 {
 				errMsg = errMsg[:47] + "..."
 			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				e.ID, e.TaskName, e.Status, duration, e.RetryCount, finished, errMsg)
 		}
-
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
-			e.ID, e.TaskName, e.Status, duration, e.RetryCount, finished, errMsg)
-	}
-	w.Flush()
+		w.Flush()
+	})
 }
 
 func handleHealth(baseURL string) {
@@ -491,3 +789,89 @@ func handleHealth(baseURL string) {
 		os.Exit(1)
 	}
 }
+
+func handleBackup(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("out", "", "File to write the snapshot to")
+	fs.Parse(subArgs)
+
+	if *out == "" {
+		fmt.Fprintf(os.Stderr, "Error: -out is required\n")
+		os.Exit(1)
+	}
+	if alfredo.FileExistsEasy(*out) {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists\n", *out)
+		os.Exit(1)
+	}
+
+	resp, err := http.Get(baseURL + "/admin/backup")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	// write beside the destination and rename, so a failed download leaves nothing behind
+	tmp := *out + ".partial"
+	f, err := os.Create(tmp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	n, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "Error writing backup: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Backup written to %s (%s)\n", *out, alfredo.FormatBytes(n))
+}
+
+func handleRestore(baseURL string, subArgs []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("in", "", "Snapshot file to restore")
+	fs.Parse(subArgs)
+
+	if *in == "" {
+		fmt.Fprintf(os.Stderr, "Error: -in is required\n")
+		os.Exit(1)
+	}
+
+	// the coordinator validates integrity and schema version before swapping it in
+	f, err := os.Open(*in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	resp, err := http.Post(baseURL+"/admin/restore", "application/vnd.sqlite3", f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: %s\n", string(body))
+		os.Exit(1)
+	}
+
+	fmt.Printf("Database restored from %s\n", *in)
+}
@@ -0,0 +1,35 @@
+package ctq
+
+import (
+	"embed"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+const dashboardPattern = "/ui/"
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// serveDashboard mounts the embedded web UI at /ui/ and redirects / to it.
+// The UI is static; it drives the coordinator through the JSON endpoints.
+func (c *Coordinator) serveDashboard(mux *http.ServeMux) {
+	sub, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		log.Printf("[coordinator] dashboard unavailable: %v", err)
+		return
+	}
+
+	log.Printf("[coordinator] Serving dashboard at %s", dashboardPattern)
+	fileServer := http.FileServer(http.FS(sub))
+	mux.Handle(dashboardPattern, http.StripPrefix(dashboardPattern, fileServer))
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, dashboardPattern, http.StatusFound)
+	})
+}
@@ -0,0 +1,183 @@
+// CTQ dashboard - talks to the coordinator JSON endpoints on the same origin
+"use strict";
+
+const refreshIntervalMs = 5000;
+let queuePaused = false;
+
+function fmtTime(ms) {
+  if (ms === null || ms === undefined) return "";
+  return new Date(ms).toLocaleString();
+}
+
+function fmtRelative(ms) {
+  if (ms === null || ms === undefined) return "never";
+  const delta = ms - Date.now();
+  if (delta <= 0) return "now";
+  const secs = Math.round(delta / 1000);
+  if (secs < 60) return "in " + secs + "s";
+  if (secs < 3600) return "in " + Math.round(secs / 60) + "m";
+  return "in " + (secs / 3600).toFixed(1) + "h";
+}
+
+function cell(tr, text, cls) {
+  const td = document.createElement("td");
+  if (cls) {
+    const span = document.createElement("span");
+    span.className = "badge " + cls;
+    span.textContent = text;
+    td.appendChild(span);
+  } else {
+    td.textContent = text;
+  }
+  tr.appendChild(td);
+  return td;
+}
+
+async function getJSON(path) {
+  const resp = await fetch(path);
+  if (!resp.ok) throw new Error(path + ": " + resp.status + " " + (await resp.text()));
+  return resp.json();
+}
+
+async function post(path) {
+  const resp = await fetch(path, { method: "POST" });
+  if (!resp.ok) alert(path + ": " + (await resp.text()));
+  refresh();
+}
+
+function taskState(t) {
+  if (t.locked_by) return ["running on " + t.locked_by, "running"];
+  if (!t.enabled) return ["disabled", "disabled"];
+  if (t.queue_paused) return ["queue paused", "paused"];
+  if (!t.last_status) return ["never run", ""];
+  return [t.last_status, t.last_status];
+}
+
+async function loadTasks() {
+  const tasks = (await getJSON("/tasks/status")) || [];
+  const body = document.querySelector("#tasks tbody");
+  body.replaceChildren();
+  for (const t of tasks) {
+    const tr = document.createElement("tr");
+    const [state, cls] = taskState(t);
+    cell(tr, t.name);
+    cell(tr, t.queue);
+    cell(tr, t.task_type);
+    cell(tr, t.priority);
+    cell(tr, t.enabled ? "yes" : "no");
+    cell(tr, state, cls || "badge");
+    cell(tr, fmtTime(t.last_finished_at));
+    const next = cell(tr, t.enabled ? fmtRelative(t.next_eligible_at) : "-");
+    next.title = fmtTime(t.next_eligible_at);
+    cell(tr, t.retry_count + "/" + t.max_retries);
+    const actions = cell(tr, "");
+    const btn = document.createElement("button");
+    btn.textContent = t.enabled ? "Disable" : "Enable";
+    btn.onclick = () =>
+      post("/tasks/" + (t.enabled ? "disable" : "enable") + "?name=" + encodeURIComponent(t.name));
+    actions.appendChild(btn);
+    body.appendChild(tr);
+  }
+}
+
+async function loadQueues() {
+  const queues = (await getJSON("/queues")) || [];
+  const body = document.querySelector("#queues tbody");
+  body.replaceChildren();
+  for (const q of queues) {
+    const tr = document.createElement("tr");
+    cell(tr, q.name);
+    cell(tr, q.priority);
+    cell(tr, q.paused ? "PAUSED" : "RUNNING", q.paused ? "paused" : "running-queue");
+    cell(tr, q.paused && q.paused_by ? q.paused_by : "");
+    const actions = cell(tr, "");
+    const btn = document.createElement("button");
+    btn.textContent = q.paused ? "Resume" : "Pause";
+    btn.onclick = () =>
+      post("/queue/" + (q.paused ? "resume" : "pause") + "?by=dashboard&queue=" + encodeURIComponent(q.name));
+    actions.appendChild(btn);
+    body.appendChild(tr);
+  }
+}
+
+async function loadWorkers() {
+  const workers = (await getJSON("/workers")) || [];
+  const body = document.querySelector("#workers tbody");
+  body.replaceChildren();
+  for (const w of workers) {
+    const tr = document.createElement("tr");
+    cell(tr, w.worker_id);
+    if (w.running_task) cell(tr, w.running_task, "running");
+    else cell(tr, "idle");
+    cell(tr, fmtTime(w.last_seen));
+    cell(tr, w.executions);
+    cell(tr, w.failed_count);
+    body.appendChild(tr);
+  }
+}
+
+async function loadExecutions() {
+  const execs = (await getJSON("/executions?limit=50")) || [];
+  const body = document.querySelector("#executions tbody");
+  body.replaceChildren();
+  for (const e of execs) {
+    const tr = document.createElement("tr");
+    cell(tr, e.id);
+    cell(tr, e.task_name);
+    cell(tr, e.status, e.status);
+    cell(tr, e.worker_id || "");
+    cell(tr, fmtTime(e.started_at));
+    cell(tr, e.duration_ms === null ? "" : e.duration_ms + "ms");
+    cell(tr, e.retry_count);
+    const logCell = cell(tr, "");
+    if (e.error_message) {
+      const pre = document.createElement("pre");
+      pre.className = "log";
+      pre.textContent = e.error_message;
+      logCell.appendChild(pre);
+    }
+    body.appendChild(tr);
+  }
+}
+
+async function loadQueue() {
+  const status = await getJSON("/queue/status");
+  queuePaused = status.paused;
+  const badge = document.getElementById("queue-status");
+  badge.textContent = queuePaused ? "PAUSED" : "RUNNING";
+  badge.className = "badge " + (queuePaused ? "paused" : "running-queue");
+  if (queuePaused && status.paused_by) badge.title = "paused by " + status.paused_by;
+  document.getElementById("queue-toggle").textContent = queuePaused ? "Resume" : "Pause";
+}
+
+async function loadHealth() {
+  const badge = document.getElementById("health");
+  try {
+    await getJSON("/health");
+    badge.textContent = "HEALTHY";
+    badge.className = "badge healthy";
+  } catch (err) {
+    badge.textContent = "UNHEALTHY";
+    badge.className = "badge unhealthy";
+  }
+}
+
+// The coordinator shares a single sqlite handle, so load sequentially
+async function refresh() {
+  for (const load of [loadHealth, loadQueue, loadQueues, loadTasks, loadWorkers, loadExecutions]) {
+    try {
+      await load();
+    } catch (err) {
+      console.error(err);
+    }
+  }
+}
+
+document.getElementById("queue-toggle").onclick = () =>
+  post(queuePaused ? "/queue/resume" : "/queue/pause?by=dashboard");
+document.getElementById("refresh").onclick = refresh;
+
+setInterval(() => {
+  if (document.getElementById("auto-refresh").checked) refresh();
+}, refreshIntervalMs);
+refresh();
@@ -1,92 +1,27 @@
 package ctq
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/cmd184psu/alfredo"
 )
 
-const schema = `
--- Task definitions
-CREATE TABLE IF NOT EXISTS tasks (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	name TEXT NOT NULL UNIQUE,
-	enabled BOOLEAN NOT NULL DEFAULT 1,
-	priority INTEGER NOT NULL DEFAULT 100,
-	cooldown_seconds INTEGER NOT NULL DEFAULT 0,
-	max_retries INTEGER NOT NULL DEFAULT 3,
-	requeue BOOLEAN NOT NULL DEFAULT 0, -- playlist mode: return to queue
-	task_type TEXT NOT NULL, -- e.g., 'exec', 'script', 'ssh'
-	args TEXT NOT NULL, -- JSON encoded arguments
-	created_at INTEGER NOT NULL DEFAULT 0,      -- epoch ms
-	updated_at INTEGER NOT NULL DEFAULT 0
-);
-
--- Task execution history and state
-CREATE TABLE IF NOT EXISTS task_executions (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	task_id INTEGER NOT NULL,
-	started_at INTEGER,
-	finished_at INTEGER,
-	status TEXT NOT NULL, -- 'pending', 'running', 'success', 'failed'
-	error_message TEXT,
-	retry_count INTEGER NOT NULL DEFAULT 0,
-	worker_id TEXT,
-	duration_ms INTEGER,
-	FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
-);
-
--- Lock table for distributed locking
-CREATE TABLE IF NOT EXISTS task_locks (
-	task_id INTEGER PRIMARY KEY,
-	worker_id TEXT NOT NULL,
-	acquired_at INTEGER NOT NULL DEFAULT 0,
-	expires_at INTEGER NOT NULL,                -- epoch ms
-	FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
-);
-
--- Queue pause state
-CREATE TABLE IF NOT EXISTS queue_state (
-	id INTEGER PRIMARY KEY CHECK (id = 1),
-	paused BOOLEAN NOT NULL DEFAULT 0,
-	paused_at INTEGER,
-	paused_by TEXT
-);
-
--- Metrics for observability
-CREATE TABLE IF NOT EXISTS task_metrics (
-	task_id INTEGER NOT NULL,
-	recorded_at INTEGER NOT NULL,
-	duration_ms INTEGER NOT NULL,
-	status TEXT NOT NULL,
-	PRIMARY KEY (task_id, recorded_at),
-	FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
-);
-
--- Indexes for performance
-CREATE INDEX IF NOT EXISTS idx_tasks_enabled_priority ON tasks(enabled, priority, id);
-CREATE INDEX IF NOT EXISTS idx_executions_task_status ON task_executions(task_id, status, finished_at);
-CREATE INDEX IF NOT EXISTS idx_executions_finished ON task_executions(finished_at DESC);
-CREATE INDEX IF NOT EXISTS idx_locks_expires ON task_locks(expires_at);
-CREATE INDEX IF NOT EXISTS idx_metrics_task_time ON task_metrics(task_id, recorded_at DESC);
-
--- Initialize queue state
-INSERT OR IGNORE INTO queue_state (id, paused) VALUES (1, 0);
-`
-
 type DB struct {
 	*alfredo.DatabaseStruct
 }
 
+// InitDB opens the database at dbPath and brings its schema up to
+// SchemaVersion, refusing to touch a database written by a newer binary
 func InitDB(dbPath string) (*DB, error) {
-	db := alfredo.NewSQLiteDB().WithDbPath(dbPath)
+	db := &DB{alfredo.NewSQLiteDB().WithDbPath(dbPath)}
 
-	if err := db.Query(schema); err != nil {
+	if err := db.Migrate(); err != nil {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
-	return &DB{db}, nil
+	return db, nil
 }
 
 // const cleanupExpiredLocksFmt = `
@@ -286,3 +221,54 @@ func (db *DB) SetQueuePaused(paused bool, pausedBy string) error {
 
 	return nil
 }
+
+// WorkerInfo summarizes a worker as seen through its execution history
+type WorkerInfo struct {
+	WorkerID    string             `json:"worker_id"`
+	LastSeen    *alfredo.EpochTime `json:"last_seen"`
+	Executions  int                `json:"executions"`
+	FailedCount int                `json:"failed_count"`
+	RunningTask *string            `json:"running_task"`
+}
+
+const listWorkersFmt = `
+SELECT json_group_array(json(value))
+FROM (
+  SELECT json_object(
+    'worker_id',    w.worker_id,
+    'last_seen',    w.last_seen,
+    'executions',   w.executions,
+    'failed_count', w.failed_count,
+    'running_task', (SELECT t.name FROM task_locks tl JOIN tasks t ON t.id = tl.task_id
+                     WHERE tl.worker_id = w.worker_id AND tl.expires_at > {{now}} LIMIT 1)
+  ) as value
+  FROM (
+    SELECT worker_id,
+           MAX(COALESCE(finished_at, started_at)) as last_seen,
+           COUNT(*) as executions,
+           SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as failed_count
+    FROM task_executions
+    WHERE worker_id IS NOT NULL
+    GROUP BY worker_id
+  ) w
+  ORDER BY w.last_seen DESC
+) sub;
+`
+
+// ListWorkers returns every worker that has recorded an execution
+func (db *DB) ListWorkers() ([]WorkerInfo, error) {
+	if err := db.Query(listWorkersFmt); err != nil {
+		return nil, err
+	}
+
+	result := db.GetResult()
+	if result == "" {
+		return []WorkerInfo{}, nil
+	}
+
+	var workers []WorkerInfo
+	if err := json.Unmarshal([]byte(result), &workers); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workers JSON: %w", err)
+	}
+	return workers, nil
+}
@@ -2,6 +2,8 @@ package ctq
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strconv"
 	"testing"
@@ -684,6 +686,152 @@ func TestCleanupExpiredLocks(t *testing.T) {
 	require.True(t, acquired2)
 }
 
+func TestTaskStatusAndWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.sqlite")
+	db, err := InitDB(dbPath)
+	require.NoError(t, err)
+
+	require.NoError(t, db.AddTask(&Task{Name: "fresh", Enabled: true, Priority: 10, Requeue: true, TaskType: "shell", Args: `{"shell":"echo fresh"}`}))
+	require.NoError(t, db.AddTask(&Task{Name: "cooling", Enabled: true, Priority: 20, CooldownSeconds: 3600, Requeue: true, TaskType: "shell", Args: `{"shell":"echo cooling"}`}))
+	require.NoError(t, db.AddTask(&Task{Name: "oneshot", Enabled: true, Priority: 30, Requeue: false, TaskType: "shell", Args: `{"shell":"echo oneshot"}`}))
+
+	cooling, err := db.GetTask("cooling")
+	require.NoError(t, err)
+	execID, err := db.CreateExecution(cooling.ID, "worker-1")
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateExecution(execID, "success", nil, 10))
+
+	oneshot, err := db.GetTask("oneshot")
+	require.NoError(t, err)
+	execID, err = db.CreateExecution(oneshot.ID, "worker-2")
+	require.NoError(t, err)
+	require.NoError(t, db.UpdateExecution(execID, "success", nil, 10))
+
+	statuses, err := db.ListTaskStatus()
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+
+	byName := map[string]TaskStatus{}
+	for _, s := range statuses {
+		byName[s.Name] = s
+	}
+
+	require.Nil(t, byName["fresh"].LastStatus)
+	require.NotNil(t, byName["fresh"].NextEligibleAt)
+	require.False(t, byName["fresh"].NextEligibleAt.After(time.Now()))
+
+	require.Equal(t, "success", *byName["cooling"].LastStatus)
+	require.NotNil(t, byName["cooling"].NextEligibleAt)
+	require.True(t, byName["cooling"].NextEligibleAt.After(time.Now().Add(59*time.Minute)))
+
+	require.Nil(t, byName["oneshot"].NextEligibleAt, "one-shot task that succeeded should never be eligible again")
+
+	workers, err := db.ListWorkers()
+	require.NoError(t, err)
+	require.Len(t, workers, 2)
+	for _, w := range workers {
+		require.Equal(t, 1, w.Executions)
+		require.Nil(t, w.RunningTask)
+	}
+
+	acquired, err := db.AcquireLock(cooling.ID, "worker-1", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	workers, err = db.ListWorkers()
+	require.NoError(t, err)
+	for _, w := range workers {
+		if w.WorkerID == "worker-1" {
+			require.NotNil(t, w.RunningTask)
+			require.Equal(t, "cooling", *w.RunningTask)
+		}
+	}
+}
+
+func TestNamedQueues(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.sqlite")
+	db, err := InitDB(dbPath)
+	require.NoError(t, err)
+
+	require.NoError(t, db.AddQueue("production", 10))
+	require.NoError(t, db.AddQueue("maintenance", 200))
+
+	// Task priority alone would put maint-job first; the queue band wins
+	require.NoError(t, db.AddTask(&Task{Name: "maint-job", Enabled: true, Priority: 1, Requeue: true, Queue: "maintenance", TaskType: "shell", Args: `{"shell":"echo maint"}`}))
+	require.NoError(t, db.AddTask(&Task{Name: "prod-job", Enabled: true, Priority: 50, Requeue: true, Queue: "production", TaskType: "shell", Args: `{"shell":"echo prod"}`}))
+	require.NoError(t, db.AddTask(&Task{Name: "plain-job", Enabled: true, Priority: 50, Requeue: true, TaskType: "shell", Args: `{"shell":"echo plain"}`}))
+
+	plain, err := db.GetTask("plain-job")
+	require.NoError(t, err)
+	require.Equal(t, DefaultQueueName, plain.Queue)
+
+	twe, err := db.GetNextTask()
+	require.NoError(t, err)
+	require.NotNil(t, twe)
+	require.Equal(t, "prod-job", twe.Task.Name)
+
+	// Worker subscribed to maintenance only
+	twe, err = db.GetNextTaskFromQueues([]string{"maintenance"})
+	require.NoError(t, err)
+	require.NotNil(t, twe)
+	require.Equal(t, "maint-job", twe.Task.Name)
+
+	// Pausing maintenance leaves production untouched
+	require.NoError(t, db.SetNamedQueuePaused("maintenance", true, "tester"))
+	require.False(t, db.IsQueuePaused())
+
+	twe, err = db.GetNextTaskFromQueues([]string{"maintenance"})
+	require.NoError(t, err)
+	require.Nil(t, twe)
+
+	twe, err = db.GetNextTaskFromQueues([]string{"production", "maintenance"})
+	require.NoError(t, err)
+	require.NotNil(t, twe)
+	require.Equal(t, "prod-job", twe.Task.Name)
+
+	q, err := db.GetQueue("maintenance")
+	require.NoError(t, err)
+	require.NotNil(t, q)
+	require.True(t, q.Paused)
+	require.NotNil(t, q.PausedBy)
+	require.Equal(t, "tester", *q.PausedBy)
+
+	require.NoError(t, db.SetNamedQueuePaused("maintenance", false, ""))
+	twe, err = db.GetNextTaskFromQueues([]string{"maintenance"})
+	require.NoError(t, err)
+	require.NotNil(t, twe)
+
+	require.Error(t, db.SetNamedQueuePaused("no-such-queue", true, "tester"))
+
+	queues, err := db.ListQueues()
+	require.NoError(t, err)
+	require.Len(t, queues, 3)
+	require.Equal(t, "production", queues[0].Name)
+}
+
+func TestDashboardServed(t *testing.T) {
+	mux := http.NewServeMux()
+	c := NewCoordinator(nil, DefaultCoordinatorURL)
+	c.serveDashboard(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Equal(t, dashboardPattern, rec.Header().Get("Location"))
+
+	for _, path := range []string{"/ui/", "/ui/app.js", "/ui/style.css"} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
 // func TestStrftimeLockCleanupFails(t *testing.T) {
 // 	tmpDir := t.TempDir()
 // 	dbPath := filepath.Join(tmpDir, "test.sqlite")
@@ -0,0 +1,234 @@
+package ctq
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cmd184psu/alfredo"
+)
+
+// migration is one step of schema history. Migrations are applied in order,
+// each in its own transaction together with its schema_version row, so a
+// database is always at exactly one version. Never edit a released migration;
+// append a new one instead.
+type migration struct {
+	version     int
+	description string
+	sql         string
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "initial schema",
+		sql: `
+-- Task definitions
+CREATE TABLE IF NOT EXISTS tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	enabled BOOLEAN NOT NULL DEFAULT 1,
+	priority INTEGER NOT NULL DEFAULT 100,
+	cooldown_seconds INTEGER NOT NULL DEFAULT 0,
+	max_retries INTEGER NOT NULL DEFAULT 3,
+	requeue BOOLEAN NOT NULL DEFAULT 0, -- playlist mode: return to queue
+	task_type TEXT NOT NULL, -- e.g., 'exec', 'script', 'ssh'
+	args TEXT NOT NULL, -- JSON encoded arguments
+	created_at INTEGER NOT NULL DEFAULT 0,      -- epoch ms
+	updated_at INTEGER NOT NULL DEFAULT 0
+);
+
+-- Task execution history and state
+CREATE TABLE IF NOT EXISTS task_executions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id INTEGER NOT NULL,
+	started_at INTEGER,
+	finished_at INTEGER,
+	status TEXT NOT NULL, -- 'pending', 'running', 'success', 'failed'
+	error_message TEXT,
+	retry_count INTEGER NOT NULL DEFAULT 0,
+	worker_id TEXT,
+	duration_ms INTEGER,
+	FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+-- Lock table for distributed locking
+CREATE TABLE IF NOT EXISTS task_locks (
+	task_id INTEGER PRIMARY KEY,
+	worker_id TEXT NOT NULL,
+	acquired_at INTEGER NOT NULL DEFAULT 0,
+	expires_at INTEGER NOT NULL,                -- epoch ms
+	FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+-- Queue pause state
+CREATE TABLE IF NOT EXISTS queue_state (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	paused BOOLEAN NOT NULL DEFAULT 0,
+	paused_at INTEGER,
+	paused_by TEXT
+);
+
+-- Metrics for observability
+CREATE TABLE IF NOT EXISTS task_metrics (
+	task_id INTEGER NOT NULL,
+	recorded_at INTEGER NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	PRIMARY KEY (task_id, recorded_at),
+	FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_tasks_enabled_priority ON tasks(enabled, priority, id);
+CREATE INDEX IF NOT EXISTS idx_executions_task_status ON task_executions(task_id, status, finished_at);
+CREATE INDEX IF NOT EXISTS idx_executions_finished ON task_executions(finished_at DESC);
+CREATE INDEX IF NOT EXISTS idx_locks_expires ON task_locks(expires_at);
+CREATE INDEX IF NOT EXISTS idx_metrics_task_time ON task_metrics(task_id, recorded_at DESC);
+
+-- Initialize queue state
+INSERT OR IGNORE INTO queue_state (id, paused) VALUES (1, 0);
+`,
+	},
+	{
+		version:     2,
+		description: "named queues",
+		sql: `
+-- Named queues: each has its own priority band and pause flag
+CREATE TABLE IF NOT EXISTS queues (
+	name TEXT PRIMARY KEY,
+	priority INTEGER NOT NULL DEFAULT 100, -- lower runs first, ahead of task priority
+	paused BOOLEAN NOT NULL DEFAULT 0,
+	paused_at INTEGER,
+	paused_by TEXT
+);
+
+ALTER TABLE tasks ADD COLUMN queue TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS idx_tasks_queue ON tasks(queue);
+
+INSERT OR IGNORE INTO queues (name) VALUES ('default');
+`,
+	},
+}
+
+// SchemaVersion is the newest schema this binary knows how to use
+var SchemaVersion = migrations[len(migrations)-1].version
+
+const schemaVersionTable = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	description TEXT NOT NULL,
+	applied_at INTEGER NOT NULL -- epoch ms
+);
+`
+
+const tableExistsFmt = `
+SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = '%s';
+`
+
+const columnExistsFmt = `
+SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name = '%s';
+`
+
+const currentSchemaVersionFmt = `
+SELECT COALESCE(MAX(version), 0) FROM schema_version;
+`
+
+// migrationFmt runs one migration atomically: .bail stops the sqlite3 shell at
+// the first error, so the open transaction is rolled back instead of committed
+const migrationFmt = `.bail on
+BEGIN;
+%s
+INSERT INTO schema_version (version, description, applied_at) VALUES (%d, '%s', {{now}});
+COMMIT;
+`
+
+func hasTable(db *alfredo.DatabaseStruct, table string) (bool, error) {
+	if err := db.Query(fmt.Sprintf(tableExistsFmt, table)); err != nil {
+		return false, err
+	}
+	return db.GetResultInt64() > 0, nil
+}
+
+func hasColumn(db *alfredo.DatabaseStruct, table, column string) (bool, error) {
+	if err := db.Query(fmt.Sprintf(columnExistsFmt, table, column)); err != nil {
+		return false, err
+	}
+	return db.GetResultInt64() > 0, nil
+}
+
+// detectSchemaVersion reports the schema version of db. Databases created
+// before schema_version existed are recognised by their tables: 0 is empty,
+// 1 has tasks, 2 also has tasks.queue.
+func detectSchemaVersion(db *alfredo.DatabaseStruct) (int, error) {
+	versioned, err := hasTable(db, "schema_version")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if versioned {
+		if err := db.Query(currentSchemaVersionFmt); err != nil {
+			return 0, fmt.Errorf("failed to read schema version: %w", err)
+		}
+		if version := int(db.GetResultInt64()); version > 0 {
+			return version, nil
+		}
+	}
+
+	hasTasks, err := hasTable(db, "tasks")
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if !hasTasks {
+		return 0, nil
+	}
+	hasQueue, err := hasColumn(db, "tasks", "queue")
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if hasQueue {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// SchemaVersion returns the version the database is currently at
+func (db *DB) SchemaVersion() (int, error) {
+	return detectSchemaVersion(db.DatabaseStruct)
+}
+
+// Migrate applies every migration newer than the database's current version.
+// It refuses to run against a database newer than this binary.
+func (db *DB) Migrate() error {
+	current, err := detectSchemaVersion(db.DatabaseStruct)
+	if err != nil {
+		return err
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); upgrade ctq", current, SchemaVersion)
+	}
+
+	if err := db.Query(schemaVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	// record the inferred version of a pre-versioning database so its
+	// existing tables are not created twice
+	if current > 0 {
+		if err := db.Query(fmt.Sprintf("INSERT OR IGNORE INTO schema_version (version, description, applied_at) VALUES (%d, 'existing schema', {{now}});", current)); err != nil {
+			return fmt.Errorf("failed to record schema version: %w", err)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		log.Printf("[db] Applying schema migration %d: %s", m.version, m.description)
+		payload := fmt.Sprintf(migrationFmt, m.sql, m.version, strings.ReplaceAll(m.description, "'", "''"))
+		if err := db.Query(payload); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+		current = m.version
+	}
+	return nil
+}
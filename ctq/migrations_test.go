@@ -0,0 +1,106 @@
+package ctq
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cmd184psu/alfredo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.sqlite"))
+	require.NoError(t, err)
+
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, version)
+
+	// one schema_version row per migration
+	require.NoError(t, db.Query("SELECT COUNT(*) FROM schema_version;"))
+	require.Equal(t, int64(len(migrations)), db.GetResultInt64())
+
+	// re-opening is a no-op
+	_, err = InitDB(db.DbPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Query("SELECT COUNT(*) FROM schema_version;"))
+	require.Equal(t, int64(len(migrations)), db.GetResultInt64())
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.sqlite"))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Query("INSERT INTO schema_version (version, description, applied_at) VALUES (9999, 'from the future', 0);"))
+
+	_, err = InitDB(db.DbPath)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "newer than this binary")
+}
+
+func TestMigrateFailureRollsBack(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "test.sqlite"))
+	require.NoError(t, err)
+
+	saved := migrations
+	savedVersion := SchemaVersion
+	t.Cleanup(func() {
+		migrations = saved
+		SchemaVersion = savedVersion
+	})
+
+	broken := migration{
+		version:     savedVersion + 1,
+		description: "half applied",
+		sql: `
+CREATE TABLE should_not_exist (id INTEGER);
+SELECT no_such_column FROM tasks;
+`,
+	}
+	migrations = append(append([]migration{}, saved...), broken)
+	SchemaVersion = broken.version
+
+	require.Error(t, db.Migrate())
+
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, savedVersion, version)
+
+	exists, err := hasTable(db.DatabaseStruct, "should_not_exist")
+	require.NoError(t, err)
+	require.False(t, exists, "failed migration must not leave partial changes")
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.sqlite")
+
+	// A tasks table from before named queues existed
+	old := &DB{alfredo.NewSQLiteDB().WithDbPath(dbPath)}
+	require.NoError(t, old.Query(`CREATE TABLE tasks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	enabled BOOLEAN NOT NULL DEFAULT 1,
+	priority INTEGER NOT NULL DEFAULT 100,
+	cooldown_seconds INTEGER NOT NULL DEFAULT 0,
+	max_retries INTEGER NOT NULL DEFAULT 3,
+	requeue BOOLEAN NOT NULL DEFAULT 0,
+	task_type TEXT NOT NULL,
+	args TEXT NOT NULL,
+	created_at INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO tasks (name, task_type, args) VALUES ('legacy', 'shell', '{}');`))
+
+	db, err := InitDB(dbPath)
+	require.NoError(t, err)
+
+	task, err := db.GetTask("legacy")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	require.Equal(t, DefaultQueueName, task.Queue)
+
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, version)
+}
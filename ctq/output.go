@@ -0,0 +1,292 @@
+package ctq
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by -o on ctqctl read commands
+const (
+	OutputTable = "table"
+	OutputWide  = "wide"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// outputOptions holds the -o, -filter and -since flags shared by read commands
+type outputOptions struct {
+	format    string
+	filterStr string
+	sinceStr  string
+
+	filters map[string]string
+	since   time.Duration
+}
+
+// addOutputFlags registers -o, -filter and -since on fs; call parse after fs.Parse
+func addOutputFlags(fs *flag.FlagSet) *outputOptions {
+	o := &outputOptions{}
+	fs.StringVar(&o.format, "o", OutputTable, "Output format: table|wide|json|yaml")
+	fs.StringVar(&o.filterStr, "filter", "", "Comma separated key=value filters on record fields, e.g. queue=default or status=failed,worker=host1")
+	fs.StringVar(&o.sinceStr, "since", "", "Only show records newer than this, e.g. 30m, 2h, 7d")
+	return o
+}
+
+func (o *outputOptions) parse() error {
+	switch o.format {
+	case OutputTable, OutputWide, OutputJSON, OutputYAML:
+	default:
+		return fmt.Errorf("unknown output format %q (want table, wide, json or yaml)", o.format)
+	}
+
+	filters, err := parseFilters(o.filterStr)
+	if err != nil {
+		return err
+	}
+	o.filters = filters
+
+	if o.sinceStr != "" {
+		since, err := parseSince(o.sinceStr)
+		if err != nil {
+			return err
+		}
+		o.since = since
+	}
+	return nil
+}
+
+// mustParse is parse for ctqctl handlers: report and exit on bad flags
+func (o *outputOptions) mustParse() {
+	if err := o.parse(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func (o *outputOptions) wide() bool {
+	return o.format == OutputWide
+}
+
+// cutoff is the oldest time -since allows, or the zero time without -since
+func (o *outputOptions) cutoff() time.Time {
+	if o.since == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-o.since)
+}
+
+func parseFilters(s string) (map[string]string, error) {
+	filters := map[string]string{}
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(f, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid filter %q (want key=value)", f)
+		}
+		filters[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return filters, nil
+}
+
+// parseSince accepts anything time.ParseDuration does plus a d (day) suffix
+func parseSince(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid -since %q: %w", s, err)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -since %q: %w", s, err)
+	}
+	return d, nil
+}
+
+// toRecords converts a slice of API structs to generic records keyed by JSON name
+func toRecords(v interface{}) ([]map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]interface{}
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// jsonFields lists the JSON names of the fields of the element type of v (a
+// slice of structs), or nil when the element type is not a struct
+func jsonFields(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Pointer) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// checkFilterKeys rejects filters that name no field of the records in v, so
+// a typo or a field the command does not have is an error rather than an
+// empty listing
+func (o *outputOptions) checkFilterKeys(v interface{}) error {
+	fields := jsonFields(v)
+	if fields == nil {
+		return nil
+	}
+	known := map[string]interface{}{}
+	for _, f := range fields {
+		known[f] = nil
+	}
+	for k := range o.filters {
+		if _, ok := lookupField(known, k); !ok {
+			return fmt.Errorf("unknown filter key %q (valid keys: %s)", k, strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// matchIndexes returns the indexes of the items in v (a slice) that pass the
+// filters and, when timeField is set, are no older than -since. Records
+// without a time field reject -since rather than ignore it
+func (o *outputOptions) matchIndexes(v interface{}, timeField string) ([]int, error) {
+	if err := o.checkFilterKeys(v); err != nil {
+		return nil, err
+	}
+	if timeField == "" && o.since != 0 {
+		return nil, fmt.Errorf("-since is not supported here: the records have no time field")
+	}
+	records, err := toRecords(v)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := o.cutoff()
+	var keep []int
+	for i, r := range records {
+		if !o.matches(r) {
+			continue
+		}
+		if timeField != "" && !cutoff.IsZero() {
+			ms, ok := r[timeField].(float64)
+			if !ok || time.UnixMilli(int64(ms)).Before(cutoff) {
+				continue
+			}
+		}
+		keep = append(keep, i)
+	}
+	return keep, nil
+}
+
+// matches reports whether a record satisfies every filter. A filter key may
+// name the field directly or omit an _id / _name suffix (worker=, task=).
+func (o *outputOptions) matches(r map[string]interface{}) bool {
+	for k, want := range o.filters {
+		got, ok := lookupField(r, k)
+		if !ok || !strings.EqualFold(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func lookupField(r map[string]interface{}, key string) (string, bool) {
+	for _, k := range []string{key, key + "_id", key + "_name"} {
+		if v, ok := r[k]; ok {
+			if v == nil {
+				return "", true
+			}
+			return fmt.Sprint(v), true
+		}
+	}
+	return "", false
+}
+
+// render prints v as JSON or YAML, or calls table for the table/wide formats
+func (o *outputOptions) render(v interface{}, table func(wide bool)) error {
+	switch o.format {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case OutputYAML:
+		// round trip through JSON so YAML keys match the API field names
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(b, &generic); err != nil {
+			return err
+		}
+		out, err := yaml.Marshal(integralNumbers(generic))
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		table(o.wide())
+		return nil
+	}
+}
+
+// integralNumbers turns whole float64 values from encoding/json back into
+// int64, so YAML prints epoch milliseconds as 1792388412487 and not 1.79e+12
+func integralNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case float64:
+		if t == math.Trunc(t) && math.Abs(t) < 1<<53 {
+			return int64(t)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = integralNumbers(t[i])
+		}
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = integralNumbers(t[k])
+		}
+	}
+	return v
+}
+
+// mustRender is render for ctqctl handlers
+func (o *outputOptions) mustRender(v interface{}, table func(wide bool)) {
+	if err := o.render(v, table); err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering output: %v\n", err)
+		os.Exit(1)
+	}
+}
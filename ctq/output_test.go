@@ -0,0 +1,74 @@
+package ctq
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/cmd184psu/alfredo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputOptions_Parse(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	out := addOutputFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-o", "json", "-filter", "status=failed, worker=host1", "-since", "2d"}))
+	require.NoError(t, out.parse())
+	require.Equal(t, OutputJSON, out.format)
+	require.Equal(t, map[string]string{"status": "failed", "worker": "host1"}, out.filters)
+	require.Equal(t, 48*time.Hour, out.since)
+
+	bad := &outputOptions{format: "xml"}
+	require.Error(t, bad.parse())
+
+	bad = &outputOptions{format: OutputTable, filterStr: "status"}
+	require.Error(t, bad.parse())
+
+	bad = &outputOptions{format: OutputTable, sinceStr: "soon"}
+	require.Error(t, bad.parse())
+}
+
+func TestOutputOptions_MatchIndexes(t *testing.T) {
+	type execution struct {
+		TaskName  string             `json:"task_name"`
+		Status    string             `json:"status"`
+		WorkerID  *string            `json:"worker_id"`
+		StartedAt *alfredo.EpochTime `json:"started_at"`
+	}
+	host1, host2 := "host1", "host2"
+	recent := alfredo.EpochTimeFromTime(time.Now().Add(-time.Hour))
+	old := alfredo.EpochTimeFromTime(time.Now().Add(-5 * time.Hour))
+	executions := []execution{
+		{TaskName: "backup", Status: "failed", WorkerID: &host1, StartedAt: &recent},
+		{TaskName: "backup", Status: "success", WorkerID: &host1, StartedAt: &recent},
+		{TaskName: "cleanup", Status: "failed", WorkerID: &host2, StartedAt: &recent},
+		{TaskName: "backup", Status: "failed", WorkerID: &host1, StartedAt: &old},
+	}
+
+	out := &outputOptions{format: OutputTable, filterStr: "status=failed,worker=host1"}
+	require.NoError(t, out.parse())
+	keep, err := out.matchIndexes(executions, "started_at")
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 3}, keep)
+
+	out = &outputOptions{format: OutputTable, filterStr: "task=backup", sinceStr: "2h"}
+	require.NoError(t, out.parse())
+	keep, err = out.matchIndexes(executions, "started_at")
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1}, keep)
+
+	out = &outputOptions{format: OutputTable, filterStr: "nosuchfield=x"}
+	require.NoError(t, out.parse())
+	_, err = out.matchIndexes(executions, "")
+	require.EqualError(t, err, `unknown filter key "nosuchfield" (valid keys: started_at, status, task_name, worker_id)`)
+
+	// the keys are checked against the type, not the records that came back
+	_, err = out.matchIndexes([]execution{}, "")
+	require.Error(t, err)
+
+	// -since needs a time field to apply to
+	out = &outputOptions{format: OutputTable, sinceStr: "1h"}
+	require.NoError(t, out.parse())
+	_, err = out.matchIndexes(executions, "")
+	require.ErrorContains(t, err, "-since is not supported")
+}
@@ -0,0 +1,143 @@
+package ctq
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cmd184psu/alfredo"
+)
+
+const DefaultQueueName = "default"
+
+// Queue is a named group of tasks with its own priority band and pause flag.
+// Queue priority is compared before task priority, so every task in a
+// priority-10 queue runs ahead of any task in a priority-100 queue.
+type Queue struct {
+	Name     string             `json:"name"`
+	Priority int                `json:"priority"`
+	Paused   bool               `json:"paused"`
+	PausedAt *alfredo.EpochTime `json:"paused_at"`
+	PausedBy *string            `json:"paused_by"`
+}
+
+const addQueueFmt = `
+INSERT INTO queues (name, priority)
+VALUES ('%s', %d)
+ON CONFLICT(name) DO UPDATE SET
+    priority = excluded.priority;
+SELECT changes();
+`
+
+// AddQueue creates a named queue or updates the priority of an existing one
+func (db *DB) AddQueue(name string, priority int) error {
+	if name == "" {
+		return fmt.Errorf("queue name is required")
+	}
+	return db.Query(fmt.Sprintf(addQueueFmt, name, priority))
+}
+
+const ensureQueueFmt = `
+INSERT OR IGNORE INTO queues (name) VALUES ('%s');
+`
+
+// EnsureQueue creates the named queue with default settings if it is missing
+func (db *DB) EnsureQueue(name string) error {
+	return db.Query(fmt.Sprintf(ensureQueueFmt, name))
+}
+
+const listQueuesFmt = `
+SELECT json_group_array(json(value))
+FROM (
+  SELECT json_object(
+    'name',      name,
+    'priority',  priority,
+    'paused',    CASE WHEN paused = 1 THEN json('true') ELSE json('false') END,
+    'paused_at', paused_at,
+    'paused_by', paused_by
+  ) as value
+  FROM queues
+  ORDER BY priority ASC, name ASC
+) sub;
+`
+
+func (db *DB) ListQueues() ([]Queue, error) {
+	if err := db.Query(listQueuesFmt); err != nil {
+		return nil, err
+	}
+
+	result := db.GetResult()
+	if result == "" {
+		return []Queue{}, nil
+	}
+
+	var queues []Queue
+	if err := json.Unmarshal([]byte(result), &queues); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal queues JSON: %w", err)
+	}
+	return queues, nil
+}
+
+// GetQueue returns the named queue, or nil if it does not exist
+func (db *DB) GetQueue(name string) (*Queue, error) {
+	queues, err := db.ListQueues()
+	if err != nil {
+		return nil, err
+	}
+	for i := range queues {
+		if queues[i].Name == name {
+			return &queues[i], nil
+		}
+	}
+	return nil, nil
+}
+
+const setNamedQueuePausedFmt = `
+UPDATE queues
+SET paused = %d, paused_at = %s, paused_by = %s
+WHERE name = '%s';
+SELECT changes();
+`
+
+// SetNamedQueuePaused pauses or resumes a single queue, leaving the others
+// (and the global pause flag) untouched
+func (db *DB) SetNamedQueuePaused(name string, paused bool, pausedBy string) error {
+	pausedAt, by := "NULL", "NULL"
+	if paused {
+		pausedAt = "{{now}}"
+		by = fmt.Sprintf("'%s'", pausedBy)
+	}
+
+	if err := db.Query(fmt.Sprintf(setNamedQueuePausedFmt, btoi(paused), pausedAt, by, name)); err != nil {
+		return err
+	}
+
+	rowsAffected := db.GetResultInt64()
+	if rowsAffected != 1 {
+		return fmt.Errorf("queue %q not found", name)
+	}
+	return nil
+}
+
+// ParseQueueList splits a comma separated list of queue names, dropping blanks
+func ParseQueueList(s string) []string {
+	var queues []string
+	for _, q := range strings.Split(s, ",") {
+		if q = strings.TrimSpace(q); q != "" {
+			queues = append(queues, q)
+		}
+	}
+	return queues
+}
+
+// queueFilterClause restricts a task query to the given queues; empty means all
+func queueFilterClause(queues []string) string {
+	if len(queues) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(queues))
+	for i, q := range queues {
+		quoted[i] = "'" + strings.ReplaceAll(q, "'", "''") + "'"
+	}
+	return fmt.Sprintf("AND t.queue IN (%s)", strings.Join(quoted, ", "))
+}
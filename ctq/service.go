@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/cmd184psu/alfredo"
 )
@@ -17,15 +18,29 @@ const (
 func RunServices(asCoordinator bool) {
 	alfredo.SetVerbose(true)
 	var (
-		dbPath   string
-		httpAddr string
-		workerID string
+		dbPath      string
+		httpAddr    string
+		workerID    string
+		queues      string
+		migrateOnly bool
+
+		backupDir      string
+		backupInterval time.Duration
+		backupKeep     int
+		backupS3       string
 	)
 
 	flag.StringVar(&dbPath, "db", defaultDBPath, "Path to SQLite database")
 	flag.StringVar(&httpAddr, "http", DefaultCoordinatorURL, "HTTP address for coordinator (coordinator mode only)")
+	flag.BoolVar(&migrateOnly, "migrate-only", false, "Apply pending schema migrations and exit")
 	if asCoordinator {
+		flag.StringVar(&backupDir, "backup-dir", "", "Directory for periodic database snapshots (coordinator mode only)")
+		flag.DurationVar(&backupInterval, "backup-interval", 0, "Interval between snapshots, e.g. 6h; 0 disables (coordinator mode only)")
+		flag.IntVar(&backupKeep, "backup-keep", 7, "Local snapshots to keep; 0 keeps all (coordinator mode only)")
+		flag.StringVar(&backupS3, "backup-s3", "", "S3 session JSON file; snapshots are also uploaded to its bucket/key prefix (coordinator mode only)")
+	} else {
 		flag.StringVar(&workerID, "worker-id", "", "Worker ID (worker mode only, defaults to hostname)")
+		flag.StringVar(&queues, "queues", "", "Comma separated queues to take tasks from (worker mode only, defaults to all)")
 	}
 	flag.Parse()
 
@@ -49,10 +64,32 @@ func RunServices(asCoordinator bool) {
 	//don't need this
 	//defer db.Close()
 
+	if migrateOnly {
+		version, err := db.SchemaVersion()
+		if err != nil {
+			log.Fatalf("Failed to read schema version: %v", err)
+		}
+		log.Printf("Database %s is at schema version %d", dbPath, version)
+		return
+	}
+
 	log.Printf(ctq_version_fmt, alfredo.BuildVersion())
 
 	if asCoordinator {
 		coordinator := NewCoordinator(db, httpAddr)
+		if backupInterval > 0 {
+			bc := BackupConfig{Dir: backupDir, Interval: backupInterval, Keep: backupKeep}
+			if bc.Dir == "" {
+				bc.Dir = filepath.Join(dbDir, "backups")
+			}
+			if backupS3 != "" {
+				bc.S3 = &alfredo.S3ClientSession{}
+				if err := bc.S3.Load(backupS3); err != nil {
+					log.Fatalf("Failed to load S3 backup config: %v", err)
+				}
+			}
+			coordinator.WithBackups(bc)
+		}
 		if err := coordinator.Start(); err != nil {
 			log.Fatalf("Coordinator error: %v", err)
 		}
@@ -66,7 +103,7 @@ func RunServices(asCoordinator bool) {
 			workerID = hostname
 		}
 
-		worker := NewWorker(db, workerID)
+		worker := NewWorker(db, workerID).WithQueues(ParseQueueList(queues)...)
 		if err := worker.Start(); err != nil {
 			log.Fatalf("Worker error: %v", err)
 		}
@@ -18,6 +18,7 @@ type Task struct {
 	CooldownSeconds int               `json:"cooldown_seconds"`
 	MaxRetries      int               `json:"max_retries"`
 	Requeue         bool              `json:"requeue"`
+	Queue           string            `json:"queue"`
 	TaskType        string            `json:"task_type"`
 	Args            string            `json:"args"` // JSON string
 	CreatedAt       alfredo.EpochTime `json:"created_at"`
@@ -165,6 +166,7 @@ SELECT
         'cooldown_seconds', t.cooldown_seconds,
         'max_retries', t.max_retries,
         'requeue', CASE WHEN t.requeue = 1 THEN json('true') ELSE json('false') END,
+        'queue', t.queue,
         'task_type', t.task_type,
         'args', t.args,
         'created_at', t.created_at,
@@ -176,8 +178,11 @@ SELECT
 FROM tasks t
 LEFT JOIN latest_executions le ON t.id = le.task_id
 LEFT JOIN task_locks tl ON t.id = tl.task_id
+LEFT JOIN queues q ON t.queue = q.name
 WHERE t.enabled = 1
   AND tl.task_id IS NULL
+  AND COALESCE(q.paused, 0) = 0
+  %s
   AND (
       le.last_finished_at IS NULL
       OR (
@@ -189,6 +194,7 @@ WHERE t.enabled = 1
       )
   )
 ORDER BY 
+  COALESCE(q.priority, 100) ASC,
   t.priority ASC, 
   CASE WHEN tl.task_id IS NOT NULL THEN 999 ELSE 0 END,
   le.last_finished_at ASC, 
@@ -255,17 +261,24 @@ LIMIT 1;
 // `
 
 func (db *DB) GetNextTask() (*TaskWithExecution, error) {
+	return db.GetNextTaskFromQueues(nil)
+}
+
+// GetNextTaskFromQueues returns the next eligible task from the given queues
+// (all queues when empty), skipping any queue that is paused
+func (db *DB) GetNextTaskFromQueues(queues []string) (*TaskWithExecution, error) {
 	alfredo.VerbosePrintln("BEGIN GetNextTask()")
 	defer alfredo.VerbosePrintln("END GetNextTask()")
 	//alfredo.SetVerbose(true)
-	if err := db.Query(getNextTaskFmt); err != nil {
+	payload := fmt.Sprintf(getNextTaskFmt, queueFilterClause(queues))
+	if err := db.Query(payload); err != nil {
 		alfredo.VerbosePrintf("[db] GetNextTask: query error: %s\n", err)
 		panic("query error: " + err.Error())
 		return nil, err
 	}
 
 	alfredo.VerbosePrintln("===================")
-	alfredo.VerbosePrintln(getNextTaskFmt)
+	alfredo.VerbosePrintln(payload)
 	alfredo.VerbosePrintln("===================")
 	alfredo.VerbosePrintln(db.GetResult())
 	alfredo.VerbosePrintln("===================")
@@ -395,14 +408,16 @@ func (db *DB) RecordMetric(taskID int64, durationMs int64, status string) error
 }
 
 const addTaskFmt = `
-INSERT INTO tasks (name, enabled, priority, cooldown_seconds, max_retries, requeue, task_type, args, created_at, updated_at)
-VALUES ('%s', %d, %d, %d, %d, %d, '%s', '%s', %d, %d)
+INSERT OR IGNORE INTO queues (name) VALUES ('%s');
+INSERT INTO tasks (name, enabled, priority, cooldown_seconds, max_retries, requeue, queue, task_type, args, created_at, updated_at)
+VALUES ('%s', %d, %d, %d, %d, %d, '%s', '%s', '%s', %d, %d)
 ON CONFLICT(name) DO UPDATE SET
     enabled = excluded.enabled,
     priority = excluded.priority,
     cooldown_seconds = excluded.cooldown_seconds,
     max_retries = excluded.max_retries,
     requeue = excluded.requeue,
+    queue = excluded.queue,
     task_type = excluded.task_type,
     args = excluded.args,
     updated_at = excluded.updated_at;
@@ -424,11 +439,14 @@ func (db *DB) AddTask(task *Task) error {
 		task.CreatedAt.Now()
 	}
 	task.UpdatedAt=task.CreatedAt
+	if task.Queue == "" {
+		task.Queue = DefaultQueueName
+	}
 
 	// Execute - your Query handles SELECT changes() result
-	return db.Query(fmt.Sprintf(addTaskFmt,
+	return db.Query(fmt.Sprintf(addTaskFmt, task.Queue,
 		task.Name, btoi(task.Enabled), task.Priority, task.CooldownSeconds,
-		task.MaxRetries, btoi(task.Requeue), task.TaskType, task.Args,
+		task.MaxRetries, btoi(task.Requeue), task.Queue, task.TaskType, task.Args,
 		task.CreatedAt.UnixMilli(), task.UpdatedAt.UnixMilli()))
 }
 
@@ -490,6 +508,7 @@ SELECT json_object(
   'cooldown_seconds', cooldown_seconds,
   'max_retries', max_retries,
   'requeue', CASE WHEN requeue = 1 THEN json('true') ELSE json('false') END,
+  'queue', queue,
   'task_type', task_type,
   'args', args,
   'created_at', created_at,
@@ -529,6 +548,7 @@ SELECT json_group_array(
     'cooldown_seconds', cooldown_seconds,
     'max_retries', max_retries,
     'requeue', CASE WHEN requeue = 1 THEN json('true') ELSE json('false') END,
+    'queue', queue,
     'task_type', task_type,
     'args', args,
     'created_at', created_at,
@@ -649,3 +669,79 @@ func (db *DB) RefreshTask(name string) error {
 
 	return nil
 }
+
+// TaskStatus is a task definition plus its current scheduling state
+type TaskStatus struct {
+	Task
+	LastStatus     *string            `json:"last_status"`
+	LastFinishedAt *alfredo.EpochTime `json:"last_finished_at"`
+	RetryCount     int                `json:"retry_count"`
+	LockedBy       *string            `json:"locked_by"`
+	QueuePaused    bool               `json:"queue_paused"`
+	NextEligibleAt *alfredo.EpochTime `json:"next_eligible_at"` // null = will not run again
+}
+
+const listTaskStatusFmt = `
+WITH latest_executions AS (
+    SELECT 
+        task_id,
+        MAX(finished_at) as last_finished_at,
+        SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END) as retry_count,
+        MAX(CASE WHEN finished_at = (SELECT MAX(finished_at) FROM task_executions te2 WHERE te2.task_id = task_executions.task_id) 
+                 THEN status END) as status
+    FROM task_executions
+    WHERE status IN ('success', 'failed')
+    GROUP BY task_id
+)
+SELECT json_group_array(json(value))
+FROM (
+  SELECT json_object(
+    'id', t.id,
+    'name', t.name,
+    'enabled', CASE WHEN t.enabled = 1 THEN json('true') ELSE json('false') END,
+    'priority', t.priority,
+    'cooldown_seconds', t.cooldown_seconds,
+    'max_retries', t.max_retries,
+    'requeue', CASE WHEN t.requeue = 1 THEN json('true') ELSE json('false') END,
+    'queue', t.queue,
+    'task_type', t.task_type,
+    'args', t.args,
+    'created_at', t.created_at,
+    'updated_at', t.updated_at,
+    'last_status', le.status,
+    'last_finished_at', le.last_finished_at,
+    'retry_count', COALESCE(le.retry_count, 0),
+    'locked_by', tl.worker_id,
+    'queue_paused', CASE WHEN COALESCE(q.paused, 0) = 1 THEN json('true') ELSE json('false') END,
+    'next_eligible_at', CASE
+        WHEN le.last_finished_at IS NULL THEN {{now}}
+        WHEN t.requeue = 1 OR (le.status = 'failed' AND le.retry_count <= t.max_retries)
+            THEN le.last_finished_at + t.cooldown_seconds * 1000
+        ELSE NULL END
+  ) as value
+  FROM tasks t
+  LEFT JOIN latest_executions le ON t.id = le.task_id
+  LEFT JOIN task_locks tl ON t.id = tl.task_id AND tl.expires_at > {{now}}
+  LEFT JOIN queues q ON t.queue = q.name
+  ORDER BY COALESCE(q.priority, 100) ASC, t.priority ASC, t.name ASC
+) sub;
+`
+
+// ListTaskStatus returns every task with its last result and the time it
+// next becomes eligible to run
+func (db *DB) ListTaskStatus() ([]TaskStatus, error) {
+	if err := db.Query(listTaskStatusFmt); err != nil {
+		return nil, err
+	}
+
+	result := db.GetResult()
+	if result == "" {
+		return []TaskStatus{}, nil
+	}
+
+	var statuses []TaskStatus
+	if err := json.Unmarshal([]byte(result), &statuses); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task status JSON: %w", err)
+	}
+	return statuses, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -18,6 +19,7 @@ type Worker struct {
 	db       *DB
 	executor *TaskExecutor
 	workerID string
+	queues   []string // subscribed queues; empty means all
 	stopChan chan struct{}
 }
 
@@ -30,9 +32,18 @@ func NewWorker(db *DB, workerID string) *Worker {
 	}
 }
 
+// WithQueues subscribes the worker to the named queues only
+func (w *Worker) WithQueues(queues ...string) *Worker {
+	w.queues = queues
+	return w
+}
+
 // Start begins the worker loop
 func (w *Worker) Start() error {
 	fmt.Printf("[%s] Worker starting...\n", w.workerID)
+	if len(w.queues) > 0 {
+		fmt.Printf("[%s] Subscribed to queues: %s\n", w.workerID, strings.Join(w.queues, ", "))
+	}
 
 	// Setup signal handling
 	sigChan := make(chan os.Signal, 1)
@@ -81,7 +92,7 @@ func (w *Worker) processNext() error {
 	}
 
 	// Get next task
-	twe, err := w.db.GetNextTask()
+	twe, err := w.db.GetNextTaskFromQueues(w.queues)
 	if err != nil {
 		panic("failed to get next task: " + err.Error())
 //		return fmt.Errorf("failed to get next task: %w", err)
@@ -0,0 +1,112 @@
+package s3fake
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+const (
+	xsiNamespace       = "http://www.w3.org/2001/XMLSchema-instance"
+	allUsersURI        = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+type granteeXML struct {
+	// the namespace and type are written literally, the way S3 does; on
+	// reading, the type is inferred from which identifier is set
+	Xmlns        string `xml:"xmlns:xsi,attr,omitempty"`
+	Type         string `xml:"xsi:type,attr,omitempty"`
+	ID           string `xml:",omitempty"`
+	DisplayName  string `xml:",omitempty"`
+	EmailAddress string `xml:",omitempty"`
+	URI          string `xml:",omitempty"`
+}
+
+type grantXML struct {
+	Grantee    granteeXML
+	Permission string
+}
+
+type accessControlPolicyXML struct {
+	XMLName xml.Name   `xml:"AccessControlPolicy"`
+	Xmlns   string     `xml:"xmlns,attr,omitempty"`
+	Owner   ownerXML   `xml:"Owner"`
+	Grants  []grantXML `xml:"AccessControlList>Grant"`
+}
+
+func ownerGrant() grantXML {
+	return grantXML{Grantee: granteeXML{ID: fakeOwner.ID, DisplayName: fakeOwner.DisplayName}, Permission: "FULL_CONTROL"}
+}
+
+func groupGrant(uri, permission string) grantXML {
+	return grantXML{Grantee: granteeXML{URI: uri}, Permission: permission}
+}
+
+// cannedACL expands the x-amz-acl header into grants; nil means the default
+// private ACL.
+func cannedACL(c *call) ([]grantXML, error) {
+	switch acl := c.header("x-amz-acl"); acl {
+	case "", "private":
+		return nil, nil
+	case "public-read":
+		return []grantXML{ownerGrant(), groupGrant(allUsersURI, "READ")}, nil
+	case "public-read-write":
+		return []grantXML{ownerGrant(), groupGrant(allUsersURI, "READ"), groupGrant(allUsersURI, "WRITE")}, nil
+	case "authenticated-read":
+		return []grantXML{ownerGrant(), groupGrant(authenticatedUsers, "READ")}, nil
+	default:
+		return nil, errorf(http.StatusBadRequest, "InvalidArgument", "unsupported canned ACL %s", acl)
+	}
+}
+
+func (s *Server) getACL(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	result := accessControlPolicyXML{Xmlns: xmlns, Owner: fakeOwner, Grants: v.grants}
+	if result.Grants == nil {
+		result.Grants = []grantXML{ownerGrant()}
+	}
+	for i := range result.Grants {
+		g := &result.Grants[i].Grantee
+		g.Xmlns = xsiNamespace
+		switch {
+		case len(g.URI) > 0:
+			g.Type = "Group"
+		case len(g.EmailAddress) > 0:
+			g.Type = "AmazonCustomerByEmail"
+		default:
+			g.Type = "CanonicalUser"
+		}
+	}
+	b.versionIDHeader(c, v)
+	return c.writeXML(http.StatusOK, result)
+}
+
+// putACL replaces the grants of a version with a canned ACL or the
+// AccessControlPolicy in the body.
+func (s *Server) putACL(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	if len(c.header("x-amz-acl")) > 0 || len(c.body) == 0 {
+		if v.grants, err = cannedACL(c); err != nil {
+			return err
+		}
+	} else {
+		var policy accessControlPolicyXML
+		if err := xml.Unmarshal(c.body, &policy); err != nil {
+			return malformedXML(err)
+		}
+		grants := make([]grantXML, 0, len(policy.Grants))
+		for _, g := range policy.Grants {
+			g.Grantee.Xmlns, g.Grantee.Type = "", ""
+			grants = append(grants, g)
+		}
+		v.grants = grants
+	}
+	b.versionIDHeader(c, v)
+	return c.ok()
+}
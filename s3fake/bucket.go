@@ -0,0 +1,272 @@
+package s3fake
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	versioningEnabled   = "Enabled"
+	versioningSuspended = "Suspended"
+)
+
+type bucket struct {
+	name       string
+	region     string
+	created    time.Time
+	versioning string // "" until versioning is first configured
+	objectLock bool
+	// default retention applied to new versions, if any
+	defaultMode string
+	defaultDays int
+	defaultYrs  int
+	lifecycle   []byte
+	// versions of each key, oldest first
+	objects map[string][]*version
+}
+
+func (b *bucket) latest(key string) *version {
+	versions := b.objects[key]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+// find returns the given version of key, or the latest one.
+func (b *bucket) find(key, versionID string) *version {
+	if len(versionID) == 0 {
+		return b.latest(key)
+	}
+	for _, v := range b.objects[key] {
+		if v.versionID == versionID {
+			return v
+		}
+	}
+	return nil
+}
+
+// add stores v as the newest version of its key. Unless versioning is
+// enabled it becomes the "null" version, replacing any earlier one.
+func (b *bucket) add(s *Server, v *version) {
+	versions := b.objects[v.key]
+	if b.versioning == versioningEnabled {
+		v.versionID = s.newID()
+	} else {
+		v.versionID = "null"
+		kept := versions[:0]
+		for _, old := range versions {
+			if old.versionID != "null" {
+				kept = append(kept, old)
+			}
+		}
+		versions = kept
+	}
+	b.objects[v.key] = append(versions, v)
+}
+
+func (b *bucket) remove(key, versionID string) {
+	versions := b.objects[key]
+	for i, v := range versions {
+		if v.versionID == versionID {
+			versions = append(versions[:i:i], versions[i+1:]...)
+			break
+		}
+	}
+	if len(versions) == 0 {
+		delete(b.objects, key)
+	} else {
+		b.objects[key] = versions
+	}
+}
+
+// versionIDHeader is only sent by buckets that have had versioning configured.
+func (b *bucket) versionIDHeader(c *call, v *version) {
+	if len(b.versioning) > 0 {
+		c.w.Header().Set("x-amz-version-id", v.versionID)
+	}
+}
+
+func (s *Server) createBucket(c *call) error {
+	if _, ok := s.buckets[c.bucket]; ok {
+		return errorf(http.StatusConflict, "BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it")
+	}
+	if len(c.bucket) < 3 || len(c.bucket) > 63 || strings.ToLower(c.bucket) != c.bucket {
+		return errorf(http.StatusBadRequest, "InvalidBucketName", "The specified bucket %s is not valid", c.bucket)
+	}
+	var config struct {
+		LocationConstraint string
+	}
+	if len(c.body) > 0 {
+		if err := xml.Unmarshal(c.body, &config); err != nil {
+			return malformedXML(err)
+		}
+	}
+	b := &bucket{name: c.bucket, region: config.LocationConstraint, created: s.now(), objects: map[string][]*version{}}
+	if strings.EqualFold(c.header("x-amz-bucket-object-lock-enabled"), "true") {
+		b.objectLock = true
+		b.versioning = versioningEnabled
+	}
+	s.buckets[c.bucket] = b
+	c.w.Header().Set("Location", "/"+c.bucket)
+	return c.ok()
+}
+
+func (s *Server) deleteBucket(c *call, b *bucket) error {
+	if len(b.objects) > 0 {
+		return errorf(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty")
+	}
+	for id, u := range s.uploads {
+		if u.bucket == b.name {
+			delete(s.uploads, id)
+		}
+	}
+	delete(s.buckets, b.name)
+	return c.noContent()
+}
+
+func (s *Server) listBuckets(c *call) error {
+	type bucketXML struct {
+		Name         string
+		CreationDate string
+	}
+	result := struct {
+		XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+		Xmlns   string      `xml:"xmlns,attr"`
+		Owner   ownerXML    `xml:"Owner"`
+		Buckets []bucketXML `xml:"Buckets>Bucket"`
+	}{Xmlns: xmlns, Owner: fakeOwner}
+	for _, name := range sortedKeys(s.buckets) {
+		result.Buckets = append(result.Buckets, bucketXML{Name: name, CreationDate: s.buckets[name].created.Format(timeFormat)})
+	}
+	return c.writeXML(http.StatusOK, result)
+}
+
+type versioningXML struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+func (b *bucket) getVersioning(c *call) error {
+	return c.writeXML(http.StatusOK, versioningXML{Xmlns: xmlns, Status: b.versioning})
+}
+
+func (b *bucket) putVersioning(c *call) error {
+	var config versioningXML
+	if err := xml.Unmarshal(c.body, &config); err != nil {
+		return malformedXML(err)
+	}
+	switch config.Status {
+	case versioningEnabled:
+	case versioningSuspended:
+		if b.objectLock {
+			return errorf(http.StatusConflict, "InvalidBucketState", "An Object Lock configuration is present on this bucket, so the versioning state cannot be changed")
+		}
+	default:
+		return malformedXML(errorf(0, "", "unknown versioning status %q", config.Status))
+	}
+	b.versioning = config.Status
+	return c.ok()
+}
+
+func (b *bucket) getLifecycle(c *call) error {
+	if b.lifecycle == nil {
+		return errorf(http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist")
+	}
+	c.w.Header().Set("Content-Type", "application/xml")
+	c.w.WriteHeader(http.StatusOK)
+	c.w.Write(b.lifecycle)
+	return nil
+}
+
+func (b *bucket) putLifecycle(c *call) error {
+	var config struct {
+		Rules []struct {
+			ID     string
+			Status string
+		} `xml:"Rule"`
+	}
+	if err := xml.Unmarshal(c.body, &config); err != nil {
+		return malformedXML(err)
+	}
+	if len(config.Rules) == 0 {
+		return malformedXML(errorf(0, "", "no lifecycle rules"))
+	}
+	for _, rule := range config.Rules {
+		if rule.Status != "Enabled" && rule.Status != "Disabled" {
+			return malformedXML(errorf(0, "", "rule %q has status %q", rule.ID, rule.Status))
+		}
+	}
+	b.lifecycle = append([]byte(nil), c.body...)
+	return c.ok()
+}
+
+type objectLockConfigurationXML struct {
+	XMLName           xml.Name `xml:"ObjectLockConfiguration"`
+	Xmlns             string   `xml:"xmlns,attr,omitempty"`
+	ObjectLockEnabled string   `xml:"ObjectLockEnabled"`
+	Rule              *struct {
+		DefaultRetention struct {
+			Mode  string `xml:"Mode"`
+			Days  int    `xml:"Days,omitempty"`
+			Years int    `xml:"Years,omitempty"`
+		} `xml:"DefaultRetention"`
+	} `xml:"Rule,omitempty"`
+}
+
+func (b *bucket) getObjectLockConfiguration(c *call) error {
+	if !b.objectLock {
+		return errorf(http.StatusNotFound, "ObjectLockConfigurationNotFoundError", "Object Lock configuration does not exist for this bucket")
+	}
+	config := objectLockConfigurationXML{Xmlns: xmlns, ObjectLockEnabled: "Enabled"}
+	if len(b.defaultMode) > 0 {
+		config.Rule = &struct {
+			DefaultRetention struct {
+				Mode  string `xml:"Mode"`
+				Days  int    `xml:"Days,omitempty"`
+				Years int    `xml:"Years,omitempty"`
+			} `xml:"DefaultRetention"`
+		}{}
+		config.Rule.DefaultRetention.Mode = b.defaultMode
+		config.Rule.DefaultRetention.Days = b.defaultDays
+		config.Rule.DefaultRetention.Years = b.defaultYrs
+	}
+	return c.writeXML(http.StatusOK, config)
+}
+
+func (b *bucket) putObjectLockConfiguration(c *call) error {
+	var config objectLockConfigurationXML
+	if err := xml.Unmarshal(c.body, &config); err != nil {
+		return malformedXML(err)
+	}
+	if config.ObjectLockEnabled != "Enabled" {
+		return malformedXML(errorf(0, "", "ObjectLockEnabled must be Enabled"))
+	}
+	if b.versioning != versioningEnabled {
+		return errorf(http.StatusConflict, "InvalidBucketState", "Versioning must be enabled on the bucket to enable Object Lock")
+	}
+	b.objectLock = true
+	b.defaultMode, b.defaultDays, b.defaultYrs = "", 0, 0
+	if config.Rule != nil {
+		d := config.Rule.DefaultRetention
+		if !validLockMode(d.Mode) || (d.Days > 0) == (d.Years > 0) {
+			return malformedXML(errorf(0, "", "a default retention needs a mode and either days or years"))
+		}
+		b.defaultMode, b.defaultDays, b.defaultYrs = d.Mode, d.Days, d.Years
+	}
+	return c.ok()
+}
+
+func validLockMode(mode string) bool {
+	return mode == "GOVERNANCE" || mode == "COMPLIANCE"
+}
+
+type ownerXML struct {
+	ID          string
+	DisplayName string
+}
+
+var fakeOwner = ownerXML{ID: "s3fake", DisplayName: "s3fake"}
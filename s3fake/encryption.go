@@ -0,0 +1,105 @@
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	sseHeader         = "x-amz-server-side-encryption"
+	sseKMSKeyIDHeader = "x-amz-server-side-encryption-aws-kms-key-id"
+	// SSE-C headers; a copy names the source's key with the
+	// x-amz-copy-source- prefix instead
+	sseCustomerAlgorithm = "server-side-encryption-customer-algorithm"
+	sseCustomerKey       = "server-side-encryption-customer-key"
+	sseCustomerKeyMD5    = "server-side-encryption-customer-key-MD5"
+)
+
+// encryption is how a version is encrypted at rest. Data is kept in the
+// clear: the server only validates, remembers and echoes the headers, and
+// insists on the customer key for SSE-C versions as S3 does.
+type encryption struct {
+	algorithm string // AES256 or aws:kms
+	kmsKeyID  string
+	// base64 MD5 of the SSE-C customer key
+	customerKeyMD5 string
+}
+
+// customerKey returns the base64 MD5 of the SSE-C key a request carries
+// under prefix, "x-amz-" or "x-amz-copy-source-", or "" if it has none.
+func customerKey(c *call, prefix string) (string, error) {
+	algorithm := c.header(prefix + sseCustomerAlgorithm)
+	key := c.header(prefix + sseCustomerKey)
+	keyMD5 := c.header(prefix + sseCustomerKeyMD5)
+	if len(algorithm) == 0 && len(key) == 0 && len(keyMD5) == 0 {
+		return "", nil
+	}
+	if algorithm != "AES256" {
+		return "", errorf(http.StatusBadRequest, "InvalidEncryptionAlgorithmError", "The encryption request you specified is not valid. The valid value is AES256.")
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return "", errorf(http.StatusBadRequest, "InvalidArgument", "The secret key was invalid for the specified algorithm.")
+	}
+	sum := md5.Sum(raw)
+	if base64.StdEncoding.EncodeToString(sum[:]) != keyMD5 {
+		return "", errorf(http.StatusBadRequest, "InvalidArgument", "The calculated MD5 hash of the key did not match the hash that was provided.")
+	}
+	return keyMD5, nil
+}
+
+// requestEncryption reads the encryption a request asks for a new version.
+func requestEncryption(c *call) (encryption, error) {
+	e := encryption{algorithm: c.header(sseHeader), kmsKeyID: c.header(sseKMSKeyIDHeader)}
+	switch e.algorithm {
+	case "", "AES256", "aws:kms":
+	default:
+		return e, errorf(http.StatusBadRequest, "InvalidArgument", "Server Side Encryption with %s is not supported", e.algorithm)
+	}
+	if len(e.kmsKeyID) > 0 && e.algorithm != "aws:kms" {
+		return e, errorf(http.StatusBadRequest, "InvalidArgument", "Server Side Encryption with KMS managed key requires HTTP header x-amz-server-side-encryption : aws:kms")
+	}
+	keyMD5, err := customerKey(c, "x-amz-")
+	if err != nil {
+		return e, err
+	}
+	if len(keyMD5) > 0 && len(e.algorithm) > 0 {
+		return e, errorf(http.StatusBadRequest, "InvalidArgument", "Server Side Encryption with Customer provided key is incompatible with the encryption method specified")
+	}
+	e.customerKeyMD5 = keyMD5
+	return e, nil
+}
+
+// checkCustomerKey verifies that a request reading v, or copying from it when
+// prefix is "x-amz-copy-source-", carries the key v was encrypted with, and
+// no key if it was not encrypted with one.
+func (e encryption) checkCustomerKey(c *call, prefix string) error {
+	keyMD5, err := customerKey(c, prefix)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(e.customerKeyMD5) == 0 && len(keyMD5) > 0:
+		return errorf(http.StatusBadRequest, "InvalidRequest", "The encryption parameters are not applicable to this object.")
+	case len(e.customerKeyMD5) > 0 && len(keyMD5) == 0:
+		return errorf(http.StatusBadRequest, "InvalidRequest", "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.")
+	case keyMD5 != e.customerKeyMD5:
+		return errorf(http.StatusForbidden, "AccessDenied", "Access Denied")
+	}
+	return nil
+}
+
+// writeHeaders echoes the encryption in a response.
+func (e encryption) writeHeaders(h http.Header) {
+	if len(e.algorithm) > 0 {
+		h.Set(sseHeader, e.algorithm)
+	}
+	if len(e.kmsKeyID) > 0 {
+		h.Set(sseKMSKeyIDHeader, e.kmsKeyID)
+	}
+	if len(e.customerKeyMD5) > 0 {
+		h.Set("x-amz-"+sseCustomerAlgorithm, "AES256")
+		h.Set("x-amz-"+sseCustomerKeyMD5, e.customerKeyMD5)
+	}
+}
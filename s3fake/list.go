@@ -0,0 +1,266 @@
+package s3fake
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type objectXML struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+	Owner        *ownerXML `xml:",omitempty"`
+}
+
+type prefixXML struct {
+	Prefix string
+}
+
+func (v *version) listEntry() objectXML {
+	storageClass := v.storageClass
+	if len(storageClass) == 0 {
+		storageClass = "STANDARD"
+	}
+	return objectXML{Key: v.key, LastModified: v.lastModified.Format(timeFormat), ETag: quote(v.etag), Size: v.size(), StorageClass: storageClass}
+}
+
+// listing walks the keys of a bucket in order for the list operations,
+// rolling keys up into common prefixes and cutting pages at max entries,
+// common prefixes included.
+type listing struct {
+	prefix    string
+	delimiter string
+	max       int
+
+	entries   int
+	prefixes  []prefixXML
+	truncated bool
+	// last is the last key or common prefix in the page
+	last       string
+	lastCommon bool
+}
+
+// rollup returns the common prefix key belongs to, or "".
+func (l *listing) rollup(key string) string {
+	if len(l.delimiter) == 0 {
+		return ""
+	}
+	if i := strings.Index(key[len(l.prefix):], l.delimiter); i >= 0 {
+		return key[:len(l.prefix)+i+len(l.delimiter)]
+	}
+	return ""
+}
+
+// add decides what to do with key, which must come after the marker the
+// listing resumes from. It returns false once the page is full; otherwise
+// entry reports whether key is listed itself rather than as a common prefix.
+func (l *listing) add(key, after string) (entry, more bool) {
+	if !strings.HasPrefix(key, l.prefix) {
+		return false, true
+	}
+	common := l.rollup(key)
+	if len(common) > 0 && (common == l.last || common == after) {
+		return false, true
+	}
+	if l.entries == l.max {
+		l.truncated = true
+		return false, false
+	}
+	l.entries++
+	if len(common) > 0 {
+		l.prefixes = append(l.prefixes, prefixXML{Prefix: common})
+		l.last, l.lastCommon = common, true
+		return false, true
+	}
+	l.last, l.lastCommon = key, false
+	return true, true
+}
+
+// currentKeys returns the keys of b whose latest version is not a delete
+// marker, in order.
+func (b *bucket) currentKeys() []string {
+	var keys []string
+	for key := range b.objects {
+		if v := b.latest(key); v != nil && !v.deleteMarker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) listObjectsV2(c *call, b *bucket) error {
+	after := c.q.Get("start-after")
+	token := c.q.Get("continuation-token")
+	if len(token) > 0 {
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return errorf(http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+		}
+		after = string(decoded)
+	}
+	l := &listing{prefix: c.q.Get("prefix"), delimiter: c.q.Get("delimiter"), max: s.pageSize(c.q.Get("max-keys"))}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Xmlns                 string   `xml:"xmlns,attr"`
+		Name                  string
+		Prefix                string
+		Delimiter             string `xml:",omitempty"`
+		StartAfter            string `xml:",omitempty"`
+		ContinuationToken     string `xml:",omitempty"`
+		NextContinuationToken string `xml:",omitempty"`
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		Contents              []objectXML `xml:"Contents"`
+		CommonPrefixes        []prefixXML `xml:"CommonPrefixes"`
+	}{Xmlns: xmlns, Name: b.name, Prefix: l.prefix, Delimiter: l.delimiter, StartAfter: c.q.Get("start-after"), ContinuationToken: token, MaxKeys: l.max}
+	for _, key := range b.currentKeys() {
+		if key <= after {
+			continue
+		}
+		entry, more := l.add(key, after)
+		if !more {
+			break
+		}
+		if entry {
+			o := b.latest(key).listEntry()
+			if c.q.Get("fetch-owner") == "true" {
+				o.Owner = &fakeOwner
+			}
+			result.Contents = append(result.Contents, o)
+		}
+	}
+	result.CommonPrefixes = l.prefixes
+	result.KeyCount = l.entries
+	result.IsTruncated = l.truncated
+	if l.truncated {
+		result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(l.last))
+	}
+	return c.writeXML(http.StatusOK, result)
+}
+
+func (s *Server) listObjects(c *call, b *bucket) error {
+	marker := c.q.Get("marker")
+	l := &listing{prefix: c.q.Get("prefix"), delimiter: c.q.Get("delimiter"), max: s.pageSize(c.q.Get("max-keys"))}
+	result := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Xmlns          string   `xml:"xmlns,attr"`
+		Name           string
+		Prefix         string
+		Marker         string
+		NextMarker     string `xml:",omitempty"`
+		Delimiter      string `xml:",omitempty"`
+		MaxKeys        int
+		IsTruncated    bool
+		Contents       []objectXML `xml:"Contents"`
+		CommonPrefixes []prefixXML `xml:"CommonPrefixes"`
+	}{Xmlns: xmlns, Name: b.name, Prefix: l.prefix, Marker: marker, Delimiter: l.delimiter, MaxKeys: l.max}
+	for _, key := range b.currentKeys() {
+		if key <= marker {
+			continue
+		}
+		entry, more := l.add(key, marker)
+		if !more {
+			break
+		}
+		if entry {
+			o := b.latest(key).listEntry()
+			o.Owner = &fakeOwner
+			result.Contents = append(result.Contents, o)
+		}
+	}
+	result.CommonPrefixes = l.prefixes
+	result.IsTruncated = l.truncated
+	if l.truncated {
+		result.NextMarker = l.last
+	}
+	return c.writeXML(http.StatusOK, result)
+}
+
+// listObjectVersions lists every version and delete marker, newest first
+// within each key, paginated with key-marker and version-id-marker.
+func (s *Server) listObjectVersions(c *call, b *bucket) error {
+	keyMarker, idMarker := c.q.Get("key-marker"), c.q.Get("version-id-marker")
+	l := &listing{prefix: c.q.Get("prefix"), delimiter: c.q.Get("delimiter"), max: s.pageSize(c.q.Get("max-keys"))}
+	type versionXML struct {
+		objectXML
+		VersionId string
+		IsLatest  bool
+	}
+	type markerXML struct {
+		Key          string
+		VersionId    string
+		IsLatest     bool
+		LastModified string
+		Owner        ownerXML
+	}
+	result := struct {
+		XMLName             xml.Name `xml:"ListVersionsResult"`
+		Xmlns               string   `xml:"xmlns,attr"`
+		Name                string
+		Prefix              string
+		KeyMarker           string
+		VersionIdMarker     string
+		NextKeyMarker       string `xml:",omitempty"`
+		NextVersionIdMarker string `xml:",omitempty"`
+		Delimiter           string `xml:",omitempty"`
+		MaxKeys             int
+		IsTruncated         bool
+		Versions            []versionXML `xml:"Version"`
+		DeleteMarkers       []markerXML  `xml:"DeleteMarker"`
+		CommonPrefixes      []prefixXML  `xml:"CommonPrefixes"`
+	}{Xmlns: xmlns, Name: b.name, Prefix: l.prefix, KeyMarker: keyMarker, VersionIdMarker: idMarker, Delimiter: l.delimiter, MaxKeys: l.max}
+
+	lastID := ""
+	keys := sortedKeys(b.objects)
+walk:
+	for _, key := range keys {
+		if key < keyMarker || (key == keyMarker && len(idMarker) == 0) {
+			continue
+		}
+		versions := b.objects[key]
+		// newest first, skipping past the version marker
+		i := len(versions) - 1
+		if key == keyMarker {
+			for i >= 0 && versions[i].versionID != idMarker {
+				i--
+			}
+			i--
+		}
+		for ; i >= 0; i-- {
+			v := versions[i]
+			entry, more := l.add(key, keyMarker)
+			if !more {
+				break walk
+			}
+			if !entry {
+				// rolled up into a common prefix
+				break
+			}
+			lastID = v.versionID
+			latest := i == len(versions)-1
+			if v.deleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, markerXML{Key: key, VersionId: v.versionID, IsLatest: latest, LastModified: v.lastModified.Format(timeFormat), Owner: fakeOwner})
+				continue
+			}
+			o := v.listEntry()
+			o.Owner = &fakeOwner
+			result.Versions = append(result.Versions, versionXML{objectXML: o, VersionId: v.versionID, IsLatest: latest})
+		}
+	}
+	result.CommonPrefixes = l.prefixes
+	result.IsTruncated = l.truncated
+	if l.truncated {
+		result.NextKeyMarker = l.last
+		if !l.lastCommon {
+			result.NextVersionIdMarker = lastID
+		}
+	}
+	return c.writeXML(http.StatusOK, result)
+}
@@ -0,0 +1,276 @@
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxParts = 10000
+
+type upload struct {
+	id        string
+	bucket    string
+	key       string
+	initiated time.Time
+	// the version the upload becomes on completion, without data
+	object *version
+	parts  map[int]*part
+}
+
+type part struct {
+	number       int
+	data         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// findUpload returns the upload named by the request's uploadId.
+func (s *Server) findUpload(c *call, b *bucket) (*upload, error) {
+	u := s.uploads[c.q.Get("uploadId")]
+	if u == nil || u.bucket != b.name || u.key != c.key {
+		return nil, errorf(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+	}
+	return u, nil
+}
+
+func (s *Server) createMultipartUpload(c *call, b *bucket) error {
+	v, err := s.newVersion(c, b, nil)
+	if err != nil {
+		return err
+	}
+	u := &upload{id: s.newID(), bucket: b.name, key: c.key, initiated: s.now(), object: v, parts: map[int]*part{}}
+	s.uploads[u.id] = u
+	v.encryption.writeHeaders(c.w.Header())
+	return c.writeXML(http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Xmlns: xmlns, Bucket: b.name, Key: c.key, UploadId: u.id})
+}
+
+// uploadPart stores a part from the request body or, for UploadPartCopy,
+// from x-amz-copy-source and x-amz-copy-source-range.
+func (s *Server) uploadPart(c *call, b *bucket) error {
+	u, err := s.findUpload(c, b)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(c.q.Get("partNumber"))
+	if err != nil || number < 1 || number > maxParts {
+		return errorf(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and %d, inclusive", maxParts)
+	}
+	// parts of an SSE-C upload are sent with the upload's key
+	if err := u.object.encryption.checkCustomerKey(c, "x-amz-"); err != nil {
+		return err
+	}
+	data := c.body
+	copying := len(c.header("x-amz-copy-source")) > 0
+	if copying {
+		src, err := s.copySource(c)
+		if err != nil {
+			return err
+		}
+		data = src.data
+		if rng := c.header("x-amz-copy-source-range"); len(rng) > 0 {
+			start, end, err := parseRange(rng, src.size())
+			if err != nil {
+				return err
+			}
+			data = data[start : end+1]
+		}
+	}
+	p := &part{number: number, data: append([]byte(nil), data...), etag: md5Hex(data), lastModified: s.now()}
+	u.parts[number] = p
+	if copying {
+		return c.writeXML(http.StatusOK, struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			Xmlns        string   `xml:"xmlns,attr"`
+			LastModified string
+			ETag         string
+		}{Xmlns: xmlns, LastModified: p.lastModified.Format(timeFormat), ETag: quote(p.etag)})
+	}
+	c.w.Header().Set("ETag", quote(p.etag))
+	return c.ok()
+}
+
+func (s *Server) completeMultipartUpload(c *call, b *bucket) error {
+	u, err := s.findUpload(c, b)
+	if err != nil {
+		return err
+	}
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(c.body, &request); err != nil {
+		return malformedXML(err)
+	}
+	if len(request.Parts) == 0 {
+		return malformedXML(fmt.Errorf("no parts"))
+	}
+	minPartSize := s.MinPartSize
+	if minPartSize <= 0 {
+		minPartSize = defaultMinPartSize
+	}
+	v := u.object
+	v.data, v.partSizes = nil, nil
+	sums := md5.New()
+	for i, p := range request.Parts {
+		if i > 0 && p.PartNumber <= request.Parts[i-1].PartNumber {
+			return errorf(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+		}
+		stored := u.parts[p.PartNumber]
+		if stored == nil || trimQuotes(p.ETag) != stored.etag {
+			return errorf(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+		}
+		if i < len(request.Parts)-1 && int64(len(stored.data)) < minPartSize {
+			return errorf(http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size")
+		}
+		v.data = append(v.data, stored.data...)
+		v.partSizes = append(v.partSizes, int64(len(stored.data)))
+		sum, _ := hex.DecodeString(stored.etag)
+		sums.Write(sum)
+	}
+	v.etag = fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), len(request.Parts))
+	v.lastModified = s.now()
+	b.add(s, v)
+	delete(s.uploads, u.id)
+	b.versionIDHeader(c, v)
+	return c.writeXML(http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Xmlns: xmlns, Location: "/" + b.name + "/" + v.key, Bucket: b.name, Key: v.key, ETag: quote(v.etag)})
+}
+
+func (s *Server) abortMultipartUpload(c *call, b *bucket) error {
+	u, err := s.findUpload(c, b)
+	if err != nil {
+		return err
+	}
+	delete(s.uploads, u.id)
+	return c.noContent()
+}
+
+// listMultipartUploads lists the bucket's uploads ordered by key and then by
+// initiation, paginated with key-marker and upload-id-marker.
+func (s *Server) listMultipartUploads(c *call, b *bucket) error {
+	prefix := c.q.Get("prefix")
+	keyMarker, idMarker := c.q.Get("key-marker"), c.q.Get("upload-id-marker")
+	var uploads []*upload
+	for _, u := range s.uploads {
+		if u.bucket == b.name && strings.HasPrefix(u.key, prefix) {
+			uploads = append(uploads, u)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		if uploads[i].key != uploads[j].key {
+			return uploads[i].key < uploads[j].key
+		}
+		return uploads[i].id < uploads[j].id
+	})
+
+	type uploadXML struct {
+		Key          string
+		UploadId     string
+		Initiator    ownerXML
+		Owner        ownerXML
+		StorageClass string
+		Initiated    string
+	}
+	result := struct {
+		XMLName            xml.Name `xml:"ListMultipartUploadsResult"`
+		Xmlns              string   `xml:"xmlns,attr"`
+		Bucket             string
+		KeyMarker          string
+		UploadIdMarker     string
+		NextKeyMarker      string `xml:",omitempty"`
+		NextUploadIdMarker string `xml:",omitempty"`
+		Prefix             string
+		MaxUploads         int
+		IsTruncated        bool
+		Uploads            []uploadXML `xml:"Upload"`
+	}{Xmlns: xmlns, Bucket: b.name, KeyMarker: keyMarker, UploadIdMarker: idMarker, Prefix: prefix, MaxUploads: s.pageSize(c.q.Get("max-uploads"))}
+	for _, u := range uploads {
+		if len(keyMarker) > 0 && (u.key < keyMarker || (u.key == keyMarker && (len(idMarker) == 0 || u.id <= idMarker))) {
+			continue
+		}
+		if len(result.Uploads) == result.MaxUploads {
+			result.IsTruncated = true
+			last := result.Uploads[len(result.Uploads)-1]
+			result.NextKeyMarker, result.NextUploadIdMarker = last.Key, last.UploadId
+			break
+		}
+		storageClass := u.object.storageClass
+		if len(storageClass) == 0 {
+			storageClass = "STANDARD"
+		}
+		result.Uploads = append(result.Uploads, uploadXML{
+			Key:          u.key,
+			UploadId:     u.id,
+			Initiator:    fakeOwner,
+			Owner:        fakeOwner,
+			StorageClass: storageClass,
+			Initiated:    u.initiated.Format(timeFormat),
+		})
+	}
+	return c.writeXML(http.StatusOK, result)
+}
+
+func (s *Server) listParts(c *call, b *bucket) error {
+	u, err := s.findUpload(c, b)
+	if err != nil {
+		return err
+	}
+	marker, _ := strconv.Atoi(c.q.Get("part-number-marker"))
+	numbers := make([]int, 0, len(u.parts))
+	for n := range u.parts {
+		if n > marker {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	type partXML struct {
+		PartNumber   int
+		LastModified string
+		ETag         string
+		Size         int64
+	}
+	result := struct {
+		XMLName              xml.Name `xml:"ListPartsResult"`
+		Xmlns                string   `xml:"xmlns,attr"`
+		Bucket               string
+		Key                  string
+		UploadId             string
+		PartNumberMarker     int
+		NextPartNumberMarker int `xml:",omitempty"`
+		MaxParts             int
+		IsTruncated          bool
+		Parts                []partXML `xml:"Part"`
+	}{Xmlns: xmlns, Bucket: b.name, Key: u.key, UploadId: u.id, PartNumberMarker: marker, MaxParts: s.pageSize(c.q.Get("max-parts"))}
+	for _, n := range numbers {
+		if len(result.Parts) == result.MaxParts {
+			result.IsTruncated = true
+			result.NextPartNumberMarker = result.Parts[len(result.Parts)-1].PartNumber
+			break
+		}
+		p := u.parts[n]
+		result.Parts = append(result.Parts, partXML{PartNumber: n, LastModified: p.lastModified.Format(timeFormat), ETag: quote(p.etag), Size: int64(len(p.data))})
+	}
+	return c.writeXML(http.StatusOK, result)
+}
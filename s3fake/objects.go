@@ -0,0 +1,602 @@
+package s3fake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemHeaders are stored with an object and returned by GET and HEAD.
+var systemHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+type version struct {
+	key          string
+	versionID    string
+	data         []byte
+	etag         string
+	lastModified time.Time
+	contentType  string
+	headers      map[string]string
+	metadata     map[string]string
+	tags         map[string]string
+	grants       []grantXML // nil for the default private ACL
+	deleteMarker bool
+	storageClass string
+	encryption   encryption
+	// object lock
+	lockMode    string
+	retainUntil time.Time
+	legalHold   bool
+	// sizes of the parts of a multipart upload, in order
+	partSizes []int64
+}
+
+func (v *version) size() int64 {
+	return int64(len(v.data))
+}
+
+// locked reports whether the version may not be deleted or overwritten by a
+// retention change, given whether governance mode is being bypassed.
+func (v *version) locked(now time.Time, bypass bool) bool {
+	if v.legalHold {
+		return true
+	}
+	if v.retainUntil.After(now) {
+		return v.lockMode == "COMPLIANCE" || !bypass
+	}
+	return false
+}
+
+// newVersion builds a version from the request's headers.
+func (s *Server) newVersion(c *call, b *bucket, data []byte) (*version, error) {
+	v := &version{
+		key:          c.key,
+		data:         data,
+		etag:         md5Hex(data),
+		lastModified: s.now(),
+		contentType:  c.header("Content-Type"),
+		headers:      map[string]string{},
+		storageClass: c.header("x-amz-storage-class"),
+	}
+	var err error
+	if v.encryption, err = requestEncryption(c); err != nil {
+		return nil, err
+	}
+	v.metadata = requestMetadata(c.r.Header)
+	for _, name := range systemHeaders {
+		if value := c.header(name); len(value) > 0 {
+			v.headers[name] = value
+		}
+	}
+	if tagging := c.header("x-amz-tagging"); len(tagging) > 0 {
+		tags, err := url.ParseQuery(tagging)
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "InvalidArgument", "invalid tagging: %v", err)
+		}
+		v.tags = map[string]string{}
+		for k := range tags {
+			v.tags[k] = tags.Get(k)
+		}
+	}
+	if v.grants, err = cannedACL(c); err != nil {
+		return nil, err
+	}
+	if err := s.applyLockHeaders(c, b, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func requestMetadata(h http.Header) map[string]string {
+	metadata := map[string]string{}
+	for name, values := range h {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") && len(values) > 0 {
+			metadata[http.CanonicalHeaderKey(name[len("x-amz-meta-"):])] = values[0]
+		}
+	}
+	return metadata
+}
+
+// applyLockHeaders sets the retention and legal hold of a new version from
+// the request, or from the bucket's default retention.
+func (s *Server) applyLockHeaders(c *call, b *bucket, v *version) error {
+	mode := c.header("x-amz-object-lock-mode")
+	until := c.header("x-amz-object-lock-retain-until-date")
+	hold := c.header("x-amz-object-lock-legal-hold")
+	if !b.objectLock {
+		if len(mode) > 0 || len(until) > 0 || len(hold) > 0 {
+			return errorf(http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration")
+		}
+		return nil
+	}
+	switch {
+	case len(mode) > 0 || len(until) > 0:
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil || !validLockMode(mode) {
+			return errorf(http.StatusBadRequest, "InvalidArgument", "x-amz-object-lock-mode and x-amz-object-lock-retain-until-date must both be valid")
+		}
+		v.lockMode, v.retainUntil = mode, t.UTC()
+	case len(b.defaultMode) > 0:
+		v.lockMode = b.defaultMode
+		v.retainUntil = v.lastModified.AddDate(b.defaultYrs, 0, b.defaultDays)
+	}
+	v.legalHold = hold == "ON"
+	return nil
+}
+
+func (s *Server) putObject(c *call, b *bucket) error {
+	v, err := s.newVersion(c, b, c.body)
+	if err != nil {
+		return err
+	}
+	b.add(s, v)
+	c.w.Header().Set("ETag", quote(v.etag))
+	v.encryption.writeHeaders(c.w.Header())
+	b.versionIDHeader(c, v)
+	return c.ok()
+}
+
+// objectHeaders writes the headers GET and HEAD return for v.
+func (b *bucket) objectHeaders(c *call, v *version) {
+	h := c.w.Header()
+	h.Set("ETag", quote(v.etag))
+	h.Set("Last-Modified", v.lastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	contentType := v.contentType
+	if len(contentType) == 0 {
+		contentType = "binary/octet-stream"
+	}
+	h.Set("Content-Type", contentType)
+	for name, value := range v.headers {
+		h.Set(name, value)
+	}
+	for name, value := range v.metadata {
+		h.Set("x-amz-meta-"+name, value)
+	}
+	if len(v.tags) > 0 {
+		h.Set("x-amz-tagging-count", strconv.Itoa(len(v.tags)))
+	}
+	if len(v.storageClass) > 0 && v.storageClass != "STANDARD" {
+		h.Set("x-amz-storage-class", v.storageClass)
+	}
+	if len(v.lockMode) > 0 {
+		h.Set("x-amz-object-lock-mode", v.lockMode)
+		h.Set("x-amz-object-lock-retain-until-date", v.retainUntil.Format(time.RFC3339))
+	}
+	if b.objectLock {
+		h.Set("x-amz-object-lock-legal-hold", onOff(v.legalHold))
+	}
+	v.encryption.writeHeaders(h)
+	if len(v.partSizes) > 0 {
+		h.Set("x-amz-mp-parts-count", strconv.Itoa(len(v.partSizes)))
+	}
+	b.versionIDHeader(c, v)
+}
+
+// lookup finds the version a GET, HEAD or subresource request refers to.
+// Delete markers answer 404 as the current version and 405 when named.
+func (b *bucket) lookup(c *call) (*version, error) {
+	versionID := c.q.Get("versionId")
+	v := b.find(c.key, versionID)
+	if v == nil {
+		if len(versionID) > 0 {
+			return nil, errorf(http.StatusNotFound, "NoSuchVersion", "The specified version %s does not exist", versionID)
+		}
+		return nil, noSuchKey(c.key)
+	}
+	if v.deleteMarker {
+		c.w.Header().Set("x-amz-delete-marker", "true")
+		b.versionIDHeader(c, v)
+		if len(versionID) > 0 {
+			return nil, errorf(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+		}
+		return nil, noSuchKey(c.key)
+	}
+	return v, nil
+}
+
+func (s *Server) getObject(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	if err := v.encryption.checkCustomerKey(c, "x-amz-"); err != nil {
+		return err
+	}
+	if match := c.header("If-Match"); len(match) > 0 && trimQuotes(match) != v.etag {
+		return errorf(http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+	}
+	if match := c.header("If-None-Match"); len(match) > 0 && trimQuotes(match) == v.etag {
+		c.w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	start, end := int64(0), v.size()-1
+	partial := false
+	if n := c.q.Get("partNumber"); len(n) > 0 {
+		part, err := strconv.Atoi(n)
+		if err != nil || part < 1 {
+			return errorf(http.StatusBadRequest, "InvalidArgument", "invalid partNumber %q", n)
+		}
+		sizes := v.partSizes
+		if len(sizes) == 0 {
+			sizes = []int64{v.size()}
+		}
+		if part > len(sizes) {
+			return errorf(http.StatusRequestedRangeNotSatisfiable, "InvalidPartNumber", "The requested partnumber is not satisfiable")
+		}
+		for _, size := range sizes[:part-1] {
+			start += size
+		}
+		end = start + sizes[part-1] - 1
+		partial = len(v.partSizes) > 0
+	} else if rng := c.header("Range"); len(rng) > 0 {
+		start, end, err = parseRange(rng, v.size())
+		if err != nil {
+			return err
+		}
+		partial = true
+	}
+
+	b.objectHeaders(c, v)
+	h := c.w.Header()
+	h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	status := http.StatusOK
+	if partial {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, v.size()))
+		status = http.StatusPartialContent
+	}
+	c.w.WriteHeader(status)
+	if c.r.Method != http.MethodHead && end >= start {
+		c.w.Write(v.data[start : end+1])
+	}
+	return nil
+}
+
+// parseRange parses a single "bytes=" range against an object of size bytes.
+func parseRange(rng string, size int64) (int64, int64, error) {
+	invalid := errorf(http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+	spec, ok := strings.CutPrefix(rng, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, invalid
+	}
+	first, last, _ := strings.Cut(spec, "-")
+	var start, end int64
+	var err error
+	switch {
+	case len(first) == 0:
+		// the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, invalid
+		}
+		start, end = max(size-n, 0), size-1
+	default:
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil || start >= size {
+			return 0, 0, invalid
+		}
+		end = size - 1
+		if len(last) > 0 {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return 0, 0, invalid
+			}
+			end = min(end, size-1)
+		}
+	}
+	return start, end, nil
+}
+
+// copySource resolves the x-amz-copy-source header of a copy request.
+func (s *Server) copySource(c *call) (*version, error) {
+	source, err := url.PathUnescape(c.header("x-amz-copy-source"))
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "InvalidArgument", "invalid x-amz-copy-source: %v", err)
+	}
+	source, versionID, _ := strings.Cut(strings.TrimPrefix(source, "/"), "?versionId=")
+	bucketName, key, ok := strings.Cut(source, "/")
+	if !ok || len(key) == 0 {
+		return nil, errorf(http.StatusBadRequest, "InvalidArgument", "invalid x-amz-copy-source %q", source)
+	}
+	b := s.buckets[bucketName]
+	if b == nil {
+		return nil, noSuchBucket(bucketName)
+	}
+	v := b.find(key, versionID)
+	if v == nil || v.deleteMarker {
+		if len(versionID) > 0 {
+			return nil, errorf(http.StatusNotFound, "NoSuchVersion", "The specified version %s does not exist", versionID)
+		}
+		return nil, noSuchKey(key)
+	}
+	if match := c.header("x-amz-copy-source-if-match"); len(match) > 0 && trimQuotes(match) != v.etag {
+		return nil, errorf(http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+	}
+	if err := v.encryption.checkCustomerKey(c, "x-amz-copy-source-"); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *Server) copyObject(c *call, b *bucket) error {
+	src, err := s.copySource(c)
+	if err != nil {
+		return err
+	}
+	v, err := s.newVersion(c, b, append([]byte(nil), src.data...))
+	if err != nil {
+		return err
+	}
+	if c.header("x-amz-metadata-directive") != "REPLACE" {
+		v.contentType, v.headers, v.metadata = src.contentType, src.headers, src.metadata
+	}
+	if c.header("x-amz-tagging-directive") != "REPLACE" {
+		v.tags = src.tags
+	}
+	if len(v.storageClass) == 0 {
+		v.storageClass = src.storageClass
+	}
+	b.add(s, v)
+	b.versionIDHeader(c, v)
+	if len(src.versionID) > 0 && src.versionID != "null" {
+		c.w.Header().Set("x-amz-copy-source-version-id", src.versionID)
+	}
+	return c.writeXML(http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		Xmlns        string   `xml:"xmlns,attr"`
+		LastModified string
+		ETag         string
+	}{Xmlns: xmlns, LastModified: v.lastModified.Format(timeFormat), ETag: quote(v.etag)})
+}
+
+// remove deletes key from b the way DeleteObject does, returning the version
+// id of the removed version or of the new delete marker.
+func (s *Server) remove(c *call, b *bucket, key, versionID string) (id string, marker bool, err error) {
+	if len(versionID) > 0 {
+		v := b.find(key, versionID)
+		if v == nil {
+			// deleting a version that does not exist succeeds
+			return versionID, false, nil
+		}
+		bypass := strings.EqualFold(c.header("x-amz-bypass-governance-retention"), "true")
+		if !v.deleteMarker && v.locked(s.now(), bypass) {
+			return "", false, errorf(http.StatusForbidden, "AccessDenied", "Access Denied because object protected by object lock")
+		}
+		b.remove(key, versionID)
+		return versionID, v.deleteMarker, nil
+	}
+	if len(b.versioning) == 0 {
+		b.remove(key, "null")
+		return "", false, nil
+	}
+	m := &version{key: key, deleteMarker: true, lastModified: s.now()}
+	b.add(s, m)
+	return m.versionID, true, nil
+}
+
+func (s *Server) deleteObject(c *call, b *bucket) error {
+	id, marker, err := s.remove(c, b, c.key, c.q.Get("versionId"))
+	if err != nil {
+		return err
+	}
+	if len(id) > 0 {
+		c.w.Header().Set("x-amz-version-id", id)
+	}
+	if marker {
+		c.w.Header().Set("x-amz-delete-marker", "true")
+	}
+	return c.noContent()
+}
+
+func (s *Server) deleteObjects(c *call, b *bucket) error {
+	var request struct {
+		Quiet   bool
+		Objects []struct {
+			Key       string
+			VersionId string
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal(c.body, &request); err != nil {
+		return malformedXML(err)
+	}
+	if len(request.Objects) > 1000 {
+		return malformedXML(fmt.Errorf("%d objects in one request", len(request.Objects)))
+	}
+	type deletedXML struct {
+		Key                   string
+		VersionId             string `xml:",omitempty"`
+		DeleteMarker          bool   `xml:",omitempty"`
+		DeleteMarkerVersionId string `xml:",omitempty"`
+	}
+	type errorXML struct {
+		Key       string
+		VersionId string `xml:",omitempty"`
+		Code      string
+		Message   string
+	}
+	result := struct {
+		XMLName xml.Name     `xml:"DeleteResult"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		Deleted []deletedXML `xml:"Deleted"`
+		Errors  []errorXML   `xml:"Error"`
+	}{Xmlns: xmlns}
+	for _, o := range request.Objects {
+		id, marker, err := s.remove(c, b, o.Key, o.VersionId)
+		if err != nil {
+			e := err.(*s3Error)
+			result.Errors = append(result.Errors, errorXML{Key: o.Key, VersionId: o.VersionId, Code: e.code, Message: e.message})
+			continue
+		}
+		if request.Quiet {
+			continue
+		}
+		d := deletedXML{Key: o.Key, VersionId: o.VersionId, DeleteMarker: marker}
+		if marker && len(o.VersionId) == 0 {
+			d.DeleteMarkerVersionId = id
+		}
+		result.Deleted = append(result.Deleted, d)
+	}
+	return c.writeXML(http.StatusOK, result)
+}
+
+type taggingXML struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Tags    []struct {
+		Key   string
+		Value string
+	} `xml:"TagSet>Tag"`
+}
+
+func (s *Server) getTagging(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	result := taggingXML{Xmlns: xmlns}
+	for _, k := range sortedKeys(v.tags) {
+		result.Tags = append(result.Tags, struct {
+			Key   string
+			Value string
+		}{k, v.tags[k]})
+	}
+	b.versionIDHeader(c, v)
+	return c.writeXML(http.StatusOK, result)
+}
+
+func (s *Server) putTagging(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	var tagging taggingXML
+	if err := xml.Unmarshal(c.body, &tagging); err != nil {
+		return malformedXML(err)
+	}
+	v.tags = map[string]string{}
+	for _, tag := range tagging.Tags {
+		v.tags[tag.Key] = tag.Value
+	}
+	b.versionIDHeader(c, v)
+	return c.ok()
+}
+
+func (s *Server) deleteTagging(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	v.tags = nil
+	b.versionIDHeader(c, v)
+	return c.noContent()
+}
+
+type retentionXML struct {
+	XMLName         xml.Name `xml:"Retention"`
+	Xmlns           string   `xml:"xmlns,attr,omitempty"`
+	Mode            string   `xml:"Mode"`
+	RetainUntilDate string   `xml:"RetainUntilDate"`
+}
+
+func (s *Server) getRetention(c *call, b *bucket) error {
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	if len(v.lockMode) == 0 {
+		return errorf(http.StatusNotFound, "NoSuchObjectLockConfiguration", "The specified object does not have a ObjectLock configuration")
+	}
+	return c.writeXML(http.StatusOK, retentionXML{Xmlns: xmlns, Mode: v.lockMode, RetainUntilDate: v.retainUntil.Format(timeFormat)})
+}
+
+// putRetention sets a version's retention. As in S3, a COMPLIANCE retention
+// can only be extended, and shortening or removing a GOVERNANCE retention
+// needs x-amz-bypass-governance-retention.
+func (s *Server) putRetention(c *call, b *bucket) error {
+	if !b.objectLock {
+		return errorf(http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration")
+	}
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	var retention retentionXML
+	if err := xml.Unmarshal(c.body, &retention); err != nil {
+		return malformedXML(err)
+	}
+	var until time.Time
+	if len(retention.RetainUntilDate) > 0 {
+		if until, err = time.Parse(time.RFC3339, retention.RetainUntilDate); err != nil {
+			return malformedXML(err)
+		}
+	}
+	if len(retention.Mode) > 0 && !validLockMode(retention.Mode) {
+		return malformedXML(fmt.Errorf("unknown retention mode %q", retention.Mode))
+	}
+	now := s.now()
+	if v.retainUntil.After(now) && (until.Before(v.retainUntil) || retention.Mode != v.lockMode) {
+		bypass := strings.EqualFold(c.header("x-amz-bypass-governance-retention"), "true")
+		if v.lockMode == "COMPLIANCE" || !bypass {
+			return errorf(http.StatusForbidden, "AccessDenied", "Access Denied because object protected by object lock")
+		}
+	}
+	v.lockMode, v.retainUntil = retention.Mode, until.UTC()
+	b.versionIDHeader(c, v)
+	return c.ok()
+}
+
+type legalHoldXML struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status"`
+}
+
+func (s *Server) getLegalHold(c *call, b *bucket) error {
+	if !b.objectLock {
+		return errorf(http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration")
+	}
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	return c.writeXML(http.StatusOK, legalHoldXML{Xmlns: xmlns, Status: onOff(v.legalHold)})
+}
+
+func (s *Server) putLegalHold(c *call, b *bucket) error {
+	if !b.objectLock {
+		return errorf(http.StatusBadRequest, "InvalidRequest", "Bucket is missing Object Lock Configuration")
+	}
+	v, err := b.lookup(c)
+	if err != nil {
+		return err
+	}
+	var hold legalHoldXML
+	if err := xml.Unmarshal(c.body, &hold); err != nil {
+		return malformedXML(err)
+	}
+	if hold.Status != "ON" && hold.Status != "OFF" {
+		return malformedXML(fmt.Errorf("unknown legal hold status %q", hold.Status))
+	}
+	v.legalHold = hold.Status == "ON"
+	return c.ok()
+}
+
+func onOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
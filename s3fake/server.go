@@ -0,0 +1,389 @@
+// Package s3fake runs an in-memory, S3-compatible HTTP server for tests.
+//
+// It answers the path-style requests the AWS SDK sends when S3ForcePathStyle
+// is set (as S3ClientSession.EstablishSession does), and covers buckets,
+// versioning and delete markers, object lock (bucket defaults, retention and
+// legal holds), lifecycle configuration, tagging, object ACLs, server-side
+// copies, multipart uploads, paginated listings and the server-side
+// encryption headers, SSE-C keys included. Requests are not authenticated,
+// ACLs are stored but never enforced, lifecycle rules are stored but never
+// applied and nothing is actually encrypted.
+//
+//	srv := s3fake.New()
+//	defer srv.Close()
+//	var s3c alfredo.S3ClientSession
+//	s3c.WithEndpoint(srv.URL).WithRegion("us-east-1").WithBucket("bucket").
+//		WithCredentials(alfredo.S3credStruct{AccessKey: "key", SecretKey: "secret"})
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxKeys     = 1000
+	defaultMinPartSize = 5 * 1024 * 1024
+	timeFormat         = "2006-01-02T15:04:05.000Z"
+	xmlns              = "http://s3.amazonaws.com/doc/2006-03-01/"
+)
+
+// Server is an in-memory S3 endpoint. Its exported fields may be changed
+// between requests, typically right after New.
+type Server struct {
+	URL string
+	// MaxKeys caps the page size of every listing, whatever the client asks
+	// for, so that a handful of objects is enough to exercise pagination.
+	MaxKeys int
+	// MinPartSize is the smallest size CompleteMultipartUpload accepts for
+	// all but the last part; 5 MiB like S3.
+	MinPartSize int64
+	// Now is the server's clock; replace it to age objects and uploads.
+	Now func() time.Time
+
+	http    *httptest.Server
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	uploads map[string]*upload
+	nextID  int64
+}
+
+// New starts a server on a local port; Close stops it.
+func New() *Server {
+	return start(httptest.NewServer)
+}
+
+// NewTLS starts a server that speaks HTTPS with a self-signed certificate,
+// which the SDK requires before it sends SSE-C keys.
+func NewTLS() *Server {
+	return start(httptest.NewTLSServer)
+}
+
+func start(serve func(http.Handler) *httptest.Server) *Server {
+	s := &Server{
+		MaxKeys:     defaultMaxKeys,
+		MinPartSize: defaultMinPartSize,
+		Now:         time.Now,
+		buckets:     map[string]*bucket{},
+		uploads:     map[string]*upload{},
+	}
+	s.http = serve(s)
+	s.URL = s.http.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.http.Close()
+}
+
+// Buckets returns the names of the existing buckets in order.
+func (s *Server) Buckets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.buckets)
+}
+
+// Object returns the content of the current version of key, or false if
+// there is none.
+func (s *Server) Object(bucketName, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.buckets[bucketName]
+	if b == nil {
+		return nil, false
+	}
+	v := b.latest(key)
+	if v == nil || v.deleteMarker {
+		return nil, false
+	}
+	return append([]byte(nil), v.data...), true
+}
+
+func (s *Server) now() time.Time {
+	return s.Now().UTC().Truncate(time.Millisecond)
+}
+
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("%016x", s.nextID)
+}
+
+func (s *Server) pageSize(requested string) int {
+	n := s.MaxKeys
+	if n <= 0 {
+		n = defaultMaxKeys
+	}
+	var asked int
+	if _, err := fmt.Sscan(requested, &asked); err == nil && asked > 0 && asked < n {
+		n = asked
+	}
+	return n
+}
+
+// s3Error is an error response in S3's format.
+type s3Error struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *s3Error) Error() string {
+	return e.code + ": " + e.message
+}
+
+func errorf(status int, code, format string, v ...interface{}) *s3Error {
+	return &s3Error{status: status, code: code, message: fmt.Sprintf(format, v...)}
+}
+
+func noSuchBucket(name string) *s3Error {
+	return errorf(http.StatusNotFound, "NoSuchBucket", "The specified bucket %s does not exist", name)
+}
+
+func noSuchKey(key string) *s3Error {
+	return errorf(http.StatusNotFound, "NoSuchKey", "The specified key %s does not exist", key)
+}
+
+func malformedXML(err error) *s3Error {
+	return errorf(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed: %v", err)
+}
+
+func notImplemented(r *http.Request) *s3Error {
+	return errorf(http.StatusNotImplemented, "NotImplemented", "%s %s is not implemented by s3fake", r.Method, r.URL.RequestURI())
+}
+
+// call is one request being served.
+type call struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	bucket string
+	key    string
+	q      url.Values
+	body   []byte
+}
+
+func (c *call) has(param string) bool {
+	_, ok := c.q[param]
+	return ok
+}
+
+func (c *call) header(name string) string {
+	return c.r.Header.Get(name)
+}
+
+func (c *call) writeXML(status int, v interface{}) error {
+	out, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.w.Header().Set("Content-Type", "application/xml")
+	c.w.WriteHeader(status)
+	c.w.Write([]byte(xml.Header))
+	c.w.Write(out)
+	return nil
+}
+
+func (c *call) noContent() error {
+	c.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (c *call) ok() error {
+	c.w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucketName, key, _ := strings.Cut(path, "/")
+	c := &call{w: w, r: r, bucket: bucketName, key: key, q: r.URL.Query(), body: body}
+	requestID := fmt.Sprintf("fake-%d", time.Now().UnixNano())
+	w.Header().Set("x-amz-request-id", requestID)
+
+	if sum := r.Header.Get("Content-MD5"); len(sum) > 0 {
+		digest := md5.Sum(body)
+		if sum != base64.StdEncoding.EncodeToString(digest[:]) {
+			writeError(c, errorf(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what was received"), requestID)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(bucketName) == 0 && r.Method == http.MethodGet:
+		err = s.listBuckets(c)
+	case len(bucketName) == 0:
+		err = notImplemented(r)
+	case len(key) == 0:
+		err = s.serveBucket(c)
+	default:
+		err = s.serveObject(c)
+	}
+	if err != nil {
+		writeError(c, err, requestID)
+	}
+}
+
+func writeError(c *call, err error, requestID string) {
+	e, ok := err.(*s3Error)
+	if !ok {
+		e = errorf(http.StatusInternalServerError, "InternalError", "%v", err)
+	}
+	if c.r.Method == http.MethodHead {
+		c.w.WriteHeader(e.status)
+		return
+	}
+	c.writeXML(e.status, struct {
+		XMLName   xml.Name `xml:"Error"`
+		Code      string
+		Message   string
+		Resource  string
+		RequestId string
+	}{Code: e.code, Message: e.message, Resource: c.r.URL.Path, RequestId: requestID})
+}
+
+func (s *Server) serveBucket(c *call) error {
+	r := c.r
+	if r.Method == http.MethodPut && len(c.q) == 0 {
+		return s.createBucket(c)
+	}
+	b := s.buckets[c.bucket]
+	if b == nil {
+		return noSuchBucket(c.bucket)
+	}
+	switch r.Method {
+	case http.MethodHead:
+		return c.ok()
+	case http.MethodGet:
+		switch {
+		case c.has("versioning"):
+			return b.getVersioning(c)
+		case c.has("lifecycle"):
+			return b.getLifecycle(c)
+		case c.has("object-lock"):
+			return b.getObjectLockConfiguration(c)
+		case c.has("location"):
+			return c.writeXML(http.StatusOK, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+				Region  string   `xml:",chardata"`
+			}{Xmlns: xmlns, Region: b.region})
+		case c.has("uploads"):
+			return s.listMultipartUploads(c, b)
+		case c.has("versions"):
+			return s.listObjectVersions(c, b)
+		case c.q.Get("list-type") == "2":
+			return s.listObjectsV2(c, b)
+		case len(c.q) == 0 || c.has("prefix") || c.has("marker") || c.has("delimiter") || c.has("max-keys"):
+			return s.listObjects(c, b)
+		}
+	case http.MethodPut:
+		switch {
+		case c.has("versioning"):
+			return b.putVersioning(c)
+		case c.has("lifecycle"):
+			return b.putLifecycle(c)
+		case c.has("object-lock"):
+			return b.putObjectLockConfiguration(c)
+		}
+	case http.MethodDelete:
+		switch {
+		case c.has("lifecycle"):
+			b.lifecycle = nil
+			return c.noContent()
+		case len(c.q) == 0:
+			return s.deleteBucket(c, b)
+		}
+	case http.MethodPost:
+		if c.has("delete") {
+			return s.deleteObjects(c, b)
+		}
+	}
+	return notImplemented(r)
+}
+
+func (s *Server) serveObject(c *call) error {
+	b := s.buckets[c.bucket]
+	if b == nil {
+		return noSuchBucket(c.bucket)
+	}
+	switch c.r.Method {
+	case http.MethodGet, http.MethodHead:
+		switch {
+		case c.has("tagging"):
+			return s.getTagging(c, b)
+		case c.has("acl"):
+			return s.getACL(c, b)
+		case c.has("retention"):
+			return s.getRetention(c, b)
+		case c.has("legal-hold"):
+			return s.getLegalHold(c, b)
+		case c.has("uploadId"):
+			return s.listParts(c, b)
+		default:
+			return s.getObject(c, b)
+		}
+	case http.MethodPut:
+		switch {
+		case c.has("tagging"):
+			return s.putTagging(c, b)
+		case c.has("acl"):
+			return s.putACL(c, b)
+		case c.has("retention"):
+			return s.putRetention(c, b)
+		case c.has("legal-hold"):
+			return s.putLegalHold(c, b)
+		case c.has("uploadId"):
+			return s.uploadPart(c, b)
+		case len(c.header("x-amz-copy-source")) > 0:
+			return s.copyObject(c, b)
+		default:
+			return s.putObject(c, b)
+		}
+	case http.MethodDelete:
+		switch {
+		case c.has("tagging"):
+			return s.deleteTagging(c, b)
+		case c.has("uploadId"):
+			return s.abortMultipartUpload(c, b)
+		default:
+			return s.deleteObject(c, b)
+		}
+	case http.MethodPost:
+		switch {
+		case c.has("uploads"):
+			return s.createMultipartUpload(c, b)
+		case c.has("uploadId"):
+			return s.completeMultipartUpload(c, b)
+		}
+	}
+	return notImplemented(c.r)
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func quote(etag string) string {
+	return `"` + etag + `"`
+}
+
+func trimQuotes(etag string) string {
+	return strings.Trim(etag, `"`)
+}
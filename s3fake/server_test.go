@@ -0,0 +1,473 @@
+package s3fake
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T) (*Server, *s3.S3) {
+	return clientOf(t, New())
+}
+
+// clientOf returns a client of srv, trusting its certificate if it has one.
+func clientOf(t *testing.T, srv *Server) (*Server, *s3.S3) {
+	t.Cleanup(srv.Close)
+	// a CA bundle from the environment would replace the test certificate
+	t.Setenv("AWS_CA_BUNDLE", "")
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithEndpoint(srv.URL).
+		WithHTTPClient(srv.http.Client()).
+		WithCredentials(credentials.NewStaticCredentials("key", "secret", "")).
+		WithS3ForcePathStyle(true).
+		WithRegion("us-east-1").
+		WithMaxRetries(0)))
+	return srv, s3.New(sess)
+}
+
+func errorCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func put(t *testing.T, client *s3.S3, bucket, key, body string) *s3.PutObjectOutput {
+	out, err := client.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: strings.NewReader(body)})
+	assert.NoError(t, err)
+	return out
+}
+
+func get(client *s3.S3, bucket, key string) (string, error) {
+	out, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return "", err
+	}
+	defer out.Body.Close()
+	b, err := io.ReadAll(out.Body)
+	return string(b), err
+}
+
+func TestBucketsAndObjects(t *testing.T) {
+	srv, client := newClient(t)
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	_, err = client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.Equal(t, "BucketAlreadyOwnedByYou", errorCode(err))
+	assert.Equal(t, []string{"bucket"}, srv.Buckets())
+
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("dir/a.txt"),
+		Body:        strings.NewReader("hello world"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]*string{"Owner": aws.String("me")},
+		Tagging:     aws.String("team=storage"),
+	})
+	assert.NoError(t, err)
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/a.txt")})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(11), aws.Int64Value(head.ContentLength))
+		assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, aws.StringValue(head.ETag))
+		assert.Equal(t, "text/plain", aws.StringValue(head.ContentType))
+		assert.Equal(t, "me", aws.StringValue(head.Metadata["Owner"]))
+		assert.Nil(t, head.VersionId, "unversioned buckets send no version id")
+	}
+	ranged, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("dir/a.txt"), Range: aws.String("bytes=6-")})
+	if assert.NoError(t, err) {
+		b, _ := io.ReadAll(ranged.Body)
+		assert.Equal(t, "world", string(b))
+		assert.Equal(t, "bytes 6-10/11", aws.StringValue(ranged.ContentRange))
+	}
+	tags, err := client.GetObjectTagging(&s3.GetObjectTaggingInput{Bucket: aws.String("bucket"), Key: aws.String("dir/a.txt")})
+	if assert.NoError(t, err) && assert.Len(t, tags.TagSet, 1) {
+		assert.Equal(t, "storage", aws.StringValue(tags.TagSet[0].Value))
+	}
+
+	_, err = client.CopyObject(&s3.CopyObjectInput{Bucket: aws.String("bucket"), Key: aws.String("b.txt"), CopySource: aws.String("bucket/dir/a.txt")})
+	assert.NoError(t, err)
+	data, ok := srv.Object("bucket", "b.txt")
+	assert.True(t, ok)
+	assert.Equal(t, "hello world", string(data))
+
+	_, err = get(client, "bucket", "missing")
+	assert.Equal(t, s3.ErrCodeNoSuchKey, errorCode(err))
+	_, err = client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")})
+	assert.Equal(t, "BucketNotEmpty", errorCode(err))
+	_, err = client.DeleteObjects(&s3.DeleteObjectsInput{Bucket: aws.String("bucket"), Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{
+		{Key: aws.String("dir/a.txt")}, {Key: aws.String("b.txt")},
+	}}})
+	assert.NoError(t, err)
+	_, err = client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	assert.Empty(t, srv.Buckets())
+}
+
+func TestListingPagination(t *testing.T) {
+	srv, client := newClient(t)
+	srv.MaxKeys = 2
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	for _, key := range []string{"a", "b/1", "b/2", "c/1", "d", "e"} {
+		put(t, client, "bucket", key, key)
+	}
+
+	var keys []string
+	pages := 0
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String("bucket")}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		pages++
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b/1", "b/2", "c/1", "d", "e"}, keys)
+	assert.Equal(t, 3, pages)
+
+	var names []string
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String("bucket"), Delimiter: aws.String("/")}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range page.Contents {
+			names = append(names, aws.StringValue(obj.Key))
+		}
+		for _, p := range page.CommonPrefixes {
+			names = append(names, aws.StringValue(p.Prefix))
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b/", "c/", "d", "e"}, names)
+
+	keys = nil
+	err = client.ListObjectsPages(&s3.ListObjectsInput{Bucket: aws.String("bucket"), Prefix: aws.String("b/")}, func(page *s3.ListObjectsOutput, last bool) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b/1", "b/2"}, keys)
+}
+
+func TestVersioning(t *testing.T) {
+	srv, client := newClient(t)
+	srv.MaxKeys = 2
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	_, err = client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket:                  aws.String("bucket"),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusEnabled)},
+	})
+	assert.NoError(t, err)
+	status, err := client.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	assert.Equal(t, s3.BucketVersioningStatusEnabled, aws.StringValue(status.Status))
+
+	v1 := put(t, client, "bucket", "key", "one")
+	put(t, client, "bucket", "key", "two")
+	put(t, client, "bucket", "other", "x")
+	del, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")})
+	assert.NoError(t, err)
+	assert.True(t, aws.BoolValue(del.DeleteMarker))
+
+	_, err = get(client, "bucket", "key")
+	assert.Equal(t, s3.ErrCodeNoSuchKey, errorCode(err))
+	old, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), VersionId: v1.VersionId})
+	if assert.NoError(t, err) {
+		b, _ := io.ReadAll(old.Body)
+		assert.Equal(t, "one", string(b))
+	}
+
+	var versions, markers []string
+	err = client.ListObjectVersionsPages(&s3.ListObjectVersionsInput{Bucket: aws.String("bucket")}, func(page *s3.ListObjectVersionsOutput, last bool) bool {
+		for _, v := range page.Versions {
+			versions = append(versions, fmt.Sprintf("%s latest=%t", aws.StringValue(v.Key), aws.BoolValue(v.IsLatest)))
+		}
+		for _, m := range page.DeleteMarkers {
+			markers = append(markers, fmt.Sprintf("%s latest=%t", aws.StringValue(m.Key), aws.BoolValue(m.IsLatest)))
+		}
+		return true
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"key latest=false", "key latest=false", "other latest=true"}, versions)
+	assert.Equal(t, []string{"key latest=true"}, markers)
+
+	// removing the delete marker restores the previous version
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key"), VersionId: del.VersionId})
+	assert.NoError(t, err)
+	body, err := get(client, "bucket", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "two", body)
+}
+
+func TestMultipartUpload(t *testing.T) {
+	srv, client := newClient(t)
+	srv.MinPartSize = 1024
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	create, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("parts")})
+	assert.NoError(t, err)
+	var completed []*s3.CompletedPart
+	for i := 0; i < 3; i++ {
+		chunk := data[i*4000 : min((i+1)*4000, len(data))]
+		part, err := client.UploadPart(&s3.UploadPartInput{
+			Bucket: aws.String("bucket"), Key: aws.String("parts"), UploadId: create.UploadId,
+			PartNumber: aws.Int64(int64(i + 1)), Body: bytes.NewReader(chunk),
+		})
+		assert.NoError(t, err)
+		completed = append(completed, &s3.CompletedPart{ETag: part.ETag, PartNumber: aws.Int64(int64(i + 1))})
+	}
+	uploads, err := client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	assert.Len(t, uploads.Uploads, 1)
+
+	_, err = client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("bucket"), Key: aws.String("parts"), UploadId: create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: []*s3.CompletedPart{completed[1], completed[0]}},
+	})
+	assert.Equal(t, "InvalidPartOrder", errorCode(err))
+	out, err := client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("bucket"), Key: aws.String("parts"), UploadId: create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasSuffix(aws.StringValue(out.ETag), `-3"`))
+	}
+	stored, _ := srv.Object("bucket", "parts")
+	assert.Equal(t, data, stored)
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("parts"), PartNumber: aws.Int64(2)})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(4000), aws.Int64Value(head.ContentLength))
+		assert.Equal(t, int64(3), aws.Int64Value(head.PartsCount))
+	}
+
+	small, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("small")})
+	assert.NoError(t, err)
+	var parts []*s3.CompletedPart
+	for i := int64(1); i <= 2; i++ {
+		part, err := client.UploadPart(&s3.UploadPartInput{
+			Bucket: aws.String("bucket"), Key: aws.String("small"), UploadId: small.UploadId,
+			PartNumber: aws.Int64(i), Body: strings.NewReader("tiny"),
+		})
+		assert.NoError(t, err)
+		parts = append(parts, &s3.CompletedPart{ETag: part.ETag, PartNumber: aws.Int64(i)})
+	}
+	_, err = client.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("bucket"), Key: aws.String("small"), UploadId: small.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	assert.Equal(t, "EntityTooSmall", errorCode(err))
+	_, err = client.AbortMultipartUpload(&s3.AbortMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("small"), UploadId: small.UploadId})
+	assert.NoError(t, err)
+	uploads, err = client.ListMultipartUploads(&s3.ListMultipartUploadsInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	assert.Empty(t, uploads.Uploads)
+}
+
+func TestObjectLock(t *testing.T) {
+	srv, client := newClient(t)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	srv.Now = func() time.Time { return now }
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("locked"), ObjectLockEnabledForBucket: aws.Bool(true)})
+	assert.NoError(t, err)
+	_, err = client.PutObjectLockConfiguration(&s3.PutObjectLockConfigurationInput{
+		Bucket: aws.String("locked"),
+		ObjectLockConfiguration: &s3.ObjectLockConfiguration{
+			ObjectLockEnabled: aws.String(s3.ObjectLockEnabledEnabled),
+			Rule: &s3.ObjectLockRule{DefaultRetention: &s3.DefaultRetention{
+				Mode: aws.String(s3.ObjectLockRetentionModeCompliance), Days: aws.Int64(1),
+			}},
+		},
+	})
+	assert.NoError(t, err)
+
+	v := put(t, client, "locked", "key", "data")
+	retention, err := client.GetObjectRetention(&s3.GetObjectRetentionInput{Bucket: aws.String("locked"), Key: aws.String("key")})
+	if assert.NoError(t, err) {
+		assert.Equal(t, now.AddDate(0, 0, 1), aws.TimeValue(retention.Retention.RetainUntilDate))
+	}
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("locked"), Key: aws.String("key"), VersionId: v.VersionId})
+	assert.Equal(t, "AccessDenied", errorCode(err))
+	_, err = client.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String("locked"), Key: aws.String("key"),
+		Retention: &s3.ObjectLockRetention{Mode: aws.String(s3.ObjectLockRetentionModeCompliance), RetainUntilDate: aws.Time(now)},
+	})
+	assert.Equal(t, "AccessDenied", errorCode(err), "compliance retention cannot be shortened")
+	_, err = client.PutObjectRetention(&s3.PutObjectRetentionInput{
+		Bucket: aws.String("locked"), Key: aws.String("key"),
+		Retention: &s3.ObjectLockRetention{Mode: aws.String(s3.ObjectLockRetentionModeCompliance), RetainUntilDate: aws.Time(now.AddDate(0, 0, 2))},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket: aws.String("locked"), Key: aws.String("key"),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(s3.ObjectLockLegalHoldStatusOn)},
+	})
+	assert.NoError(t, err)
+	now = now.AddDate(0, 0, 3)
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("locked"), Key: aws.String("key"), VersionId: v.VersionId})
+	assert.Equal(t, "AccessDenied", errorCode(err), "legal hold outlives the retention")
+	_, err = client.PutObjectLegalHold(&s3.PutObjectLegalHoldInput{
+		Bucket: aws.String("locked"), Key: aws.String("key"),
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(s3.ObjectLockLegalHoldStatusOff)},
+	})
+	assert.NoError(t, err)
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("locked"), Key: aws.String("key"), VersionId: v.VersionId})
+	assert.NoError(t, err)
+
+	_, err = client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket:                  aws.String("locked"),
+		VersioningConfiguration: &s3.VersioningConfiguration{Status: aws.String(s3.BucketVersioningStatusSuspended)},
+	})
+	assert.Equal(t, "InvalidBucketState", errorCode(err))
+}
+
+func TestLifecycleConfiguration(t *testing.T) {
+	_, client := newClient(t)
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	_, err = client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String("bucket")})
+	assert.Equal(t, "NoSuchLifecycleConfiguration", errorCode(err))
+
+	_, err = client.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket: aws.String("bucket"),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: []*s3.LifecycleRule{{
+			ID:         aws.String("expire-logs"),
+			Status:     aws.String(s3.ExpirationStatusEnabled),
+			Filter:     &s3.LifecycleRuleFilter{Prefix: aws.String("logs/")},
+			Expiration: &s3.LifecycleExpiration{Days: aws.Int64(30)},
+		}}},
+	})
+	assert.NoError(t, err)
+	config, err := client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String("bucket")})
+	if assert.NoError(t, err) && assert.Len(t, config.Rules, 1) {
+		assert.Equal(t, "expire-logs", aws.StringValue(config.Rules[0].ID))
+		assert.Equal(t, int64(30), aws.Int64Value(config.Rules[0].Expiration.Days))
+	}
+	_, err = client.DeleteBucketLifecycle(&s3.DeleteBucketLifecycleInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	_, err = client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String("bucket")})
+	assert.Equal(t, "NoSuchLifecycleConfiguration", errorCode(err))
+}
+
+func TestEncryption(t *testing.T) {
+	_, client := clientOf(t, NewTLS())
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	key := aws.String(strings.Repeat("k", 32))
+	other := aws.String(strings.Repeat("o", 32))
+
+	out, err := client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String("bucket"),
+		Key:                  aws.String("kms"),
+		Body:                 strings.NewReader("kms"),
+		ServerSideEncryption: aws.String("aws:kms"),
+		SSEKMSKeyId:          aws.String("alias/test"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "aws:kms", aws.StringValue(out.ServerSideEncryption))
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("kms")})
+	assert.NoError(t, err)
+	assert.Equal(t, "alias/test", aws.StringValue(head.SSEKMSKeyId))
+
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String("bucket"),
+		Key:                  aws.String("ssec"),
+		Body:                 strings.NewReader("secret"),
+		SSECustomerAlgorithm: aws.String("AES256"),
+		SSECustomerKey:       key,
+	})
+	assert.NoError(t, err)
+	_, err = get(client, "bucket", "ssec")
+	assert.Equal(t, "InvalidRequest", errorCode(err))
+	_, err = client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("ssec"), SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: other})
+	assert.Error(t, err)
+	got, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("ssec"), SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: key})
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(got.Body)
+		assert.Equal(t, "secret", string(body))
+		assert.Equal(t, "AES256", aws.StringValue(got.SSECustomerAlgorithm))
+	}
+
+	// copying needs the source's key and re-encrypts with the target's
+	_, err = client.CopyObject(&s3.CopyObjectInput{Bucket: aws.String("bucket"), Key: aws.String("copy"), CopySource: aws.String("bucket/ssec")})
+	assert.Equal(t, "InvalidRequest", errorCode(err))
+	_, err = client.CopyObject(&s3.CopyObjectInput{
+		Bucket:                         aws.String("bucket"),
+		Key:                            aws.String("copy"),
+		CopySource:                     aws.String("bucket/ssec"),
+		CopySourceSSECustomerAlgorithm: aws.String("AES256"),
+		CopySourceSSECustomerKey:       key,
+		SSECustomerAlgorithm:           aws.String("AES256"),
+		SSECustomerKey:                 other,
+	})
+	assert.NoError(t, err)
+	_, err = client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("copy"), SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: other})
+	assert.NoError(t, err)
+
+	// parts of an SSE-C upload must carry its key
+	mpu, err := client.CreateMultipartUpload(&s3.CreateMultipartUploadInput{Bucket: aws.String("bucket"), Key: aws.String("mpu"), SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: key})
+	assert.NoError(t, err)
+	_, err = client.UploadPart(&s3.UploadPartInput{Bucket: aws.String("bucket"), Key: aws.String("mpu"), UploadId: mpu.UploadId, PartNumber: aws.Int64(1), Body: strings.NewReader("part")})
+	assert.Equal(t, "InvalidRequest", errorCode(err))
+	_, err = client.UploadPart(&s3.UploadPartInput{Bucket: aws.String("bucket"), Key: aws.String("mpu"), UploadId: mpu.UploadId, PartNumber: aws.Int64(1), Body: strings.NewReader("part"), SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKey: key})
+	assert.NoError(t, err)
+}
+
+func TestObjectACL(t *testing.T) {
+	_, client := newClient(t)
+	_, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("bucket")})
+	assert.NoError(t, err)
+	put(t, client, "bucket", "private", "p")
+	_, err = client.PutObject(&s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("public"), Body: strings.NewReader("p"), ACL: aws.String(s3.ObjectCannedACLPublicRead)})
+	assert.NoError(t, err)
+
+	acl, err := client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String("bucket"), Key: aws.String("private")})
+	if assert.NoError(t, err) && assert.Len(t, acl.Grants, 1) {
+		assert.Equal(t, "s3fake", aws.StringValue(acl.Owner.ID))
+		assert.Equal(t, s3.TypeCanonicalUser, aws.StringValue(acl.Grants[0].Grantee.Type))
+		assert.Equal(t, s3.PermissionFullControl, aws.StringValue(acl.Grants[0].Permission))
+	}
+	acl, err = client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String("bucket"), Key: aws.String("public")})
+	if assert.NoError(t, err) && assert.Len(t, acl.Grants, 2) {
+		assert.Equal(t, s3.TypeGroup, aws.StringValue(acl.Grants[1].Grantee.Type))
+		assert.Equal(t, allUsersURI, aws.StringValue(acl.Grants[1].Grantee.URI))
+	}
+
+	_, err = client.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("private"),
+		AccessControlPolicy: &s3.AccessControlPolicy{
+			Owner: &s3.Owner{ID: aws.String("s3fake")},
+			Grants: []*s3.Grant{
+				{Grantee: &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("s3fake")}, Permission: aws.String(s3.PermissionFullControl)},
+				{Grantee: &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("reader")}, Permission: aws.String(s3.PermissionRead)},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	acl, err = client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String("bucket"), Key: aws.String("private")})
+	if assert.NoError(t, err) && assert.Len(t, acl.Grants, 2) {
+		assert.Equal(t, "reader", aws.StringValue(acl.Grants[1].Grantee.ID))
+		assert.Equal(t, s3.PermissionRead, aws.StringValue(acl.Grants[1].Permission))
+	}
+
+	_, err = client.PutObjectAcl(&s3.PutObjectAclInput{Bucket: aws.String("bucket"), Key: aws.String("private"), ACL: aws.String(s3.ObjectCannedACLPrivate)})
+	assert.NoError(t, err)
+	acl, err = client.GetObjectAcl(&s3.GetObjectAclInput{Bucket: aws.String("bucket"), Key: aws.String("private")})
+	if assert.NoError(t, err) {
+		assert.Len(t, acl.Grants, 1)
+	}
+}